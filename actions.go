@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/chromedp/chromedp"
+	"github.com/chromedp/chromedp/kb"
+)
+
+// Сценарий действий перед сбором — actions, массив шагов в теле POST /scrape:
+//
+//	"actions": [
+//	  {"action": "click", "selector": ".show-more"},
+//	  {"action": "type", "selector": "#q", "text": "ноутбук"},
+//	  {"action": "press", "key": "Enter"},
+//	  {"action": "wait_for", "selector": ".results", "timeout": 5000},
+//	  {"action": "wait", "ms": 1000},
+//	  {"action": "scroll_to", "selector": "#reviews"}
+//	]
+//
+// Шаги выполняются по порядку после закрытия баннеров и наведения;
+// ошибка шага прерывает скрапинг с указанием номера шага.
+
+const (
+	maxActions           = 50
+	defaultActionTimeout = 10 * time.Second
+)
+
+type pageAction struct {
+	Action   string `json:"action"`
+	Selector string `json:"selector,omitempty"`
+	Text     string `json:"text,omitempty"`
+	Key      string `json:"key,omitempty"`
+	Ms       int    `json:"ms,omitempty"`      // wait: пауза
+	Timeout  int    `json:"timeout,omitempty"` // мс, для шагов с селектором
+}
+
+// actionKeys — клавиши, доступные в press; одиночный символ тоже допустим.
+var actionKeys = map[string]string{
+	"Enter":      kb.Enter,
+	"Tab":        kb.Tab,
+	"Escape":     kb.Escape,
+	"Backspace":  kb.Backspace,
+	"Delete":     kb.Delete,
+	"ArrowUp":    kb.ArrowUp,
+	"ArrowDown":  kb.ArrowDown,
+	"ArrowLeft":  kb.ArrowLeft,
+	"ArrowRight": kb.ArrowRight,
+	"PageDown":   kb.PageDown,
+	"PageUp":     kb.PageUp,
+	"Home":       kb.Home,
+	"End":        kb.End,
+}
+
+func parsePageActions(raw string) ([]pageAction, error) {
+	var actions []pageAction
+	if err := json.Unmarshal([]byte(raw), &actions); err != nil {
+		return nil, errors.New("Параметр 'actions' должен быть JSON-массивом шагов")
+	}
+	if len(actions) > maxActions {
+		return nil, fmt.Errorf("Параметр 'actions' может содержать не больше %d шагов", maxActions)
+	}
+	for i, a := range actions {
+		var bad string
+		switch a.Action {
+		case "click", "type", "scroll_to", "wait_for":
+			if a.Selector == "" {
+				bad = "нужен selector"
+			}
+		case "press":
+			if _, ok := actionKeys[a.Key]; !ok && len([]rune(a.Key)) != 1 {
+				bad = "неизвестная клавиша " + a.Key
+			}
+		case "wait":
+			if a.Ms < 0 || a.Ms > int(maxWaitTimeout/time.Millisecond) {
+				bad = fmt.Sprintf("ms должно быть от 0 до %d", maxWaitTimeout/time.Millisecond)
+			}
+		default:
+			bad = "неизвестное действие '" + a.Action + "'"
+		}
+		if a.Timeout < 0 || a.Timeout > int(maxWaitTimeout/time.Millisecond) {
+			bad = fmt.Sprintf("timeout должен быть от 0 до %d", maxWaitTimeout/time.Millisecond)
+		}
+		if bad != "" {
+			return nil, fmt.Errorf("Шаг %d в actions: %s", i+1, bad)
+		}
+	}
+	return actions, nil
+}
+
+// runPageActions выполняет сценарий. Шаги с селектором ждут элемент не
+// дольше timeout, чтобы опечатка в селекторе не повесила запрос.
+func runPageActions(actions []pageAction) chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		for i, a := range actions {
+			slog.InfoContext(ctx, "Шаг [1.5]: действие", "index", i+1, "total", len(actions), "action", a.Action, "selector", a.Selector)
+			timeout := defaultActionTimeout
+			if a.Timeout > 0 {
+				timeout = time.Duration(a.Timeout) * time.Millisecond
+			}
+			var step chromedp.Action
+			switch a.Action {
+			case "click":
+				step = chromedp.Click(a.Selector, chromedp.ByQuery, chromedp.NodeVisible)
+			case "type":
+				step = chromedp.SendKeys(a.Selector, a.Text, chromedp.ByQuery, chromedp.NodeVisible)
+			case "press":
+				key := a.Key
+				if k, ok := actionKeys[key]; ok {
+					key = k
+				}
+				step = chromedp.KeyEvent(key)
+			case "wait":
+				step = chromedp.Sleep(time.Duration(a.Ms) * time.Millisecond)
+			case "wait_for":
+				step = waitForSelector(a.Selector, timeout)
+			case "scroll_to":
+				step = chromedp.ScrollIntoView(a.Selector, chromedp.ByQuery)
+			}
+			stepCtx, cancel := context.WithTimeout(ctx, timeout+time.Duration(a.Ms)*time.Millisecond)
+			err := step.Do(stepCtx)
+			cancel()
+			if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+				err = fmt.Errorf("элемент '%s' не найден за %v", a.Selector, timeout)
+			}
+			if err != nil {
+				return fmt.Errorf("шаг %d в actions (%s): %w", i+1, a.Action, err)
+			}
+		}
+		return nil
+	})
+}
+
+// describeActions — краткая запись сценария для лога.
+func describeActions(actions []pageAction) string {
+	names := make([]string, len(actions))
+	for i, a := range actions {
+		names[i] = a.Action
+	}
+	return strings.Join(names, " → ")
+}
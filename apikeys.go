@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Аутентификация по ключам API. Ключи задаются в API_KEYS (через запятую)
+// и/или в файле API_KEYS_FILE (по строке, # — комментарий) в виде
+// имя:ключ или просто ключ; имя клиента попадает в лог. Ключ передаётся
+// в заголовке X-Api-Key. Без ключей аутентификация выключена.
+//
+// Без ключа API доступны: /metrics (закрывается на уровне сети),
+// /artifacts/ (адрес содержит SHA-256 и не угадывается) и страницы со
+// своими токенами — /captcha (ADMIN_TOKEN) и /debug/console (DEBUG_TOKEN),
+// которые открываются в браузере, где заголовок не задать.
+
+// apiKeys — SHA-256 ключа → имя клиента. Поиск идёт по хешу, поэтому время
+// ответа не выдаёт, насколько присланный ключ похож на настоящий.
+var apiKeys map[[sha256.Size]byte]string
+
+var apiKeyExemptPrefixes = []string{"/metrics", "/artifacts/", "/captcha", "/debug/console"}
+
+func loadAPIKeys() {
+	var lines []string
+	if raw := os.Getenv("API_KEYS"); raw != "" {
+		lines = strings.Split(raw, ",")
+	}
+	if path := os.Getenv("API_KEYS_FILE"); path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			log.Fatalf("Не удалось открыть API_KEYS_FILE %s: %v", path, err)
+		}
+		sc := bufio.NewScanner(f)
+		for sc.Scan() {
+			lines = append(lines, sc.Text())
+		}
+		f.Close()
+	}
+	keys := map[[sha256.Size]byte]string{}
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, key, ok := strings.Cut(line, ":")
+		if !ok {
+			name, key = "key"+strconv.Itoa(i+1), line
+		}
+		name, key = strings.TrimSpace(name), strings.TrimSpace(key)
+		if key == "" {
+			log.Fatalf("Пустой ключ API у клиента %q", name)
+		}
+		keys[sha256.Sum256([]byte(key))] = name
+	}
+	if len(keys) == 0 {
+		return
+	}
+	apiKeys = keys
+	log.Printf("ЛОГ: Аутентификация по ключам API включена, клиентов: %d.", len(keys))
+}
+
+// apiClient возвращает имя клиента по ключу запроса.
+func apiClient(r *http.Request) (string, bool) {
+	got := r.Header.Get("X-Api-Key")
+	if got == "" {
+		return "", false
+	}
+	name, ok := apiKeys[sha256.Sum256([]byte(got))]
+	return name, ok
+}
+
+// requestClient — идентификатор клиента для логов и лимитов: имя ключа
+// API или, без аутентификации, IP-адрес.
+func requestClient(r *http.Request) string {
+	if name, ok := apiClient(r); ok {
+		return name
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// withAPIKeys пропускает только запросы с действующим ключом.
+func withAPIKeys(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if apiKeys == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		for _, prefix := range apiKeyExemptPrefixes {
+			if strings.HasPrefix(r.URL.Path, prefix) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		name, ok := apiClient(r)
+		if !ok {
+			slog.WarnContext(r.Context(), "Отклонён запрос без действующего ключа API", "method", r.Method, "path", r.URL.Path, "remote", r.RemoteAddr)
+			w.Header().Set("WWW-Authenticate", `ApiKey header="X-Api-Key"`)
+			writeJsonError(w, "Нужен действующий ключ API в заголовке X-Api-Key", http.StatusUnauthorized)
+			return
+		}
+		slog.InfoContext(r.Context(), "Клиент API", "client", name, "method", r.Method, "path", r.URL.Path)
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,88 @@
+package main
+
+// Article — основной текст страницы без навигации, подвалов и баннеров.
+type Article struct {
+	Title     string `json:"title"`
+	Byline    string `json:"byline,omitempty"`
+	Published string `json:"published,omitempty"` // Как указано на странице (обычно ISO 8601)
+	Text      string `json:"text"`                // Абзацы через пустую строку
+	HTML      string `json:"html"`                // Очищенная разметка основного блока
+}
+
+// articleScript — упрощённый алгоритм в духе Readability. Абзацы (p, pre,
+// blockquote с текстом длиннее 25 символов) начисляют очки родителю и
+// половину — деду; очки растут с длиной и числом запятых. Класс и id блока
+// дают бонус (article, content, post...) или штраф (nav, footer, comment,
+// cookie...), итог умножается на долю текста вне ссылок. Если на странице
+// единственный <article> с заметным текстом, берётся он. Из выбранного
+// блока удаляются служебные элементы и блоки, состоящие в основном из ссылок.
+const articleScript = `(() => {
+	const clean = s => (s || '').replace(/\s+/g, ' ').trim();
+	const NEG = /comment|footer|footnote|nav|menu|sidebar|aside|cookie|consent|banner|promo|share|social|related|subscribe|newsletter|advert|\bad[s-]?\b|popup|modal|breadcrumb/i;
+	const POS = /article|content|entry|main|post|story|text|body|blog/i;
+	const weight = el => {
+		const s = (el.className && typeof el.className === 'string' ? el.className : '') + ' ' + (el.id || '');
+		return (POS.test(s) ? 25 : 0) - (NEG.test(s) ? 25 : 0);
+	};
+	const linkDensity = el => {
+		const total = clean(el.textContent).length || 1;
+		let links = 0;
+		for (const a of el.querySelectorAll('a')) links += clean(a.textContent).length;
+		return links / total;
+	};
+	const meta = (...sels) => {
+		for (const sel of sels) {
+			const el = document.querySelector(sel);
+			if (!el) continue;
+			const v = clean(el.getAttribute('content') || el.getAttribute('datetime') || el.textContent);
+			if (v) return v;
+		}
+		return '';
+	};
+
+	let best = null;
+	const articles = document.querySelectorAll('article');
+	if (articles.length === 1 && clean(articles[0].textContent).length > 500) {
+		best = articles[0];
+	} else {
+		const scores = new Map();
+		const add = (el, v) => { if (el && el !== document.documentElement) scores.set(el, (scores.get(el) || 0) + v); };
+		for (const p of document.querySelectorAll('p, pre, blockquote')) {
+			const text = clean(p.textContent);
+			if (text.length < 25) continue;
+			const score = text.split(/[,，]/).length + Math.min(Math.floor(text.length / 100), 3);
+			add(p.parentElement, score);
+			add(p.parentElement && p.parentElement.parentElement, score / 2);
+		}
+		let bestScore = 0;
+		for (const [el, raw] of scores) {
+			const score = (raw + weight(el)) * (1 - linkDensity(el));
+			if (score > bestScore) { best = el; bestScore = score; }
+		}
+	}
+	if (!best) best = document.body;
+
+	const root = best.cloneNode(true);
+	root.querySelectorAll('script, style, noscript, template, iframe, form, button, input, select, textarea, nav, footer, aside, svg, canvas, [hidden], [aria-hidden="true"]').forEach(el => el.remove());
+	for (const el of Array.from(root.querySelectorAll('div, section, ul, ol, table, header'))) {
+		if (!el.isConnected) continue;
+		const s = (el.className && typeof el.className === 'string' ? el.className : '') + ' ' + (el.id || '');
+		if ((NEG.test(s) && !POS.test(s)) || (linkDensity(el) > 0.5 && clean(el.textContent).length < 1000)) el.remove();
+	}
+	const blocks = [];
+	for (const el of root.querySelectorAll('h1, h2, h3, h4, h5, h6, p, li, pre, blockquote, figcaption, td')) {
+		if (el.parentElement && el.parentElement.closest('p, li, pre, blockquote, td') && root.contains(el.parentElement)) continue;
+		const t = el.tagName === 'PRE' ? el.textContent.trim() : clean(el.textContent);
+		if (t) blocks.push(t);
+	}
+	const text = blocks.length ? blocks.join('\n\n') : clean(root.textContent);
+
+	const h1 = document.querySelector('h1');
+	return {
+		title: meta('meta[property="og:title"]') || (h1 && clean(h1.textContent)) || clean(document.title),
+		byline: meta('meta[name="author"]', 'meta[property="article:author"]', '[itemprop="author"] [itemprop="name"]', '[itemprop="author"]', '[rel="author"]', '.byline', '.author'),
+		published: meta('meta[property="article:published_time"]', 'meta[itemprop="datePublished"]', '[itemprop="datePublished"]', 'meta[name="date"]', 'article time[datetime]', 'time[datetime]'),
+		text,
+		html: root.innerHTML.trim(),
+	};
+})()`
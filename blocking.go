@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"log"
+	"log/slog"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/fetch"
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/chromedp"
+)
+
+// Блокировка ресурсов: параметр block=images,fonts,media,css,analytics.
+// Запросы перехватываются через Fetch и отклоняются до отправки, поэтому
+// страница грузится быстрее и не тратит трафик на то, что скрапингу не нужно.
+//
+// Список блокировки сторонних доменов (реклама, трекеры, виджеты чатов)
+// применяется к каждому скрапингу: BLOCK_DOMAINS (через запятую) и
+// BLOCK_DOMAINS_FILE (по строке, # — комментарий). Запись — домен
+// (с поддоменами) или домен с путём: example.com/widgets/. Параметр
+// block_domains добавляет записи для одного скрапинга, allow_domains
+// исключает их из общего списка. Домен самой страницы не блокируется.
+
+// blockResourceTypes — типы ресурсов Chrome для категорий block.
+var blockResourceTypes = map[string][]network.ResourceType{
+	"images": {network.ResourceTypeImage},
+	"fonts":  {network.ResourceTypeFont},
+	"media":  {network.ResourceTypeMedia},
+	"css":    {network.ResourceTypeStylesheet},
+}
+
+// analyticsDomains — счётчики и рекламные трекеры для block=analytics.
+var analyticsDomains = []string{
+	"google-analytics.com",
+	"googletagmanager.com",
+	"doubleclick.net",
+	"googlesyndication.com",
+	"mc.yandex.ru",
+	"top-fwz1.mail.ru",
+	"connect.facebook.net",
+	"hotjar.com",
+	"segment.io",
+	"cdn.segment.com",
+	"mixpanel.com",
+	"clarity.ms",
+}
+
+// validBlockCategories — допустимые значения параметра block.
+const validBlockCategories = "images, fonts, media, css, analytics"
+
+// blockedDomains — общий список блокировки из окружения.
+var blockedDomains []string
+
+func loadBlocklistConfig() {
+	var lines []string
+	if raw := os.Getenv("BLOCK_DOMAINS"); raw != "" {
+		lines = strings.Split(raw, ",")
+	}
+	if path := os.Getenv("BLOCK_DOMAINS_FILE"); path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			log.Fatalf("Не удалось открыть BLOCK_DOMAINS_FILE %s: %v", path, err)
+		}
+		sc := bufio.NewScanner(f)
+		for sc.Scan() {
+			lines = append(lines, sc.Text())
+		}
+		f.Close()
+	}
+	blockedDomains = parseDomainList(strings.Join(lines, ","))
+	if len(blockedDomains) > 0 {
+		log.Printf("ЛОГ: Список блокировки сторонних доменов: %d записей.", len(blockedDomains))
+	}
+}
+
+// parseDomainList разбирает записи через запятую: схема отбрасывается,
+// комментарии и пустые записи пропускаются.
+func parseDomainList(raw string) []string {
+	var list []string
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+		entry = strings.TrimPrefix(strings.TrimPrefix(entry, "https://"), "http://")
+		if !slices.Contains(list, entry) {
+			list = append(list, entry)
+		}
+	}
+	return list
+}
+
+// domainBlocklist собирает список блокировки для скрапинга pageURL.
+func domainBlocklist(pageURL string, extra, allow []string) []string {
+	var list []string
+	for _, entry := range append(slices.Clip(blockedDomains), extra...) {
+		if slices.Contains(allow, entry) || blocklistMatches(entry, pageURL) {
+			continue
+		}
+		list = append(list, entry)
+	}
+	return list
+}
+
+// blocklistMatches проверяет адрес по записи списка блокировки.
+func blocklistMatches(entry, rawURL string) bool {
+	domain, path, hasPath := strings.Cut(entry, "/")
+	if !hostMatchesDomain(rawURL, domain) {
+		return false
+	}
+	if !hasPath {
+		return true
+	}
+	u, err := url.Parse(rawURL)
+	return err == nil && strings.HasPrefix(strings.ToLower(u.Path), "/"+path)
+}
+
+// parseBlockParam разбирает список категорий через запятую.
+func parseBlockParam(raw string) ([]string, bool) {
+	var block []string
+	for _, name := range strings.Split(raw, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || slices.Contains(block, name) {
+			continue
+		}
+		if _, ok := blockResourceTypes[name]; !ok && name != "analytics" {
+			return nil, false
+		}
+		block = append(block, name)
+	}
+	return block, true
+}
+
+// requestBlocked решает, отклонить ли запрос.
+func requestBlocked(block, domains []string, req *fetch.EventRequestPaused) bool {
+	for _, name := range block {
+		if slices.Contains(blockResourceTypes[name], req.ResourceType) {
+			return true
+		}
+	}
+	if slices.Contains(block, "analytics") {
+		for _, domain := range analyticsDomains {
+			if hostMatchesDomain(req.Request.URL, domain) {
+				return true
+			}
+		}
+	}
+	for _, entry := range domains {
+		if blocklistMatches(entry, req.Request.URL) {
+			return true
+		}
+	}
+	return false
+}
+
+// interceptRequests включает Fetch для вкладки: проверяет каждый запрос
+// страницы по политике адресов (checkPageRequest), отвечает на запросы
+// авторизации прокси и отклоняет заблокированные ресурсы и домены. Fetch у
+// вкладки один, поэтому всё решается одним обработчиком. Перехват нужен
+// всегда: без него редирект или ресурс страницы ушёл бы во внутреннюю сеть
+// в обход checkTargetURL.
+func interceptRequests(proxy *proxyConfig, block, domains []string) chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		auth := proxy != nil && proxy.Username != ""
+		if len(block) > 0 {
+			slog.InfoContext(ctx, "Блокирую загрузку ресурсов", "block", strings.Join(block, ","))
+		}
+		if len(domains) > 0 {
+			slog.InfoContext(ctx, "Блокирую сторонние домены", "entries", len(domains))
+		}
+		exec := cdp.WithExecutor(ctx, chromedp.FromContext(ctx).Target)
+		// Ресурсы страницы часто идут на один хост: адрес проверяется
+		// (и разрешается через DNS) один раз за вкладку.
+		var mu sync.Mutex
+		checked := map[string]error{}
+		checkRequest := func(ev *fetch.EventRequestPaused) error {
+			document := ev.ResourceType == network.ResourceTypeDocument
+			if document {
+				return checkPageRequest(ev.Request.URL, true)
+			}
+			u, err := url.Parse(ev.Request.URL)
+			if err != nil {
+				return nil
+			}
+			mu.Lock()
+			err, ok := checked[u.Host]
+			mu.Unlock()
+			if !ok {
+				err = checkPageRequest(ev.Request.URL, false)
+				mu.Lock()
+				checked[u.Host] = err
+				mu.Unlock()
+			}
+			return err
+		}
+		chromedp.ListenTarget(ctx, func(ev any) {
+			switch ev := ev.(type) {
+			case *fetch.EventRequestPaused:
+				go func() {
+					if err := checkRequest(ev); err != nil {
+						slog.WarnContext(ctx, "Запрос страницы отклонён политикой адресов", "url", ev.Request.URL, "resource", ev.ResourceType, "error", err)
+						fetch.FailRequest(ev.RequestID, network.ErrorReasonAccessDenied).Do(exec)
+						return
+					}
+					// Документ самой страницы не блокируется никогда.
+					if ev.ResourceType != network.ResourceTypeDocument && requestBlocked(block, domains, ev) {
+						fetch.FailRequest(ev.RequestID, network.ErrorReasonBlockedByClient).Do(exec)
+						return
+					}
+					fetch.ContinueRequest(ev.RequestID).Do(exec)
+				}()
+			case *fetch.EventAuthRequired:
+				resp := fetch.AuthChallengeResponseResponseDefault
+				if auth && ev.AuthChallenge.Source == fetch.AuthChallengeSourceProxy {
+					resp = fetch.AuthChallengeResponseResponseProvideCredentials
+				}
+				challenge := &fetch.AuthChallengeResponse{Response: resp}
+				if auth {
+					challenge.Username, challenge.Password = proxy.Username, proxy.Password
+				}
+				go fetch.ContinueWithAuth(ev.RequestID, challenge).Do(exec)
+			}
+		})
+		return fetch.Enable().WithHandleAuthRequests(auth).Do(ctx)
+	})
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/chromedp/cdproto/browser"
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/inspector"
+	"github.com/chromedp/chromedp"
+)
+
+// Постоянные браузеры и горячий резерв. BROWSER_INSTANCES (по умолчанию
+// 1) независимых процессов Chrome, у каждого свой аллокатор и временный
+// профиль; новая вкладка открывается в наименее загруженном. Так падение
+// или рост памяти одного процесса затрагивает только его вкладки.
+//
+// При BROWSER_STANDBY=true рядом держится ещё один, уже запущенный
+// экземпляр; если основной падает (или выводится из работы), резерв
+// занимает его место сразу, а новый резерв поднимается в фоне. Без
+// резерва упавший браузер перезапускается на месте.
+//
+// REMOTE_DEBUGGING_URL подключает сервис к уже запущенному Chrome
+// (browserless, контейнер-сосед, десктоп с расширениями) вместо запуска
+// своего: ws://хост:9222/devtools/browser/<id> или http://хост:9222 (адрес
+// WebSocket берётся из /json/version). Флаги запуска (-headless, прокси
+// PROXY_URL, User-Agent по умолчанию) к чужому браузеру не применяются;
+// PROXY_URL в этом режиме задаётся каждой вкладке через BrowserContext.
+// Каждый экземпляр — отдельное подключение; упавшее подключение
+// восстанавливается так же, как перезапускается упавший браузер.
+//
+// Падение процесса Chrome видно по завершению его контекста. Зависший
+// браузер процесс не завершает, поэтому каждый основной экземпляр раз в
+// browserProbeInterval опрашивается (Browser.getVersion); не ответивший
+// закрывается и заменяется так же, как упавший. Падение отдельной вкладки
+// (рендерер убит из-за нехватки памяти) прерывает только её скрапинг.
+
+type browserInstance struct {
+	id       int
+	ctx      context.Context
+	cancel   func() // закрывает браузер и его аллокатор
+	retired  bool   // выведен из работы намеренно, падением не считается
+	draining bool   // ждёт завершения вкладок перед заменой, новые не получает
+	started  time.Time
+	tabs     atomic.Int64 // Открытые сейчас вкладки
+	opened   atomic.Int64 // Вкладки, открытые за всё время
+}
+
+var (
+	browserMu      sync.Mutex
+	browserSlots   []*browserInstance // Основные экземпляры, по одному на слот
+	standbyBrowser *browserInstance
+	browserOpts    []chromedp.ExecAllocatorOption
+	remoteBrowser  string // REMOTE_DEBUGGING_URL; пусто — свой процесс Chrome
+	browserSeq     int
+	standbyEnabled bool
+)
+
+var validRemoteSchemes = map[string]bool{"ws": true, "wss": true, "http": true, "https": true}
+
+const (
+	maxBrowserInstances = 16
+	// browserRelaunchDelay — пауза между неудачными попытками запуска.
+	browserRelaunchDelay = 10 * time.Second
+	browserProbeInterval = 30 * time.Second
+	browserProbeTimeout  = 10 * time.Second
+	// browserPickWait — сколько новая вкладка ждёт браузер, пока единственный
+	// выводится из работы и перезапускается.
+	browserPickWait = browserDrainTimeout + 30*time.Second
+)
+
+// errTabCrashed — рендерер вкладки упал во время скрапинга.
+var errTabCrashed = errors.New("вкладка упала во время загрузки (нехватка памяти или сбой рендерера Chrome)")
+
+// pickBrowser возвращает наименее загруженный живой основной экземпляр.
+// Если все живые выводятся из работы (recycle.go), ждёт замены до
+// browserPickWait; если живых нет — первый (запросы к нему завершатся
+// ошибкой, пока он перезапускается).
+func pickBrowser() *browserInstance {
+	deadline := time.Now().Add(browserPickWait)
+	for {
+		browserMu.Lock()
+		var best *browserInstance
+		draining := false
+		for _, b := range browserSlots {
+			if b.ctx.Err() != nil {
+				continue
+			}
+			if b.draining {
+				draining = true
+				continue
+			}
+			if best == nil || b.tabs.Load() < best.tabs.Load() {
+				best = b
+			}
+		}
+		if best == nil && (!draining || time.Now().After(deadline)) {
+			best = browserSlots[0]
+		}
+		browserMu.Unlock()
+		if best != nil {
+			return best
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+}
+
+// openBrowserTab открывает вкладку в наименее загруженном браузере и
+// учитывает её в нагрузке, пока вкладка не закрыта.
+func openBrowserTab(opts ...chromedp.ContextOption) (context.Context, context.CancelFunc) {
+	b := pickBrowser()
+	b.tabs.Add(1)
+	b.opened.Add(1)
+	ctx, cancel := chromedp.NewContext(b.ctx, opts...)
+	var once sync.Once
+	return ctx, func() {
+		cancel()
+		once.Do(func() { b.tabs.Add(-1) })
+	}
+}
+
+// launchBrowser запускает экземпляр для слота slot; -1 — резерв.
+func launchBrowser(slot int) (*browserInstance, error) {
+	var (
+		allocCtx    context.Context
+		cancelAlloc context.CancelFunc
+	)
+	if remoteBrowser != "" {
+		allocCtx, cancelAlloc = chromedp.NewRemoteAllocator(context.Background(), remoteBrowser)
+	} else {
+		opts := browserOpts
+		if profileDir != "" && slot >= 0 {
+			opts = append(opts[:len(opts):len(opts)], chromedp.UserDataDir(profileDirFor(slot)))
+		}
+		allocCtx, cancelAlloc = chromedp.NewExecAllocator(context.Background(), opts...)
+	}
+	ctx, cancelBrowser := chromedp.NewContext(allocCtx, chromedp.WithLogf(log.Printf))
+	if err := chromedp.Run(ctx); err != nil {
+		cancelBrowser()
+		cancelAlloc()
+		return nil, err
+	}
+	browserMu.Lock()
+	browserSeq++
+	b := &browserInstance{id: browserSeq, started: time.Now(), ctx: ctx, cancel: func() { cancelBrowser(); cancelAlloc() }}
+	browserMu.Unlock()
+	go watchBrowser(b)
+	return b, nil
+}
+
+// startBrowsers запускает основные браузеры (ошибка фатальна для сервиса)
+// и, если включено, резервный в фоне.
+func startBrowsers(opts []chromedp.ExecAllocatorOption) error {
+	browserOpts = opts
+	if raw := os.Getenv("REMOTE_DEBUGGING_URL"); raw != "" {
+		u, err := url.Parse(raw)
+		if err != nil || u.Host == "" || !validRemoteSchemes[u.Scheme] {
+			log.Fatalf("REMOTE_DEBUGGING_URL должен быть адресом ws://, wss://, http:// или https://")
+		}
+		if profileDir != "" {
+			log.Fatalf("Профиль на диске (PROFILE_DIR, -user-data-dir) несовместим с REMOTE_DEBUGGING_URL")
+		}
+		remoteBrowser = raw
+		log.Printf("ЛОГ: Подключаюсь к удалённому браузеру %s.", u.Host)
+	}
+	standbyEnabled = os.Getenv("BROWSER_STANDBY") == "true" || os.Getenv("BROWSER_STANDBY") == "1"
+	n := 1
+	if raw := os.Getenv("BROWSER_INSTANCES"); raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil || v < 1 || v > maxBrowserInstances {
+			log.Fatalf("BROWSER_INSTANCES должен быть числом от 1 до %d", maxBrowserInstances)
+		}
+		n = v
+	}
+	if profileDir != "" {
+		if err := os.MkdirAll(profileDir, 0o700); err != nil {
+			return err
+		}
+		log.Printf("ЛОГ: Профили браузера хранятся в %s.", profileDir)
+	}
+	if profileDir != "" && standbyEnabled {
+		// Резерву пришлось бы делить профиль слота с живым основным, а Chrome
+		// не открывает один профиль двумя процессами.
+		log.Println("ЛОГ: С профилем на диске резервный браузер не используется.")
+		standbyEnabled = false
+	}
+	slots := make([]*browserInstance, n)
+	for i := range slots {
+		b, err := launchBrowser(i)
+		if err != nil {
+			for _, started := range slots[:i] {
+				started.retired = true
+				started.cancel()
+			}
+			return err
+		}
+		slots[i] = b
+		log.Printf("ЛОГ: Постоянный экземпляр браузера #%d успешно запущен.", b.id)
+	}
+	browserMu.Lock()
+	browserSlots = slots
+	browserMu.Unlock()
+	if standbyEnabled {
+		go replenishStandby()
+	}
+	go probeBrowsers()
+	return nil
+}
+
+// probeBrowsers закрывает основные браузеры, переставшие отвечать;
+// watchBrowser затем заменяет их как упавшие.
+func probeBrowsers() {
+	for range time.Tick(browserProbeInterval) {
+		for _, b := range primaryBrowsers() {
+			if b.ctx.Err() != nil {
+				continue // Уже заменяется
+			}
+			ctx, cancel := context.WithTimeout(b.ctx, browserProbeTimeout)
+			_, _, _, _, _, err := browser.GetVersion().Do(cdp.WithExecutor(ctx, chromedp.FromContext(b.ctx).Browser))
+			cancel()
+			if err != nil && b.ctx.Err() == nil {
+				log.Printf("ЛОГ: Основной браузер #%d не отвечает (%v), закрываю.", b.id, err)
+				b.cancel()
+			}
+		}
+	}
+}
+
+// primaryBrowsers возвращает копию списка основных экземпляров.
+func primaryBrowsers() []*browserInstance {
+	browserMu.Lock()
+	defer browserMu.Unlock()
+	return append([]*browserInstance(nil), browserSlots...)
+}
+
+// browserSlot возвращает слот основного экземпляра или -1. Вызывается под browserMu.
+func browserSlot(b *browserInstance) int {
+	for i, slot := range browserSlots {
+		if slot == b {
+			return i
+		}
+	}
+	return -1
+}
+
+// watchTabCrash прерывает скрапинг, если рендерер вкладки упал: иначе
+// ожидания на мёртвой вкладке висели бы до таймаута.
+func watchTabCrash(tabCtx context.Context) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(tabCtx)
+	chromedp.ListenTarget(ctx, func(ev any) {
+		if _, ok := ev.(*inspector.EventTargetCrashed); ok {
+			log.Println("ЛОГ: Вкладка упала.")
+			cancel(errTabCrashed)
+		}
+	})
+	return ctx, func() { cancel(nil) }
+}
+
+// tabError заменяет ошибку отмены причиной, если вкладка упала.
+func tabError(ctx context.Context, err error) error {
+	if errors.Is(context.Cause(ctx), errTabCrashed) {
+		return errTabCrashed
+	}
+	return err
+}
+
+// closeBrowsers закрывает все экземпляры при остановке сервиса.
+func closeBrowsers() {
+	browserMu.Lock()
+	defer browserMu.Unlock()
+	for _, b := range append(append([]*browserInstance(nil), browserSlots...), standbyBrowser) {
+		if b != nil {
+			b.retired = true
+			b.cancel()
+		}
+	}
+}
+
+// watchBrowser ждёт завершения экземпляра и, если это не намеренный
+// вывод из работы, заменяет его.
+func watchBrowser(b *browserInstance) {
+	<-b.ctx.Done()
+	browserMu.Lock()
+	retired := b.retired
+	slot, isStandby := browserSlot(b), b == standbyBrowser
+	if isStandby {
+		standbyBrowser = nil
+	}
+	browserMu.Unlock()
+	if retired {
+		return
+	}
+	browserRestarts.Add(1)
+	switch {
+	case slot >= 0:
+		log.Printf("ЛОГ: Основной браузер #%d упал.", b.id)
+		promoteStandby(slot)
+	case isStandby:
+		log.Printf("ЛОГ: Резервный браузер #%d упал, поднимаю новый.", b.id)
+		replenishStandby()
+	}
+}
+
+// promoteStandby ставит резерв в слот основного браузера и возвращает
+// прежний экземпляр слота — вызывающий решает, когда его закрыть. Если
+// живого резерва нет, экземпляр слота запускается заново; пока он
+// поднимается, новые вкладки открываются в остальных слотах.
+func promoteStandby(slot int) *browserInstance {
+	browserMu.Lock()
+	old := browserSlots[slot]
+	old.retired = true
+	promoted := standbyBrowser != nil && standbyBrowser.ctx.Err() == nil
+	if promoted {
+		browserSlots[slot], standbyBrowser = standbyBrowser, nil
+		log.Printf("ЛОГ: Резервный браузер #%d стал основным вместо #%d.", browserSlots[slot].id, old.id)
+	}
+	browserMu.Unlock()
+
+	for !promoted {
+		b, err := launchBrowser(slot)
+		if err != nil {
+			log.Printf("ЛОГ: Не удалось перезапустить браузер: %v. Повтор через %v.", err, browserRelaunchDelay)
+			time.Sleep(browserRelaunchDelay)
+			continue
+		}
+		browserMu.Lock()
+		browserSlots[slot] = b
+		browserMu.Unlock()
+		log.Printf("ЛОГ: Основной браузер #%d перезапущен как #%d.", old.id, b.id)
+		promoted = true
+	}
+	if standbyEnabled {
+		go replenishStandby()
+	}
+	return old
+}
+
+// replenishStandby поднимает резервный браузер, если его нет.
+func replenishStandby() {
+	for {
+		browserMu.Lock()
+		have := standbyBrowser != nil
+		browserMu.Unlock()
+		if have {
+			return
+		}
+		b, err := launchBrowser(-1)
+		if err != nil {
+			log.Printf("ЛОГ: Не удалось запустить резервный браузер: %v. Повтор через %v.", err, browserRelaunchDelay)
+			time.Sleep(browserRelaunchDelay)
+			continue
+		}
+		browserMu.Lock()
+		if standbyBrowser != nil {
+			// Параллельный вызов успел раньше — лишний экземпляр не нужен.
+			b.retired = true
+			browserMu.Unlock()
+			b.cancel()
+			return
+		}
+		standbyBrowser = b
+		browserMu.Unlock()
+		log.Printf("ЛОГ: Резервный браузер #%d запущен и ждёт.", b.id)
+		return
+	}
+}
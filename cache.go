@@ -0,0 +1,339 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Кэш результатов. Включается CACHE_TTL (секунды); ключ — параметры
+// извлечения запроса, поэтому /scrape?url=X&content и /scrape?url=X&links
+// кэшируются раздельно. Параметры постобработки (fields, transform,
+// template) в ключ не входят: они применяются к уже готовому ответу.
+//
+// CACHE_BACKEND выбирает хранилище: memory (по умолчанию; при
+// CACHE_MAX_ENTRIES вытесняются давно не запрошенные записи) или redis
+// (REDIS_ADDR, REDIS_PASSWORD; кэш общий для нескольких экземпляров).
+// Параметры запроса: cache_ttl — сколько секунд результат годен (и при
+// чтении, и при записи), no_cache — не брать результат из кэша, а
+// выполнить скрапинг заново и обновить запись. /scrape отвечает
+// заголовком X-Cache: HIT или MISS.
+
+// scrapeCacheStore — хранилище кэша результатов.
+type scrapeCacheStore interface {
+	// Get возвращает запись не старше maxAge (0 — TTL записи).
+	Get(key string, maxAge time.Duration) (*Response, bool)
+	Put(key, url string, response *Response, ttl time.Duration)
+	// Sweep удаляет просроченные записи и сверх maxEntries; возвращает число удалённых.
+	Sweep(maxEntries int) int
+	// Purge удаляет записи, для адреса которых match возвращает true.
+	Purge(match func(url string) bool) int
+}
+
+const maxCacheTTL = 30 * 24 * time.Hour
+
+var (
+	// scrapeCache — nil, если кэш выключен.
+	scrapeCache scrapeCacheStore
+	// cacheTTL — срок жизни записи по умолчанию.
+	cacheTTL time.Duration
+)
+
+// nonKeyParams не влияют на работу браузера и не входят в ключ кэша.
+var nonKeyParams = []string{"fields", "transform", "template", "cache_ttl", "no_cache", "retries", "retry_backoff", "previous_hash"}
+
+func loadCacheConfig() {
+	raw := os.Getenv("CACHE_TTL")
+	if raw == "" {
+		return
+	}
+	v, err := strconv.Atoi(raw)
+	if err != nil || v <= 0 {
+		log.Fatalf("CACHE_TTL должен быть положительным числом секунд, получено %q", raw)
+	}
+	cacheTTL = time.Duration(v) * time.Second
+	switch backend := os.Getenv("CACHE_BACKEND"); backend {
+	case "", "memory":
+		scrapeCache = &memoryCache{entries: map[string]*cacheEntry{}}
+	case "redis":
+		client := clusterRedis
+		if client == nil {
+			addr := os.Getenv("REDIS_ADDR")
+			if addr == "" {
+				log.Fatal("CACHE_BACKEND=redis требует REDIS_ADDR (host:port)")
+			}
+			client = newRedisClient(addr, os.Getenv("REDIS_PASSWORD"))
+			if _, err := client.Do("PING"); err != nil {
+				log.Fatalf("Не удалось подключиться к Redis %s: %v", addr, err)
+			}
+		}
+		scrapeCache = &redisCache{client: client}
+	default:
+		log.Fatalf("CACHE_BACKEND может принимать значения: memory, redis; получено %q", backend)
+	}
+	log.Printf("ЛОГ: Кэш результатов включён (%T), TTL %v.", scrapeCache, cacheTTL)
+}
+
+// cacheKey строит ключ из параметров извлечения. url.Values.Encode
+// сортирует ключи, так что порядок параметров в запросе не важен.
+func cacheKey(q url.Values) string {
+	key := url.Values{}
+	for name, values := range q {
+		key[name] = values
+	}
+	// previous_hash включает hash: без этого он попал бы на запись без hash.
+	if key.Has("previous_hash") && !key.Has("hash") {
+		key.Set("hash", "")
+	}
+	for _, name := range nonKeyParams {
+		key.Del(name)
+	}
+	return key.Encode()
+}
+
+// --- Кэш в памяти ---
+
+type cacheEntry struct {
+	url      string
+	response *Response
+	storedAt time.Time
+	usedAt   time.Time
+	ttl      time.Duration
+}
+
+type memoryCache struct {
+	mu      sync.Mutex
+	entries map[string]*cacheEntry
+}
+
+func (e *cacheEntry) fresh(maxAge time.Duration) bool {
+	if maxAge == 0 || maxAge > e.ttl {
+		maxAge = e.ttl
+	}
+	return time.Since(e.storedAt) <= maxAge
+}
+
+func (c *memoryCache) Get(key string, maxAge time.Duration) (*Response, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if !e.fresh(0) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	if !e.fresh(maxAge) {
+		return nil, false
+	}
+	e.usedAt = time.Now()
+	return e.response, true
+}
+
+func (c *memoryCache) Put(key, url string, response *Response, ttl time.Duration) {
+	c.mu.Lock()
+	now := time.Now()
+	c.entries[key] = &cacheEntry{url: url, response: response, storedAt: now, usedAt: now, ttl: ttl}
+	over := cacheMaxEntries > 0 && len(c.entries) > cacheMaxEntries
+	c.mu.Unlock()
+	if over {
+		c.Sweep(cacheMaxEntries)
+	}
+}
+
+func (c *memoryCache) Sweep(maxEntries int) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	removed := 0
+	for key, e := range c.entries {
+		if !e.fresh(0) {
+			delete(c.entries, key)
+			removed++
+		}
+	}
+	if maxEntries <= 0 || len(c.entries) <= maxEntries {
+		return removed
+	}
+	keys := make([]string, 0, len(c.entries))
+	for key := range c.entries {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return c.entries[keys[i]].usedAt.Before(c.entries[keys[j]].usedAt) })
+	for _, key := range keys[:len(keys)-maxEntries] {
+		delete(c.entries, key)
+		removed++
+	}
+	return removed
+}
+
+func (c *memoryCache) Purge(match func(url string) bool) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	removed := 0
+	for key, e := range c.entries {
+		if match(e.url) {
+			delete(c.entries, key)
+			removed++
+		}
+	}
+	return removed
+}
+
+// --- Кэш в Redis ---
+//
+//	webextract:cache:<sha256 ключа> — запись (JSON, TTL записи)
+//	webextract:cache:urls           — хеш: sha256 ключа → адрес (для Purge)
+
+const redisCacheURLs = clusterKeyPrefix + "cache:urls"
+
+type redisCache struct {
+	client *redisClient
+}
+
+// redisCacheEntry — запись кэша в Redis.
+type redisCacheEntry struct {
+	StoredAt time.Time `json:"stored_at"`
+	Response *Response `json:"response"`
+}
+
+func redisCacheID(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *redisCache) Get(key string, maxAge time.Duration) (*Response, bool) {
+	raw, err := c.client.String("GET", clusterKeyPrefix+"cache:"+redisCacheID(key))
+	if err != nil {
+		if !errors.Is(err, errRedisNil) {
+			log.Printf("ЛОГ: Кэш: ошибка чтения из Redis: %v", err)
+		}
+		return nil, false
+	}
+	var e redisCacheEntry
+	if err := json.Unmarshal([]byte(raw), &e); err != nil || e.Response == nil {
+		return nil, false
+	}
+	if maxAge > 0 && time.Since(e.StoredAt) > maxAge {
+		return nil, false
+	}
+	return e.Response, true
+}
+
+func (c *redisCache) Put(key, url string, response *Response, ttl time.Duration) {
+	data, err := json.Marshal(redisCacheEntry{StoredAt: time.Now(), Response: response})
+	if err != nil {
+		log.Printf("ЛОГ: Кэш: не удалось сериализовать ответ: %v", err)
+		return
+	}
+	id := redisCacheID(key)
+	secs := strconv.Itoa(max(int(ttl/time.Second), 1))
+	if _, err := c.client.Do("SET", clusterKeyPrefix+"cache:"+id, string(data), "EX", secs); err != nil {
+		log.Printf("ЛОГ: Кэш: ошибка записи в Redis: %v", err)
+		return
+	}
+	c.client.Do("HSET", redisCacheURLs, id, url)
+}
+
+// urls возвращает индекс записей: sha256 ключа → адрес.
+func (c *redisCache) urls() map[string]string {
+	raw, err := c.client.Do("HGETALL", redisCacheURLs)
+	items, _ := raw.([]any)
+	if err != nil {
+		log.Printf("ЛОГ: Кэш: ошибка чтения индекса из Redis: %v", err)
+	}
+	index := make(map[string]string, len(items)/2)
+	for i := 0; i+1 < len(items); i += 2 {
+		id, _ := items[i].(string)
+		u, _ := items[i+1].(string)
+		index[id] = u
+	}
+	return index
+}
+
+// Sweep чистит индекс от записей, которые Redis уже удалил по TTL. Лимит
+// числа записей в Redis не применяется — за памятью следит сам Redis.
+func (c *redisCache) Sweep(int) int {
+	for id := range c.urls() {
+		if n, _ := c.client.Do("EXISTS", clusterKeyPrefix+"cache:"+id); n == int64(0) {
+			c.client.Do("HDEL", redisCacheURLs, id)
+		}
+	}
+	return 0
+}
+
+func (c *redisCache) Purge(match func(url string) bool) int {
+	removed := 0
+	for id, u := range c.urls() {
+		if !match(u) {
+			continue
+		}
+		if n, _ := c.client.Do("DEL", clusterKeyPrefix+"cache:"+id); n == int64(1) {
+			removed++
+		}
+		c.client.Do("HDEL", redisCacheURLs, id)
+	}
+	return removed
+}
+
+// checkScrapeScope проверяет перед обращением к сайту, что скрапинг не
+// стоит на паузе из-за CAPTCHA и не превышен лимит домена. Координатор
+// CAPTCHA не видит: паузу проверяет воркер (runClusterJob).
+func checkScrapeScope(rawURL, session string) error {
+	if clusterMode != "coordinator" {
+		if err := captchaBusy(rawURL, session); err != nil {
+			return err
+		}
+	}
+	return takeDomainSlot(rawURL)
+}
+
+// scrapeWithCache отдаёт результат из кэша или выполняет скрапинг и
+// кэширует его. Ответ из кэша общий — вызывающие не должны его менять.
+// cacheStatus — значение X-Cache: HIT, MISS или "", если кэш не участвовал.
+// Итог пишется в лог (logScrape) для любого вызывающего.
+func scrapeWithCache(q url.Values, opts *scrapeOptions) (response *Response, cacheStatus string, err error) {
+	activeScrapes.Add(1)
+	defer activeScrapes.Add(-1)
+	start := time.Now()
+	defer func() { logScrape(opts.trace, q, start, response, cacheStatus, err) }()
+	// Ответ из кэша сайт не трогает, поэтому CAPTCHA на нём отдаче из кэша
+	// не мешает.
+	checkScope := func() error { return checkScrapeScope(opts.URL, opts.Session) }
+	// Страница в сессии зависит от её состояния (вход, корзина), а не только
+	// от параметров запроса.
+	if scrapeCache == nil || opts.Session != "" {
+		if err := checkScope(); err != nil {
+			return nil, "", err
+		}
+		response, err = executeScrape(q, opts)
+		return response, "", err
+	}
+	key := cacheKey(q)
+	if !opts.NoCache {
+		if response, ok := scrapeCache.Get(key, opts.CacheTTL); ok {
+			return response, "HIT", nil
+		}
+	}
+	if err := checkScope(); err != nil {
+		return nil, "MISS", err
+	}
+	response, err = executeScrape(q, opts)
+	if err != nil {
+		return nil, "MISS", err
+	}
+	ttl := cacheTTL
+	if opts.CacheTTL > 0 {
+		ttl = opts.CacheTTL
+	}
+	scrapeCache.Put(key, opts.URL, response, ttl)
+	return response, "MISS", nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Ожидающие CAPTCHA. Пауза касается только вкладки, на которой CAPTCHA
+// обнаружена: новые скрапинги того же сайта (и той же сессии) отклоняются,
+// пока она не решена, — они упёрлись бы в ту же проверку, — а остальные
+// запросы обслуживаются как обычно. Каждая CAPTCHA получает
+// идентификатор; оператор решает их по одной (/captcha?id=, Telegram,
+// Enter в консоли — самую раннюю).
+
+type captchaWait struct {
+	ID      string
+	URL     string
+	Host    string
+	Session string
+	Since   time.Time
+	tab     context.Context
+	done    chan struct{}
+}
+
+var (
+	captchaMutex sync.Mutex
+	captchaWaits []*captchaWait // В порядке появления
+)
+
+// captchaBusyError — сайт или сессия ждут решения CAPTCHA.
+type captchaBusyError struct {
+	Host string
+}
+
+func (e *captchaBusyError) Error() string {
+	return fmt.Sprintf("на сайте %s ожидает решения CAPTCHA, попробуйте позже", e.Host)
+}
+
+func captchaHost(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(trimWWW(u.Hostname()))
+}
+
+// registerCaptcha ставит вкладку на паузу.
+func registerCaptcha(tab context.Context, pageURL, session string) *captchaWait {
+	w := &captchaWait{
+		ID:      newJobID()[:8],
+		URL:     pageURL,
+		Host:    captchaHost(pageURL),
+		Session: session,
+		Since:   time.Now(),
+		tab:     tab,
+		done:    make(chan struct{}),
+	}
+	captchaMutex.Lock()
+	captchaWaits = append(captchaWaits, w)
+	captchaMutex.Unlock()
+	return w
+}
+
+// unregisterCaptcha убирает паузу; повторный вызов безопасен.
+func unregisterCaptcha(w *captchaWait) bool {
+	captchaMutex.Lock()
+	defer captchaMutex.Unlock()
+	for i, c := range captchaWaits {
+		if c == w {
+			captchaWaits = append(captchaWaits[:i], captchaWaits[i+1:]...)
+			close(w.done)
+			return true
+		}
+	}
+	return false
+}
+
+// captchaPending сообщает, ждёт ли решения хотя бы одна CAPTCHA.
+func captchaPending() bool {
+	return captchaCount() > 0
+}
+
+func captchaCount() int {
+	captchaMutex.Lock()
+	defer captchaMutex.Unlock()
+	return len(captchaWaits)
+}
+
+// currentCaptcha возвращает CAPTCHA по идентификатору или, если он пуст,
+// самую раннюю; nil — такой нет.
+func currentCaptcha(id string) *captchaWait {
+	captchaMutex.Lock()
+	defer captchaMutex.Unlock()
+	for _, w := range captchaWaits {
+		if id == "" || w.ID == id {
+			return w
+		}
+	}
+	return nil
+}
+
+// pendingCaptchas возвращает копию списка ожидающих CAPTCHA.
+func pendingCaptchas() []*captchaWait {
+	captchaMutex.Lock()
+	defer captchaMutex.Unlock()
+	return append([]*captchaWait(nil), captchaWaits...)
+}
+
+// resolveCaptcha снимает паузу по команде оператора; source — откуда
+// пришла команда, для лога.
+func resolveCaptcha(w *captchaWait, source string) {
+	if unregisterCaptcha(w) {
+		log.Printf("ЛОГ: CAPTCHA %s (%s): оператор отметил решение (%s).", w.ID, w.Host, source)
+	}
+}
+
+// captchaBusy проверяет, можно ли сейчас скрапить адрес в сессии.
+func captchaBusy(pageURL, session string) error {
+	host := captchaHost(pageURL)
+	captchaMutex.Lock()
+	defer captchaMutex.Unlock()
+	for _, w := range captchaWaits {
+		if (host != "" && w.Host == host) || (session != "" && w.Session == session) {
+			return &captchaBusyError{Host: w.Host}
+		}
+	}
+	return nil
+}
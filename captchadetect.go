@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/chromedp/chromedp"
+)
+
+// Распознавание CAPTCHA. Слова вроде «captcha» в тексте встречаются и на
+// обычных страницах, которые о CAPTCHA пишут, поэтому основной признак —
+// разметка проверок:
+//
+//   - видимые виджеты reCAPTCHA, hCaptcha, Cloudflare Turnstile, Yandex
+//     SmartCaptcha (невидимые reCAPTCHA v3 и т. п. не мешают скрапингу и
+//     не считаются);
+//   - страницы-заглушки Cloudflare («Just a moment...», challenge-platform)
+//     и Яндекса (showcaptcha / checkcaptcha).
+//
+// Ключевые слова учитываются как слабый признак: только если документ
+// пришёл с одним из «заглушечных» статусов (по умолчанию 403/429/503) или
+// страница короткая, как у заглушки.
+//
+// Правила можно задать файлом CAPTCHA_RULES_FILE (JSON) с переопределениями
+// для отдельных доменов:
+//
+//	{
+//	  "keywords": ["captcha", "я не робот"],
+//	  "selectors": [{"name": "geetest", "selector": ".geetest_holder"}],
+//	  "statuses": [403, 429, 503],
+//	  "max_text": 3000,
+//	  "domains": {
+//	    "shop.example": {"keywords": [], "selectors": [{"name": "slider", "selector": "#nc_1_wrapper"}]},
+//	    "docs.example": {"disabled": true}
+//	  }
+//	}
+//
+// Поля домена заменяют общие (keywords: [] отключает слова), selectors
+// добавляются к общим, builtin_markers: false отключает встроенную
+// разметку. Файл перечитывается при изменении (проверка раз в
+// CAPTCHA_RULES_RELOAD, по умолчанию 30s); файл с ошибкой не применяется,
+// действуют прежние правила. Без файла работают встроенные правила и
+// CAPTCHA_KEYWORDS (через запятую).
+
+// captchaKeywordMaxText — длина текста, до которой страница считается
+// похожей на заглушку.
+const captchaKeywordMaxText = 3000
+
+type captchaSelector struct {
+	Name     string `json:"name"`
+	Selector string `json:"selector"`
+}
+
+// captchaRuleSet — правила для одного сайта. Указатели и nil-срезы
+// означают «не задано, взять из общих правил».
+type captchaRuleSet struct {
+	Keywords       []string          `json:"keywords"`
+	Selectors      []captchaSelector `json:"selectors"`
+	Statuses       []int64           `json:"statuses"`
+	MaxText        *int              `json:"max_text"`
+	BuiltinMarkers *bool             `json:"builtin_markers"`
+	Disabled       bool              `json:"disabled"`
+}
+
+type captchaRules struct {
+	captchaRuleSet
+	Domains map[string]captchaRuleSet `json:"domains"`
+}
+
+// captchaRulesCurrent — действующие правила; заменяются целиком при перечитывании.
+var captchaRulesCurrent atomic.Pointer[captchaRules]
+
+// captchaMarkersScript возвращает название найденной проверки или "".
+func captchaMarkersScript(extra []captchaSelector, builtin bool) string {
+	widgets := make([][2]string, 0, len(extra)+4)
+	if builtin {
+		widgets = append(widgets,
+			[2]string{"recaptcha", `iframe[src*="/recaptcha/api2/anchor"]:not([src*="size=invisible"]), iframe[src*="/recaptcha/api2/bframe"], iframe[src*="/recaptcha/enterprise/anchor"]:not([src*="size=invisible"])`},
+			[2]string{"hcaptcha", `iframe[src*="hcaptcha.com"][src*="checkbox"], iframe[src*="hcaptcha.com"][src*="challenge"]`},
+			[2]string{"turnstile", `iframe[src*="challenges.cloudflare.com"], .cf-turnstile`},
+			[2]string{"yandex-smartcaptcha", `iframe[src*="smartcaptcha.yandexcloud.net"], .smart-captcha, .CheckboxCaptcha, .AdvancedCaptcha`},
+		)
+	}
+	for _, s := range extra {
+		widgets = append(widgets, [2]string{s.Name, s.Selector})
+	}
+	list, _ := json.Marshal(widgets)
+	return fmt.Sprintf(`(() => {
+	const visible = el => {
+		const r = el.getBoundingClientRect();
+		const s = getComputedStyle(el);
+		return r.width > 20 && r.height > 20 && s.visibility !== 'hidden' && s.display !== 'none';
+	};
+	const widgets = %s;
+	for (const [name, sel] of widgets) {
+		let nodes;
+		try { nodes = document.querySelectorAll(sel); } catch (e) { continue; }
+		for (const el of nodes) {
+			if (visible(el)) return name;
+		}
+	}
+	if (!%t) return '';
+	if (document.querySelector('#challenge-form, #challenge-running, #cf-challenge-running, script[src*="/cdn-cgi/challenge-platform/"]') &&
+		/just a moment|checking your browser|attention required/i.test(document.title + ' ' + (document.body ? document.body.innerText.slice(0, 500) : ''))) {
+		return 'cloudflare';
+	}
+	if (/\/showcaptcha|\/checkcaptcha/.test(location.pathname) || document.querySelector('form[action*="checkcaptcha"]')) {
+		return 'yandex-smartcaptcha';
+	}
+	return '';
+})()`, list, builtin)
+}
+
+// loadCaptchaKeywords загружает правила распознавания CAPTCHA: из
+// CAPTCHA_RULES_FILE, если он задан, иначе встроенные с CAPTCHA_KEYWORDS.
+func loadCaptchaKeywords() {
+	if raw := os.Getenv("CAPTCHA_KEYWORDS"); raw != "" {
+		var words []string
+		for _, w := range strings.Split(raw, ",") {
+			if w = strings.ToLower(strings.TrimSpace(w)); w != "" {
+				words = append(words, w)
+			}
+		}
+		captchaKeywords = words
+		log.Printf("ЛОГ: Ключевые слова CAPTCHA из CAPTCHA_KEYWORDS: %d.", len(words))
+	}
+	path := os.Getenv("CAPTCHA_RULES_FILE")
+	if path == "" {
+		captchaRulesCurrent.Store(&captchaRules{})
+		return
+	}
+	rules, modTime, err := readCaptchaRules(path)
+	if err != nil {
+		log.Fatalf("Ошибка в файле правил CAPTCHA %s: %v", path, err)
+	}
+	captchaRulesCurrent.Store(rules)
+	log.Printf("ЛОГ: Правила CAPTCHA загружены из %s (доменов с переопределениями: %d).", path, len(rules.Domains))
+
+	interval := 30 * time.Second
+	if raw := os.Getenv("CAPTCHA_RULES_RELOAD"); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 {
+			log.Fatalf("Некорректное значение CAPTCHA_RULES_RELOAD: %q", raw)
+		}
+		interval = d
+	}
+	go watchCaptchaRules(path, modTime, interval)
+}
+
+func readCaptchaRules(path string) (*captchaRules, time.Time, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	var rules captchaRules
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&rules); err != nil {
+		return nil, time.Time{}, err
+	}
+	normalize := func(set *captchaRuleSet, where string) error {
+		for i, w := range set.Keywords {
+			set.Keywords[i] = strings.ToLower(strings.TrimSpace(w))
+		}
+		set.Keywords = slices.DeleteFunc(set.Keywords, func(w string) bool { return w == "" })
+		for _, s := range set.Selectors {
+			if s.Name == "" || s.Selector == "" {
+				return fmt.Errorf("%s: у селектора должны быть name и selector", where)
+			}
+		}
+		if set.MaxText != nil && *set.MaxText < 0 {
+			return fmt.Errorf("%s: max_text не может быть отрицательным", where)
+		}
+		return nil
+	}
+	if err := normalize(&rules.captchaRuleSet, "общие правила"); err != nil {
+		return nil, time.Time{}, err
+	}
+	domains := make(map[string]captchaRuleSet, len(rules.Domains))
+	for domain, set := range rules.Domains {
+		if err := normalize(&set, domain); err != nil {
+			return nil, time.Time{}, err
+		}
+		domains[trimWWW(domain)] = set
+	}
+	rules.Domains = domains
+	return &rules, info.ModTime(), nil
+}
+
+// watchCaptchaRules перечитывает файл правил, когда меняется время его изменения.
+func watchCaptchaRules(path string, modTime time.Time, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		info, err := os.Stat(path)
+		if err != nil || info.ModTime().Equal(modTime) {
+			continue
+		}
+		rules, newModTime, err := readCaptchaRules(path)
+		if err != nil {
+			log.Printf("ЛОГ: Файл правил CAPTCHA %s не применён, действуют прежние правила: %v", path, err)
+			modTime = info.ModTime()
+			continue
+		}
+		modTime = newModTime
+		captchaRulesCurrent.Store(rules)
+		log.Printf("ЛОГ: Правила CAPTCHA перечитаны из %s (доменов с переопределениями: %d).", path, len(rules.Domains))
+	}
+}
+
+// effectiveCaptchaRules собирает правила для адреса: общие, поверх них —
+// правила самого длинного подходящего домена.
+func effectiveCaptchaRules(pageURL string) captchaRuleSet {
+	rules := captchaRulesCurrent.Load()
+	if rules == nil {
+		rules = &captchaRules{}
+	}
+	eff := rules.captchaRuleSet
+	if eff.Keywords == nil {
+		eff.Keywords = captchaKeywords
+	}
+	if eff.Statuses == nil {
+		eff.Statuses = []int64{403, 429, 503}
+	}
+	if eff.MaxText == nil {
+		n := captchaKeywordMaxText
+		eff.MaxText = &n
+	}
+	if eff.BuiltinMarkers == nil {
+		builtin := true
+		eff.BuiltinMarkers = &builtin
+	}
+	best := ""
+	for domain := range rules.Domains {
+		if len(domain) > len(best) && hostMatchesDomain(pageURL, domain) {
+			best = domain
+		}
+	}
+	if best == "" {
+		return eff
+	}
+	site := rules.Domains[best]
+	if site.Keywords != nil {
+		eff.Keywords = site.Keywords
+	}
+	eff.Selectors = append(slices.Clip(eff.Selectors), site.Selectors...)
+	if site.Statuses != nil {
+		eff.Statuses = site.Statuses
+	}
+	if site.MaxText != nil {
+		eff.MaxText = site.MaxText
+	}
+	if site.BuiltinMarkers != nil {
+		eff.BuiltinMarkers = site.BuiltinMarkers
+	}
+	eff.Disabled = site.Disabled
+	return eff
+}
+
+// detectCaptcha возвращает описание найденного признака CAPTCHA или "".
+// pageURL выбирает правила домена; status — код ответа документа (0, если
+// неизвестен).
+func detectCaptcha(ctx context.Context, pageURL string, status int64) (string, error) {
+	rules := effectiveCaptchaRules(pageURL)
+	if rules.Disabled {
+		return "", nil
+	}
+	var marker string
+	if err := chromedp.Evaluate(captchaMarkersScript(rules.Selectors, *rules.BuiltinMarkers), &marker).Do(ctx); err != nil {
+		return "", err
+	}
+	if marker != "" {
+		return "разметка " + marker, nil
+	}
+	if len(rules.Keywords) == 0 {
+		return "", nil
+	}
+	var bodyText string
+	if err := chromedp.Text(`body`, &bodyText, chromedp.ByQuery).Do(ctx); err != nil {
+		return "", err
+	}
+	interstitial := slices.Contains(rules.Statuses, status)
+	if !interstitial && len([]rune(bodyText)) > *rules.MaxText {
+		return "", nil
+	}
+	lower := strings.ToLower(bodyText)
+	for _, keyword := range rules.Keywords {
+		if strings.Contains(lower, keyword) {
+			if interstitial {
+				return fmt.Sprintf("HTTP %d и слово '%s'", status, keyword), nil
+			}
+			return fmt.Sprintf("слово '%s' на короткой странице", keyword), nil
+		}
+	}
+	return "", nil
+}
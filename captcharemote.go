@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chromedp/cdproto/input"
+	"github.com/chromedp/chromedp"
+	"github.com/chromedp/chromedp/kb"
+)
+
+// Удалённое решение CAPTCHA — для headless-режима и серверов без консоли.
+// Пока CAPTCHA ждёт решения, оператор открывает /captcha?id= (нужен ADMIN_TOKEN;
+// без id — самая ранняя из ожидающих):
+// там обновляющийся скриншот вкладки; клик по скриншоту кликает в ту же
+// точку страницы, поле ввода печатает текст, «Готово» снимает паузу.
+// Если задан PUBLIC_URL, ссылка на страницу уходит в уведомление Telegram.
+
+// captchaActionTimeout ограничивает одно действие оператора.
+const captchaActionTimeout = 15 * time.Second
+
+// captchaRemoteLink — ссылка на страницу решения для уведомления.
+func captchaRemoteLink(id string) string {
+	base := strings.TrimRight(os.Getenv("PUBLIC_URL"), "/")
+	if base == "" {
+		return ""
+	}
+	return base + "/captcha?id=" + id
+}
+
+var captchaPage = template.Must(template.New("captcha").Parse(`<!doctype html>
+<html lang="ru"><head><meta charset="utf-8"><title>webextract: CAPTCHA</title>
+<style>body{font-family:sans-serif;margin:16px}img{border:1px solid #999;cursor:crosshair;max-width:100%}</style>
+</head><body>
+<h3>CAPTCHA {{.ID}} на {{.URL}}</h3>
+{{if gt (len .Pending) 1}}<p>Ждут решения:{{range .Pending}} <a href="captcha?id={{.ID}}&token={{$.Token}}">{{.ID}} ({{.Host}})</a>{{end}}</p>{{end}}
+<p>Кликните по скриншоту, чтобы кликнуть в странице. Скриншот обновляется каждые 2 с.</p>
+<form id="type"><input id="text" size="40" placeholder="Текст для ввода"> <button>Ввести</button>
+<button type="button" id="enter">Enter</button> <button type="button" id="done"><b>Готово</b></button></form>
+<p><img id="shot" src="captcha/screenshot?id={{.ID}}&token={{.Token}}"></p>
+<script>
+const token = {{.Token}}, id = {{.ID}};
+const query = () => '?id=' + encodeURIComponent(id) + '&token=' + encodeURIComponent(token);
+const post = (path, body) => fetch('captcha/' + path + query(), {method: 'POST', body});
+const shot = document.getElementById('shot');
+const refresh = () => { shot.src = 'captcha/screenshot' + query() + '&t=' + Date.now(); };
+setInterval(refresh, 2000);
+shot.addEventListener('click', e => {
+	const r = shot.getBoundingClientRect();
+	const x = Math.round((e.clientX - r.left) * shot.naturalWidth / r.width);
+	const y = Math.round((e.clientY - r.top) * shot.naturalHeight / r.height);
+	// Строка ушла бы как text/plain, а ParseForm читает только форму.
+	post('click', new URLSearchParams({x, y})).then(refresh);
+});
+document.getElementById('type').addEventListener('submit', e => {
+	e.preventDefault();
+	post('type', document.getElementById('text').value).then(refresh);
+});
+document.getElementById('enter').addEventListener('click', () => post('key', 'Enter').then(refresh));
+document.getElementById('done').addEventListener('click', () => post('done', '').then(() => { document.body.innerHTML = '<h3>Пауза снята, скрапинг продолжается.</h3>'; }));
+</script></body></html>`))
+
+// captchaHandler: /captcha и /captcha/{screenshot,click,type,key,done}.
+func captchaHandler(w http.ResponseWriter, r *http.Request) {
+	if !adminTokenValid(r) {
+		writeJsonError(w, "Неверный или не настроенный ADMIN_TOKEN", http.StatusUnauthorized)
+		return
+	}
+	wait := currentCaptcha(r.URL.Query().Get("id"))
+	if wait == nil {
+		writeJsonError(w, "Сейчас нет CAPTCHA, ожидающей решения", http.StatusNotFound)
+		return
+	}
+	tab := wait.tab
+	action := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/captcha"), "/")
+	if action == "" {
+		var loc string
+		chromedp.Run(tab, chromedp.Location(&loc))
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		captchaPage.Execute(w, map[string]any{"URL": loc, "ID": wait.ID, "Token": r.URL.Query().Get("token"), "Pending": pendingCaptchas()})
+		return
+	}
+	if action != "screenshot" && r.Method != http.MethodPost {
+		writeJsonError(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(tab, captchaActionTimeout)
+	defer cancel()
+	var err error
+	switch action {
+	case "screenshot":
+		var buf []byte
+		if err = chromedp.Run(ctx, chromedp.CaptureScreenshot(&buf)); err == nil {
+			w.Header().Set("Content-Type", "image/png")
+			w.Header().Set("Cache-Control", "no-store")
+			w.Write(buf)
+			return
+		}
+	case "click":
+		r.ParseForm()
+		x, errX := strconv.ParseFloat(r.Form.Get("x"), 64)
+		y, errY := strconv.ParseFloat(r.Form.Get("y"), 64)
+		if errX != nil || errY != nil {
+			writeJsonError(w, "Параметры 'x' и 'y' должны быть числами", http.StatusBadRequest)
+			return
+		}
+		log.Printf("ЛОГ: CAPTCHA: оператор кликает в (%.0f, %.0f).", x, y)
+		err = chromedp.Run(ctx,
+			input.DispatchMouseEvent(input.MouseMoved, x, y),
+			input.DispatchMouseEvent(input.MousePressed, x, y).WithButton(input.Left).WithClickCount(1),
+			input.DispatchMouseEvent(input.MouseReleased, x, y).WithButton(input.Left).WithClickCount(1),
+		)
+	case "type":
+		body, _ := io.ReadAll(io.LimitReader(r.Body, 4096))
+		log.Println("ЛОГ: CAPTCHA: оператор вводит текст.")
+		err = chromedp.Run(ctx, chromedp.KeyEvent(string(body)))
+	case "key":
+		body, _ := io.ReadAll(io.LimitReader(r.Body, 64))
+		if strings.TrimSpace(string(body)) != "Enter" {
+			writeJsonError(w, "Поддерживается только клавиша Enter", http.StatusBadRequest)
+			return
+		}
+		err = chromedp.Run(ctx, chromedp.KeyEvent(kb.Enter))
+	case "done":
+		resolveCaptcha(wait, "/captcha")
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		writeJsonError(w, fmt.Sprintf("Не удалось выполнить действие: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"log/slog"
+	"time"
+
+	"github.com/chromedp/chromedp"
+)
+
+// consentSelectors — кнопки "Принять"/"Закрыть" популярных consent-менеджеров.
+// Порядок важен: сначала специфичные селекторы CMP, затем общие варианты.
+var consentSelectors = []string{
+	// OneTrust
+	"#onetrust-accept-btn-handler",
+	"#accept-recommended-btn-handler",
+	".onetrust-close-btn-handler",
+	// Cookiebot
+	"#CybotCookiebotDialogBodyLevelButtonLevelOptinAllowAll",
+	"#CybotCookiebotDialogBodyButtonAccept",
+	"#CybotCookiebotDialogBodyLevelButtonAccept",
+	// Quantcast, Didomi, Usercentrics, TrustArc
+	".qc-cmp2-summary-buttons button[mode=\"primary\"]",
+	"#didomi-notice-agree-button",
+	"button[data-testid=\"uc-accept-all-button\"]",
+	"#truste-consent-button",
+	// Типовые русскоязычные баннеры (Яндекс, маркетплейсы, самописные)
+	"button[data-id=\"button-all\"]",
+	".cookie-notice__button",
+	".cookies-notification__button",
+	".cookie-agreement__button",
+	".cookie-policy__button",
+	".js-cookie-accept",
+	"[data-qa=\"cookie-accept\"]",
+	"[data-testid=\"cookie-accept\"]",
+	"#cookie-accept",
+	"#cookies-accept",
+	".cookie-consent__accept",
+}
+
+// clickFirstVisibleScript возвращает JS, который кликает по первому видимому
+// элементу из списка селекторов и возвращает сработавший селектор (или "").
+func clickFirstVisibleScript(selectors []string) string {
+	list, _ := json.Marshal(selectors)
+	return fmt.Sprintf(`(() => {
+	const selectors = %s;
+	for (const sel of selectors) {
+		let nodes;
+		try { nodes = document.querySelectorAll(sel); } catch (e) { continue; }
+		for (const el of nodes) {
+			const rect = el.getBoundingClientRect();
+			const style = window.getComputedStyle(el);
+			if (rect.width === 0 || rect.height === 0 || style.visibility === 'hidden' || style.display === 'none') {
+				continue;
+			}
+			el.click();
+			return sel;
+		}
+	}
+	return "";
+})()`, list)
+}
+
+// dismissCookieConsent закрывает баннер согласия на cookies, если он найден.
+// Отсутствие баннера не является ошибкой.
+func dismissCookieConsent() chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		slog.InfoContext(ctx, "Шаг [1.1]: ищу баннер согласия на cookies")
+		var matched string
+		if err := chromedp.Evaluate(clickFirstVisibleScript(consentSelectors), &matched).Do(ctx); err != nil {
+			log.Printf("ЛОГ: Не удалось проверить баннер cookies: %v", err)
+			return nil
+		}
+		if matched == "" {
+			// Самописные баннеры: ищем кнопку согласия по тексту.
+			if err := chromedp.Evaluate(consentTextScript, &matched).Do(ctx); err != nil {
+				log.Printf("ЛОГ: Не удалось проверить баннер cookies: %v", err)
+				return nil
+			}
+		}
+		if matched == "" {
+			slog.InfoContext(ctx, "Шаг [1.1]: баннер cookies не найден")
+			return nil
+		}
+		slog.InfoContext(ctx, "Шаг [1.1]: баннер cookies закрыт", "matched", matched)
+		// Даём странице время убрать оверлей и перерисоваться.
+		return chromedp.Sleep(500 * time.Millisecond).Do(ctx)
+	})
+}
+
+// consentTextScript — запасной поиск для баннеров без известного CMP:
+// кнопка с текстом согласия («Принять», «Accept all», «Согласен»...) внутри
+// блока, который по классу, id, aria-label или тексту похож на баннер
+// cookies. Заодно просматриваются открытые shadow root (Usercentrics и
+// подобные рисуют баннер в них). Возвращает текст нажатой кнопки или "".
+const consentTextScript = `(() => {
+	const ACCEPT = /^(принять( все| всё)?( cookies?| куки)?|согласен|согласна|соглашаюсь|я согласен|хорошо|понятно|ок|ok|accept( all)?( cookies)?|allow( all)?( cookies)?|agree|i agree|got it|alle akzeptieren|akzeptieren|tout accepter|accepter|aceptar( todo)?)[.!]?$/i;
+	const BANNER = /cookie|consent|gdpr|privacy|куки|согласи|персональн/i;
+	const visible = el => {
+		const r = el.getBoundingClientRect(), st = getComputedStyle(el);
+		return r.width > 0 && r.height > 0 && st.visibility !== 'hidden' && st.display !== 'none';
+	};
+	const inBanner = el => {
+		for (let n = el.parentElement, depth = 0; n && depth < 8; n = n.parentElement, depth++) {
+			const attrs = (typeof n.className === 'string' ? n.className : '') + ' ' + (n.id || '') + ' ' + (n.getAttribute('aria-label') || '');
+			if (BANNER.test(attrs)) return true;
+			if (n.textContent.length < 2000 && BANNER.test(n.textContent)) return true;
+		}
+		return false;
+	};
+	const roots = [document];
+	for (let i = 0; i < roots.length; i++) {
+		for (const el of roots[i].querySelectorAll('*')) if (el.shadowRoot) roots.push(el.shadowRoot);
+	}
+	for (const root of roots) {
+		for (const el of root.querySelectorAll('button, a[role="button"], [role="button"], input[type="button"], input[type="submit"]')) {
+			const text = (el.innerText || el.value || el.textContent || '').replace(/\s+/g, ' ').trim();
+			if (!text || text.length > 40 || !ACCEPT.test(text) || !visible(el) || !inBanner(el)) continue;
+			el.click();
+			return 'text: ' + text;
+		}
+	}
+	return '';
+})()`
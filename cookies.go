@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/chromedp"
+)
+
+// Куки запроса: cookies — JSON-массив, который выставляется до навигации,
+// return_cookies=true — вернуть куки страницы после загрузки в
+// page_cookies (поле ответа названо иначе, чем параметр, иначе fields без
+// него снимал бы входные куки):
+//
+//	{"url": "...", "cookies": [{"name": "sid", "value": "...", "domain": ".example.com"}],
+//	 "return_cookies": true}
+//
+// Без domain кука привязывается к адресу запроса. Скрапинг с cookies идёт
+// в отдельном BrowserContext, чтобы чужие куки не остались в общем
+// браузере и не попали в ответы другим клиентам.
+
+const maxRequestCookies = 200
+
+// Cookie — кука во входных параметрах и в ответе.
+type Cookie struct {
+	Name     string  `json:"name"`
+	Value    string  `json:"value"`
+	Domain   string  `json:"domain,omitempty"`
+	Path     string  `json:"path,omitempty"`
+	Expires  float64 `json:"expires,omitempty"` // Unix-время в секундах; 0 — сессионная
+	HTTPOnly bool    `json:"http_only,omitempty"`
+	Secure   bool    `json:"secure,omitempty"`
+	SameSite string  `json:"same_site,omitempty"` // Strict, Lax или None
+}
+
+var validSameSite = map[string]network.CookieSameSite{
+	"strict": network.CookieSameSiteStrict,
+	"lax":    network.CookieSameSiteLax,
+	"none":   network.CookieSameSiteNone,
+}
+
+func parseRequestCookies(raw string) ([]Cookie, error) {
+	var cookies []Cookie
+	if err := json.Unmarshal([]byte(raw), &cookies); err != nil {
+		return nil, errors.New("Параметр 'cookies' должен быть JSON-массивом объектов {name, value, domain, ...}")
+	}
+	if len(cookies) > maxRequestCookies {
+		return nil, fmt.Errorf("Параметр 'cookies' может содержать не больше %d кук", maxRequestCookies)
+	}
+	for i, c := range cookies {
+		if c.Name == "" {
+			return nil, fmt.Errorf("Кука %d в cookies: нужно имя", i+1)
+		}
+		if _, ok := validSameSite[strings.ToLower(c.SameSite)]; c.SameSite != "" && !ok {
+			return nil, fmt.Errorf("Кука %d в cookies: same_site может принимать значения: Strict, Lax, None", i+1)
+		}
+	}
+	return cookies, nil
+}
+
+// setCookies выставляет куки вкладки до навигации.
+func setCookies(cookies []Cookie, pageURL string) chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		log.Printf("ЛОГ: Выставляю куки запроса: %d шт.", len(cookies))
+		params := make([]*network.CookieParam, 0, len(cookies))
+		for _, c := range cookies {
+			p := &network.CookieParam{
+				Name:     c.Name,
+				Value:    c.Value,
+				Domain:   c.Domain,
+				Path:     c.Path,
+				Secure:   c.Secure,
+				HTTPOnly: c.HTTPOnly,
+				SameSite: validSameSite[strings.ToLower(c.SameSite)],
+			}
+			if c.Domain == "" {
+				p.URL = pageURL
+			}
+			if c.Expires > 0 {
+				sec := int64(c.Expires)
+				t := cdp.TimeSinceEpoch(time.Unix(sec, 0))
+				p.Expires = &t
+			}
+			params = append(params, p)
+		}
+		return network.SetCookies(params).Do(ctx)
+	})
+}
+
+// pageCookies возвращает куки текущей страницы и её фреймов.
+func pageCookies(out *[]Cookie) chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		cookies, err := network.GetCookies().Do(ctx)
+		if err != nil {
+			return err
+		}
+		for _, c := range cookies {
+			cookie := Cookie{
+				Name:     c.Name,
+				Value:    c.Value,
+				Domain:   c.Domain,
+				Path:     c.Path,
+				HTTPOnly: c.HTTPOnly,
+				Secure:   c.Secure,
+				SameSite: string(c.SameSite),
+			}
+			if !c.Session {
+				cookie.Expires = c.Expires
+			}
+			*out = append(*out, cookie)
+		}
+		return nil
+	})
+}
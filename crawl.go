@@ -0,0 +1,554 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Обход множества страниц (/crawl/sitemap, /crawl): общий для режимов
+// обхода исполнитель. Параметры скрапинга — как у /scrape (без url), плюс:
+//
+//	limit       — сколько страниц обойти (по умолчанию 100, до maxCrawlPages);
+//	include     — регулярное выражение: обходить только подходящие адреса;
+//	exclude     — регулярное выражение: пропускать подходящие адреса;
+//	concurrency — сколько страниц скрапить одновременно (1–maxCrawlConcurrency);
+//	delay       — пауза между запросами к одному хосту, мс (до maxCrawlDelay);
+//	robots      — true (по умолчанию) или false: соблюдать robots.txt
+//	              (Disallow, Crawl-delay, Clean-param; см. robots.go);
+//	stream      — true (по умолчанию) или false: отдать всё одним JSON.
+//
+// Результаты отдаются потоком NDJSON по мере готовности: строка CrawlPage
+// на страницу и последней строкой CrawlSummary; при stream=false —
+// объект CrawlResult после обхода. fields и transform
+// применяются к каждой странице; template не поддерживается. Обход
+// прекращается, если клиент закрыл соединение.
+
+const (
+	defaultCrawlPages   = 100
+	maxCrawlPages       = 10000
+	maxCrawlConcurrency = 8
+	crawlFetchTimeout   = time.Minute
+	// crawlThrottleRetries — сколько раз ждать освобождения лимита домена
+	// (DOMAIN_RATE_LIMIT), прежде чем записать страницу в ошибки.
+	crawlThrottleRetries = 5
+)
+
+// crawlParams — параметры обхода; из параметров скрапинга страниц они удаляются.
+var crawlParams = []string{"sitemap", "limit", "include", "exclude", "concurrency", "delay", "robots", "stream", "depth", "canonical"}
+
+// CrawlPage — результат одной страницы обхода.
+type CrawlPage struct {
+	URL     string `json:"url"`
+	Lastmod string `json:"lastmod,omitempty"` // Из sitemap
+	Depth   int    `json:"depth,omitempty"`   // /crawl: сколько переходов от начальной страницы
+	Cache   string `json:"cache,omitempty"`   // HIT, MISS
+	Result  any    `json:"result,omitempty"`
+	Error   string `json:"error,omitempty"`
+	Code    string `json:"code,omitempty"`
+	Skipped string `json:"skipped,omitempty"` // robots.txt — страница не скрапилась
+
+	Canonical   string `json:"canonical,omitempty"`    // /crawl: rel=canonical, если отличается от url
+	DuplicateOf string `json:"duplicate_of,omitempty"` // /crawl: канонический адрес уже обойдён — результат не отдаётся
+}
+
+// CrawlSummary — итог обхода, последняя строка потока.
+type CrawlSummary struct {
+	Done       bool   `json:"done"`
+	Pages      int    `json:"pages"` // Сколько адресов отобрано для обхода
+	Scraped    int    `json:"scraped"`
+	Failed     int    `json:"failed"`
+	Skipped    int    `json:"skipped"`
+	Duplicates int    `json:"duplicates,omitempty"`
+	Error      string `json:"error,omitempty"` // Обход прерван
+}
+
+// CrawlResult — ответ при stream=false.
+type CrawlResult struct {
+	Pages   []CrawlPage  `json:"pages"`
+	Summary CrawlSummary `json:"summary"`
+}
+
+// crawlTarget — адрес, отобранный для обхода.
+type crawlTarget struct {
+	URL     string
+	Lastmod string
+	Depth   int
+}
+
+// crawlRun — состояние одного обхода.
+type crawlRun struct {
+	ctx         context.Context
+	base        url.Values // Параметры скрапинга без url
+	selection   []*gqlField
+	transform   *jsonPath
+	limit       int
+	concurrency int
+	include     *regexp.Regexp
+	exclude     *regexp.Regexp
+	delay       time.Duration
+	robots      bool
+	stream      bool
+	hideLinks   bool // links и meta включены обходчиком, а не клиентом
+	hideMeta    bool
+
+	mu        sync.Mutex
+	hostRules map[string]*robotsRules
+	nextVisit map[string]time.Time // Когда можно следующий запрос к хосту (Crawl-delay)
+	seen      map[string]bool
+
+	w       http.ResponseWriter
+	writeMu sync.Mutex
+	enc     *json.Encoder
+	pages   []CrawlPage // stream=false
+	summary CrawlSummary
+}
+
+// newCrawlRun разбирает параметры обхода. Ошибка — для ответа 400.
+func newCrawlRun(w http.ResponseWriter, r *http.Request, q url.Values) (*crawlRun, int, error) {
+	c := &crawlRun{
+		ctx:         r.Context(),
+		limit:       defaultCrawlPages,
+		concurrency: 1,
+		robots:      true,
+		stream:      true,
+		hostRules:   map[string]*robotsRules{},
+		nextVisit:   map[string]time.Time{},
+		seen:        map[string]bool{},
+		w:           w,
+	}
+	if raw := q.Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxCrawlPages {
+			return nil, http.StatusBadRequest, fmt.Errorf("Параметр 'limit' должен быть числом от 1 до %d", maxCrawlPages)
+		}
+		c.limit = n
+	}
+	if raw := q.Get("concurrency"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxCrawlConcurrency {
+			return nil, http.StatusBadRequest, fmt.Errorf("Параметр 'concurrency' должен быть числом от 1 до %d", maxCrawlConcurrency)
+		}
+		c.concurrency = n
+	}
+	var err error
+	if raw := q.Get("include"); raw != "" {
+		if c.include, err = regexp.Compile(raw); err != nil {
+			return nil, http.StatusBadRequest, errors.New("Параметр 'include' должен быть корректным регулярным выражением")
+		}
+	}
+	if raw := q.Get("exclude"); raw != "" {
+		if c.exclude, err = regexp.Compile(raw); err != nil {
+			return nil, http.StatusBadRequest, errors.New("Параметр 'exclude' должен быть корректным регулярным выражением")
+		}
+	}
+	if raw := q.Get("delay"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 || n > int(maxCrawlDelay/time.Millisecond) {
+			return nil, http.StatusBadRequest, fmt.Errorf("Параметр 'delay' должен быть числом миллисекунд от 0 до %d", int(maxCrawlDelay/time.Millisecond))
+		}
+		c.delay = time.Duration(n) * time.Millisecond
+	}
+	for _, p := range []struct {
+		name string
+		dst  *bool
+	}{{"robots", &c.robots}, {"stream", &c.stream}} {
+		switch q.Get(p.name) {
+		case "", "true":
+		case "false":
+			*p.dst = false
+		default:
+			return nil, http.StatusBadRequest, fmt.Errorf("Параметр '%s' может принимать значения: true, false", p.name)
+		}
+	}
+	if q.Has("template") {
+		return nil, http.StatusBadRequest, errors.New("Параметр 'template' не поддерживается при обходе")
+	}
+	if status, err := checkEvalParam(r, q); err != nil {
+		return nil, status, err
+	}
+
+	c.base = url.Values{}
+	for name, values := range q {
+		c.base[name] = values
+	}
+	for _, name := range append(crawlParams, "url", "async", "callback_url") {
+		c.base.Del(name)
+	}
+	if raw := c.base.Get("fields"); raw != "" {
+		c.selection = parseFieldsParam(raw)
+		applyFieldSelection(c.base, c.selection)
+	}
+	if raw := c.base.Get("transform"); raw != "" {
+		if c.transform, err = compileJSONPath(raw); err != nil {
+			return nil, http.StatusBadRequest, err
+		}
+	}
+	return c, 0, nil
+}
+
+// pageQuery — параметры скрапинга страницы.
+func (c *crawlRun) pageQuery(target string) url.Values {
+	q := url.Values{}
+	for name, values := range c.base {
+		q[name] = values
+	}
+	q.Set("url", target)
+	return q
+}
+
+// checkOptions проверяет параметры скрапинга на первом адресе, пока
+// клиенту ещё можно ответить 400.
+func (c *crawlRun) checkOptions(target string) error {
+	_, err := parseScrapeOptions(c.pageQuery(target))
+	return err
+}
+
+// crawlClient загружает sitemap и robots.txt; переадресации проходят ту же
+// проверку SSRF, что и адреса скрапинга.
+var crawlClient = &http.Client{
+	Timeout: crawlFetchTimeout,
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 10 {
+			return errors.New("слишком много переадресаций")
+		}
+		return checkTargetURL(req.URL.String())
+	},
+}
+
+// fetchCrawlFile загружает файл не больше limit байт, распаковывая gzip
+// (sitemap.xml.gz отдаётся без Content-Encoding). status — код ответа;
+// тело читается только при 200.
+func fetchCrawlFile(ctx context.Context, rawURL string, limit int64) (data []byte, status int, err error) {
+	if err := checkTargetURL(rawURL); err != nil {
+		return nil, 0, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("User-Agent", desktopProfiles[0].UserAgent)
+	resp, err := crawlClient.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, resp.StatusCode, nil
+	}
+	if data, err = readLimited(resp.Body, limit); err != nil {
+		return nil, resp.StatusCode, err
+	}
+	if len(data) > 2 && data[0] == 0x1f && data[1] == 0x8b {
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, resp.StatusCode, err
+		}
+		if data, err = readLimited(gz, limit); err != nil {
+			return nil, resp.StatusCode, err
+		}
+	}
+	return data, resp.StatusCode, nil
+}
+
+func readLimited(r io.Reader, limit int64) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("больше %d байт", limit)
+	}
+	return data, nil
+}
+
+// rules возвращает robots.txt хоста, загружая его при первом обращении.
+// Недоступный robots.txt ничего не запрещает.
+func (c *crawlRun) rules(u *url.URL) *robotsRules {
+	key := u.Scheme + "://" + u.Host
+	c.mu.Lock()
+	rules, ok := c.hostRules[key]
+	c.mu.Unlock()
+	if ok {
+		return rules
+	}
+	data, status, err := fetchCrawlFile(c.ctx, key+"/robots.txt", maxRobotsSize*2)
+	switch {
+	case err != nil:
+		slog.WarnContext(c.ctx, "Обход: не удалось загрузить robots.txt", "site", key, "error", err)
+		rules = &robotsRules{}
+	case status != http.StatusOK:
+		rules = &robotsRules{}
+	default:
+		rules = parseRobots(data)
+		if rules.crawlDelay > 0 {
+			slog.InfoContext(c.ctx, "Обход: сайт просит Crawl-delay", "site", key, "crawl_delay", rules.crawlDelay.String())
+		}
+	}
+	c.mu.Lock()
+	c.hostRules[key] = rules
+	c.mu.Unlock()
+	return rules
+}
+
+// accept нормализует адрес по Clean-param и решает, брать ли его в обход:
+// адрес подходит под include/exclude и ещё не встречался. Возвращает
+// нормализованный адрес.
+func (c *crawlRun) accept(raw string) (string, bool) {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", false
+	}
+	u.Fragment = ""
+	if c.robots {
+		c.rules(u).Clean(u)
+	}
+	target := u.String()
+	if c.include != nil && !c.include.MatchString(target) {
+		return "", false
+	}
+	if c.exclude != nil && c.exclude.MatchString(target) {
+		return "", false
+	}
+	if !c.claim(target) {
+		return "", false
+	}
+	return target, true
+}
+
+// crawlKey — ключ адреса для поиска дублей: адреса с www. и без него
+// считаются одним.
+func crawlKey(target string) string {
+	u, err := url.Parse(target)
+	if err != nil {
+		return target
+	}
+	u.Host = trimWWW(u.Host)
+	return u.String()
+}
+
+// claim отмечает адрес обойдённым; false — он уже встречался.
+func (c *crawlRun) claim(target string) bool {
+	key := crawlKey(target)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.seen[key] {
+		return false
+	}
+	c.seen[key] = true
+	return true
+}
+
+// pace ждёт очереди к хосту: delay — больший из параметра delay и
+// Crawl-delay. Очередь резервируется
+// сразу, поэтому параллельные обработчики к одному хосту не совпадают.
+func (c *crawlRun) pace(u *url.URL, delay time.Duration) error {
+	if delay <= 0 {
+		return nil
+	}
+	c.mu.Lock()
+	at := time.Now()
+	if next := c.nextVisit[u.Host]; next.After(at) {
+		at = next
+	}
+	c.nextVisit[u.Host] = at.Add(delay)
+	c.mu.Unlock()
+	select {
+	case <-time.After(time.Until(at)):
+		return nil
+	case <-c.ctx.Done():
+		return c.ctx.Err()
+	}
+}
+
+// scrape обходит одну страницу. Ответ нужен обходчику ссылок; результат
+// для клиента формирует complete.
+func (c *crawlRun) scrape(target crawlTarget) (CrawlPage, *Response) {
+	page := CrawlPage{URL: target.URL, Lastmod: target.Lastmod, Depth: target.Depth}
+	u, _ := url.Parse(target.URL)
+	delay := c.delay
+	if c.robots {
+		rules := c.rules(u)
+		if !rules.Allowed(u) {
+			page.Skipped = "robots.txt"
+			return page, nil
+		}
+		delay = max(delay, rules.crawlDelay)
+	}
+	if err := c.pace(u, delay); err != nil {
+		return c.fail(page, err), nil
+	}
+	q := c.pageQuery(target.URL)
+	opts, err := parseScrapeOptions(q)
+	if err != nil {
+		return c.fail(page, err), nil
+	}
+	opts.trace = c.ctx
+	var response *Response
+	for attempt := 0; ; attempt++ {
+		response, page.Cache, err = scrapeWithCache(q, opts)
+		var thErr *throttledError
+		if !errors.As(err, &thErr) || attempt >= crawlThrottleRetries {
+			break
+		}
+		select {
+		case <-time.After(thErr.RetryAfter):
+		case <-c.ctx.Done():
+			return c.fail(page, c.ctx.Err()), nil
+		}
+	}
+	if err != nil {
+		return c.fail(page, fmt.Errorf("Не удалось выполнить скрапинг: %w", err)), nil
+	}
+	return page, response
+}
+
+// complete формирует результат страницы (fields, transform) и отдаёт её
+// клиенту. Поля, которые обходчик включил для себя (links, meta), из
+// результата убираются. Для дубликата результат не отдаётся.
+func (c *crawlRun) complete(page CrawlPage, response *Response) {
+	if response != nil && page.DuplicateOf == "" {
+		if c.hideLinks || c.hideMeta {
+			trimmed := *response // Ответ из кэша общий — меняем копию
+			if c.hideLinks {
+				trimmed.Links, trimmed.LinksTotal, trimmed.LinksTruncated = nil, 0, false
+			}
+			if c.hideMeta {
+				trimmed.Meta = nil
+			}
+			response = &trimmed
+		}
+		var out any = response
+		var err error
+		if c.selection != nil {
+			out, err = projectResponse(response, c.selection)
+		}
+		if err == nil && c.transform != nil {
+			if out, err = toGenericJSON(out); err == nil {
+				out = c.transform.Apply(out)
+			}
+		}
+		if err != nil {
+			page = c.fail(page, fmt.Errorf("Не удалось сформировать ответ: %w", err))
+		} else {
+			page.Result = out
+		}
+	}
+	c.mu.Lock()
+	switch {
+	case page.Skipped != "":
+		c.summary.Skipped++
+	case page.Error != "":
+		c.summary.Failed++
+	case page.DuplicateOf != "":
+		c.summary.Duplicates++
+	default:
+		c.summary.Scraped++
+	}
+	c.mu.Unlock()
+	c.emit(page)
+}
+
+// fail записывает ошибку страницы на языке запроса.
+func (c *crawlRun) fail(page CrawlPage, err error) CrawlPage {
+	page.Error, page.Code = localize(responseLang(c.w), err.Error())
+	return page
+}
+
+// start отправляет заголовки ответа.
+func (c *crawlRun) start() {
+	if c.stream {
+		c.w.Header().Set("Content-Type", "application/x-ndjson; charset=utf-8")
+	} else {
+		c.w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	}
+	c.enc = json.NewEncoder(c.w)
+}
+
+// emit пишет страницу или итог: в потоке — сразу строкой NDJSON, иначе
+// копит страницы до finish.
+func (c *crawlRun) emit(v any) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if !c.stream {
+		if page, ok := v.(CrawlPage); ok {
+			c.pages = append(c.pages, page)
+		}
+		return
+	}
+	if err := c.enc.Encode(v); err != nil {
+		return
+	}
+	if f, ok := c.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// stopped сообщает, что обход пора прекратить.
+func (c *crawlRun) stopped() bool {
+	return c.ctx.Err() != nil || shuttingDown.Load()
+}
+
+// batch обходит адреса concurrency обработчиками; done вызывается по
+// одной странице за раз.
+func (c *crawlRun) batch(targets []crawlTarget, done func(CrawlPage, *Response)) {
+	queue := make(chan crawlTarget)
+	var wg sync.WaitGroup
+	var doneMu sync.Mutex
+	for range c.concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for target := range queue {
+				page, response := c.scrape(target)
+				doneMu.Lock()
+				done(page, response)
+				doneMu.Unlock()
+			}
+		}()
+	}
+	for _, target := range targets {
+		if c.stopped() {
+			break
+		}
+		queue <- target
+	}
+	close(queue)
+	wg.Wait()
+}
+
+// run обходит заранее известные адреса и завершает ответ итогом.
+func (c *crawlRun) run(targets []crawlTarget) {
+	c.summary.Pages = len(targets)
+	c.batch(targets, c.complete)
+	c.finish()
+}
+
+func (c *crawlRun) finish() {
+	switch {
+	case c.ctx.Err() != nil:
+		slog.InfoContext(c.ctx, "Обход прерван клиентом", "scraped", c.summary.Scraped, "pages", c.summary.Pages)
+		return
+	case shuttingDown.Load():
+		c.summary.Error, _ = localize(responseLang(c.w), "Сервер останавливается, обход прерван")
+	}
+	c.summary.Done = c.summary.Error == ""
+	slog.InfoContext(c.ctx, "Обход завершён", "pages", c.summary.Pages, "scraped", c.summary.Scraped,
+		"failed", c.summary.Failed, "duplicates", c.summary.Duplicates, "skipped", c.summary.Skipped)
+	if c.stream {
+		c.emit(c.summary)
+		return
+	}
+	c.enc.Encode(CrawlResult{Pages: c.pages, Summary: c.summary})
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Обход сайта по ссылкам: GET|POST /crawl?url=<начальная страница>&depth=N
+// &<параметры обхода и скрапинга> (crawl.go). Обход идёт в ширину по
+// ссылкам на тот же сайт (www. не различается; учитывается и хост после
+// редиректа начальной страницы) на глубину depth переходов. Ссылки
+// берутся из обычного сбора links: если клиент их не запросил, обходчик
+// включает links_internal_only сам и убирает ссылки из результата.
+//
+// canonical=true (по умолчанию) схлопывает дубликаты: страница, чей
+// rel=canonical или адрес после редиректа уже обойдён или стоит в очереди,
+// отдаётся строкой с duplicate_of без результата, а её ссылки не обходятся.
+// С robots=true не обходятся и ссылки страниц с meta robots nofollow.
+
+const (
+	defaultCrawlDepth = 2
+	maxCrawlDepth     = 10
+)
+
+// crawlSkipExt — расширения файлов, которые не рендерятся как страницы.
+var crawlSkipExt = map[string]bool{
+	"pdf": true, "zip": true, "rar": true, "gz": true, "7z": true, "exe": true, "dmg": true,
+	"jpg": true, "jpeg": true, "png": true, "gif": true, "webp": true, "svg": true, "ico": true,
+	"mp3": true, "mp4": true, "avi": true, "mov": true, "webm": true,
+	"doc": true, "docx": true, "xls": true, "xlsx": true, "ppt": true, "pptx": true,
+	"css": true, "js": true, "xml": true, "json": true, "txt": true,
+}
+
+// siteCrawl — состояние обхода по ссылкам поверх crawlRun.
+type siteCrawl struct {
+	*crawlRun
+	maxDepth int
+	hosts    map[string]bool // Хосты сайта без www.
+}
+
+// normalize приводит адрес к виду, в котором он сравнивается с
+// обойдёнными: без фрагмента и параметров Clean-param.
+func (s *siteCrawl) normalize(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	u.Fragment = ""
+	if s.robots {
+		s.rules(u).Clean(u)
+	}
+	return u.String()
+}
+
+// dedupe проверяет, не дубликат ли страница: её каноническим адресом
+// (rel=canonical или адрес после редиректа) уже занята другая страница.
+func (s *siteCrawl) dedupe(page *CrawlPage, response *Response) {
+	if response.Meta != nil && response.Meta.Canonical != "" {
+		if canonical := s.normalize(response.Meta.Canonical); crawlKey(canonical) != crawlKey(page.URL) {
+			page.Canonical = canonical
+			if !s.claim(canonical) {
+				page.DuplicateOf = canonical
+			}
+			return
+		}
+	}
+	if response.FinalURL != "" {
+		if final := s.normalize(response.FinalURL); crawlKey(final) != crawlKey(page.URL) && !s.claim(final) {
+			page.DuplicateOf = final
+		}
+	}
+}
+
+// follow разрешает ссылку страницы и решает, обходить ли её.
+func (s *siteCrawl) follow(base *url.URL, href string) (string, bool) {
+	ref, err := url.Parse(strings.TrimSpace(href))
+	if err != nil {
+		return "", false
+	}
+	u := base.ResolveReference(ref)
+	if (u.Scheme != "http" && u.Scheme != "https") || !s.hosts[trimWWW(u.Hostname())] {
+		return "", false
+	}
+	if crawlSkipExt[strings.ToLower(strings.TrimPrefix(path.Ext(u.Path), "."))] {
+		return "", false
+	}
+	return s.accept(u.String())
+}
+
+// crawlHandler: GET|POST /crawl.
+func crawlHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		writeJsonError(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+		return
+	}
+	q, err := scrapeQuery(w, r)
+	if err != nil {
+		writeJsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	startURL := q.Get("url")
+	if startURL == "" {
+		writeJsonError(w, "Параметр 'url' обязателен", http.StatusBadRequest)
+		return
+	}
+	if err := checkTargetURL(startURL); err != nil {
+		writeJsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	maxDepth := defaultCrawlDepth
+	if raw := q.Get("depth"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 || n > maxCrawlDepth {
+			writeJsonError(w, fmt.Sprintf("Параметр 'depth' должен быть числом от 0 до %d", maxCrawlDepth), http.StatusBadRequest)
+			return
+		}
+		maxDepth = n
+	}
+	canonical := true
+	switch q.Get("canonical") {
+	case "", "true":
+	case "false":
+		canonical = false
+	default:
+		writeJsonError(w, "Параметр 'canonical' может принимать значения: true, false", http.StatusBadRequest)
+		return
+	}
+	run, status, err := newCrawlRun(w, r, q)
+	if err != nil {
+		writeJsonError(w, err.Error(), status)
+		return
+	}
+	s := &siteCrawl{crawlRun: run, maxDepth: maxDepth, hosts: map[string]bool{}}
+	if maxDepth > 0 && !run.base.Has("links") {
+		run.base.Set("links", "true")
+		run.base.Set("links_internal_only", "true")
+		run.hideLinks = true
+	}
+	if canonical && !run.base.Has("meta") {
+		run.base.Set("meta", "true")
+		run.hideMeta = true
+	}
+	start := s.normalize(startURL)
+	if err := run.checkOptions(start); err != nil {
+		writeJsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	u, _ := url.Parse(start)
+	s.hosts[trimWWW(u.Hostname())] = true
+	s.claim(start)
+	slog.InfoContext(r.Context(), "Обход сайта", "start", start, "depth", maxDepth, "limit", run.limit)
+
+	run.start()
+	run.summary.Pages = 1
+	level := []crawlTarget{{URL: start}}
+	for depth := 0; len(level) > 0 && !run.stopped(); depth++ {
+		var next []crawlTarget
+		run.batch(level, func(page CrawlPage, response *Response) {
+			if response != nil {
+				if canonical {
+					s.dedupe(&page, response)
+				}
+				s.expand(page, response, depth, &next)
+			}
+			run.complete(page, response)
+		})
+		level = next
+	}
+	run.finish()
+}
+
+// expand добавляет в следующий уровень ссылки страницы.
+func (s *siteCrawl) expand(page CrawlPage, response *Response, depth int, next *[]crawlTarget) {
+	base, _ := url.Parse(page.URL)
+	if response.FinalURL != "" {
+		if final, err := url.Parse(response.FinalURL); err == nil {
+			base = final
+			// Начальная страница могла переадресовать на другой хост сайта
+			// (http → https://www.): он тоже считается своим.
+			if depth == 0 {
+				s.hosts[trimWWW(final.Hostname())] = true
+			}
+		}
+	}
+	if depth >= s.maxDepth || page.DuplicateOf != "" {
+		return
+	}
+	if s.robots && response.Meta != nil && response.Meta.Robots != nil && response.Meta.Robots.NoFollow {
+		return
+	}
+	for _, link := range response.Links {
+		if s.summary.Pages >= s.limit {
+			return
+		}
+		href := link.URL
+		if href == "" {
+			href = link.Href
+		}
+		if target, ok := s.follow(base, href); ok {
+			*next = append(*next, crawlTarget{URL: target, Depth: depth + 1})
+			s.summary.Pages++
+		}
+	}
+}
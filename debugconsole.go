@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chromedp/chromedp"
+	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsutil"
+)
+
+// Отладочная консоль: WebSocket /debug/console, по которому разработчик
+// построчно управляет отдельной вкладкой постоянного браузера — с тем же
+// профилем (UA, флаги), что и боевые запросы. Включается только при
+// заданном DEBUG_TOKEN; токен передаётся в ?token= или X-Debug-Token.
+
+const debugHelp = `Команды:
+  open <url>              — открыть страницу
+  url | title             — текущий адрес / заголовок
+  count <css>             — число элементов по селектору
+  text <css>              — текст первого элемента
+  html <css>              — outerHTML первого элемента
+  attr <css> <имя>        — значение атрибута первого элемента
+  why <css>               — почему элемент не считается видимым
+  wait <css> [секунды]    — дождаться видимости (по умолчанию 10 с)
+  click <css>             — кликнуть по элементу
+  type <css> <текст>      — ввести текст в поле
+  eval <js>               — выполнить JS и вернуть результат как JSON
+  captcha                 — прогнать проверку CAPTCHA как в /scrape
+  help                    — эта справка
+  exit                    — закрыть сессию`
+
+// debugCommandTimeout ограничивает одну команду, чтобы зависший селектор
+// не держал вкладку бесконечно.
+const debugCommandTimeout = 30 * time.Second
+
+// whyNotVisibleScript собирает диагностику по элементам селектора.
+const whyNotVisibleScript = `(() => {
+	const nodes = document.querySelectorAll(%s);
+	return Array.from(nodes).slice(0, 5).map(el => {
+		const r = el.getBoundingClientRect();
+		const s = window.getComputedStyle(el);
+		return {
+			tag: el.tagName.toLowerCase(),
+			width: r.width, height: r.height, top: r.top, left: r.left,
+			display: s.display, visibility: s.visibility, opacity: s.opacity,
+			inViewport: r.bottom > 0 && r.right > 0 && r.top < innerHeight && r.left < innerWidth,
+			offsetParent: el.offsetParent !== null,
+		};
+	});
+})()`
+
+func debugTokenValid(r *http.Request) bool {
+	return requestTokenValid(r, "DEBUG_TOKEN", "X-Debug-Token")
+}
+
+// requestTokenValid сверяет токен из заголовка header или ?token= со
+// значением переменной окружения env. Пустая переменная — доступ закрыт.
+func requestTokenValid(r *http.Request, env, header string) bool {
+	expected := os.Getenv(env)
+	if expected == "" {
+		return false
+	}
+	got := r.Header.Get(header)
+	if got == "" {
+		got = r.URL.Query().Get("token")
+	}
+	return subtle.ConstantTimeCompare([]byte(got), []byte(expected)) == 1
+}
+
+// debugConsoleHandler: GET /debug/console (WebSocket).
+func debugConsoleHandler(w http.ResponseWriter, r *http.Request) {
+	if os.Getenv("DEBUG_TOKEN") == "" {
+		writeJsonError(w, "Отладочная консоль выключена (задайте DEBUG_TOKEN)", http.StatusNotFound)
+		return
+	}
+	if clusterMode == "coordinator" {
+		writeJsonError(w, "Отладочная консоль недоступна на координаторе: у него нет браузера", http.StatusNotFound)
+		return
+	}
+	if !debugTokenValid(r) {
+		writeJsonError(w, "Неверный отладочный токен", http.StatusUnauthorized)
+		return
+	}
+	conn, _, _, err := ws.UpgradeHTTP(r, w)
+	if err != nil {
+		log.Printf("ЛОГ: Отладка: не удалось открыть WebSocket: %v", err)
+		return
+	}
+	defer conn.Close()
+	log.Printf("ЛОГ: Отладка: подключилась сессия с %s.", r.RemoteAddr)
+
+	tabCtx, cancelTab := openBrowserTab()
+	defer cancelTab()
+	if err := chromedp.Run(tabCtx); err != nil {
+		wsutil.WriteServerText(conn, []byte("ошибка: не удалось открыть вкладку: "+err.Error()))
+		return
+	}
+
+	send := func(msg string) bool {
+		return wsutil.WriteServerText(conn, []byte(msg)) == nil
+	}
+	send("Отладочная консоль webextract. Введите help для списка команд.")
+	for {
+		data, err := wsutil.ReadClientText(conn)
+		if err != nil {
+			log.Printf("ЛОГ: Отладка: сессия с %s закрыта: %v", r.RemoteAddr, err)
+			return
+		}
+		line := strings.TrimSpace(string(data))
+		if line == "" {
+			continue
+		}
+		if line == "exit" || line == "quit" {
+			send("bye")
+			return
+		}
+		log.Printf("ЛОГ: Отладка: команда %q", line)
+		out, err := runDebugCommand(tabCtx, line)
+		if err != nil {
+			out = "ошибка: " + err.Error()
+		}
+		if !send(out) {
+			return
+		}
+	}
+}
+
+// runDebugCommand выполняет одну строку консоли во вкладке tabCtx.
+func runDebugCommand(tabCtx context.Context, line string) (string, error) {
+	cmd, rest, _ := strings.Cut(line, " ")
+	rest = strings.TrimSpace(rest)
+	ctx, cancel := context.WithTimeout(tabCtx, debugCommandTimeout)
+	defer cancel()
+
+	needArg := func() error {
+		if rest == "" {
+			return fmt.Errorf("команде %s нужен аргумент (см. help)", cmd)
+		}
+		return nil
+	}
+
+	switch cmd {
+	case "help":
+		return debugHelp, nil
+	case "open":
+		if err := needArg(); err != nil {
+			return "", err
+		}
+		resp, err := chromedp.RunResponse(ctx, chromedp.Navigate(rest))
+		if err != nil {
+			return "", err
+		}
+		if resp == nil {
+			return "открыто", nil
+		}
+		return fmt.Sprintf("HTTP %d %s", resp.Status, resp.URL), nil
+	case "url":
+		var loc string
+		err := chromedp.Run(ctx, chromedp.Location(&loc))
+		return loc, err
+	case "title":
+		var title string
+		err := chromedp.Run(ctx, chromedp.Title(&title))
+		return title, err
+	case "count":
+		if err := needArg(); err != nil {
+			return "", err
+		}
+		var n int
+		err := chromedp.Run(ctx, chromedp.Evaluate(fmt.Sprintf(`document.querySelectorAll(%s).length`, jsString(rest)), &n))
+		return strconv.Itoa(n), err
+	case "text":
+		if err := needArg(); err != nil {
+			return "", err
+		}
+		var text string
+		err := chromedp.Run(ctx, chromedp.Text(rest, &text, chromedp.ByQuery, chromedp.AtLeast(0)))
+		return text, err
+	case "html":
+		if err := needArg(); err != nil {
+			return "", err
+		}
+		var html string
+		err := chromedp.Run(ctx, chromedp.OuterHTML(rest, &html, chromedp.ByQuery))
+		return html, err
+	case "attr":
+		sel, name, ok := strings.Cut(rest, " ")
+		if !ok {
+			return "", fmt.Errorf("использование: attr <css> <имя>")
+		}
+		var value string
+		var found bool
+		err := chromedp.Run(ctx, chromedp.AttributeValue(sel, strings.TrimSpace(name), &value, &found, chromedp.ByQuery))
+		if err == nil && !found {
+			return "(атрибут отсутствует)", nil
+		}
+		return value, err
+	case "why":
+		if err := needArg(); err != nil {
+			return "", err
+		}
+		var diag []map[string]any
+		if err := chromedp.Run(ctx, chromedp.Evaluate(fmt.Sprintf(whyNotVisibleScript, jsString(rest)), &diag)); err != nil {
+			return "", err
+		}
+		if len(diag) == 0 {
+			return "элементов по селектору нет в DOM — WaitVisible будет ждать их появления", nil
+		}
+		out, _ := json.MarshalIndent(diag, "", "  ")
+		return string(out), nil
+	case "wait":
+		if err := needArg(); err != nil {
+			return "", err
+		}
+		sel, secs := rest, 10
+		if i := strings.LastIndexByte(rest, ' '); i > 0 {
+			if v, err := strconv.Atoi(rest[i+1:]); err == nil && v > 0 {
+				sel, secs = strings.TrimSpace(rest[:i]), v
+			}
+		}
+		waitCtx, waitCancel := context.WithTimeout(tabCtx, time.Duration(secs)*time.Second)
+		defer waitCancel()
+		start := time.Now()
+		if err := chromedp.Run(waitCtx, chromedp.WaitVisible(sel, chromedp.ByQuery)); err != nil {
+			return "", fmt.Errorf("элемент не стал видимым за %d с (%v); используйте why %s", secs, err, sel)
+		}
+		return fmt.Sprintf("виден через %v", time.Since(start).Round(time.Millisecond)), nil
+	case "click":
+		if err := needArg(); err != nil {
+			return "", err
+		}
+		return "ok", chromedp.Run(ctx, chromedp.Click(rest, chromedp.ByQuery))
+	case "type":
+		sel, text, ok := strings.Cut(rest, " ")
+		if !ok {
+			return "", fmt.Errorf("использование: type <css> <текст>")
+		}
+		return "ok", chromedp.Run(ctx, chromedp.SendKeys(sel, text, chromedp.ByQuery))
+	case "eval":
+		if err := needArg(); err != nil {
+			return "", err
+		}
+		var result any
+		if err := chromedp.Run(ctx, chromedp.Evaluate(rest, &result)); err != nil {
+			return "", err
+		}
+		out, _ := json.MarshalIndent(result, "", "  ")
+		return string(out), nil
+	case "captcha":
+		var loc string
+		if err := chromedp.Run(ctx, chromedp.Location(&loc)); err != nil {
+			return "", err
+		}
+		return "проверка завершена, см. лог сервера", chromedp.Run(tabCtx, detectAndPauseOnCaptcha(loc, "", 0))
+	default:
+		return "", fmt.Errorf("неизвестная команда %q (см. help)", cmd)
+	}
+}
+
+// jsString кодирует строку как JS-литерал.
+func jsString(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Распределённый режим через общую очередь в Redis (CLUSTER_MODE):
+//
+//	coordinator — принимает HTTP-запросы, браузер не запускает; каждый
+//	              скрапинг ставится задачей в очередь и ждёт ответа;
+//	worker      — забирает задачи из очереди и выполняет их своим браузером.
+//
+// Задачи с параметром session прилипают к воркеру, который выполнил первую
+// задачу сессии (куки и состояние вкладок живут в его браузере), пока этот
+// воркер жив. Вежливость по доменам общая для всего кластера: старт
+// скрапинга одного домена не чаще раза в DOMAIN_MIN_INTERVAL мс. Воркер
+// выполняет до WORKER_CONCURRENCY задач одновременно (по умолчанию 4).
+// CAPTCHA видят только воркеры: ожидание решения они возвращают
+// координатору кодом ошибки, и клиент получает тот же 503, что и без
+// кластера.
+//
+// Ключи Redis:
+//
+//	webextract:jobs              — общая очередь задач
+//	webextract:jobs:<воркер>     — очередь прилипших задач воркера
+//	webextract:reply:<задача>    — ответ на задачу
+//	webextract:session:<сессия>  — воркер, за которым закреплена сессия
+//	webextract:worker:<воркер>   — признак жизни воркера (TTL)
+//	webextract:domain:<хост>     — занятость домена (TTL = интервал)
+
+const (
+	clusterKeyJobs    = "webextract:jobs"
+	clusterKeyPrefix  = "webextract:"
+	workerHeartbeat   = 10 * time.Second
+	workerAliveTTL    = 30 * time.Second
+	sessionStickyTTL  = 24 * time.Hour
+	workerPollTimeout = 5 // секунд, таймаут BRPOP
+)
+
+var (
+	clusterMode       string // "", "coordinator" или "worker"
+	clusterRedis      *redisClient
+	workerID          string
+	jobTimeout        = 5 * time.Minute
+	domainMinInterval = time.Second
+	workerConcurrency = 4
+)
+
+const maxWorkerConcurrency = 64
+
+// clusterJob — задача скрапинга в очереди.
+type clusterJob struct {
+	ID        string `json:"id"`
+	Query     string `json:"query"` // Параметры /scrape в виде query-строки
+	Session   string `json:"session,omitempty"`
+	RequestID string `json:"request_id,omitempty"` // Чтобы логи воркера находились по идентификатору запроса
+}
+
+// clusterReply — ответ воркера. Для ошибок, у которых есть свой код
+// (captcha_pending, domain_rate_limited), координатор восстанавливает
+// типизированную ошибку по Code, Host и RetryAfter.
+type clusterReply struct {
+	Worker     string         `json:"worker"`
+	Response   *Response      `json:"response,omitempty"`
+	Error      string         `json:"error,omitempty"`
+	Code       string         `json:"code,omitempty"`
+	Status     int            `json:"status,omitempty"` // HTTP-статус ошибки для клиента
+	Host       string         `json:"host,omitempty"`
+	RetryAfter int            `json:"retry_after,omitempty"` // Секунд
+	RateLimit  *RateLimitInfo `json:"rate_limit,omitempty"`
+}
+
+// setError заполняет ответ по ошибке скрапинга.
+func (r *clusterReply) setError(err error) {
+	var (
+		rlErr   *rateLimitError
+		busyErr *captchaBusyError
+		thErr   *throttledError
+	)
+	switch {
+	case errors.As(err, &rlErr):
+		r.RateLimit = &rlErr.Info
+		return
+	case errors.As(err, &busyErr):
+		r.Code, r.Status, r.Host = "captcha_pending", http.StatusServiceUnavailable, busyErr.Host
+	case errors.As(err, &thErr) && thErr.Scope == "domain":
+		r.Code, r.Status, r.Host = "domain_rate_limited", http.StatusTooManyRequests, thErr.Key
+		r.RetryAfter = retryAfterSeconds(thErr.RetryAfter)
+	}
+	r.Error = err.Error()
+}
+
+// err восстанавливает ошибку воркера; nil — скрапинг удался.
+func (r *clusterReply) err() error {
+	switch {
+	case r.RateLimit != nil:
+		return &rateLimitError{Info: *r.RateLimit}
+	case r.Code == "captcha_pending":
+		return &captchaBusyError{Host: r.Host}
+	case r.Code == "domain_rate_limited":
+		return &throttledError{Scope: "domain", Key: r.Host, RetryAfter: time.Duration(r.RetryAfter) * time.Second}
+	case r.Error != "":
+		return errors.New(r.Error)
+	}
+	return nil
+}
+
+func loadClusterConfig() {
+	clusterMode = os.Getenv("CLUSTER_MODE")
+	if clusterMode == "" {
+		return
+	}
+	if clusterMode != "coordinator" && clusterMode != "worker" {
+		log.Fatalf("CLUSTER_MODE может принимать значения: coordinator, worker; получено %q", clusterMode)
+	}
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		log.Fatal("Распределённый режим требует REDIS_ADDR (host:port)")
+	}
+	clusterRedis = newRedisClient(addr, os.Getenv("REDIS_PASSWORD"))
+	if _, err := clusterRedis.Do("PING"); err != nil {
+		log.Fatalf("Не удалось подключиться к Redis %s: %v", addr, err)
+	}
+	if raw := os.Getenv("JOB_TIMEOUT"); raw != "" {
+		if v, err := strconv.Atoi(raw); err == nil && v > 0 {
+			jobTimeout = time.Duration(v) * time.Second
+		}
+	}
+	if raw := os.Getenv("DOMAIN_MIN_INTERVAL"); raw != "" {
+		if v, err := strconv.Atoi(raw); err == nil && v >= 0 {
+			domainMinInterval = time.Duration(v) * time.Millisecond
+		}
+	}
+	if raw := os.Getenv("WORKER_CONCURRENCY"); raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil || v < 1 || v > maxWorkerConcurrency {
+			log.Fatalf("WORKER_CONCURRENCY должен быть числом от 1 до %d", maxWorkerConcurrency)
+		}
+		workerConcurrency = v
+	}
+	workerID = os.Getenv("WORKER_ID")
+	if workerID == "" {
+		host, _ := os.Hostname()
+		workerID = fmt.Sprintf("%s-%d", host, os.Getpid())
+	}
+	log.Printf("ЛОГ: Распределённый режим: %s (Redis %s, воркер %s).", clusterMode, addr, workerID)
+}
+
+func newJobID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// executeScrape выполняет скрапинг своим браузером или, на координаторе,
+// через очередь кластера.
+func executeScrape(q url.Values, opts *scrapeOptions) (*Response, error) {
+	if clusterMode == "coordinator" {
+		return dispatchScrape(opts.trace, q)
+	}
+	return scrapeWithRetries(opts)
+}
+
+// dispatchScrape ставит скрапинг в очередь кластера и ждёт ответа воркера.
+func dispatchScrape(ctx context.Context, q url.Values) (*Response, error) {
+	job := clusterJob{ID: newJobID(), Query: q.Encode(), Session: q.Get("session"), RequestID: requestID(ctx)}
+	queue := clusterKeyJobs
+	if job.Session != "" {
+		if w, err := clusterRedis.String("GET", clusterKeyPrefix+"session:"+job.Session); err == nil {
+			if alive, _ := clusterRedis.Do("EXISTS", clusterKeyPrefix+"worker:"+w); alive == int64(1) {
+				queue = clusterKeyJobs + ":" + w
+			} else {
+				// Воркер сессии пропал — сессия начнётся заново на другом.
+				clusterRedis.Do("DEL", clusterKeyPrefix+"session:"+job.Session)
+			}
+		}
+	}
+	data, _ := json.Marshal(job)
+	if _, err := clusterRedis.Do("LPUSH", queue, string(data)); err != nil {
+		return nil, fmt.Errorf("не удалось поставить задачу в очередь: %w", err)
+	}
+	slog.InfoContext(ctx, "Кластер: задача поставлена в очередь", "job", job.ID, "queue", queue)
+
+	replyKey := clusterKeyPrefix + "reply:" + job.ID
+	secs := int(jobTimeout / time.Second)
+	raw, err := clusterRedis.DoTimeout(jobTimeout+10*time.Second, "BRPOP", replyKey, strconv.Itoa(secs))
+	if errors.Is(err, errRedisNil) {
+		return nil, fmt.Errorf("воркер не ответил за %v", jobTimeout)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка ожидания ответа воркера: %w", err)
+	}
+	items, ok := raw.([]any)
+	if !ok || len(items) != 2 {
+		return nil, fmt.Errorf("неожиданный ответ Redis: %v", raw)
+	}
+	var reply clusterReply
+	if err := json.Unmarshal([]byte(fmt.Sprint(items[1])), &reply); err != nil {
+		return nil, fmt.Errorf("некорректный ответ воркера: %w", err)
+	}
+	slog.InfoContext(ctx, "Кластер: задача выполнена", "job", job.ID, "worker", reply.Worker)
+	if err := reply.err(); err != nil {
+		return nil, err
+	}
+	return reply.Response, nil
+}
+
+// runWorker забирает задачи: сначала прилипшие к этому воркеру, затем
+// общие. Новая задача берётся из очереди, только когда есть свободный из
+// workerConcurrency слотов: остальные тем временем достаются другим воркерам.
+func runWorker() {
+	go func() {
+		for {
+			clusterRedis.Do("SET", clusterKeyPrefix+"worker:"+workerID, "1", "PX", strconv.FormatInt(workerAliveTTL.Milliseconds(), 10))
+			time.Sleep(workerHeartbeat)
+		}
+	}()
+	own := clusterKeyJobs + ":" + workerID
+	slots := make(chan struct{}, workerConcurrency)
+	for !shuttingDown.Load() {
+		slots <- struct{}{}
+		raw, err := clusterRedis.DoTimeout(time.Duration(workerPollTimeout+10)*time.Second, "BRPOP", own, clusterKeyJobs, strconv.Itoa(workerPollTimeout))
+		if errors.Is(err, errRedisNil) {
+			<-slots
+			continue
+		}
+		if err != nil {
+			<-slots
+			log.Printf("ЛОГ: Кластер: ошибка чтения очереди: %v", err)
+			time.Sleep(time.Second)
+			continue
+		}
+		items, ok := raw.([]any)
+		if !ok || len(items) != 2 {
+			<-slots
+			continue
+		}
+		var job clusterJob
+		if err := json.Unmarshal([]byte(fmt.Sprint(items[1])), &job); err != nil {
+			<-slots
+			log.Printf("ЛОГ: Кластер: некорректная задача: %v", err)
+			continue
+		}
+		go func() {
+			defer func() { <-slots }()
+			reply := runClusterJob(job)
+			data, _ := json.Marshal(reply)
+			replyKey := clusterKeyPrefix + "reply:" + job.ID
+			clusterRedis.Do("LPUSH", replyKey, string(data))
+			// Если координатор не дождался, ответ не должен висеть вечно.
+			clusterRedis.Do("EXPIRE", replyKey, strconv.Itoa(int(jobTimeout/time.Second)))
+		}()
+	}
+}
+
+func runClusterJob(job clusterJob) clusterReply {
+	activeScrapes.Add(1)
+	defer activeScrapes.Add(-1)
+	reply := clusterReply{Worker: workerID}
+	q, err := url.ParseQuery(job.Query)
+	if err != nil {
+		reply.Error = "некорректные параметры задачи: " + err.Error()
+		return reply
+	}
+	opts, err := parseScrapeOptions(q)
+	if err != nil {
+		reply.Error = err.Error()
+		return reply
+	}
+	if job.RequestID != "" {
+		opts.trace = context.WithValue(context.Background(), requestIDKey{}, job.RequestID)
+	}
+	if job.Session != "" {
+		clusterRedis.Do("SET", clusterKeyPrefix+"session:"+job.Session, workerID, "NX", "EX", strconv.Itoa(int(sessionStickyTTL/time.Second)))
+	}
+	if err := captchaBusy(opts.URL, opts.Session); err != nil {
+		reply.setError(err)
+		return reply
+	}
+	waitDomainSlot(opts.URL)
+	slog.InfoContext(opts.trace, "Кластер: выполняю задачу", "job", job.ID, "url", opts.URL)
+	response, err := scrapeWithRetries(opts)
+	if err != nil {
+		reply.setError(err)
+		return reply
+	}
+	reply.Response = response
+	return reply
+}
+
+// waitDomainSlot ждёт, пока домен освободится во всём кластере: занятость
+// — ключ с TTL = DOMAIN_MIN_INTERVAL, выставляемый через SET NX.
+func waitDomainSlot(rawURL string) {
+	if domainMinInterval == 0 {
+		return
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Hostname() == "" {
+		return
+	}
+	key := clusterKeyPrefix + "domain:" + strings.ToLower(trimWWW(u.Hostname()))
+	ttl := strconv.FormatInt(domainMinInterval.Milliseconds(), 10)
+	deadline := time.Now().Add(jobTimeout)
+	for time.Now().Before(deadline) {
+		_, err := clusterRedis.Do("SET", key, workerID, "NX", "PX", ttl)
+		if err == nil {
+			return
+		}
+		if !errors.Is(err, errRedisNil) {
+			log.Printf("ЛОГ: Кластер: не удалось занять домен: %v", err)
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
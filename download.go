@@ -0,0 +1,278 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/chromedp"
+)
+
+// Скачивание файлов через браузер: GET|POST /download?url=<файл>
+// &referer=<страница>&session=<имя>&proxy=<адрес>&store=true. Файл (PDF,
+// картинка, CSV и т. п.) загружается через Network.loadNetworkResource —
+// с куками вкладки или сессии и через её прокси, поэтому доступны файлы
+// за входом и за антибот-проверкой, пройденной при скрапинге. referer
+// открывается перед загрузкой: он ставит куки и делает запрос
+// «своим» для кук SameSite. Ответ — сам файл с типом содержимого и
+// именем из Content-Disposition; store=true сохраняет файл артефактом и
+// возвращает ссылку на него (нужен STORAGE_DIR). Каждый запрос вкладки,
+// включая шаги редиректов файла и страницы, проходит проверку адресов
+// (interceptRequests).
+
+const (
+	maxDownloadSize        = 50 << 20
+	defaultDownloadTimeout = 60 * time.Second
+)
+
+// DownloadResult — ответ /download со store=true.
+type DownloadResult struct {
+	URL      string `json:"url"`
+	Filename string `json:"filename"`
+	ArtifactRef
+}
+
+// downloadFilename — имя файла из Content-Disposition или из пути адреса.
+func downloadFilename(headers network.Headers, rawURL string) string {
+	name := ""
+	if _, params, err := mime.ParseMediaType(headerValue(headers, "Content-Disposition")); err == nil {
+		name = params["filename"] // В том числе filename* (RFC 5987)
+	}
+	if name == "" {
+		if u, err := url.Parse(rawURL); err == nil {
+			name, _ = url.PathUnescape(path.Base(u.Path))
+		}
+	}
+	name = path.Base(strings.ReplaceAll(name, `\`, "/"))
+	if name == "" || name == "." || name == "/" {
+		return "download"
+	}
+	return name
+}
+
+// downloadContentType — тип содержимого из ответа, по расширению имени
+// или по самим данным.
+func downloadContentType(headers network.Headers, filename string, data []byte) string {
+	if contentType := headerValue(headers, "Content-Type"); contentType != "" {
+		return contentType
+	}
+	if contentType := mime.TypeByExtension(path.Ext(filename)); contentType != "" {
+		return contentType
+	}
+	return http.DetectContentType(data)
+}
+
+// downloadExt — расширение артефакта: из имени файла, если оно известно,
+// иначе по типу содержимого.
+func downloadExt(filename, contentType string) string {
+	if ext := strings.ToLower(path.Ext(filename)); ext != "" && mime.TypeByExtension(ext) != "" {
+		return ext
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if exts, _ := mime.ExtensionsByType(mediaType); len(exts) > 0 {
+		// Список отсортирован: для image/jpeg первым идёт .jfif.
+		if _, subtype, _ := strings.Cut(mediaType, "/"); slices.Contains(exts, "."+subtype) {
+			return "." + subtype
+		}
+		return exts[0]
+	}
+	return ".bin"
+}
+
+// downloadHandler: GET|POST /download.
+func downloadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		writeJsonError(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+		return
+	}
+	if clusterMode == "coordinator" {
+		writeJsonError(w, "Скачивание недоступно на координаторе: у него нет браузера", http.StatusNotFound)
+		return
+	}
+	q, err := scrapeQuery(w, r)
+	if err != nil {
+		writeJsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	fileURL, referer, session := q.Get("url"), q.Get("referer"), q.Get("session")
+	if fileURL == "" {
+		writeJsonError(w, "Параметр 'url' обязателен", http.StatusBadRequest)
+		return
+	}
+	for _, target := range []string{fileURL, referer} {
+		if target == "" {
+			continue
+		}
+		if err := checkTargetURL(target); err != nil {
+			writeJsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if session != "" && !validSessionName.MatchString(session) {
+		writeJsonError(w, "Параметр 'session' может содержать латиницу, цифры, _ . - (до 64 символов)", http.StatusBadRequest)
+		return
+	}
+	var proxy *proxyConfig
+	if raw := q.Get("proxy"); raw != "" {
+		if session != "" {
+			writeJsonError(w, "Параметры 'session' и 'proxy' нельзя указывать вместе", http.StatusBadRequest)
+			return
+		}
+		if proxy, err = parseRequestProxy(raw); err != nil {
+			writeJsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	store := false
+	switch q.Get("store") {
+	case "", "false":
+	case "true":
+		store = true
+	default:
+		writeJsonError(w, "Параметр 'store' может принимать значения: true, false", http.StatusBadRequest)
+		return
+	}
+	if store && resultStore == nil {
+		writeJsonError(w, "Параметр 'store' требует включённого хранилища (STORAGE_DIR)", http.StatusBadRequest)
+		return
+	}
+	timeout := defaultDownloadTimeout
+	if raw := q.Get("timeout"); raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil || v < 1 || v > 300 {
+			writeJsonError(w, "Параметр 'timeout' должен быть числом от 1 до 300", http.StatusBadRequest)
+			return
+		}
+		timeout = time.Duration(v) * time.Second
+	}
+	// Скачивание обращается к сайту так же, как скрапинг: те же пауза по
+	// CAPTCHA и лимит домена, и прогрев с остановкой его тоже ждут.
+	activeScrapes.Add(1)
+	defer activeScrapes.Add(-1)
+	if err := checkScrapeScope(fileURL, session); err != nil {
+		var thErr *throttledError
+		if errors.As(err, &thErr) {
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds(thErr.RetryAfter)))
+			writeErrorResponse(w, ErrorResponse{Error: "Не удалось скачать файл: " + err.Error(), Code: "domain_rate_limited"}, http.StatusTooManyRequests)
+			return
+		}
+		writeJsonError(w, "Не удалось скачать файл: "+err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	var (
+		tabCtx    context.Context
+		cancelTab context.CancelFunc
+		pooled    *poolProxy
+	)
+	if session != "" {
+		if tabCtx, cancelTab, proxy, err = sessionTab(r.Context(), session, clusterMode == "worker"); err != nil {
+			writeJsonError(w, err.Error(), http.StatusNotFound)
+			return
+		}
+	} else {
+		if proxy == nil && proxyPool != nil {
+			pooled = proxyPool.Pick(fileURL)
+			proxy = pooled.cfg
+		}
+		tabCtx, cancelTab = newScrapeTab(r.Context(), proxy, false)
+	}
+	defer cancelTab()
+	tabCtx, cancelCrashWatch := watchTabCrash(tabCtx)
+	defer cancelCrashWatch()
+	tabCtx, cancelTimeout := context.WithTimeout(tabCtx, timeout)
+	defer cancelTimeout()
+	if proxy == nil {
+		proxy = globalProxy
+	}
+
+	slog.InfoContext(r.Context(), "Скачиваю файл", "url", fileURL, "session", session, "referer", referer)
+	var (
+		data    []byte
+		headers network.Headers
+	)
+	err = chromedp.Run(tabCtx,
+		proxyAuth(proxy),
+		chromedp.ActionFunc(func(ctx context.Context) error {
+			if referer == "" {
+				return nil
+			}
+			navResp, err := navigateRespectingRetryAfter(ctx, referer)
+			if pooled != nil {
+				var status int64
+				if navResp != nil {
+					status = navResp.Status
+				}
+				proxyPool.Report(pooled, err, status)
+			}
+			if err != nil {
+				return err
+			}
+			// Редиректы страницы уже проверил interceptRequests; итоговый
+			// адрес проверяется ещё раз перед загрузкой файла с её куками.
+			var final string
+			if err := chromedp.Location(&final).Do(ctx); err != nil {
+				return err
+			}
+			return checkTargetURL(final)
+		}),
+		chromedp.ActionFunc(func(ctx context.Context) error {
+			var err error
+			data, headers, err = loadResourceHeaders(ctx, fileURL, maxDownloadSize)
+			return err
+		}),
+	)
+	if err != nil {
+		err = tabError(tabCtx, err)
+		slog.WarnContext(r.Context(), "Не удалось скачать файл", "url", fileURL, "error", err)
+		status := http.StatusBadGateway
+		if errors.Is(err, context.DeadlineExceeded) {
+			status = http.StatusGatewayTimeout
+		}
+		writeJsonError(w, "Не удалось скачать файл: "+err.Error(), status)
+		return
+	}
+	filename := downloadFilename(headers, fileURL)
+	contentType := downloadContentType(headers, filename, data)
+	slog.InfoContext(r.Context(), "Файл скачан", "url", fileURL, "filename", filename, "bytes", len(data), "content_type", contentType)
+
+	if store {
+		id, err := resultStore.SaveArtifact(data, downloadExt(filename, contentType))
+		if err != nil {
+			writeJsonError(w, fmt.Sprintf("Не удалось сохранить файл: %v", err), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(w).Encode(DownloadResult{
+			URL:      fileURL,
+			Filename: filename,
+			ArtifactRef: ArtifactRef{
+				Artifact:    requestBaseURL(r) + "/artifacts/" + id,
+				Size:        len(data),
+				SHA256:      id,
+				ContentType: contentType,
+			},
+		})
+		return
+	}
+	disposition := mime.FormatMediaType("attachment", map[string]string{"filename": filename})
+	if disposition == "" {
+		disposition = "attachment"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", disposition)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Write(data)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+// Duplicate — страница из хранилища, близкая к искомой по SimHash.
+type Duplicate struct {
+	URL       string `json:"url"`
+	VersionID string `json:"version_id"`
+	Simhash   string `json:"simhash"`
+	Distance  int    `json:"distance"`
+}
+
+// DuplicatesResponse — ответ /duplicates.
+type DuplicatesResponse struct {
+	URL        string      `json:"url"`
+	Simhash    string      `json:"simhash"`
+	Threshold  int         `json:"threshold"`
+	Duplicates []Duplicate `json:"duplicates"`
+}
+
+// defaultSimhashThreshold — расстояние Хэмминга, до которого страницы
+// считаются почти одинаковыми (3 бита из 64 — типичное значение).
+const defaultSimhashThreshold = 3
+
+// duplicatesHandler: GET /duplicates?url=&threshold= — ищет среди последних
+// версий сохранённых страниц те, что почти совпадают с последней версией url.
+func duplicatesHandler(w http.ResponseWriter, r *http.Request) {
+	if resultStore == nil {
+		writeJsonError(w, "Хранилище результатов выключено (задайте STORAGE_DIR)", http.StatusNotFound)
+		return
+	}
+	url := r.URL.Query().Get("url")
+	if url == "" {
+		writeJsonError(w, "Параметр 'url' обязателен", http.StatusBadRequest)
+		return
+	}
+	threshold := defaultSimhashThreshold
+	if raw := r.URL.Query().Get("threshold"); raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil || v < 0 || v > 64 {
+			writeJsonError(w, "Параметр 'threshold' должен быть числом от 0 до 64", http.StatusBadRequest)
+			return
+		}
+		threshold = v
+	}
+
+	latest, err := resultStore.LatestAll()
+	if err != nil {
+		log.Printf("ЛОГ: Ошибка чтения хранилища: %v", err)
+		writeJsonError(w, "Не удалось прочитать хранилище: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var target *StoredResult
+	for _, rec := range latest {
+		if rec.URL == url {
+			target = rec
+			break
+		}
+	}
+	if target == nil || target.Response.Simhash == "" {
+		writeJsonError(w, "Для этого url нет сохранённых результатов с simhash", http.StatusNotFound)
+		return
+	}
+	targetSig, err := strconv.ParseUint(target.Response.Simhash, 16, 64)
+	if err != nil {
+		writeJsonError(w, "Некорректный simhash в хранилище", http.StatusInternalServerError)
+		return
+	}
+
+	result := DuplicatesResponse{URL: url, Simhash: target.Response.Simhash, Threshold: threshold, Duplicates: []Duplicate{}}
+	for _, rec := range latest {
+		if rec.URL == url || rec.Response.Simhash == "" {
+			continue
+		}
+		sig, err := strconv.ParseUint(rec.Response.Simhash, 16, 64)
+		if err != nil {
+			continue
+		}
+		if d := hammingDistance(targetSig, sig); d <= threshold {
+			result.Duplicates = append(result.Duplicates, Duplicate{
+				URL:       rec.URL,
+				VersionID: rec.ID,
+				Simhash:   rec.Response.Simhash,
+				Distance:  d,
+			})
+		}
+	}
+	sort.Slice(result.Duplicates, func(i, j int) bool { return result.Duplicates[i].Distance < result.Duplicates[j].Distance })
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(result)
+}
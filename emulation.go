@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	_ "time/tzdata" // Часовые пояса для timezone= и в образах без /usr/share/zoneinfo
+
+	"github.com/chromedp/cdproto/browser"
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/emulation"
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/chromedp"
+)
+
+// validMediaTypes — поддерживаемые значения параметра media.
+var validMediaTypes = map[string]bool{"print": true, "screen": true}
+
+// validColorSchemes — поддерживаемые значения параметра color_scheme.
+var validColorSchemes = map[string]bool{"dark": true, "light": true}
+
+// emulateMedia включает эмуляцию CSS media type (print/screen) и
+// prefers-color-scheme для вкладки. Оба параметра задаются одним вызовом
+// Emulation.setEmulatedMedia: повторный вызов сбросил бы предыдущую настройку.
+// Настройка действует на все последующие навигации в этой вкладке.
+func emulateMedia(media, colorScheme string) chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		params := emulation.SetEmulatedMedia()
+		if media != "" {
+			log.Printf("ЛОГ: Включаю эмуляцию CSS media: %s.", media)
+			params = params.WithMedia(media)
+		}
+		if colorScheme != "" {
+			log.Printf("ЛОГ: Включаю эмуляцию prefers-color-scheme: %s.", colorScheme)
+			params = params.WithFeatures([]*emulation.MediaFeature{
+				{Name: "prefers-color-scheme", Value: colorScheme},
+			})
+		}
+		return params.Do(ctx)
+	})
+}
+
+// networkProfile — параметры Network.emulateNetworkConditions.
+// Пропускная способность в байтах в секунду, задержка в миллисекундах.
+type networkProfile struct {
+	Offline  bool
+	Latency  float64
+	Download float64
+	Upload   float64
+}
+
+// networkProfiles повторяют пресеты DevTools, чтобы результаты совпадали
+// с тем, что видит разработчик во вкладке Network.
+var networkProfiles = map[string]networkProfile{
+	"slow3g":  {Latency: 2000, Download: 500 * 1000 / 8 * 0.8, Upload: 500 * 1000 / 8 * 0.8},
+	"fast3g":  {Latency: 562.5, Download: 1.6 * 1000 * 1000 / 8 * 0.9, Upload: 750 * 1000 / 8 * 0.9},
+	"offline": {Offline: true},
+}
+
+// emulateNetwork включает троттлинг сети по имени профиля.
+func emulateNetwork(name string) chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		p := networkProfiles[name]
+		log.Printf("ЛОГ: Включаю троттлинг сети: %s.", name)
+		return network.EmulateNetworkConditions(p.Offline, p.Latency, p.Download, p.Upload).Do(ctx)
+	})
+}
+
+// emulateCPU замедляет CPU вкладки в rate раз (1 — без замедления).
+func emulateCPU(rate float64) chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		log.Printf("ЛОГ: Включаю замедление CPU: %gx.", rate)
+		return emulation.SetCPUThrottlingRate(rate).Do(ctx)
+	})
+}
+
+// geoPoint — координаты для Emulation.setGeolocationOverride.
+type geoPoint struct {
+	Latitude, Longitude, Accuracy float64
+}
+
+var localePattern = regexp.MustCompile(`^[a-zA-Z]{2,3}(-[a-zA-Z0-9]{2,8})*$`)
+
+// parseGeolocation разбирает "широта,долгота[,точность в метрах]".
+func parseGeolocation(raw string) (*geoPoint, error) {
+	errInvalid := errors.New("Параметр 'geolocation' должен иметь вид широта,долгота[,точность в метрах]")
+	parts := strings.Split(raw, ",")
+	if len(parts) < 2 || len(parts) > 3 {
+		return nil, errInvalid
+	}
+	values := make([]float64, len(parts))
+	for i, p := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return nil, errInvalid
+		}
+		values[i] = v
+	}
+	g := &geoPoint{Latitude: values[0], Longitude: values[1], Accuracy: 50}
+	if len(values) == 3 {
+		g.Accuracy = values[2]
+	}
+	if g.Latitude < -90 || g.Latitude > 90 || g.Longitude < -180 || g.Longitude > 180 || g.Accuracy <= 0 {
+		return nil, errInvalid
+	}
+	return g, nil
+}
+
+// acceptLanguageFor строит Accept-Language для локали: de-DE → "de-DE,de;q=0.9".
+func acceptLanguageFor(locale string) string {
+	if lang, _, ok := strings.Cut(locale, "-"); ok {
+		return locale + "," + lang + ";q=0.9"
+	}
+	return locale
+}
+
+// emulateGeolocation подменяет координаты и выдаёт странице разрешение на
+// геолокацию, иначе navigator.geolocation спросил бы пользователя.
+func emulateGeolocation(g *geoPoint, pageURL string) chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		log.Printf("ЛОГ: Включаю эмуляцию геолокации: %g, %g.", g.Latitude, g.Longitude)
+		if u, err := url.Parse(pageURL); err == nil {
+			grant := browser.GrantPermissions([]browser.PermissionType{browser.PermissionTypeGeolocation}).
+				WithOrigin(u.Scheme + "://" + u.Host)
+			if c := chromedp.FromContext(ctx); c != nil && c.BrowserContextID != "" {
+				grant = grant.WithBrowserContextID(c.BrowserContextID)
+			}
+			if err := grant.Do(cdp.WithExecutor(ctx, chromedp.FromContext(ctx).Browser)); err != nil {
+				log.Printf("ЛОГ: Не удалось выдать разрешение на геолокацию: %v", err)
+			}
+		}
+		return emulation.SetGeolocationOverride().
+			WithLatitude(g.Latitude).
+			WithLongitude(g.Longitude).
+			WithAccuracy(g.Accuracy).
+			Do(ctx)
+	})
+}
+
+// emulateLocale меняет локаль Intl/ICU и часовой пояс вкладки. navigator.language
+// и Accept-Language задаются вместе с User-Agent (applyProfile,
+// overrideHeaders); если UA не переопределяется, override ставится здесь
+// со стандартным UA сервиса.
+func emulateLocale(locale, timezone string, overrideUA bool) chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		if locale != "" {
+			log.Printf("ЛОГ: Включаю эмуляцию локали: %s.", locale)
+			if err := emulation.SetLocaleOverride().WithLocale(strings.ReplaceAll(locale, "-", "_")).Do(ctx); err != nil {
+				return err
+			}
+			if overrideUA {
+				p := desktopProfiles[0]
+				err := emulation.SetUserAgentOverride(p.UserAgent).
+					WithPlatform(p.Platform).
+					WithUserAgentMetadata(userAgentMetadata(p)).
+					WithAcceptLanguage(acceptLanguageFor(locale)).
+					Do(ctx)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		if timezone != "" {
+			log.Printf("ЛОГ: Включаю эмуляцию часового пояса: %s.", timezone)
+			return emulation.SetTimezoneOverride(timezone).Do(ctx)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/chromedp/cdproto/runtime"
+	"github.com/chromedp/chromedp"
+)
+
+// eval — выполнение JavaScript клиента в контексте страницы для логики
+// извлечения, которой нет среди встроенных режимов. Это произвольный код
+// в браузере сервиса, поэтому возможность выключена, пока не задан
+// EVAL_TOKEN, и принимается только в теле POST /scrape с заголовком
+// X-Eval-Token:
+//
+//	{"url": "...", "eval": "Array.from(document.querySelectorAll('.sku'), e => e.dataset.id)"}
+//
+// eval — выражение; если оно возвращает Promise, ждём его. Результат
+// отдаётся в поле eval как JSON, исключение — текстом в eval_error.
+
+// checkEvalParam проверяет, можно ли выполнить eval из этого запроса.
+// Возвращает HTTP-статус и ошибку для клиента.
+func checkEvalParam(r *http.Request, q url.Values) (int, error) {
+	if !q.Has("eval") {
+		return 0, nil
+	}
+	if os.Getenv("EVAL_TOKEN") == "" {
+		return http.StatusForbidden, errors.New("Выполнение JavaScript выключено (задайте EVAL_TOKEN)")
+	}
+	if r.Method != http.MethodPost || r.URL.Path != "/scrape" || r.URL.Query().Has("eval") {
+		return http.StatusBadRequest, errors.New("Параметр 'eval' принимается только в теле POST /scrape")
+	}
+	if !requestTokenValid(r, "EVAL_TOKEN", "X-Eval-Token") {
+		return http.StatusUnauthorized, errors.New("Неверный EVAL_TOKEN")
+	}
+	return 0, nil
+}
+
+// evaluateUserScript выполняет выражение клиента. Исключение в скрипте —
+// не ошибка скрапинга: остальные данные страницы всё равно отдаются.
+func evaluateUserScript(expr string, result *[]byte, errText *string) chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		slog.InfoContext(ctx, "Шаг [1.5]: выполняю JavaScript клиента")
+		err := chromedp.Evaluate(expr, result, func(p *runtime.EvaluateParams) *runtime.EvaluateParams {
+			return p.WithAwaitPromise(true)
+		}).Do(ctx)
+		var exc *runtime.ExceptionDetails
+		if errors.As(err, &exc) {
+			*errText = exc.Error()
+			if exc.Exception != nil && exc.Exception.Description != "" {
+				*errText = exc.Exception.Description
+			}
+			return nil
+		}
+		return err
+	})
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/chromedp/chromedp"
+)
+
+// startTestBrowser запускает headless-браузер для тестов обработчиков;
+// без установленного Chrome тест пропускается.
+func startTestBrowser(t *testing.T) {
+	t.Helper()
+	var path string
+	for _, name := range []string{"headless-shell", "chromium", "chromium-browser", "google-chrome", "google-chrome-stable"} {
+		if p, err := exec.LookPath(name); err == nil {
+			path = p
+			break
+		}
+	}
+	if path == "" {
+		t.Skip("Chrome не найден")
+	}
+	opts := append(chromedp.DefaultExecAllocatorOptions[:], chromedp.ExecPath(path), chromedp.NoSandbox)
+	if err := startBrowsers(opts); err != nil {
+		t.Fatalf("startBrowsers: %v", err)
+	}
+	t.Cleanup(closeBrowsers)
+}
+
+// allowTestServer разрешает скрапинг локального httptest-сервера.
+func allowTestServer(t *testing.T) {
+	t.Helper()
+	t.Cleanup(loadTargetPolicy) // После восстановления окружения
+	t.Setenv("ALLOW_PRIVATE_NETWORKS", "true")
+	loadTargetPolicy()
+}
+
+func TestParseScrapeOptionsEval(t *testing.T) {
+	allowTestServer(t)
+	q := map[string][]string{"url": {"http://127.0.0.1/"}, "eval": {"document.title"}}
+	opts, err := parseScrapeOptions(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.Eval != "document.title" {
+		t.Fatalf("Eval = %q, want %q", opts.Eval, "document.title")
+	}
+}
+
+func TestScrapeHandlerEval(t *testing.T) {
+	allowTestServer(t)
+	t.Setenv("EVAL_TOKEN", "secret")
+	startTestBrowser(t)
+
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte("<html><head><title>Eval</title></head><body><p>ok</p></body></html>"))
+	}))
+	defer site.Close()
+
+	body := `{"url": "` + site.URL + `", "eval": "document.title + ':' + (20 + 22)"}`
+	req := httptest.NewRequest(http.MethodPost, "/scrape", strings.NewReader(body))
+	req.Header.Set("X-Eval-Token", "secret")
+	rec := httptest.NewRecorder()
+	scrapeHandler(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+	var resp struct {
+		Eval      json.RawMessage `json:"eval"`
+		EvalError string          `json:"eval_error"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.EvalError != "" {
+		t.Fatalf("eval_error = %q", resp.EvalError)
+	}
+	if got := string(resp.Eval); got != `"Eval:42"` {
+		t.Fatalf("eval = %s, want %q", got, "Eval:42")
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+)
+
+// exportFilter — условия отбора версий для выгрузки.
+type exportFilter struct {
+	domain   string
+	from, to time.Time
+}
+
+func (f exportFilter) match(rec *StoredResult) bool {
+	if f.domain != "" && !hostMatchesDomain(rec.URL, f.domain) {
+		return false
+	}
+	if !f.from.IsZero() && rec.ScrapedAt.Before(f.from) {
+		return false
+	}
+	if !f.to.IsZero() && !rec.ScrapedAt.Before(f.to) {
+		return false
+	}
+	return true
+}
+
+// exportCSVHeader — колонки CSV-выгрузки.
+var exportCSVHeader = []string{"id", "url", "scraped_at", "hash", "content_hash", "title", "description", "keywords", "content"}
+
+func exportCSVRow(rec *StoredResult) []string {
+	var title, description, keywords string
+	if rec.Response.Meta != nil {
+		title, description, keywords = rec.Response.Meta.Title, rec.Response.Meta.Description, rec.Response.Meta.Keywords
+	}
+	return []string{
+		rec.ID, rec.URL, rec.ScrapedAt.Format(time.RFC3339Nano), rec.Hash,
+		rec.Response.ContentHash, title, description, keywords, rec.Response.Content,
+	}
+}
+
+// exportHandler: GET /export?domain=&from=&to=&format=ndjson|csv — потоковая
+// выгрузка сохранённых версий, подходящих под фильтр. Поддерживаются только
+// ndjson (по умолчанию, версия целиком) и csv (колонки exportCSVHeader).
+// Parquet не поддерживается: формат колоночный и не пишется потоком по
+// записи, а своей библиотеки для него в сборке нет — на format=parquet
+// отвечаем 400.
+func exportHandler(w http.ResponseWriter, r *http.Request) {
+	if resultStore == nil {
+		writeJsonError(w, "Хранилище результатов выключено (задайте STORAGE_DIR)", http.StatusNotFound)
+		return
+	}
+	filter := exportFilter{domain: r.URL.Query().Get("domain")}
+	var err error
+	if raw := r.URL.Query().Get("from"); raw != "" {
+		if filter.from, err = parseDateParam(raw); err != nil {
+			writeJsonError(w, "Параметр 'from' должен быть датой (YYYY-MM-DD или RFC3339)", http.StatusBadRequest)
+			return
+		}
+	}
+	if raw := r.URL.Query().Get("to"); raw != "" {
+		if filter.to, err = parseDateParam(raw); err != nil {
+			writeJsonError(w, "Параметр 'to' должен быть датой (YYYY-MM-DD или RFC3339)", http.StatusBadRequest)
+			return
+		}
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "ndjson"
+	}
+
+	flusher, _ := w.(http.Flusher)
+	count := 0
+	switch format {
+	case "ndjson":
+		w.Header().Set("Content-Type", "application/x-ndjson; charset=utf-8")
+		enc := json.NewEncoder(w)
+		err = resultStore.Walk(func(rec *StoredResult) error {
+			if !filter.match(rec) {
+				return nil
+			}
+			count++
+			if err := enc.Encode(rec); err != nil {
+				return err
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+			return nil
+		})
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="export.csv"`)
+		cw := csv.NewWriter(w)
+		if err = cw.Write(exportCSVHeader); err != nil {
+			break
+		}
+		err = resultStore.Walk(func(rec *StoredResult) error {
+			if !filter.match(rec) {
+				return nil
+			}
+			count++
+			if err := cw.Write(exportCSVRow(rec)); err != nil {
+				return err
+			}
+			cw.Flush()
+			if flusher != nil {
+				flusher.Flush()
+			}
+			return cw.Error()
+		})
+		cw.Flush()
+	case "parquet":
+		writeJsonError(w, "Формат parquet не поддерживается: выгрузите ndjson или csv и преобразуйте на своей стороне", http.StatusBadRequest)
+		return
+	default:
+		writeJsonError(w, "Параметр 'format' может принимать значения: ndjson, csv", http.StatusBadRequest)
+		return
+	}
+	// Заголовки уже отправлены, поэтому ошибку посреди потока можем только залогировать.
+	if err != nil {
+		log.Printf("ЛОГ: Выгрузка прервана после %d записей: %v", count, err)
+		return
+	}
+	log.Printf("ЛОГ: Выгрузка завершена, записей: %d.", count)
+}
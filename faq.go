@@ -0,0 +1,116 @@
+package main
+
+// FAQItem — пара вопрос/ответ.
+type FAQItem struct {
+	Question string `json:"question"`
+	Answer   string `json:"answer"`
+	Source   string `json:"source"` // jsonld, microdata или markup
+}
+
+// HowToStep — шаг инструкции.
+type HowToStep struct {
+	Name string `json:"name,omitempty"`
+	Text string `json:"text"`
+}
+
+// HowTo — инструкция из разметки schema.org/HowTo.
+type HowTo struct {
+	Name  string      `json:"name"`
+	Steps []HowToStep `json:"steps"`
+}
+
+// faqResult — результат faqScript.
+type faqResult struct {
+	FAQ   []FAQItem `json:"faq"`
+	HowTo []HowTo   `json:"howto"`
+}
+
+// faqScript извлекает FAQ и HowTo из трёх источников по убыванию надёжности:
+// JSON-LD, microdata schema.org и типовая разметка аккордеонов
+// (details/summary, dl внутри FAQ-блоков, кнопки с aria-controls).
+// Вопросы из разметки добавляются, только если структурированных данных нет.
+const faqScript = `(() => {
+	const clean = s => (s || '').replace(/\s+/g, ' ').trim();
+	const stripHTML = s => { const d = document.createElement('div'); d.innerHTML = s || ''; return clean(d.textContent); };
+	const asArray = v => v == null ? [] : (Array.isArray(v) ? v : [v]);
+	const hasType = (o, t) => asArray(o && o['@type']).some(x => String(x).toLowerCase() === t);
+	const faq = [], howto = [];
+
+	const walk = node => {
+		if (!node || typeof node !== 'object') return;
+		if (Array.isArray(node)) { node.forEach(walk); return; }
+		if (hasType(node, 'faqpage')) {
+			for (const q of asArray(node.mainEntity)) {
+				const a = asArray(q.acceptedAnswer)[0] || asArray(q.suggestedAnswer)[0] || {};
+				if (q.name) faq.push({question: stripHTML(q.name), answer: stripHTML(a.text), source: 'jsonld'});
+			}
+		}
+		if (hasType(node, 'howto')) {
+			const steps = [];
+			const addSteps = list => {
+				for (const s of asArray(list)) {
+					if (typeof s === 'string') { steps.push({text: stripHTML(s)}); continue; }
+					if (hasType(s, 'howtosection')) { addSteps(s.itemListElement || s.steps); continue; }
+					steps.push({name: stripHTML(s.name), text: stripHTML(s.text || s.name)});
+				}
+			};
+			addSteps(node.step || node.steps);
+			howto.push({name: stripHTML(node.name), steps});
+		}
+		if (node['@graph']) walk(node['@graph']);
+		for (const key of ['mainEntity', 'mainEntityOfPage', 'hasPart']) {
+			if (node[key] && typeof node[key] === 'object' && !hasType(node, 'faqpage')) walk(node[key]);
+		}
+	};
+	for (const s of document.querySelectorAll('script[type="application/ld+json"]')) {
+		try { walk(JSON.parse(s.textContent)); } catch (e) {}
+	}
+
+	if (faq.length === 0) {
+		for (const q of document.querySelectorAll('[itemtype*="schema.org/Question"]')) {
+			const name = q.querySelector('[itemprop="name"]');
+			const answer = q.querySelector('[itemprop="acceptedAnswer"] [itemprop="text"], [itemprop="acceptedAnswer"]');
+			if (name) faq.push({question: clean(name.textContent), answer: clean(answer && answer.textContent), source: 'microdata'});
+		}
+	}
+	if (howto.length === 0) {
+		for (const h of document.querySelectorAll('[itemtype*="schema.org/HowTo"]:not([itemtype*="HowToStep"]):not([itemtype*="HowToSection"])')) {
+			const name = h.querySelector('[itemprop="name"]');
+			const steps = Array.from(h.querySelectorAll('[itemprop="step"]')).map(s => {
+				const t = s.querySelector('[itemprop="text"]');
+				return {text: clean((t || s).textContent)};
+			});
+			howto.push({name: clean(name && name.textContent), steps});
+		}
+	}
+
+	if (faq.length === 0) {
+		const seen = new Set();
+		const add = (q, a) => {
+			q = clean(q); a = clean(a);
+			if (!q || !a || seen.has(q)) return;
+			seen.add(q);
+			faq.push({question: q, answer: a, source: 'markup'});
+		};
+		for (const d of document.querySelectorAll('details')) {
+			const s = d.querySelector('summary');
+			if (!s) continue;
+			const full = clean(d.textContent), q = clean(s.textContent);
+			add(q, full.slice(q.length));
+		}
+		const faqBlocks = '[class*="faq" i], [id*="faq" i], [class*="accordion" i], [class*="vopros" i]';
+		for (const dl of document.querySelectorAll('dl')) {
+			if (!dl.closest(faqBlocks)) continue;
+			for (const dt of dl.querySelectorAll('dt')) {
+				const dd = dt.nextElementSibling;
+				if (dd && dd.tagName === 'DD') add(dt.textContent, dd.textContent);
+			}
+		}
+		for (const b of document.querySelectorAll('[aria-controls]')) {
+			if (!b.closest(faqBlocks)) continue;
+			const panel = document.getElementById(b.getAttribute('aria-controls'));
+			if (panel) add(b.textContent, panel.textContent);
+		}
+	}
+	return {faq, howto};
+})()`
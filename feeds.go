@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"html"
+	stdio "io"
+	"log/slog"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/chromedp/chromedp"
+)
+
+// RSS/Atom-ленты страницы. feeds=true находит объявленные ленты
+// (<link rel="alternate" type="application/rss+xml"> и родственные),
+// feeds=items дополнительно загружает их и приводит записи к общему виду:
+// заголовок, ссылка, дата, краткое содержание. Поддерживаются RSS 2.0,
+// RSS 1.0 (RDF), Atom и JSON Feed. Ленты загружаются через
+// loadResource (icons.go) — от имени страницы, без ограничений CORS.
+
+var validFeedModes = map[string]bool{"true": true, "items": true}
+
+const (
+	maxFeedsFetched = 5
+	maxFeedItems    = 50
+	maxFeedSize     = 5 << 20
+	maxFeedSummary  = 500
+)
+
+// Feed — лента, объявленная на странице.
+type Feed struct {
+	URL   string     `json:"url"`
+	Type  string     `json:"type"` // rss, atom или json
+	Title string     `json:"title,omitempty"`
+	Items []FeedItem `json:"items,omitempty"` // feeds=items
+	Error string     `json:"error,omitempty"` // Ленту не удалось загрузить или разобрать
+}
+
+// FeedItem — запись ленты.
+type FeedItem struct {
+	Title   string     `json:"title,omitempty"`
+	Link    string     `json:"link,omitempty"`
+	Date    *time.Time `json:"date,omitempty"`
+	Summary string     `json:"summary,omitempty"` // Текст без разметки, до maxFeedSummary символов
+}
+
+// feedsScript находит объявленные ленты.
+const feedsScript = `(() => {
+	const types = {'application/rss+xml': 'rss', 'application/rdf+xml': 'rss', 'application/atom+xml': 'atom',
+		'application/feed+json': 'json'};
+	const out = [], seen = new Set();
+	for (const el of document.querySelectorAll('link[rel~="alternate" i][type][href]')) {
+		const type = types[el.getAttribute('type').trim().toLowerCase()];
+		// application/json в alternate не учитывается: это обычно REST API (WordPress), а не лента.
+		if (!type || seen.has(el.href)) continue;
+		seen.add(el.href);
+		out.push({url: el.href, type, title: (el.getAttribute('title') || '').trim()});
+	}
+	return out;
+})()`
+
+// feedDoc покрывает RSS 2.0, RSS 1.0 и Atom: encoding/xml сопоставляет
+// элементы по локальному имени, пространства имён не мешают.
+type feedDoc struct {
+	XMLName xml.Name
+	Channel struct {
+		Title string        `xml:"title"`
+		Items []feedDocItem `xml:"item"`
+	} `xml:"channel"`
+	Items   []feedDocItem `xml:"item"` // RSS 1.0: записи на верхнем уровне
+	Title   string        `xml:"title"`
+	Entries []feedDocItem `xml:"entry"`
+}
+
+type feedDocItem struct {
+	Title string `xml:"title"`
+	Links []struct {
+		Href string `xml:"href,attr"`
+		Rel  string `xml:"rel,attr"`
+		Text string `xml:",chardata"`
+	} `xml:"link"`
+	GUID        string `xml:"guid"`
+	PubDate     string `xml:"pubDate"`
+	Date        string `xml:"date"` // dc:date
+	Published   string `xml:"published"`
+	Updated     string `xml:"updated"`
+	Description string `xml:"description"`
+	Summary     string `xml:"summary"`
+	Content     string `xml:"content"`
+	Encoded     string `xml:"encoded"` // content:encoded
+}
+
+var feedDateLayouts = []string{
+	time.RFC1123Z, time.RFC1123, time.RFC3339, time.RFC3339Nano,
+	"Mon, 2 Jan 2006 15:04:05 -0700", "Mon, 2 Jan 2006 15:04:05 MST",
+	"2 Jan 2006 15:04:05 -0700", "Mon, 02 Jan 2006 15:04 -0700", "2006-01-02T15:04:05", "2006-01-02",
+}
+
+func parseFeedDate(raw string) *time.Time {
+	raw = strings.TrimSpace(raw)
+	for _, layout := range feedDateLayouts {
+		if t, err := time.Parse(layout, raw); err == nil {
+			t = t.UTC()
+			return &t
+		}
+	}
+	return nil
+}
+
+var feedTagPattern = regexp.MustCompile(`<[^>]*>`)
+
+// feedSummary превращает HTML описания в короткий текст.
+func feedSummary(raw string) string {
+	text := html.UnescapeString(feedTagPattern.ReplaceAllString(raw, " "))
+	text = strings.Join(strings.Fields(text), " ")
+	if r := []rune(text); len(r) > maxFeedSummary {
+		text = strings.TrimSpace(string(r[:maxFeedSummary])) + "…"
+	}
+	return text
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// resolveFeedLink приводит ссылку записи к абсолютной относительно ленты.
+func resolveFeedLink(base *url.URL, link string) string {
+	if link == "" || base == nil {
+		return link
+	}
+	if u, err := base.Parse(link); err == nil {
+		return u.String()
+	}
+	return link
+}
+
+func (it feedDocItem) normalize(base *url.URL) FeedItem {
+	var link string
+	for _, l := range it.Links {
+		if l.Href != "" && (l.Rel == "" || l.Rel == "alternate") {
+			link = l.Href
+			break
+		}
+		if link == "" && strings.TrimSpace(l.Text) != "" {
+			link = strings.TrimSpace(l.Text)
+		}
+	}
+	// В RSS guid с isPermaLink по умолчанию — тоже адрес записи.
+	if link == "" && strings.HasPrefix(it.GUID, "http") {
+		link = strings.TrimSpace(it.GUID)
+	}
+	return FeedItem{
+		Title:   feedSummary(it.Title),
+		Link:    resolveFeedLink(base, link),
+		Date:    parseFeedDate(firstNonEmpty(it.PubDate, it.Date, it.Published, it.Updated)),
+		Summary: feedSummary(firstNonEmpty(it.Description, it.Summary, it.Content, it.Encoded)),
+	}
+}
+
+// parseJSONFeed разбирает JSON Feed 1.x.
+func parseJSONFeed(data []byte, feed *Feed, base *url.URL) error {
+	var doc struct {
+		Title string `json:"title"`
+		Items []struct {
+			Title         string `json:"title"`
+			URL           string `json:"url"`
+			DatePublished string `json:"date_published"`
+			DateModified  string `json:"date_modified"`
+			Summary       string `json:"summary"`
+			ContentText   string `json:"content_text"`
+			ContentHTML   string `json:"content_html"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	feed.Title = firstNonEmpty(feed.Title, doc.Title)
+	for _, it := range doc.Items {
+		feed.Items = append(feed.Items, FeedItem{
+			Title:   it.Title,
+			Link:    resolveFeedLink(base, it.URL),
+			Date:    parseFeedDate(firstNonEmpty(it.DatePublished, it.DateModified)),
+			Summary: feedSummary(firstNonEmpty(it.Summary, it.ContentText, it.ContentHTML)),
+		})
+	}
+	return nil
+}
+
+// parseXMLFeed разбирает RSS или Atom. Кодировки, отличные от UTF-8
+// (windows-1251, koi8-r...), перекодирует TextDecoder вкладки, чтобы не
+// заводить таблицы кодировок.
+func parseXMLFeed(ctx context.Context, data []byte, feed *Feed, base *url.URL) error {
+	dec := xml.NewDecoder(strings.NewReader(string(data)))
+	dec.Strict = false
+	dec.CharsetReader = func(label string, input stdio.Reader) (stdio.Reader, error) {
+		raw, err := stdio.ReadAll(input)
+		if err != nil {
+			return nil, err
+		}
+		var text string
+		expr := fmt.Sprintf(`new TextDecoder(%q).decode(Uint8Array.from(atob(%q), c => c.charCodeAt(0)))`,
+			strings.ToLower(label), base64.StdEncoding.EncodeToString(raw))
+		if err := chromedp.Evaluate(expr, &text).Do(ctx); err != nil {
+			return nil, fmt.Errorf("кодировка %s не поддерживается", label)
+		}
+		return strings.NewReader(text), nil
+	}
+	var doc feedDoc
+	if err := dec.Decode(&doc); err != nil {
+		return err
+	}
+	items := doc.Channel.Items
+	switch {
+	case len(doc.Entries) > 0:
+		items = doc.Entries
+		feed.Title = firstNonEmpty(feed.Title, doc.Title)
+	case len(doc.Items) > 0:
+		items = doc.Items
+		feed.Title = firstNonEmpty(feed.Title, doc.Channel.Title)
+	default:
+		feed.Title = firstNonEmpty(feed.Title, doc.Channel.Title, doc.Title)
+	}
+	if doc.XMLName.Local == "feed" {
+		feed.Type = "atom"
+	}
+	for _, it := range items {
+		feed.Items = append(feed.Items, it.normalize(base))
+	}
+	return nil
+}
+
+// fetchFeed загружает и разбирает ленту; ошибка попадает в feed.Error.
+func fetchFeed(ctx context.Context, feed *Feed) {
+	data, _, err := loadResource(ctx, feed.URL, maxFeedSize)
+	if err == nil {
+		base, _ := url.Parse(feed.URL)
+		if feed.Type == "json" {
+			err = parseJSONFeed(data, feed, base)
+		} else {
+			err = parseXMLFeed(ctx, data, feed, base)
+		}
+	}
+	if err != nil {
+		slog.WarnContext(ctx, "Не удалось прочитать ленту", "url", feed.URL, "error", err)
+		feed.Error = err.Error()
+		return
+	}
+	if len(feed.Items) > maxFeedItems {
+		feed.Items = feed.Items[:maxFeedItems]
+	}
+}
+
+// collectFeeds находит ленты страницы и, если items, загружает первые
+// maxFeedsFetched из них.
+func collectFeeds(items bool, feeds *[]Feed) chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		slog.InfoContext(ctx, "Шаг [1.6]: ищу RSS/Atom-ленты")
+		if err := chromedp.Evaluate(feedsScript, feeds).Do(ctx); err != nil {
+			return err
+		}
+		if !items {
+			return nil
+		}
+		for i := range *feeds {
+			if i >= maxFeedsFetched {
+				break
+			}
+			fetchFeed(ctx, &(*feeds)[i])
+		}
+		return nil
+	})
+}
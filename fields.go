@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+	"reflect"
+	"strings"
+)
+
+// parseFieldsParam разбирает fields=content,meta.title,links.href в дерево
+// выборки того же вида, что строит GraphQL-парсер.
+func parseFieldsParam(raw string) []*gqlField {
+	var root []*gqlField
+	for _, path := range strings.Split(raw, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		level := &root
+		for _, name := range strings.Split(path, ".") {
+			var field *gqlField
+			for _, f := range *level {
+				if f.Name == name {
+					field = f
+					break
+				}
+			}
+			if field == nil {
+				field = &gqlField{Name: name}
+				*level = append(*level, field)
+			}
+			level = &field.Selection
+		}
+	}
+	return root
+}
+
+// responseFieldNames — JSON-имена полей верхнего уровня Response.
+func responseFieldNames() []string {
+	t := reflect.TypeOf(Response{})
+	names := make([]string, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// applyFieldSelection включает извлечение только для выбранных полей:
+// флаги, совпадающие с именами полей ответа, выставляются по выборке,
+// а не выбранные снимаются, чтобы лишняя работа не выполнялась.
+func applyFieldSelection(q url.Values, selection []*gqlField) {
+	selected := map[string]bool{}
+	for _, f := range selection {
+		selected[f.Name] = true
+	}
+	for _, name := range responseFieldNames() {
+		if selected[name] {
+			if !q.Has(name) {
+				q.Set(name, "")
+			}
+		} else {
+			q.Del(name)
+		}
+	}
+}
+
+// projectResponse оставляет в ответе только выбранные поля в порядке выборки.
+// Проекция идёт по JSON-представлению, поэтому имена полей совпадают с ключами JSON.
+func projectResponse(response *Response, selection []*gqlField) (any, error) {
+	generic, err := toGenericJSON(response)
+	if err != nil {
+		return nil, err
+	}
+	return projectValue(generic, selection), nil
+}
+
+// toGenericJSON переводит значение в map[string]any/[]any через JSON.
+func toGenericJSON(v any) (any, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var generic any
+	if err := json.Unmarshal(raw, &generic); err != nil {
+		return nil, err
+	}
+	return generic, nil
+}
@@ -0,0 +1,110 @@
+package main
+
+// Формы страницы (forms=true): адрес и метод отправки и перечень полей с
+// типами, подписями, обязательностью и вариантами выбора — чтобы
+// спланировать заполнение через actions или проверить страницу, не разбирая
+// HTML. В поля входят и элементы вне <form>, привязанные к ней атрибутом
+// form. Значения полей-паролей не возвращаются.
+
+// Form — форма страницы.
+type Form struct {
+	ID      string      `json:"id,omitempty"`
+	Name    string      `json:"name,omitempty"`
+	Action  string      `json:"action"`            // Абсолютный адрес отправки
+	Method  string      `json:"method"`            // GET, POST или DIALOG
+	Enctype string      `json:"enctype,omitempty"` // Только для POST
+	Fields  []FormField `json:"fields"`
+}
+
+// FormField — поле формы. Радиокнопки с одним именем собраны в одно поле
+// с вариантами.
+type FormField struct {
+	Name         string       `json:"name,omitempty"`
+	ID           string       `json:"id,omitempty"`
+	Type         string       `json:"type"` // text, email, select, textarea, radio, submit...
+	Label        string       `json:"label,omitempty"`
+	Required     bool         `json:"required,omitempty"`
+	Disabled     bool         `json:"disabled,omitempty"`
+	Multiple     bool         `json:"multiple,omitempty"`
+	Value        string       `json:"value,omitempty"`
+	Placeholder  string       `json:"placeholder,omitempty"`
+	Pattern      string       `json:"pattern,omitempty"`
+	MinLength    int          `json:"min_length,omitempty"`
+	MaxLength    int          `json:"max_length,omitempty"`
+	Min          string       `json:"min,omitempty"`
+	Max          string       `json:"max,omitempty"`
+	Autocomplete string       `json:"autocomplete,omitempty"`
+	Options      []FormOption `json:"options,omitempty"` // select, datalist, radio
+}
+
+// FormOption — вариант выбора.
+type FormOption struct {
+	Value    string `json:"value"`
+	Label    string `json:"label,omitempty"`
+	Selected bool   `json:"selected,omitempty"`
+}
+
+// formsScript собирает формы. Подпись поля — из <label>, затем
+// aria-label, aria-labelledby и title.
+const formsScript = `(() => {
+	const clean = s => (s || '').replace(/\s+/g, ' ').trim();
+	const labelOf = el => {
+		if (el.labels && el.labels.length) return clean(Array.from(el.labels, l => l.innerText || l.textContent).join(' '));
+		if (el.getAttribute('aria-label')) return clean(el.getAttribute('aria-label'));
+		const ids = (el.getAttribute('aria-labelledby') || '').split(/\s+/).filter(Boolean);
+		const byIds = ids.map(id => document.getElementById(id)).filter(Boolean).map(n => n.textContent).join(' ');
+		if (clean(byIds)) return clean(byIds);
+		return clean(el.getAttribute('title'));
+	};
+	const num = v => { const n = Number(v); return Number.isFinite(n) && n > 0 ? n : 0; };
+	const out = [];
+	for (const form of document.forms) {
+		const method = (form.getAttribute('method') || 'get').trim().toUpperCase();
+		const fields = [];
+		const groups = {};
+		for (const el of form.elements) {
+			const tag = el.tagName.toLowerCase();
+			if (tag === 'fieldset' || tag === 'object' || tag === 'output') continue;
+			const type = tag === 'input' ? (el.type || 'text') : tag === 'button' ? (el.type || 'submit') : tag;
+			const option = o => ({value: o.value, label: clean(o.label || o.textContent), selected: !!o.selected});
+			if (type === 'radio' && el.name) {
+				const opt = {value: el.value, label: labelOf(el), selected: el.checked};
+				if (groups[el.name]) {
+					groups[el.name].options.push(opt);
+					groups[el.name].required = groups[el.name].required || el.required;
+					continue;
+				}
+				groups[el.name] = {name: el.name, type, label: '', required: el.required, options: [opt]};
+				fields.push(groups[el.name]);
+				continue;
+			}
+			const isButton = tag === 'button' || ['submit', 'reset', 'button', 'image'].includes(type);
+			let value = String(el.value || '');
+			if (type === 'password' || type === 'file' || tag === 'select') value = '';
+			else if (type === 'checkbox' && !el.checked) value = '';
+			const field = {
+				name: el.name || '', id: el.id || '', type,
+				label: isButton ? clean(el.innerText || el.value || el.alt) || labelOf(el) : labelOf(el),
+				required: !!el.required, disabled: !!el.disabled, multiple: !!el.multiple, value,
+				placeholder: el.getAttribute('placeholder') || '', pattern: el.getAttribute('pattern') || '',
+				min_length: num(el.getAttribute('minlength')), max_length: num(el.getAttribute('maxlength')),
+				min: el.getAttribute('min') || '', max: el.getAttribute('max') || '',
+				autocomplete: el.getAttribute('autocomplete') || '',
+			};
+			if (tag === 'select') field.options = Array.from(el.options, option);
+			else if (el.list) field.options = Array.from(el.list.options, option);
+			fields.push(field);
+		}
+		// Свойства формы затеняются полями с именами action, id и т. п. —
+		// читаем атрибуты.
+		let action = document.baseURI;
+		try { action = new URL(form.getAttribute('action') || '', document.baseURI).href; } catch (e) {}
+		out.push({
+			id: form.getAttribute('id') || '', name: form.getAttribute('name') || '',
+			action, method,
+			enctype: method === 'POST' ? (form.getAttribute('enctype') || 'application/x-www-form-urlencoded').toLowerCase() : '',
+			fields,
+		});
+	}
+	return out;
+})()`
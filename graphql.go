@@ -0,0 +1,584 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Поддерживается подмножество GraphQL, достаточное для выбора полей:
+//
+//	query ($u: String!) {
+//	  page: scrape(url: $u, consent: true) {
+//	    content_hash
+//	    meta { title }
+//	    links(filter: "/catalog/") { href }
+//	  }
+//	}
+//
+// Аргументы корневого поля scrape превращаются в query-параметры /scrape,
+// выбранные поля ответа первого уровня — в флаги извлечения (content, meta,
+// links...), а аргументы вложенных полей — в параметры вида <поле>_<аргумент>.
+// Так невыбранные поля не извлекаются вовсе, а новые параметры /scrape сразу
+// становятся доступны в GraphQL. Фрагменты и директивы не поддерживаются.
+
+// gqlField — поле в наборе выборки.
+type gqlField struct {
+	Alias     string
+	Name      string
+	Args      map[string]any
+	Selection []*gqlField
+}
+
+// gqlVariable — ссылка на переменную ($name) в значении аргумента.
+type gqlVariable string
+
+type gqlParser struct {
+	src string
+	pos int
+}
+
+func parseGraphQL(src string) ([]*gqlField, error) {
+	p := &gqlParser{src: src}
+	p.skipIgnored()
+	if p.peekName() == "query" {
+		p.readName()
+		p.skipIgnored()
+		if isNameStart(p.peek()) {
+			p.readName()
+			p.skipIgnored()
+		}
+		if p.peek() == '(' {
+			if err := p.skipVariableDefinitions(); err != nil {
+				return nil, err
+			}
+		}
+	} else if name := p.peekName(); name == "mutation" || name == "subscription" {
+		return nil, fmt.Errorf("операция %s не поддерживается", name)
+	}
+	fields, err := p.parseSelectionSet()
+	if err != nil {
+		return nil, err
+	}
+	p.skipIgnored()
+	if p.pos < len(p.src) {
+		return nil, p.errorf("лишние символы после запроса")
+	}
+	return fields, nil
+}
+
+func (p *gqlParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("синтаксическая ошибка GraphQL (позиция %d): %s", p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *gqlParser) peek() byte {
+	if p.pos >= len(p.src) {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+// skipIgnored пропускает пробелы, запятые и комментарии — в GraphQL они незначимы.
+func (p *gqlParser) skipIgnored() {
+	for p.pos < len(p.src) {
+		switch c := p.src[p.pos]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			p.pos++
+		case c == '#':
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isNameChar(c byte) bool {
+	return isNameStart(c) || (c >= '0' && c <= '9')
+}
+
+func (p *gqlParser) peekName() string {
+	end := p.pos
+	for end < len(p.src) && isNameChar(p.src[end]) {
+		end++
+	}
+	return p.src[p.pos:end]
+}
+
+func (p *gqlParser) readName() string {
+	name := p.peekName()
+	p.pos += len(name)
+	return name
+}
+
+func (p *gqlParser) expect(c byte) error {
+	p.skipIgnored()
+	if p.peek() != c {
+		return p.errorf("ожидался символ '%c'", c)
+	}
+	p.pos++
+	return nil
+}
+
+// skipVariableDefinitions пропускает ($a: String!, $b: Int = 1): типы не проверяются,
+// значения берутся из variables.
+func (p *gqlParser) skipVariableDefinitions() error {
+	depth := 0
+	for p.pos < len(p.src) {
+		switch p.src[p.pos] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				p.pos++
+				p.skipIgnored()
+				return nil
+			}
+		case '"':
+			if _, err := p.parseString(); err != nil {
+				return err
+			}
+			continue
+		}
+		p.pos++
+	}
+	return p.errorf("не закрыто объявление переменных")
+}
+
+func (p *gqlParser) parseSelectionSet() ([]*gqlField, error) {
+	if err := p.expect('{'); err != nil {
+		return nil, err
+	}
+	var fields []*gqlField
+	for {
+		p.skipIgnored()
+		switch c := p.peek(); {
+		case c == '}':
+			p.pos++
+			if len(fields) == 0 {
+				return nil, p.errorf("пустой набор полей")
+			}
+			return fields, nil
+		case c == '.':
+			return nil, p.errorf("фрагменты не поддерживаются")
+		case c == '@':
+			return nil, p.errorf("директивы не поддерживаются")
+		case isNameStart(c):
+			field, err := p.parseField()
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, field)
+		default:
+			return nil, p.errorf("ожидалось имя поля")
+		}
+	}
+}
+
+func (p *gqlParser) parseField() (*gqlField, error) {
+	field := &gqlField{Name: p.readName()}
+	p.skipIgnored()
+	if p.peek() == ':' {
+		p.pos++
+		p.skipIgnored()
+		if !isNameStart(p.peek()) {
+			return nil, p.errorf("ожидалось имя поля после псевдонима")
+		}
+		field.Alias = field.Name
+		field.Name = p.readName()
+		p.skipIgnored()
+	}
+	if p.peek() == '(' {
+		p.pos++
+		field.Args = map[string]any{}
+		for {
+			p.skipIgnored()
+			if p.peek() == ')' {
+				p.pos++
+				break
+			}
+			if !isNameStart(p.peek()) {
+				return nil, p.errorf("ожидалось имя аргумента")
+			}
+			name := p.readName()
+			if err := p.expect(':'); err != nil {
+				return nil, err
+			}
+			value, err := p.parseValue()
+			if err != nil {
+				return nil, err
+			}
+			field.Args[name] = value
+		}
+		p.skipIgnored()
+	}
+	if p.peek() == '{' {
+		selection, err := p.parseSelectionSet()
+		if err != nil {
+			return nil, err
+		}
+		field.Selection = selection
+	}
+	return field, nil
+}
+
+func (p *gqlParser) parseValue() (any, error) {
+	p.skipIgnored()
+	switch c := p.peek(); {
+	case c == '"':
+		return p.parseString()
+	case c == '$':
+		p.pos++
+		if !isNameStart(p.peek()) {
+			return nil, p.errorf("ожидалось имя переменной")
+		}
+		return gqlVariable(p.readName()), nil
+	case c == '[':
+		p.pos++
+		var list []any
+		for {
+			p.skipIgnored()
+			if p.peek() == ']' {
+				p.pos++
+				return list, nil
+			}
+			if p.pos >= len(p.src) {
+				return nil, p.errorf("не закрыт список")
+			}
+			v, err := p.parseValue()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+	case c == '-' || (c >= '0' && c <= '9'):
+		start := p.pos
+		p.pos++
+		for p.pos < len(p.src) && strings.IndexByte("0123456789.eE+-", p.src[p.pos]) >= 0 {
+			p.pos++
+		}
+		f, err := strconv.ParseFloat(p.src[start:p.pos], 64)
+		if err != nil {
+			return nil, p.errorf("некорректное число")
+		}
+		return f, nil
+	case isNameStart(c):
+		switch name := p.readName(); name {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		default:
+			// Значение enum передаём как строку.
+			return name, nil
+		}
+	case c == '{':
+		return nil, p.errorf("объекты в аргументах не поддерживаются")
+	default:
+		return nil, p.errorf("ожидалось значение аргумента")
+	}
+}
+
+func (p *gqlParser) parseString() (string, error) {
+	p.pos++ // открывающая кавычка
+	var sb strings.Builder
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		switch c {
+		case '"':
+			p.pos++
+			return sb.String(), nil
+		case '\\':
+			if p.pos+1 >= len(p.src) {
+				return "", p.errorf("незавершённая escape-последовательность")
+			}
+			p.pos++
+			switch e := p.src[p.pos]; e {
+			case 'n':
+				sb.WriteByte('\n')
+			case 't':
+				sb.WriteByte('\t')
+			case 'r':
+				sb.WriteByte('\r')
+			case 'b':
+				sb.WriteByte('\b')
+			case 'f':
+				sb.WriteByte('\f')
+			case 'u':
+				if p.pos+4 >= len(p.src) {
+					return "", p.errorf("некорректная escape-последовательность \\u")
+				}
+				code, err := strconv.ParseUint(p.src[p.pos+1:p.pos+5], 16, 32)
+				if err != nil {
+					return "", p.errorf("некорректная escape-последовательность \\u")
+				}
+				sb.WriteRune(rune(code))
+				p.pos += 4
+			default:
+				sb.WriteByte(e)
+			}
+			p.pos++
+		case '\n':
+			return "", p.errorf("перенос строки внутри строкового литерала")
+		default:
+			sb.WriteByte(c)
+			p.pos++
+		}
+	}
+	return "", p.errorf("не закрыт строковый литерал")
+}
+
+// resolveValue подставляет переменные в значение аргумента.
+func resolveValue(v any, vars map[string]any) (any, error) {
+	switch val := v.(type) {
+	case gqlVariable:
+		resolved, ok := vars[string(val)]
+		if !ok {
+			return nil, fmt.Errorf("не передано значение переменной $%s", val)
+		}
+		return resolved, nil
+	case []any:
+		out := make([]any, 0, len(val))
+		for _, item := range val {
+			r, err := resolveValue(item, vars)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, r)
+		}
+		return out, nil
+	default:
+		return v, nil
+	}
+}
+
+// addQueryParam записывает аргумент GraphQL как query-параметр. false и null
+// не записываются: флаги /scrape включаются самим наличием параметра.
+func addQueryParam(q url.Values, name string, value any) {
+	switch v := value.(type) {
+	case nil:
+	case bool:
+		if v {
+			q.Set(name, "true")
+		}
+	case float64:
+		q.Set(name, strconv.FormatFloat(v, 'f', -1, 64))
+	case string:
+		q.Set(name, v)
+	case []any:
+		for _, item := range v {
+			switch iv := item.(type) {
+			case string:
+				q.Add(name, iv)
+			case float64:
+				q.Add(name, strconv.FormatFloat(iv, 'f', -1, 64))
+			default:
+				q.Add(name, fmt.Sprint(iv))
+			}
+		}
+	default:
+		q.Set(name, fmt.Sprint(v))
+	}
+}
+
+// scrapeQueryFromField переводит поле scrape в query-параметры /scrape.
+func scrapeQueryFromField(field *gqlField, vars map[string]any) (url.Values, error) {
+	q := url.Values{}
+	for name, raw := range field.Args {
+		v, err := resolveValue(raw, vars)
+		if err != nil {
+			return nil, err
+		}
+		addQueryParam(q, name, v)
+	}
+	applyFieldSelection(q, field.Selection)
+	for _, sub := range field.Selection {
+		for name, raw := range sub.Args {
+			v, err := resolveValue(raw, vars)
+			if err != nil {
+				return nil, err
+			}
+			addQueryParam(q, sub.Name+"_"+name, v)
+		}
+	}
+	return q, nil
+}
+
+// orderedObject — JSON-объект, сохраняющий порядок полей из запроса.
+type orderedObject []orderedEntry
+
+type orderedEntry struct {
+	Key   string
+	Value any
+}
+
+func (o orderedObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, e := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(e.Key)
+		buf.Write(key)
+		buf.WriteByte(':')
+		val, err := json.Marshal(e.Value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(val)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// projectValue оставляет в значении только выбранные поля.
+func projectValue(value any, selection []*gqlField) any {
+	if selection == nil {
+		return value
+	}
+	switch v := value.(type) {
+	case map[string]any:
+		obj := orderedObject{}
+		for _, f := range selection {
+			key := f.Name
+			if f.Alias != "" {
+				key = f.Alias
+			}
+			obj = append(obj, orderedEntry{Key: key, Value: projectValue(v[f.Name], f.Selection)})
+		}
+		return obj
+	case []any:
+		out := make([]any, len(v))
+		for i, item := range v {
+			out[i] = projectValue(item, selection)
+		}
+		return out
+	default:
+		return value
+	}
+}
+
+// GraphQLError — ошибка в формате спецификации GraphQL.
+type GraphQLError struct {
+	Message    string            `json:"message"`
+	Path       []string          `json:"path,omitempty"`
+	Extensions map[string]string `json:"extensions,omitempty"` // code — машинный код ошибки
+}
+
+// newGraphQLError переводит сообщение на язык запроса.
+func newGraphQLError(lang string, err error, path []string) GraphQLError {
+	message, code := localize(lang, err.Error())
+	gqlErr := GraphQLError{Message: message, Path: path}
+	if code != "" {
+		gqlErr.Extensions = map[string]string{"code": code}
+	}
+	return gqlErr
+}
+
+// GraphQLResponse — ответ /graphql.
+type GraphQLResponse struct {
+	Data   orderedObject  `json:"data"`
+	Errors []GraphQLError `json:"errors,omitempty"`
+}
+
+type graphQLRequest struct {
+	Query     string         `json:"query"`
+	Variables map[string]any `json:"variables"`
+}
+
+// graphqlHandler: POST /graphql {"query": "...", "variables": {...}} или GET ?query=.
+func graphqlHandler(w http.ResponseWriter, r *http.Request) {
+	var req graphQLRequest
+	switch r.Method {
+	case http.MethodGet:
+		req.Query = r.URL.Query().Get("query")
+		if raw := r.URL.Query().Get("variables"); raw != "" {
+			if err := json.Unmarshal([]byte(raw), &req.Variables); err != nil {
+				writeJsonError(w, "Параметр 'variables' должен быть JSON-объектом", http.StatusBadRequest)
+				return
+			}
+		}
+	case http.MethodPost:
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJsonError(w, "Тело запроса должно быть JSON вида {\"query\": \"...\"}", http.StatusBadRequest)
+			return
+		}
+	default:
+		writeJsonError(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+		return
+	}
+	if strings.TrimSpace(req.Query) == "" {
+		writeJsonError(w, "Параметр 'query' обязателен", http.StatusBadRequest)
+		return
+	}
+
+	fields, err := parseGraphQL(req.Query)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(GraphQLResponse{Errors: []GraphQLError{newGraphQLError(responseLang(w), err, nil)}})
+		return
+	}
+
+	result := GraphQLResponse{Data: orderedObject{}}
+	for _, field := range fields {
+		key := field.Name
+		if field.Alias != "" {
+			key = field.Alias
+		}
+		value, err := resolveRootField(r.Context(), field, req.Variables)
+		if err != nil {
+			slog.WarnContext(r.Context(), "GraphQL: ошибка в поле", "field", key, "error", err)
+			result.Errors = append(result.Errors, newGraphQLError(responseLang(w), err, []string{key}))
+		}
+		result.Data = append(result.Data, orderedEntry{Key: key, Value: value})
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(result)
+}
+
+func resolveRootField(ctx context.Context, field *gqlField, vars map[string]any) (any, error) {
+	if field.Name != "scrape" {
+		return nil, fmt.Errorf("неизвестное поле '%s' (доступно: scrape)", field.Name)
+	}
+	if field.Selection == nil {
+		return nil, errors.New("для поля scrape нужно выбрать хотя бы одно поле ответа")
+	}
+	q, err := scrapeQueryFromField(field, vars)
+	if err != nil {
+		return nil, err
+	}
+	if q.Has("eval") {
+		return nil, errors.New("Параметр 'eval' принимается только в теле POST /scrape")
+	}
+	// Только имена: в значениях бывают куки, заголовки и пароль прокси.
+	slog.DebugContext(ctx, "GraphQL: поле scrape преобразовано в параметры", "params", slices.Sorted(maps.Keys(q)))
+	opts, err := parseScrapeOptions(q)
+	if err != nil {
+		return nil, err
+	}
+	opts.trace = ctx
+	response, _, err := scrapeWithCache(q, opts)
+	if err != nil {
+		return nil, fmt.Errorf("Не удалось выполнить скрапинг: %w", err)
+	}
+	return projectResponse(response, field.Selection)
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/chromedp"
+)
+
+// HAR 1.2 по событиям Network вкладки (har=true): все запросы страницы с
+// заголовками, статусами и таймингами — чтобы видеть, чем сайт нас
+// блокирует и к каким API обращается фронтенд. Тела ответов не
+// записываются (content.text пуст): их пришлось бы запрашивать у Chrome
+// по каждому запросу. Заблокированные запросы (block, block_domains)
+// попадают в лог с _error net::ERR_BLOCKED_BY_CLIENT; нестандартные поля
+// по спецификации начинаются с подчёркивания.
+
+type HAR struct {
+	Log HARLog `json:"log"`
+}
+
+type HARLog struct {
+	Version string     `json:"version"`
+	Creator HARCreator `json:"creator"`
+	Pages   []HARPage  `json:"pages"`
+	Entries []HAREntry `json:"entries"`
+}
+
+type HARCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type HARPage struct {
+	StartedDateTime time.Time      `json:"startedDateTime"`
+	ID              string         `json:"id"`
+	Title           string         `json:"title"`
+	PageTimings     HARPageTimings `json:"pageTimings"`
+}
+
+type HARPageTimings struct {
+	OnContentLoad float64 `json:"onContentLoad"`
+	OnLoad        float64 `json:"onLoad"`
+}
+
+type HAREntry struct {
+	Pageref         string      `json:"pageref"`
+	StartedDateTime time.Time   `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         HARRequest  `json:"request"`
+	Response        HARResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         HARTimings  `json:"timings"`
+	ServerIPAddress string      `json:"serverIPAddress,omitempty"`
+	ResourceType    string      `json:"_resourceType,omitempty"`
+	Error           string      `json:"_error,omitempty"`
+}
+
+type HARNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type HARPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type HARRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARNameValue `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	QueryString []HARNameValue `json:"queryString"`
+	PostData    *HARPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type HARResponse struct {
+	Status      int64          `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARNameValue `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	Content     HARContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type HARContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+}
+
+// HARTimings — фазы запроса в миллисекундах; -1 — фаза не применима.
+type HARTimings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+	SSL     float64 `json:"ssl"`
+}
+
+// harRequest — запрос в процессе записи. При редиректе Chrome повторяет
+// RequestID, поэтому по ID хранится текущий шаг, а порядок всех шагов — в order.
+type harRequest struct {
+	entry    HAREntry
+	sentAt   float64 // Монотонное время отправки, секунды
+	timing   *network.ResourceTiming
+	received int
+	done     bool
+}
+
+type harRecorder struct {
+	mu       sync.Mutex
+	start    float64
+	wallTime time.Time
+	pending  map[network.RequestID]*harRequest
+	order    []*harRequest
+	onDOM    float64
+	onLoad   float64
+}
+
+func monotonicSeconds(t *cdp.MonotonicTime) float64 {
+	if t == nil {
+		return 0
+	}
+	return t.Time().Sub(*cdp.MonotonicTimeEpoch).Seconds()
+}
+
+func recordHAR(ctx context.Context) *harRecorder {
+	rec := &harRecorder{pending: map[network.RequestID]*harRequest{}, onDOM: -1, onLoad: -1}
+	chromedp.ListenTarget(ctx, func(ev any) {
+		rec.mu.Lock()
+		defer rec.mu.Unlock()
+		switch ev := ev.(type) {
+		case *network.EventRequestWillBeSent:
+			if prev := rec.pending[ev.RequestID]; prev != nil && ev.RedirectResponse != nil {
+				prev.setResponse(ev.RedirectResponse)
+				prev.entry.Response.RedirectURL = ev.Request.URL
+				prev.finish(monotonicSeconds(ev.Timestamp))
+			}
+			sentAt := monotonicSeconds(ev.Timestamp)
+			if rec.start == 0 {
+				rec.start = sentAt
+				if ev.WallTime != nil {
+					rec.wallTime = ev.WallTime.Time()
+				}
+			}
+			req := &harRequest{sentAt: sentAt, entry: HAREntry{
+				Pageref:         "page_1",
+				StartedDateTime: rec.wallTime.Add(time.Duration((sentAt - rec.start) * float64(time.Second))),
+				Request:         harRequestFrom(ev.Request),
+				Response:        HARResponse{Cookies: []HARNameValue{}, Headers: []HARNameValue{}, HeadersSize: -1, BodySize: -1},
+				Timings:         HARTimings{Blocked: -1, DNS: -1, Connect: -1, SSL: -1},
+				ResourceType:    string(ev.Type),
+			}}
+			rec.pending[ev.RequestID] = req
+			rec.order = append(rec.order, req)
+		case *network.EventResponseReceived:
+			if req := rec.pending[ev.RequestID]; req != nil {
+				req.setResponse(ev.Response)
+			}
+		case *network.EventDataReceived:
+			if req := rec.pending[ev.RequestID]; req != nil {
+				req.received += int(ev.DataLength)
+			}
+		case *network.EventLoadingFinished:
+			if req := rec.pending[ev.RequestID]; req != nil {
+				req.entry.Response.BodySize = int(ev.EncodedDataLength)
+				req.finish(monotonicSeconds(ev.Timestamp))
+				delete(rec.pending, ev.RequestID)
+			}
+		case *network.EventLoadingFailed:
+			if req := rec.pending[ev.RequestID]; req != nil {
+				req.entry.Error = ev.ErrorText
+				if ev.BlockedReason != "" {
+					req.entry.Error += " (" + string(ev.BlockedReason) + ")"
+				}
+				req.finish(monotonicSeconds(ev.Timestamp))
+				delete(rec.pending, ev.RequestID)
+			}
+		case *page.EventDomContentEventFired:
+			if rec.onDOM < 0 && rec.start > 0 {
+				rec.onDOM = (monotonicSeconds(ev.Timestamp) - rec.start) * 1000
+			}
+		case *page.EventLoadEventFired:
+			if rec.onLoad < 0 && rec.start > 0 {
+				rec.onLoad = (monotonicSeconds(ev.Timestamp) - rec.start) * 1000
+			}
+		}
+	})
+	return rec
+}
+
+func harHeaders(headers network.Headers) []HARNameValue {
+	out := make([]HARNameValue, 0, len(headers))
+	for name, value := range headers {
+		// Chrome склеивает повторяющиеся заголовки через перевод строки.
+		for _, v := range strings.Split(fmt.Sprint(value), "\n") {
+			out = append(out, HARNameValue{Name: name, Value: v})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+func harRequestFrom(r *network.Request) HARRequest {
+	req := HARRequest{
+		Method:      r.Method,
+		URL:         r.URL,
+		Cookies:     []HARNameValue{},
+		Headers:     harHeaders(r.Headers),
+		QueryString: []HARNameValue{},
+		HeadersSize: -1,
+		BodySize:    0,
+	}
+	if u, err := url.Parse(r.URL); err == nil {
+		for name, values := range u.Query() {
+			for _, v := range values {
+				req.QueryString = append(req.QueryString, HARNameValue{Name: name, Value: v})
+			}
+		}
+		sort.Slice(req.QueryString, func(i, j int) bool { return req.QueryString[i].Name < req.QueryString[j].Name })
+	}
+	if r.HasPostData {
+		var body strings.Builder
+		for _, e := range r.PostDataEntries {
+			if data, err := base64.StdEncoding.DecodeString(e.Bytes); err == nil {
+				body.Write(data)
+			}
+		}
+		req.PostData = &HARPostData{MimeType: headerValue(r.Headers, "Content-Type"), Text: body.String()}
+		req.BodySize = body.Len()
+	}
+	return req
+}
+
+func (req *harRequest) setResponse(r *network.Response) {
+	req.entry.Response.Status = r.Status
+	req.entry.Response.StatusText = r.StatusText
+	req.entry.Response.HTTPVersion = r.Protocol
+	req.entry.Response.Headers = harHeaders(r.Headers)
+	req.entry.Response.Content.MimeType = r.MimeType
+	req.entry.Request.HTTPVersion = r.Protocol
+	if len(r.RequestHeaders) > 0 {
+		req.entry.Request.Headers = harHeaders(r.RequestHeaders)
+	}
+	req.entry.ServerIPAddress = r.RemoteIPAddress
+	req.timing = r.Timing
+}
+
+// finish раскладывает ResourceTiming по фазам HAR. Отметки в
+// ResourceTiming — миллисекунды от requestTime, -1 — фазы не было.
+func (req *harRequest) finish(end float64) {
+	req.done = true
+	req.entry.Response.Content.Size = req.received
+	total := (end - req.sentAt) * 1000
+	t := req.timing
+	if t == nil {
+		req.entry.Timings.Send, req.entry.Timings.Wait, req.entry.Timings.Receive = 0, max(total, 0), 0
+		req.entry.Time = max(total, 0)
+		return
+	}
+	phase := func(start, end float64) float64 {
+		if start < 0 || end < 0 {
+			return -1
+		}
+		return end - start
+	}
+	timings := HARTimings{
+		DNS:     phase(t.DNSStart, t.DNSEnd),
+		Connect: phase(t.ConnectStart, t.ConnectEnd),
+		SSL:     phase(t.SslStart, t.SslEnd),
+		Send:    max(t.SendEnd-t.SendStart, 0),
+		Wait:    max(t.ReceiveHeadersEnd-t.SendEnd, 0),
+		Receive: max((end-t.RequestTime)*1000-t.ReceiveHeadersEnd, 0),
+	}
+	// Очередь — от создания запроса до первой сетевой фазы.
+	firstPhase := t.SendStart
+	for _, s := range []float64{t.ConnectStart, t.DNSStart} {
+		if s >= 0 {
+			firstPhase = s
+		}
+	}
+	timings.Blocked = max((t.RequestTime-req.sentAt)*1000+firstPhase, 0)
+	req.entry.Timings = timings
+	// По спецификации HAR ssl входит в connect и в time не добавляется.
+	req.entry.Time = timings.Blocked + timings.Send + timings.Wait + timings.Receive
+	for _, v := range []float64{timings.DNS, timings.Connect} {
+		if v > 0 {
+			req.entry.Time += v
+		}
+	}
+}
+
+// HAR собирает документ из записанного; запросы, не завершившиеся к этому
+// моменту, попадают в него с _error "pending".
+func (rec *harRecorder) HAR(title string) *HAR {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	entries := make([]HAREntry, 0, len(rec.order))
+	for _, req := range rec.order {
+		entry := req.entry
+		if !req.done {
+			entry.Error = "pending"
+		}
+		entries = append(entries, entry)
+	}
+	return &HAR{Log: HARLog{
+		Version: "1.2",
+		Creator: HARCreator{Name: "webextract", Version: "1.0"},
+		Pages: []HARPage{{
+			StartedDateTime: rec.wallTime,
+			ID:              "page_1",
+			Title:           title,
+			PageTimings:     HARPageTimings{OnContentLoad: rec.onDOM, OnLoad: rec.onLoad},
+		}},
+		Entries: entries,
+	}}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash/fnv"
+	"math/bits"
+	"strings"
+)
+
+// normalizeText схлопывает все пробельные символы в одиночные пробелы,
+// чтобы хэш не зависел от переносов строк и отступов в вёрстке.
+func normalizeText(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// contentHash возвращает SHA-256 нормализованного текста страницы.
+func contentHash(text string) string {
+	sum := sha256.Sum256([]byte(normalizeText(text)))
+	return hex.EncodeToString(sum[:])
+}
+
+// simhash считает 64-битный SimHash по шинглам из трёх слов.
+// Близкие тексты дают подписи с малым расстоянием Хэмминга.
+func simhash(text string) uint64 {
+	words := strings.Fields(strings.ToLower(text))
+	if len(words) == 0 {
+		return 0
+	}
+	const shingleSize = 3
+	var weights [64]int
+	for i := 0; i+shingleSize <= len(words) || i == 0; i++ {
+		end := i + shingleSize
+		if end > len(words) {
+			end = len(words)
+		}
+		h := fnv.New64a()
+		h.Write([]byte(strings.Join(words[i:end], " ")))
+		sum := h.Sum64()
+		for bit := 0; bit < 64; bit++ {
+			if sum&(1<<bit) != 0 {
+				weights[bit]++
+			} else {
+				weights[bit]--
+			}
+		}
+	}
+	var result uint64
+	for bit := 0; bit < 64; bit++ {
+		if weights[bit] > 0 {
+			result |= 1 << bit
+		}
+	}
+	return result
+}
+
+// hammingDistance — число различающихся бит двух подписей.
+func hammingDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// Отслеживание изменений (hash=true): hash — SHA-256 основного текста
+// страницы, то есть текста статьи без меню, подвалов и баннеров, а если
+// статьи не нашлось — всего текста body. С previous_hash (предыдущее
+// значение hash) неизменившаяся страница даёт короткий ответ с
+// changed: false, изменившаяся — обычный ответ с changed: true.
+
+// invisibleChars — символы, которые не видны читателю, но часто
+// меняются между отдачами одной страницы.
+var invisibleChars = strings.NewReplacer("\u200b", "", "\u200c", "", "\u200d", "", "\u2060", "", "\ufeff", "", "\u00ad", "")
+
+// mainTextHash — hash по тексту статьи или, без неё, по тексту body.
+func mainTextHash(article, body string) string {
+	text := article
+	if strings.TrimSpace(text) == "" {
+		text = body
+	}
+	return contentHash(invisibleChars.Replace(text))
+}
+
+// UnchangedResponse — ответ с previous_hash, если страница не изменилась.
+type UnchangedResponse struct {
+	Status   int64  `json:"status,omitempty"`
+	FinalURL string `json:"final_url,omitempty"`
+	Hash     string `json:"hash"`
+	Changed  bool   `json:"changed"`
+}
+
+// compareHash сравнивает hash ответа с предыдущим. Если страница не
+// изменилась, возвращает короткий ответ, иначе — копию ответа с
+// changed: true (ответ из кэша менять нельзя).
+func compareHash(response *Response, previous string) (*Response, *UnchangedResponse) {
+	if response.Hash == previous {
+		return nil, &UnchangedResponse{Status: response.Status, FinalURL: response.FinalURL, Hash: response.Hash}
+	}
+	changed, yes := *response, true
+	changed.Changed = &yes
+	return &changed, nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/chromedp/cdproto/emulation"
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/chromedp"
+)
+
+// Переопределение User-Agent и заголовков запроса:
+//
+//	{"url": "...", "user_agent": "Mozilla/5.0 ...",
+//	 "headers": {"Accept-Language": "de-DE,de;q=0.9", "Referer": "https://www.google.com/"}}
+//
+// User-Agent меняется через Emulation.setUserAgentOverride — он виден и в
+// заголовке, и в navigator.userAgent. Остальные заголовки добавляются ко
+// всем запросам вкладки через Network.setExtraHTTPHeaders.
+
+const maxRequestHeaders = 50
+
+// forbiddenRequestHeaders управляются самим браузером.
+var forbiddenRequestHeaders = map[string]bool{
+	"Host": true, "Content-Length": true, "Connection": true, "Transfer-Encoding": true, "Upgrade": true,
+}
+
+func parseRequestHeaders(raw string) (map[string]string, error) {
+	var headers map[string]string
+	if err := json.Unmarshal([]byte(raw), &headers); err != nil || headers == nil {
+		return nil, errors.New("Параметр 'headers' должен быть JSON-объектом со строковыми значениями")
+	}
+	if len(headers) > maxRequestHeaders {
+		return nil, fmt.Errorf("Параметр 'headers' может содержать не больше %d заголовков", maxRequestHeaders)
+	}
+	out := make(map[string]string, len(headers))
+	for name, value := range headers {
+		canonical := http.CanonicalHeaderKey(name)
+		if forbiddenRequestHeaders[canonical] {
+			return nil, fmt.Errorf("Заголовок '%s' нельзя переопределить", name)
+		}
+		out[canonical] = value
+	}
+	return out, nil
+}
+
+// overrideHeaders применяет User-Agent и дополнительные заголовки к вкладке.
+// Accept-Language передаётся и в override UA, чтобы совпал navigator.languages.
+func overrideHeaders(userAgent string, headers map[string]string) chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		if userAgent != "" {
+			log.Printf("ЛОГ: Переопределяю User-Agent: %s.", userAgent)
+			params := emulation.SetUserAgentOverride(userAgent)
+			if lang := headers["Accept-Language"]; lang != "" {
+				params = params.WithAcceptLanguage(lang)
+			}
+			if err := params.Do(ctx); err != nil {
+				return err
+			}
+		}
+		if len(headers) == 0 {
+			return nil
+		}
+		log.Printf("ЛОГ: Добавляю заголовки запроса: %d шт.", len(headers))
+		extra := make(network.Headers, len(headers))
+		for name, value := range headers {
+			extra[name] = value
+		}
+		return network.SetExtraHTTPHeaders(extra).Do(ctx)
+	})
+}
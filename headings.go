@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+)
+
+// Структура заголовков страницы (headings=true): h1–h6 и элементы с
+// role="heading" в порядке документа — для SEO-аудита без разбора HTML.
+// headings=N ограничивает уровни: headings=2 вернёт только h1 и h2.
+
+// Heading — заголовок страницы.
+type Heading struct {
+	Level  int    `json:"level"`
+	Text   string `json:"text"`
+	ID     string `json:"id,omitempty"`     // id заголовка или якоря внутри/прямо перед ним
+	Anchor string `json:"anchor,omitempty"` // Абсолютный адрес с #id
+}
+
+// parseHeadingsParam возвращает максимальный уровень по значению заданного
+// параметра headings; пустое значение (?headings, fields=headings) — все
+// уровни, как true. "1" здесь — уровень, а не флаг.
+func parseHeadingsParam(raw string) (int, error) {
+	switch raw {
+	case "", "true":
+		return 6, nil
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 1 || n > 6 {
+		return 0, errors.New("Параметр 'headings' может принимать значения: true, 1–6")
+	}
+	return n, nil
+}
+
+// headingsScript собирает заголовки до уровня maxLevel (аргумент функции,
+// см. headingsExpression). Не отрисованные (display:none, hidden) и
+// aria-hidden пропускаются; текст — как видит пользователь, с пробелами,
+// схлопнутыми в один.
+const headingsScript = `(maxLevel) => {
+	const out = [];
+	const anchorOf = el => {
+		if (el.id) return el.id;
+		const inner = el.querySelector('[id], a[name]');
+		if (inner) return inner.id || inner.getAttribute('name');
+		const prev = el.previousElementSibling;
+		if (prev && prev.tagName === 'A' && !prev.textContent.trim()) return prev.id || prev.getAttribute('name') || '';
+		return '';
+	};
+	for (const el of document.querySelectorAll('h1, h2, h3, h4, h5, h6, [role="heading"]')) {
+		const level = /^H[1-6]$/.test(el.tagName) && el.getAttribute('role') !== 'heading'
+			? Number(el.tagName[1])
+			: Number(el.getAttribute('aria-level')) || 2;
+		if (level > maxLevel || el.getClientRects().length === 0 || el.closest('[aria-hidden="true"]')) continue;
+		const text = (el.innerText || el.textContent || '').replace(/\s+/g, ' ').trim();
+		if (!text) continue;
+		const id = anchorOf(el);
+		let anchor = '';
+		if (id) {
+			const u = new URL(document.baseURI);
+			u.hash = id;
+			anchor = u.href;
+		}
+		out.push({level, text, id, anchor});
+	}
+	return out;
+}`
+
+func headingsExpression(maxLevel int) string {
+	return "(" + headingsScript + ")(" + strconv.Itoa(maxLevel) + ")"
+}
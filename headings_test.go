@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestHeadingsParam(t *testing.T) {
+	allowTestServer(t)
+	for _, tc := range []struct {
+		query string
+		want  int
+	}{
+		{"url=http://127.0.0.1/", 0},
+		{"url=http://127.0.0.1/&headings", 6},
+		{"url=http://127.0.0.1/&headings=true", 6},
+		{"url=http://127.0.0.1/&headings=1", 1},
+		{"url=http://127.0.0.1/&headings=3", 3},
+		{"url=http://127.0.0.1/&fields=url,headings", 6},
+	} {
+		q, err := url.ParseQuery(tc.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if raw := q.Get("fields"); raw != "" {
+			applyFieldSelection(q, parseFieldsParam(raw))
+		}
+		opts, err := parseScrapeOptions(q)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.query, err)
+		}
+		if opts.Headings != tc.want {
+			t.Errorf("%s: Headings = %d, want %d", tc.query, opts.Headings, tc.want)
+		}
+	}
+	if _, err := parseHeadingsParam("7"); err == nil {
+		t.Error("headings=7: ошибки нет")
+	}
+}
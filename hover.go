@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/chromedp/cdproto/input"
+	"github.com/chromedp/chromedp"
+)
+
+// maxHoverTargets ограничивает число наведений на один селектор, чтобы
+// селектор вроде "a" не растянул запрос на минуты.
+const maxHoverTargets = 50
+
+// hoverPointScript прокручивает к i-му элементу селектора и возвращает
+// координаты его центра во вьюпорте.
+const hoverPointScript = `(() => {
+	const el = document.querySelectorAll(%s)[%d];
+	if (!el) return null;
+	el.scrollIntoView({block: 'center', inline: 'center'});
+	const r = el.getBoundingClientRect();
+	if (r.width === 0 || r.height === 0) return null;
+	return {x: r.left + r.width / 2, y: r.top + r.height / 2};
+})()`
+
+type hoverPoint struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// hoverElements по очереди наводит курсор на все элементы селекторов.
+// Используются настоящие события мыши CDP (Input.dispatchMouseEvent), а не
+// синтетические из JS, поэтому срабатывают и :hover в CSS, и обработчики
+// mouseenter/mouseover. После каждого наведения ждём wait, чтобы
+// раскрывающееся меню или подсказка успели отрисоваться.
+func hoverElements(selectors []string, wait time.Duration) chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		for _, sel := range selectors {
+			var count int
+			if err := chromedp.Evaluate(fmt.Sprintf(`document.querySelectorAll(%s).length`, jsString(sel)), &count).Do(ctx); err != nil {
+				slog.WarnContext(ctx, "Шаг [1.3]: некорректный селектор наведения", "selector", sel, "error", err.Error())
+				continue
+			}
+			count = min(count, maxHoverTargets)
+			hovered := 0
+			for i := 0; i < count; i++ {
+				var point *hoverPoint
+				if err := chromedp.Evaluate(fmt.Sprintf(hoverPointScript, jsString(sel), i), &point).Do(ctx); err != nil {
+					return err
+				}
+				if point == nil {
+					continue
+				}
+				if err := input.DispatchMouseEvent(input.MouseMoved, point.X, point.Y).Do(ctx); err != nil {
+					return err
+				}
+				hovered++
+				if err := chromedp.Sleep(wait).Do(ctx); err != nil {
+					return err
+				}
+			}
+			slog.InfoContext(ctx, "Шаг [1.3]: наведение", "selector", sel, "elements", hovered)
+		}
+		return nil
+	})
+}
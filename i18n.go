@@ -0,0 +1,340 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Локализация сообщений об ошибках для клиентов API. Код формирует
+// сообщения по-русски, как и раньше; при отдаче клиенту writeJsonError
+// переводит их по каталогу на язык запроса (Accept-Language, по умолчанию
+// API_LANG, иначе ru) и добавляет стабильный машинный код ошибки.
+//
+// Шаблоны каталога — русские строки с %s на месте подставляемых частей.
+// Подставленные части переводятся рекурсивно, поэтому «Не удалось
+// выполнить скрапинг: <ошибка>» переводится целиком вместе с вложенной
+// ошибкой. Сообщения вне каталога (например, ошибки Chrome) отдаются как есть.
+// Новое сообщение для клиента должно сопровождаться записью в каталоге.
+
+var supportedLangs = map[string]bool{"ru": true, "en": true}
+
+// defaultLang — язык, если клиент не прислал подходящий Accept-Language.
+var defaultLang = "ru"
+
+type catalogEntry struct {
+	code string
+	ru   string
+	en   string
+	re   *regexp.Regexp
+}
+
+var messageCatalog = []*catalogEntry{
+	// Общие
+	{code: "unauthorized", ru: "Нужен действующий ключ API в заголовке X-Api-Key", en: "A valid API key is required in the X-Api-Key header"},
+	{code: "too_many_requests", ru: "Превышен лимит запросов, повторите через %s с", en: "Request limit exceeded, retry in %s s"},
+	{code: "method_not_allowed", ru: "Метод не поддерживается", en: "Method not allowed"},
+	{code: "invalid_body", ru: "Тело запроса должно быть JSON вида %s", en: "Request body must be JSON like %s"},
+	{code: "invalid_body", ru: "Поле '%s' тела запроса имеет неподдерживаемое значение", en: "Request body field '%s' has an unsupported value"},
+	{code: "invalid_body", ru: "Поле '%s' тела запроса обязательно", en: "Request body field '%s' is required"},
+	{code: "invalid_body", ru: "Поле '%s' тела запроса должно быть числом миллисекунд от %s до %s", en: "Request body field '%s' must be a number of milliseconds from %s to %s"},
+	{code: "invalid_body", ru: "Поле 'extract' тела запроса должно быть массивом строк", en: "Request body field 'extract' must be an array of strings"},
+	{code: "scrape_failed", ru: "Не удалось выполнить скрапинг: %s", en: "Scraping failed: %s"},
+	{code: "response_failed", ru: "Не удалось сформировать ответ: %s", en: "Failed to build the response: %s"},
+	{code: "offload_failed", ru: "Не удалось выгрузить крупные поля: %s", en: "Failed to offload large fields: %s"},
+	{code: "template_failed", ru: "Не удалось применить шаблон: %s", en: "Failed to render the template: %s"},
+	{code: "rate_limited", ru: "сайт ограничил частоту запросов (HTTP %s, Retry-After %s с, попыток: %s)", en: "the site is rate limiting requests (HTTP %s, Retry-After %s s, attempts: %s)"},
+
+	// Параметры
+	{code: "missing_param", ru: "Параметр '%s' обязателен", en: "Parameter '%s' is required"},
+	{code: "invalid_param", ru: "Параметр '%s' должен быть корректным регулярным выражением", en: "Parameter '%s' must be a valid regular expression"},
+	{code: "invalid_param", ru: "Параметр '%s' должен быть неотрицательным целым числом", en: "Parameter '%s' must be a non-negative integer"},
+	{code: "invalid_param", ru: "Параметр '%s' должен быть числом миллисекунд от %s до %s", en: "Parameter '%s' must be a number of milliseconds from %s to %s"},
+	{code: "invalid_param", ru: "Параметр '%s' должен быть числом от %s до %s или auto", en: "Parameter '%s' must be a number from %s to %s or auto"},
+	{code: "invalid_param", ru: "Параметр '%s' должен быть числом от %s до %s", en: "Parameter '%s' must be a number from %s to %s"},
+	{code: "invalid_param", ru: "Параметр '%s' может принимать значения: %s", en: "Parameter '%s' accepts the values: %s"},
+	{code: "invalid_param", ru: "Параметр '%s' должен содержать 1, 2 или 4 числа миллиметров от %s до %s через запятую", en: "Parameter '%s' must contain 1, 2 or 4 comma-separated millimetre values from %s to %s"},
+	{code: "invalid_param", ru: "Параметр '%s' должен быть датой (YYYY-MM-DD или RFC3339)", en: "Parameter '%s' must be a date (YYYY-MM-DD or RFC3339)"},
+	{code: "invalid_param", ru: "Параметр '%s' должен быть JSON-объектом", en: "Parameter '%s' must be a JSON object"},
+	{code: "invalid_param", ru: "Параметр '%s' может содержать не больше %s правил", en: "Parameter '%s' may contain at most %s rules"},
+	{code: "invalid_param", ru: "Параметр '%s' может содержать не больше %s шагов", en: "Parameter '%s' may contain at most %s steps"},
+	{code: "invalid_param", ru: "Параметр '%s' должен быть JSON-объектом со строковыми значениями", en: "Parameter '%s' must be a JSON object with string values"},
+	{code: "invalid_param", ru: "Параметр '%s' может содержать не больше %s заголовков", en: "Parameter '%s' may contain at most %s headers"},
+	{code: "invalid_param", ru: "Параметр '%s' должен иметь вид широта,долгота[,точность в метрах]", en: "Parameter '%s' must look like latitude,longitude[,accuracy in metres]"},
+	{code: "invalid_param", ru: "Параметр '%s' должен быть тегом языка, например %s", en: "Parameter '%s' must be a language tag, e.g. %s"},
+	{code: "invalid_param", ru: "Параметр '%s' должен быть часовым поясом IANA, например %s", en: "Parameter '%s' must be an IANA time zone, e.g. %s"},
+	{code: "invalid_param", ru: "Параметры '%s' и '%s' нельзя указывать вместе", en: "Parameters '%s' and '%s' cannot be used together"},
+	{code: "invalid_param", ru: "Заголовок '%s' нельзя переопределить", en: "Header '%s' cannot be overridden"},
+	{code: "invalid_param", ru: "Параметр 'cookies' должен быть JSON-массивом объектов {name, value, domain, ...}", en: "Parameter 'cookies' must be a JSON array of objects {name, value, domain, ...}"},
+	{code: "invalid_param", ru: "Параметр '%s' может содержать не больше %s кук", en: "Parameter '%s' may contain at most %s cookies"},
+	{code: "invalid_param", ru: "Кука %s в cookies: нужно имя", en: "Cookie %s in cookies: name is required"},
+	{code: "invalid_param", ru: "Кука %s в cookies: same_site может принимать значения: Strict, Lax, None", en: "Cookie %s in cookies: same_site accepts the values: Strict, Lax, None"},
+	{code: "invalid_param", ru: "Параметр 'actions' должен быть JSON-массивом шагов", en: "Parameter 'actions' must be a JSON array of steps"},
+	{code: "invalid_param", ru: "Шаг %s в actions: нужен selector", en: "Step %s in actions: selector is required"},
+	{code: "invalid_param", ru: "Шаг %s в actions: неизвестная клавиша %s", en: "Step %s in actions: unknown key %s"},
+	{code: "invalid_param", ru: "Шаг %s в actions: неизвестное действие '%s'", en: "Step %s in actions: unknown action '%s'"},
+	{code: "invalid_param", ru: "Шаг %s в actions: ms должно быть от 0 до %s", en: "Step %s in actions: ms must be from 0 to %s"},
+	{code: "invalid_param", ru: "Шаг %s в actions: timeout должен быть от 0 до %s", en: "Step %s in actions: timeout must be from 0 to %s"},
+	{code: "invalid_param", ru: "Правило '%s' в selectors должно быть строкой или объектом {selector, attr, all}", en: "Rule '%s' in selectors must be a string or an object {selector, attr, all}"},
+	{code: "storage_disabled", ru: "Параметр '%s' требует включённого хранилища (STORAGE_DIR)", en: "Parameter '%s' requires storage to be enabled (STORAGE_DIR)"},
+	{code: "invalid_param", ru: "Параметр 'previous_hash' должен быть значением hash: SHA-256 в шестнадцатеричной записи", en: "Parameter 'previous_hash' must be a hash value: a hex-encoded SHA-256"},
+	{code: "invalid_param", ru: "Укажите ровно один из параметров 'url' или 'domain'", en: "Specify exactly one of the parameters 'url' or 'domain'"},
+
+	// Возможности, выключенные конфигурацией
+	{code: "storage_disabled", ru: "Хранилище результатов выключено (задайте STORAGE_DIR)", en: "Result storage is disabled (set STORAGE_DIR)"},
+	{code: "cache_disabled", ru: "Кэш результатов выключен (задайте CACHE_TTL)", en: "Result cache is disabled (set CACHE_TTL)"},
+	{code: "debug_disabled", ru: "Отладочная консоль выключена (задайте DEBUG_TOKEN)", en: "Debug console is disabled (set DEBUG_TOKEN)"},
+	{code: "debug_disabled", ru: "Отладочная консоль недоступна на координаторе: у него нет браузера", en: "Debug console is unavailable on the coordinator: it has no browser"},
+	{code: "unauthorized", ru: "Неверный отладочный токен", en: "Invalid debug token"},
+	{code: "unauthorized", ru: "Неверный или не настроенный ADMIN_TOKEN", en: "Invalid or unconfigured ADMIN_TOKEN"},
+	{code: "eval_disabled", ru: "Выполнение JavaScript выключено (задайте EVAL_TOKEN)", en: "JavaScript evaluation is disabled (set EVAL_TOKEN)"},
+	{code: "eval_not_allowed", ru: "Параметр 'eval' принимается только в теле POST /scrape", en: "Parameter 'eval' is only accepted in the body of POST /scrape"},
+	{code: "unauthorized", ru: "Неверный EVAL_TOKEN", en: "Invalid EVAL_TOKEN"},
+	{code: "template_not_found", ru: "шаблоны ответа не настроены (задайте TEMPLATES_DIR)", en: "response templates are not configured (set TEMPLATES_DIR)"},
+	{code: "template_not_found", ru: "шаблон %s не найден", en: "template %s not found"},
+
+	// Хранилище
+	{code: "not_found", ru: "Версия не найдена", en: "Version not found"},
+	{code: "not_found", ru: "версия не найдена", en: "version not found"},
+	{code: "not_found", ru: "Артефакт не найден", en: "Artifact not found"},
+	{code: "not_found", ru: "Снимок для указанной версии не найден", en: "No screenshot for the given version"},
+	{code: "not_found", ru: "Для сравнения нужны минимум два снимка (скрапьте url с параметром visual)", en: "At least two screenshots are needed for comparison (scrape the url with the visual parameter)"},
+	{code: "not_found", ru: "Для этого url нет сохранённых результатов с simhash", en: "No stored results with a simhash for this url"},
+	{code: "invalid_param", ru: "Формат parquet не поддерживается: выгрузите ndjson или csv и преобразуйте на своей стороне", en: "The parquet format is not supported: export ndjson or csv and convert it on your side"},
+	{code: "storage_error", ru: "Некорректный simhash в хранилище", en: "Invalid simhash in storage"},
+	{code: "storage_error", ru: "Не удалось прочитать хранилище: %s", en: "Failed to read storage: %s"},
+	{code: "storage_error", ru: "Не удалось обойти хранилище: %s", en: "Failed to scan storage: %s"},
+	{code: "storage_error", ru: "Не удалось удалить версии: %s", en: "Failed to delete versions: %s"},
+	{code: "storage_error", ru: "Не удалось прочитать версию: %s", en: "Failed to read the version: %s"},
+	{code: "storage_error", ru: "Не удалось прочитать историю: %s", en: "Failed to read history: %s"},
+	{code: "storage_error", ru: "Не удалось прочитать артефакт: %s", en: "Failed to read the artifact: %s"},
+	{code: "storage_error", ru: "Не удалось прочитать снимок: %s", en: "Failed to read the screenshot: %s"},
+	{code: "internal_error", ru: "Не удалось закодировать изображение: %s", en: "Failed to encode the image: %s"},
+
+	// Удалённое решение CAPTCHA
+	{code: "no_captcha", ru: "Сейчас нет CAPTCHA, ожидающей решения", en: "There is no CAPTCHA waiting to be solved"},
+	{code: "invalid_param", ru: "Параметры 'x' и 'y' должны быть числами", en: "Parameters 'x' and 'y' must be numbers"},
+	{code: "invalid_param", ru: "Поддерживается только клавиша Enter", en: "Only the Enter key is supported"},
+	{code: "captcha_action_failed", ru: "Не удалось выполнить действие: %s", en: "Failed to perform the action: %s"},
+
+	// Прокси
+	{code: "invalid_proxy", ru: "Прокси должен быть задан как http://, https:// или socks5://[логин:пароль@]хост:порт", en: "Proxy must be given as http://, https:// or socks5://[user:password@]host:port"},
+	{code: "invalid_proxy", ru: "Chrome не поддерживает авторизацию в SOCKS5-прокси", en: "Chrome does not support authentication for SOCKS5 proxies"},
+	{code: "proxy_pool_disabled", ru: "Пул прокси не настроен (задайте PROXY_LIST или PROXY_FILE)", en: "Proxy pool is not configured (set PROXY_LIST or PROXY_FILE)"},
+
+	// Профиль браузера
+	{code: "profile_disabled", ru: "Профиль на диске не настроен (задайте PROFILE_DIR или -user-data-dir)", en: "On-disk profile is not configured (set PROFILE_DIR or -user-data-dir)"},
+	{code: "profile_error", ru: "Не удалось очистить профиль: %s", en: "Failed to clear the profile: %s"},
+	{code: "not_found", ru: "Неизвестное действие с профилем: %s", en: "Unknown profile action: %s"},
+	{code: "browser_unavailable", ru: "Браузер на координаторе не запускается", en: "The coordinator does not run a browser"},
+
+	// Обход
+	{code: "invalid_param", ru: "Параметр 'template' не поддерживается при обходе", en: "Parameter 'template' is not supported when crawling"},
+	{code: "sitemap_failed", ru: "Не удалось загрузить sitemap: %s", en: "Failed to load the sitemap: %s"},
+	{code: "shutting_down", ru: "Сервер останавливается, обход прерван", en: "The server is shutting down, the crawl was interrupted"},
+
+	// Скачивание файлов
+	{code: "download_failed", ru: "Не удалось скачать файл: %s", en: "Failed to download the file: %s"},
+	{code: "storage_error", ru: "Не удалось сохранить файл: %s", en: "Failed to save the file: %s"},
+	{code: "browser_unavailable", ru: "Скачивание недоступно на координаторе: у него нет браузера", en: "Downloads are unavailable on the coordinator: it has no browser"},
+	{ru: "больше %s байт", en: "more than %s bytes"},
+
+	// Асинхронные задачи
+	{code: "job_not_found", ru: "Задача не найдена", en: "Job not found"},
+	{code: "invalid_param", ru: "Параметр 'callback_url' должен быть абсолютным http(s)-адресом", en: "Parameter 'callback_url' must be an absolute http(s) URL"},
+	{code: "invalid_param", ru: "Параметр 'template' не поддерживается в асинхронном режиме", en: "Parameter 'template' is not supported in async mode"},
+
+	// Мониторы
+	{code: "monitor_not_found", ru: "Монитор не найден", en: "Monitor not found"},
+	{code: "too_many_monitors", ru: "Достигнут предел мониторов: %s", en: "Monitor limit reached: %s"},
+	{code: "invalid_param", ru: "Параметр '%s' не поддерживается в мониторах", en: "Parameter '%s' is not supported in monitors"},
+	{code: "invalid_param", ru: "Прокси с логином и паролем не поддерживается в мониторах: параметры монитора хранятся открытым текстом", en: "A proxy with a username and password is not supported in monitors: monitor parameters are stored in plain text"},
+	{code: "invalid_param", ru: "Параметр 'interval' должен быть числом секунд от %s до %s", en: "Parameter 'interval' must be a number of seconds from %s to %s"},
+	{code: "invalid_param", ru: "Параметр 'webhook' должен быть абсолютным http(s)-адресом", en: "Parameter 'webhook' must be an absolute http(s) URL"},
+	{code: "telegram_disabled", ru: "Уведомления в Telegram не настроены (задайте TELEGRAM_BOT_TOKEN и TELEGRAM_CHAT_ID)", en: "Telegram notifications are not configured (set TELEGRAM_BOT_TOKEN and TELEGRAM_CHAT_ID)"},
+	{code: "invalid_param", ru: "Укажите, куда сообщать об изменениях: 'webhook' и/или 'telegram'", en: "Specify where to report changes: 'webhook' and/or 'telegram'"},
+	{ru: "страница ответила статусом %s", en: "the page responded with status %s"},
+
+	// Сессии
+	{code: "session_not_found", ru: "Сессия '%s' не найдена (создайте её через POST /sessions)", en: "Session '%s' not found (create it with POST /sessions)"},
+	{code: "session_lost", ru: "Сессия '%s' потеряна при перезапуске браузера", en: "Session '%s' was lost when the browser restarted"},
+	{code: "session_exists", ru: "Сессия '%s' уже существует", en: "Session '%s' already exists"},
+	{code: "invalid_session", ru: "Имя сессии может содержать латиницу, цифры, _ . - (до 64 символов)", en: "A session name may contain Latin letters, digits, _ . - (up to 64 characters)"},
+	{code: "invalid_param", ru: "Параметр 'session' может содержать латиницу, цифры, _ . - (до 64 символов)", en: "Parameter 'session' may contain Latin letters, digits, _ . - (up to 64 characters)"},
+	{code: "login_failed", ru: "Вход не выполнен: %s", en: "Login failed: %s"},
+	{code: "session_failed", ru: "Не удалось создать сессию: %s", en: "Failed to create the session: %s"},
+	{code: "sessions_unavailable", ru: "Сессии недоступны на координаторе: они создаются на воркерах при первом скрапинге с session", en: "Sessions are unavailable on the coordinator: workers create them on the first scrape with session"},
+
+	// Политика адресов
+	{code: "forbidden_target", ru: "Адрес '%s' не поддерживается: нужен абсолютный http(s)-адрес", en: "URL '%s' is not supported: an absolute http(s) URL is required"},
+	{code: "forbidden_target", ru: "Домен '%s' запрещён для скрапинга", en: "Domain '%s' may not be scraped"},
+	{code: "forbidden_target", ru: "Адрес '%s' запрещён для скрапинга: %s (%s)", en: "Address '%s' may not be scraped: %s (%s)"},
+	{code: "forbidden_target", ru: "Параметр '%s' запрещён: адрес '%s' — %s (%s)", en: "Parameter '%s' is not allowed: host '%s' is %s (%s)"},
+	{ru: "слишком много переадресаций", en: "too many redirects"},
+	{ru: "переадресация на %s не поддерживается", en: "redirect to %s is not supported"},
+
+	// Скрапинг
+	{code: "captcha_pending", ru: "на сайте %s ожидает решения CAPTCHA, попробуйте позже", en: "a CAPTCHA on %s is waiting to be solved, try again later"},
+	{code: "domain_rate_limited", ru: "превышен лимит скрапинга домена %s, повторите через %s с", en: "scrape limit for domain %s exceeded, retry in %s s"},
+	{code: "storage_error", ru: "не удалось сохранить архив MHTML: %s", en: "failed to save the MHTML archive: %s"},
+	{code: "invalid_pdf", ru: "некорректный PDF: %s", en: "invalid PDF: %s"},
+	{code: "pdf_unavailable", ru: "печать в PDF доступна только в headless-режиме (флаг -headless)", en: "PDF printing is only available in headless mode (-headless flag)"},
+	{code: "tab_crashed", ru: "вкладка упала во время загрузки (нехватка памяти или сбой рендерера Chrome)", en: "the tab crashed while loading (out of memory or Chrome renderer failure)"},
+	{code: "wait_timeout", ru: "элемент '%s' не появился за %s", en: "element '%s' did not appear within %s"},
+	{code: "wait_timeout", ru: "элемент '%s' не найден за %s", en: "element '%s' was not found within %s"},
+	{code: "action_failed", ru: "шаг %s в actions (%s): %s", en: "step %s in actions (%s): %s"},
+	{ru: "кодировка %s не поддерживается", en: "encoding %s is not supported"},
+
+	// Кластер
+	{code: "cluster_error", ru: "не удалось поставить задачу в очередь: %s", en: "failed to enqueue the job: %s"},
+	{code: "cluster_timeout", ru: "воркер не ответил за %s", en: "no worker replied within %s"},
+	{code: "cluster_error", ru: "ошибка ожидания ответа воркера: %s", en: "error while waiting for a worker reply: %s"},
+	{code: "cluster_error", ru: "неожиданный ответ Redis: %s", en: "unexpected Redis reply: %s"},
+	{code: "cluster_error", ru: "некорректный ответ воркера: %s", en: "invalid worker reply: %s"},
+	{code: "cluster_error", ru: "некорректные параметры задачи: %s", en: "invalid job parameters: %s"},
+
+	// GraphQL
+	{code: "graphql_syntax", ru: "синтаксическая ошибка GraphQL (позиция %s): %s", en: "GraphQL syntax error (position %s): %s"},
+	{code: "graphql_unsupported", ru: "операция %s не поддерживается", en: "operation %s is not supported"},
+	{code: "graphql_invalid", ru: "не передано значение переменной $%s", en: "no value passed for variable $%s"},
+	{code: "graphql_invalid", ru: "неизвестное поле '%s' (доступно: scrape)", en: "unknown field '%s' (available: scrape)"},
+	{code: "graphql_invalid", ru: "для поля scrape нужно выбрать хотя бы одно поле ответа", en: "select at least one response field for scrape"},
+	{ru: "лишние символы после запроса", en: "unexpected characters after the query"},
+	{ru: "ожидался символ '%s'", en: "expected character '%s'"},
+	{ru: "не закрыто объявление переменных", en: "unterminated variable declarations"},
+	{ru: "пустой набор полей", en: "empty selection set"},
+	{ru: "фрагменты не поддерживаются", en: "fragments are not supported"},
+	{ru: "директивы не поддерживаются", en: "directives are not supported"},
+	{ru: "ожидалось имя поля", en: "expected a field name"},
+	{ru: "ожидалось имя поля после псевдонима", en: "expected a field name after the alias"},
+	{ru: "ожидалось имя аргумента", en: "expected an argument name"},
+	{ru: "ожидалось имя переменной", en: "expected a variable name"},
+	{ru: "не закрыт список", en: "unterminated list"},
+	{ru: "некорректное число", en: "invalid number"},
+	{ru: "объекты в аргументах не поддерживаются", en: "objects in arguments are not supported"},
+	{ru: "ожидалось значение аргумента", en: "expected an argument value"},
+	{ru: "незавершённая escape-последовательность", en: "unterminated escape sequence"},
+	{ru: "некорректная escape-последовательность \\u", en: "invalid \\u escape sequence"},
+	{ru: "перенос строки внутри строкового литерала", en: "newline inside a string literal"},
+	{ru: "не закрыт строковый литерал", en: "unterminated string literal"},
+
+	// transform
+	{code: "invalid_transform", ru: "выражение transform должно начинаться с '$'", en: "the transform expression must start with '$'"},
+	{code: "invalid_transform", ru: "ожидалось имя после '..' в transform", en: "expected a name after '..' in transform"},
+	{code: "invalid_transform", ru: "ожидалось имя поля после '.' в transform", en: "expected a field name after '.' in transform"},
+	{code: "invalid_transform", ru: "не закрыта скобка '[' в transform", en: "unclosed '[' in transform"},
+	{code: "invalid_transform", ru: "неожиданный символ %s в transform", en: "unexpected character %s in transform"},
+	{code: "invalid_transform", ru: "некорректный срез [%s] в transform", en: "invalid slice [%s] in transform"},
+	{code: "invalid_transform", ru: "некорректный индекс [%s] в transform", en: "invalid index [%s] in transform"},
+	{code: "invalid_transform", ru: "некорректное регулярное выражение в фильтре transform: %s", en: "invalid regular expression in transform filter: %s"},
+	{code: "invalid_transform", ru: "некорректное значение %s в фильтре transform", en: "invalid value %s in transform filter"},
+	{code: "invalid_transform", ru: "фильтр transform должен ссылаться на @", en: "a transform filter must refer to @"},
+}
+
+func init() {
+	for _, e := range messageCatalog {
+		parts := strings.Split(e.ru, "%s")
+		for i, p := range parts {
+			parts[i] = regexp.QuoteMeta(p)
+		}
+		e.re = regexp.MustCompile("^" + strings.Join(parts, "(.*?)") + "$")
+	}
+}
+
+func loadLanguageConfig() {
+	if lang := os.Getenv("API_LANG"); lang != "" {
+		if !supportedLangs[lang] {
+			log.Fatalf("API_LANG может принимать значения: ru, en; получено %q", lang)
+		}
+		defaultLang = lang
+	}
+}
+
+// localize переводит сообщение на lang и возвращает код ошибки по
+// внешнему шаблону ("" для сообщений вне каталога).
+func localize(lang, message string) (string, string) {
+	for _, e := range messageCatalog {
+		m := e.re.FindStringSubmatch(message)
+		if m == nil {
+			continue
+		}
+		if lang == "ru" {
+			return message, e.code
+		}
+		args := make([]any, len(m)-1)
+		for i, sub := range m[1:] {
+			args[i], _ = localize(lang, sub)
+		}
+		return fmt.Sprintf(e.en, args...), e.code
+	}
+	return message, ""
+}
+
+// negotiateLang выбирает язык по Accept-Language с учётом весов q.
+func negotiateLang(header string) string {
+	type candidate struct {
+		lang string
+		q    float64
+	}
+	var candidates []candidate
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		lang, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		if supportedLangs[lang] && q > 0 {
+			candidates = append(candidates, candidate{lang, q})
+		}
+	}
+	if len(candidates) == 0 {
+		return defaultLang
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].q > candidates[j].q })
+	return candidates[0].lang
+}
+
+// langResponseWriter несёт выбранный язык до writeJsonError, не меняя
+// сигнатуры обработчиков.
+type langResponseWriter struct {
+	http.ResponseWriter
+	lang string
+}
+
+func (w *langResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack нужен WebSocket-консоли.
+func (w *langResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
+
+func (w *langResponseWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+// withLanguage определяет язык ответа для каждого запроса.
+func withLanguage(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(&langResponseWriter{ResponseWriter: w, lang: negotiateLang(r.Header.Get("Accept-Language"))}, r)
+	})
+}
+
+// responseLang — язык ответа, выбранный withLanguage.
+func responseLang(w http.ResponseWriter) string {
+	if lw, ok := w.(*langResponseWriter); ok {
+		return lw.lang
+	}
+	return defaultLang
+}
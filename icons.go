@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/io"
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/chromedp"
+)
+
+// Иконки страницы (icons=true): <link rel="icon">, apple-touch-icon,
+// mask-icon и иконки из web app manifest с абсолютными адресами и
+// размерами — для превью ссылок. Если иконок не объявлено, возвращается
+// /favicon.ico, который браузер запрашивает сам. icons=best дополнительно
+// скачивает самую крупную иконку в icon. Манифест и иконка загружаются
+// через Network.loadNetworkResource — от имени страницы, с её куками и
+// прокси, но без ограничений CORS.
+
+var validIconModes = map[string]bool{"true": true, "best": true}
+
+const (
+	maxManifestSize = 1 << 20
+	maxIconSize     = 1 << 20
+)
+
+// Icon — объявленная иконка страницы.
+type Icon struct {
+	URL     string `json:"url"`
+	Rel     string `json:"rel"`             // icon, apple-touch-icon, mask-icon, manifest или default
+	Sizes   string `json:"sizes,omitempty"` // Как объявлено: 32x32, 192x192 512x512, any
+	Width   int    `json:"width,omitempty"` // Наибольший из sizes
+	Height  int    `json:"height,omitempty"`
+	Type    string `json:"type,omitempty"`
+	Purpose string `json:"purpose,omitempty"` // Из манифеста: any, maskable, monochrome
+}
+
+// IconData — скачанная иконка (icons=best).
+type IconData struct {
+	URL         string `json:"url"`
+	ContentType string `json:"content_type,omitempty"`
+	Data        []byte `json:"data"`
+}
+
+// iconsResult — результат iconsScript.
+type iconsResult struct {
+	Icons    []Icon `json:"icons"`
+	Manifest string `json:"manifest"`
+}
+
+// iconsScript собирает <link rel> иконок и адрес манифеста.
+const iconsScript = `(() => {
+	const icons = [];
+	const rels = ['icon', 'shortcut', 'apple-touch-icon', 'apple-touch-icon-precomposed', 'mask-icon', 'fluid-icon'];
+	for (const el of document.querySelectorAll('link[rel][href]')) {
+		const list = el.getAttribute('rel').toLowerCase().split(/\s+/);
+		const rel = list.find(r => rels.includes(r) && r !== 'shortcut') || (list.includes('shortcut') ? 'icon' : '');
+		if (!rel) continue;
+		icons.push({url: el.href, rel: rel === 'apple-touch-icon-precomposed' ? 'apple-touch-icon' : rel,
+			sizes: (el.getAttribute('sizes') || '').trim(), type: (el.getAttribute('type') || '').trim()});
+	}
+	const manifest = document.querySelector('link[rel~="manifest" i][href]');
+	return {icons, manifest: manifest ? manifest.href : ''};
+})()`
+
+// setIconSize заполняет Width/Height наибольшим размером из sizes.
+func (icon *Icon) setIconSize() {
+	for _, size := range strings.Fields(strings.ToLower(icon.Sizes)) {
+		w, h, ok := strings.Cut(size, "x")
+		if !ok {
+			continue
+		}
+		width, err1 := strconv.Atoi(w)
+		height, err2 := strconv.Atoi(h)
+		if err1 == nil && err2 == nil && width*height > icon.Width*icon.Height {
+			icon.Width, icon.Height = width, height
+		}
+	}
+}
+
+// iconScore упорядочивает иконки для icons=best: крупнее — лучше; без
+// размеров — по типичному размеру для rel. SVG масштабируется без потерь,
+// но не все клиенты превью его показывают, поэтому идёт после растровых
+// крупнее 128px.
+func iconScore(icon Icon) int {
+	if icon.Width > 0 {
+		return icon.Width * icon.Height
+	}
+	switch {
+	case icon.Rel == "mask-icon":
+		return 0 // Одноцветный силуэт для Safari
+	case icon.Type == "image/svg+xml" || strings.HasSuffix(strings.ToLower(icon.URL), ".svg"):
+		return 128 * 128
+	case icon.Rel == "apple-touch-icon":
+		return 180 * 180
+	}
+	return 16 * 16
+}
+
+// loadResource загружает адрес от имени основного фрейма вкладки.
+func loadResource(ctx context.Context, rawURL string, limit int) ([]byte, string, error) {
+	data, headers, err := loadResourceHeaders(ctx, rawURL, limit)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, headerValue(headers, "Content-Type"), nil
+}
+
+// loadResourceHeaders — loadResource с заголовками ответа.
+func loadResourceHeaders(ctx context.Context, rawURL string, limit int) ([]byte, network.Headers, error) {
+	if err := checkTargetURL(rawURL); err != nil {
+		return nil, nil, err
+	}
+	tree, err := page.GetFrameTree().Do(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	res, err := network.LoadNetworkResource(rawURL, &network.LoadNetworkResourceOptions{IncludeCredentials: true}).
+		WithFrameID(tree.Frame.ID).Do(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !res.Success {
+		if res.NetErrorName != "" {
+			return nil, nil, errors.New(res.NetErrorName)
+		}
+		return nil, nil, fmt.Errorf("HTTP %d", int(res.HTTPStatusCode))
+	}
+	defer io.Close(res.Stream).Do(ctx)
+	var data []byte
+	for {
+		var chunk io.ReadReturns
+		if err := cdp.Execute(ctx, io.CommandRead, io.Read(res.Stream), &chunk); err != nil {
+			return nil, nil, err
+		}
+		if chunk.Base64encoded {
+			decoded, err := base64.StdEncoding.DecodeString(chunk.Data)
+			if err != nil {
+				return nil, nil, err
+			}
+			data = append(data, decoded...)
+		} else {
+			data = append(data, chunk.Data...)
+		}
+		if len(data) > limit {
+			return nil, nil, fmt.Errorf("больше %d байт", limit)
+		}
+		if chunk.EOF {
+			break
+		}
+	}
+	return data, res.Headers, nil
+}
+
+// manifestIcons читает иконки из web app manifest.
+func manifestIcons(ctx context.Context, manifestURL string) ([]Icon, error) {
+	data, _, err := loadResource(ctx, manifestURL, maxManifestSize)
+	if err != nil {
+		return nil, err
+	}
+	var manifest struct {
+		Icons []struct {
+			Src     string `json:"src"`
+			Sizes   string `json:"sizes"`
+			Type    string `json:"type"`
+			Purpose string `json:"purpose"`
+		} `json:"icons"`
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, err
+	}
+	base, _ := url.Parse(manifestURL)
+	var icons []Icon
+	for _, m := range manifest.Icons {
+		src, err := base.Parse(strings.TrimSpace(m.Src))
+		if err != nil || m.Src == "" {
+			continue
+		}
+		icons = append(icons, Icon{URL: src.String(), Rel: "manifest", Sizes: m.Sizes, Type: m.Type, Purpose: m.Purpose})
+	}
+	return icons, nil
+}
+
+// collectIcons собирает иконки страницы и, если best, скачивает лучшую.
+// Ошибки манифеста и скачивания не прерывают скрапинг — только пишутся в лог.
+func collectIcons(pageURL string, best bool, icons *[]Icon, data **IconData) chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		slog.InfoContext(ctx, "Шаг [1.6]: собираю иконки страницы")
+		var res iconsResult
+		if err := chromedp.Evaluate(iconsScript, &res).Do(ctx); err != nil {
+			return err
+		}
+		found := res.Icons
+		if res.Manifest != "" {
+			fromManifest, err := manifestIcons(ctx, res.Manifest)
+			if err != nil {
+				slog.WarnContext(ctx, "Не удалось прочитать манифест", "url", res.Manifest, "error", err)
+			}
+			found = append(found, fromManifest...)
+		}
+		if len(found) == 0 {
+			if u, err := url.Parse(pageURL); err == nil {
+				found = append(found, Icon{URL: u.Scheme + "://" + u.Host + "/favicon.ico", Rel: "default"})
+			}
+		}
+		seen := map[string]bool{}
+		for _, icon := range found {
+			if seen[icon.URL+" "+icon.Sizes] {
+				continue
+			}
+			seen[icon.URL+" "+icon.Sizes] = true
+			icon.setIconSize()
+			*icons = append(*icons, icon)
+		}
+		if !best || len(*icons) == 0 {
+			return nil
+		}
+		ranked := append([]Icon(nil), *icons...)
+		sort.SliceStable(ranked, func(i, j int) bool { return iconScore(ranked[i]) > iconScore(ranked[j]) })
+		// Лучшая может не загрузиться (битая ссылка) — пробуем следующие.
+		for _, icon := range ranked {
+			body, contentType, err := loadResource(ctx, icon.URL, maxIconSize)
+			if err != nil {
+				slog.WarnContext(ctx, "Не удалось скачать иконку", "url", icon.URL, "error", err)
+				continue
+			}
+			*data = &IconData{URL: icon.URL, ContentType: contentType, Data: body}
+			break
+		}
+		return nil
+	})
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/chromedp/chromedp"
+)
+
+// Image — изображение страницы. Адреса абсолютные.
+type Image struct {
+	Src    string   `json:"src"`              // Фактически загруженный адрес (currentSrc), иначе data-src/src
+	Srcset []string `json:"srcset,omitempty"` // Кандидаты из srcset/data-srcset
+	Alt    string   `json:"alt"`
+	Width  int      `json:"width,omitempty"` // Натуральные размеры; 0 — не загрузилось
+	Height int      `json:"height,omitempty"`
+}
+
+const (
+	maxLazyScrollSteps = 40
+	lazyScrollPause    = 250 * time.Millisecond
+)
+
+// lazyScrollStepScript прокручивает на экран вниз и сообщает, достигнут ли низ.
+// Нативно ленивые картинки заодно переводятся в eager.
+const lazyScrollStepScript = `(() => {
+	for (const img of document.querySelectorAll('img[loading="lazy"]')) img.loading = 'eager';
+	window.scrollBy(0, window.innerHeight);
+	return window.innerHeight + window.scrollY >= document.documentElement.scrollHeight - 2;
+})()`
+
+// triggerLazyLoad прокручивает страницу до конца экран за экраном, чтобы
+// сработали IntersectionObserver и scroll-обработчики ленивой загрузки,
+// затем возвращается наверх.
+func triggerLazyLoad() chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		slog.InfoContext(ctx, "Шаг [1.4]: прокручиваю страницу для ленивой загрузки")
+		for i := 0; i < maxLazyScrollSteps; i++ {
+			var bottom bool
+			if err := chromedp.Evaluate(lazyScrollStepScript, &bottom).Do(ctx); err != nil {
+				return err
+			}
+			if err := chromedp.Sleep(lazyScrollPause).Do(ctx); err != nil {
+				return err
+			}
+			if bottom {
+				break
+			}
+		}
+		if err := chromedp.Evaluate(`window.scrollTo(0, 0)`, nil).Do(ctx); err != nil {
+			return err
+		}
+		return chromedp.Sleep(lazyScrollPause).Do(ctx)
+	})
+}
+
+// imagesScript собирает <img>. Ленивые атрибуты (data-src, data-lazy-src,
+// data-original, data-srcset) учитываются, если браузер ещё не подставил
+// настоящий адрес; заглушки data: заменяются ими.
+const imagesScript = `(() => {
+	const abs = v => { try { return new URL(v, document.baseURI).href; } catch (e) { return ''; } };
+	const parseSrcset = s => (s || '').split(/,\s+/).map(c => c.trim().split(/\s+/)[0]).filter(Boolean).map(abs).filter(Boolean);
+	const out = [], seen = new Set();
+	for (const img of document.querySelectorAll('img')) {
+		const lazy = img.getAttribute('data-src') || img.getAttribute('data-lazy-src') || img.getAttribute('data-original') || '';
+		let src = img.currentSrc || img.getAttribute('src') || '';
+		if ((!src || src.startsWith('data:')) && lazy) src = lazy;
+		src = abs(src);
+		if (!src || seen.has(src)) continue;
+		seen.add(src);
+		const srcset = parseSrcset(img.getAttribute('srcset') || img.getAttribute('data-srcset'));
+		out.push({src, srcset: srcset.length ? srcset : null, alt: (img.getAttribute('alt') || '').trim(),
+			width: img.naturalWidth, height: img.naturalHeight});
+	}
+	return out;
+})()`
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/chromedp"
+)
+
+// Перехват ответов XHR/fetch (intercept=*/api/products*): JSON-API, из
+// которого фронтенд строит страницу, обычно чище DOM. Шаблоны — адреса со
+// звёздочкой вместо любой последовательности символов, через запятую или
+// повтором параметра. Тело ответа забирается у Chrome после
+// Network.loadingFinished; JSON возвращается как есть, остальное — текстом.
+
+const (
+	maxInterceptPatterns  = 20
+	maxInterceptResponses = 100
+	maxInterceptBody      = 5 << 20
+	// interceptDrainTimeout — сколько ждать тел ответов, запрошенных перед сбором.
+	interceptDrainTimeout = 5 * time.Second
+)
+
+// InterceptedResponse — перехваченный ответ XHR/fetch.
+type InterceptedResponse struct {
+	URL         string          `json:"url"`
+	Method      string          `json:"method"`
+	Status      int64           `json:"status"`
+	ContentType string          `json:"content_type,omitempty"`
+	JSON        json.RawMessage `json:"json,omitempty"`   // Тело, если это корректный JSON
+	Text        string          `json:"text,omitempty"`   // Тело в остальных случаях
+	Base64      bool            `json:"base64,omitempty"` // Двоичное тело, text в base64
+	Truncated   bool            `json:"truncated,omitempty"`
+	Error       string          `json:"error,omitempty"` // Тело получить не удалось
+
+	finished bool
+}
+
+// parseInterceptPatterns превращает шаблоны со звёздочками в регулярные выражения.
+func parseInterceptPatterns(values []string) ([]*regexp.Regexp, error) {
+	var patterns []*regexp.Regexp
+	for _, value := range values {
+		for _, p := range strings.Split(value, ",") {
+			if p = strings.TrimSpace(p); p == "" {
+				continue
+			}
+			expr := "^" + strings.ReplaceAll(regexp.QuoteMeta(p), `\*`, ".*") + "$"
+			patterns = append(patterns, regexp.MustCompile(expr))
+		}
+	}
+	if len(patterns) > maxInterceptPatterns {
+		return nil, fmt.Errorf("Параметр 'intercept' может содержать не больше %d правил", maxInterceptPatterns)
+	}
+	return patterns, nil
+}
+
+type interceptRecorder struct {
+	mu        sync.Mutex
+	wg        sync.WaitGroup
+	patterns  []*regexp.Regexp
+	requests  map[network.RequestID]*InterceptedResponse
+	responses []*InterceptedResponse
+	closed    bool // Сбор завершён, новые тела не запрашиваются
+}
+
+func interceptMatches(patterns []*regexp.Regexp, rawURL string) bool {
+	for _, p := range patterns {
+		if p.MatchString(rawURL) {
+			return true
+		}
+	}
+	return false
+}
+
+// recordIntercepted начинает сбор ответов XHR/fetch, подходящих под шаблоны.
+func recordIntercepted(ctx context.Context, patterns []*regexp.Regexp) *interceptRecorder {
+	rec := &interceptRecorder{patterns: patterns, requests: map[network.RequestID]*InterceptedResponse{}}
+	exec := cdp.WithExecutor(ctx, chromedp.FromContext(ctx).Target)
+	chromedp.ListenTarget(ctx, func(ev any) {
+		rec.mu.Lock()
+		defer rec.mu.Unlock()
+		switch ev := ev.(type) {
+		case *network.EventRequestWillBeSent:
+			if ev.Type != network.ResourceTypeXHR && ev.Type != network.ResourceTypeFetch {
+				return
+			}
+			if len(rec.responses) >= maxInterceptResponses || !interceptMatches(rec.patterns, ev.Request.URL) {
+				return
+			}
+			resp := &InterceptedResponse{URL: ev.Request.URL, Method: ev.Request.Method}
+			rec.requests[ev.RequestID] = resp
+			rec.responses = append(rec.responses, resp)
+		case *network.EventResponseReceived:
+			if resp := rec.requests[ev.RequestID]; resp != nil {
+				resp.URL = ev.Response.URL
+				resp.Status = ev.Response.Status
+				resp.ContentType = ev.Response.MimeType
+			}
+		case *network.EventLoadingFailed:
+			if resp := rec.requests[ev.RequestID]; resp != nil {
+				resp.Error, resp.finished = ev.ErrorText, true
+				delete(rec.requests, ev.RequestID)
+			}
+		case *network.EventLoadingFinished:
+			resp := rec.requests[ev.RequestID]
+			if resp == nil || rec.closed {
+				return
+			}
+			delete(rec.requests, ev.RequestID)
+			rec.wg.Add(1)
+			go func() {
+				defer rec.wg.Done()
+				body, err := network.GetResponseBody(ev.RequestID).Do(exec)
+				rec.mu.Lock()
+				defer rec.mu.Unlock()
+				resp.finished = true
+				if err != nil {
+					resp.Error = err.Error()
+					return
+				}
+				resp.setBody(body)
+			}()
+		}
+	})
+	return rec
+}
+
+func (resp *InterceptedResponse) setBody(body []byte) {
+	if len(body) > maxInterceptBody {
+		body, resp.Truncated = body[:maxInterceptBody], true
+	}
+	switch {
+	case !resp.Truncated && json.Valid(body):
+		resp.JSON = body
+	case utf8.Valid(body):
+		resp.Text = string(body)
+	default:
+		resp.Text, resp.Base64 = base64.StdEncoding.EncodeToString(body), true
+	}
+}
+
+// Responses ждёт тела уже завершённых ответов и возвращает собранное.
+// Запросы, не завершившиеся к этому моменту, в результат не попадают.
+func (rec *interceptRecorder) Responses() []InterceptedResponse {
+	rec.mu.Lock()
+	rec.closed = true
+	rec.mu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		rec.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(interceptDrainTimeout):
+		log.Println("ЛОГ: Не все тела перехваченных ответов получены вовремя.")
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	out := make([]InterceptedResponse, 0, len(rec.responses))
+	for _, resp := range rec.responses {
+		if !resp.finished {
+			continue
+		}
+		out = append(out, *resp)
+	}
+	return out
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Асинхронные задачи: /scrape с async=true или callback_url отвечает сразу
+// 202 с идентификатором задачи, а скрапинг идёт в фоне. Состояние и
+// результат — GET /jobs/<id> (хранятся JOB_RETENTION секунд после
+// завершения, не больше JOB_MAX_ENTRIES задач — см. retention.go). Задачу
+// видит только создавший её клиент: с ключом API — тот же ключ.
+//
+// С callback_url по завершении задача отправляется POST-запросом на этот
+// адрес (тело — как у GET /jobs/<id>). Неудачная доставка (не 2xx)
+// повторяется с растущей паузой. Если задан WEBHOOK_SECRET, тело
+// подписывается: X-Webextract-Signature: sha256=<HMAC-SHA256 в hex>.
+// Постобработка fields и transform применяется к результату; template
+// в асинхронном режиме не поддерживается.
+
+const (
+	webhookAttempts  = 5
+	webhookFirstWait = 2 * time.Second
+	webhookTimeout   = 15 * time.Second
+)
+
+// Job — асинхронная задача скрапинга.
+type Job struct {
+	ID       string          `json:"id"`
+	Status   string          `json:"status"` // running, done, failed
+	URL      string          `json:"url"`
+	Created  time.Time       `json:"created"`
+	Finished *time.Time      `json:"finished,omitempty"`
+	Result   any             `json:"result,omitempty"`
+	Error    string          `json:"error,omitempty"`
+	Callback *CallbackStatus `json:"callback,omitempty"`
+
+	client string // Имя ключа API создателя; "" — без аутентификации
+}
+
+// CallbackStatus — состояние доставки результата на callback_url.
+type CallbackStatus struct {
+	URL       string `json:"url"`
+	Attempts  int    `json:"attempts"`
+	Delivered bool   `json:"delivered"`
+	Error     string `json:"error,omitempty"`
+}
+
+var (
+	jobsMu sync.Mutex
+	jobs   = map[string]*Job{}
+)
+
+// jobSnapshot возвращает копию задачи для отдачи клиенту.
+func jobSnapshot(id string) (Job, bool) {
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+	job, ok := jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	snapshot := *job
+	if job.Callback != nil {
+		cb := *job.Callback
+		snapshot.Callback = &cb
+	}
+	return snapshot, true
+}
+
+// trimJobsLocked освобождает место под новую задачу, удаляя самые старые
+// завершённые сверх jobMaxEntries; выполняющиеся не трогает. Вызывается
+// под jobsMu.
+func trimJobsLocked() {
+	if jobMaxEntries == 0 || len(jobs) < jobMaxEntries {
+		return
+	}
+	finished := make([]*Job, 0, len(jobs))
+	for _, job := range jobs {
+		if job.Finished != nil {
+			finished = append(finished, job)
+		}
+	}
+	sort.Slice(finished, func(i, j int) bool { return finished[i].Finished.Before(*finished[j].Finished) })
+	for _, job := range finished {
+		if len(jobs) < jobMaxEntries {
+			break
+		}
+		delete(jobs, job.ID)
+	}
+}
+
+// purgeJobs удаляет задачи по адресам, для которых match истинно.
+func purgeJobs(match func(string) bool) int {
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+	n := 0
+	for id, job := range jobs {
+		if match(job.URL) {
+			delete(jobs, id)
+			n++
+		}
+	}
+	return n
+}
+
+// parseCallbackURL проверяет адрес для callback_url.
+func parseCallbackURL(raw string) (string, error) {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", errors.New("Параметр 'callback_url' должен быть абсолютным http(s)-адресом")
+	}
+	if err := checkOutboundHost("callback_url", u.Hostname()); err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+// webhookClient — клиент доставки на адрес из параметра param; каждая
+// переадресация проверяется так же, как сам адрес. Адрес проверяется и при
+// соединении: DNS мог сменить ответ после checkOutboundHost. Прокси из
+// окружения не используется — за ним проверка адреса теряет смысл.
+func webhookClient(param string) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: webhookTimeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip, err := netip.ParseAddr(host)
+			if err != nil {
+				return err
+			}
+			if reason := forbiddenAddr(ip); reason != "" {
+				return fmt.Errorf("Параметр '%s' запрещён: адрес '%s' — %s (%s)", param, host, ip.Unmap(), reason)
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Timeout:   webhookTimeout,
+		Transport: &http.Transport{DialContext: dialer.DialContext, TLSHandshakeTimeout: webhookTimeout},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return errors.New("слишком много переадресаций")
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return fmt.Errorf("переадресация на %s не поддерживается", req.URL.Scheme)
+			}
+			return checkOutboundHost(param, req.URL.Hostname())
+		},
+	}
+}
+
+// startJob запускает скрапинг в фоне от имени client. postProcess
+// превращает ответ в результат задачи (fields, transform).
+func startJob(q url.Values, opts *scrapeOptions, client, callbackURL string, postProcess func(*Response) (any, error)) *Job {
+	job := &Job{ID: newJobID(), Status: "running", URL: opts.URL, Created: time.Now(), client: client}
+	if callbackURL != "" {
+		job.Callback = &CallbackStatus{URL: callbackURL}
+	}
+	jobsMu.Lock()
+	trimJobsLocked()
+	jobs[job.ID] = job
+	jobsMu.Unlock()
+	slog.InfoContext(opts.trace, "Задача запущена асинхронно", "job", job.ID, "url", opts.URL)
+
+	go func() {
+		response, _, err := scrapeWithCache(q, opts)
+		var result any
+		if err == nil {
+			result, err = postProcess(response)
+		}
+		now := time.Now()
+		jobsMu.Lock()
+		job.Finished = &now
+		if err != nil {
+			job.Status, job.Error = "failed", "Не удалось выполнить скрапинг: "+err.Error()
+		} else {
+			job.Status, job.Result = "done", result
+		}
+		jobsMu.Unlock()
+		slog.InfoContext(opts.trace, "Задача завершена", "job", job.ID, "status", job.Status)
+		if callbackURL != "" {
+			deliverCallback(job.ID)
+		}
+		time.AfterFunc(jobRetention, func() {
+			jobsMu.Lock()
+			delete(jobs, job.ID)
+			jobsMu.Unlock()
+		})
+	}()
+	return job
+}
+
+// deliverCallback отправляет задачу на callback_url с повторами.
+func deliverCallback(id string) {
+	snapshot, ok := jobSnapshot(id)
+	if !ok {
+		return
+	}
+	target := snapshot.Callback.URL
+	snapshot.Callback = nil
+	body, err := json.Marshal(snapshot)
+	if err != nil {
+		log.Printf("ЛОГ: Задача %s: не удалось сериализовать результат: %v", id, err)
+		return
+	}
+	client := webhookClient("callback_url")
+	wait := webhookFirstWait
+	for attempt := 1; attempt <= webhookAttempts; attempt++ {
+		err := postCallback(client, target, id, body)
+		jobsMu.Lock()
+		if job, ok := jobs[id]; ok {
+			job.Callback.Attempts = attempt
+			job.Callback.Delivered = err == nil
+			job.Callback.Error = ""
+			if err != nil {
+				job.Callback.Error = err.Error()
+			}
+		}
+		jobsMu.Unlock()
+		if err == nil {
+			log.Printf("ЛОГ: Задача %s: результат доставлен на %s.", id, target)
+			return
+		}
+		log.Printf("ЛОГ: Задача %s: попытка %d доставки на %s не удалась: %v", id, attempt, target, err)
+		if attempt < webhookAttempts {
+			time.Sleep(wait)
+			wait *= 2
+		}
+	}
+}
+
+func postCallback(client *http.Client, target, id string, body []byte) error {
+	return postWebhook(client, target, "X-Webextract-Job", id, body)
+}
+
+// postWebhook отправляет JSON-тело с заголовком-идентификатором и, если
+// задан WEBHOOK_SECRET, подписью.
+func postWebhook(client *http.Client, target, idHeader, id string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set(idHeader, id)
+	if secret := os.Getenv("WEBHOOK_SECRET"); secret != "" {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		req.Header.Set("X-Webextract-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("ответ %s", resp.Status)
+	}
+	return nil
+}
+
+// jobsHandler: GET /jobs/<id>.
+func jobsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJsonError(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+		return
+	}
+	job, ok := jobSnapshot(strings.TrimPrefix(r.URL.Path, "/jobs/"))
+	// Чужая задача неотличима от несуществующей.
+	if client, _ := apiClient(r); !ok || job.client != client {
+		writeJsonError(w, "Задача не найдена", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(job)
+}
+
+// startAsyncScrape отвечает 202 и запускает задачу для /scrape.
+func startAsyncScrape(w http.ResponseWriter, r *http.Request, q url.Values, opts *scrapeOptions, selection []*gqlField, transform *jsonPath, outTemplate *outputTemplate) {
+	if outTemplate != nil {
+		writeJsonError(w, "Параметр 'template' не поддерживается в асинхронном режиме", http.StatusBadRequest)
+		return
+	}
+	var callbackURL string
+	if q.Has("callback_url") {
+		var err error
+		if callbackURL, err = parseCallbackURL(q.Get("callback_url")); err != nil {
+			writeJsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	// Параметры задачи не должны попадать в ключ кэша.
+	q.Del("async")
+	q.Del("callback_url")
+	client, _ := apiClient(r)
+	job := startJob(q, opts, client, callbackURL, func(response *Response) (any, error) {
+		if opts.PreviousHash != "" {
+			var unchanged *UnchangedResponse
+			if response, unchanged = compareHash(response, opts.PreviousHash); unchanged != nil {
+				return unchanged, nil
+			}
+		}
+		var out any = response
+		var err error
+		if selection != nil {
+			if out, err = projectResponse(response, selection); err != nil {
+				return nil, err
+			}
+		}
+		if transform != nil {
+			if out, err = toGenericJSON(out); err != nil {
+				return nil, err
+			}
+			out = transform.Apply(out)
+		}
+		return out, nil
+	})
+	snapshot, _ := jobSnapshot(job.ID)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Location", requestBaseURL(r)+"/jobs/"+job.ID)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(snapshot)
+}
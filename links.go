@@ -0,0 +1,236 @@
+package main
+
+import (
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// trackingParams — рекламные и аналитические параметры, не влияющие на
+// содержимое страницы. Параметры с префиксом utm_ удаляются всегда.
+// Список дополняется через TRACKING_PARAMS (через запятую).
+var trackingParams = map[string]bool{
+	"yclid":  true,
+	"ysclid": true,
+	"gclid":  true,
+	"fbclid": true,
+}
+
+func loadTrackingParams() {
+	extra := os.Getenv("TRACKING_PARAMS")
+	if extra == "" {
+		return
+	}
+	for _, name := range strings.Split(extra, ",") {
+		if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+			trackingParams[name] = true
+		}
+	}
+	log.Printf("ЛОГ: Загружено трекинговых параметров: %d.", len(trackingParams))
+}
+
+func isTrackingParam(name string, extra map[string]bool) bool {
+	name = strings.ToLower(name)
+	return strings.HasPrefix(name, "utm_") || trackingParams[name] || extra[name]
+}
+
+// stripTrackingParams удаляет трекинговые параметры из href. Остальные
+// параметры сохраняют исходный порядок и кодирование, поэтому query
+// разбирается вручную, а не через url.Values (та сортирует ключи).
+func stripTrackingParams(href string, extra map[string]bool) string {
+	fragment := ""
+	if i := strings.IndexByte(href, '#'); i >= 0 {
+		href, fragment = href[:i], href[i:]
+	}
+	i := strings.IndexByte(href, '?')
+	if i < 0 {
+		return href + fragment
+	}
+	base, query := href[:i], href[i+1:]
+	var kept []string
+	for _, part := range strings.Split(query, "&") {
+		if part == "" {
+			continue
+		}
+		name := part
+		if j := strings.IndexByte(part, '='); j >= 0 {
+			name = part[:j]
+		}
+		if isTrackingParam(name, extra) {
+			continue
+		}
+		kept = append(kept, part)
+	}
+	if len(kept) == 0 {
+		return base + fragment
+	}
+	return base + "?" + strings.Join(kept, "&") + fragment
+}
+
+// linkFilter — условия отбора ссылок из параметров links_*.
+type linkFilter struct {
+	Include      *regexp.Regexp  // links_filter: href должен совпадать
+	Exclude      *regexp.Regexp  // links_exclude: href не должен совпадать
+	InternalOnly bool            // links_internal_only: только ссылки на тот же сайт
+	Extensions   map[string]bool // links_ext: только файлы с этими расширениями
+	ExcludeExt   map[string]bool // links_exclude_ext: без файлов с этими расширениями
+}
+
+// parseExtList разбирает "pdf, .DOC" в {"pdf": true, "doc": true}.
+func parseExtList(raw string) map[string]bool {
+	exts := map[string]bool{}
+	for _, ext := range strings.Split(raw, ",") {
+		ext = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(ext), "."))
+		if ext != "" {
+			exts[ext] = true
+		}
+	}
+	return exts
+}
+
+// trimWWW отбрасывает ведущий "www.", чтобы example.com и www.example.com
+// считались одним сайтом.
+func trimWWW(host string) string {
+	return strings.TrimPrefix(strings.ToLower(host), "www.")
+}
+
+// Allow проверяет ссылку; base — адрес страницы для разрешения относительных href.
+func (f *linkFilter) Allow(href string, base *url.URL) bool {
+	if f.Include != nil && !f.Include.MatchString(href) {
+		return false
+	}
+	if f.Exclude != nil && f.Exclude.MatchString(href) {
+		return false
+	}
+	if !f.InternalOnly && f.Extensions == nil && f.ExcludeExt == nil {
+		return true
+	}
+	u, err := url.Parse(href)
+	if err != nil {
+		return false
+	}
+	if base != nil {
+		u = base.ResolveReference(u)
+	}
+	if f.InternalOnly && (base == nil || trimWWW(u.Hostname()) != trimWWW(base.Hostname())) {
+		return false
+	}
+	ext := strings.ToLower(strings.TrimPrefix(path.Ext(u.Path), "."))
+	if f.Extensions != nil && !f.Extensions[ext] {
+		return false
+	}
+	if f.ExcludeExt != nil && f.ExcludeExt[ext] {
+		return false
+	}
+	return true
+}
+
+// linkItem — ссылка из linksScript.
+type linkItem struct {
+	Href    string   `json:"href"`
+	URL     string   `json:"url"`
+	Text    string   `json:"text"`
+	Rel     []string `json:"rel"`
+	Target  string   `json:"target"`
+	Visible bool     `json:"visible"`
+}
+
+// linksScript собирает все <a> в порядке документа одним проходом: href
+// как в атрибуте и абсолютный, текст, rel, target и видимость. У <a> внутри
+// SVG href — не строка, такие ссылки получают адрес из атрибута.
+const linksScript = `(() => Array.from(document.querySelectorAll('a'), el => {
+	const style = getComputedStyle(el);
+	return {
+		href: el.getAttribute('href') || el.getAttribute('xlink:href') || '',
+		url: typeof el.href === 'string' ? el.href : '',
+		text: (el.textContent || '').trim(),
+		rel: (el.getAttribute('rel') || '').toLowerCase().split(/\s+/).filter(Boolean),
+		target: (el.getAttribute('target') || '').trim(),
+		visible: el.getClientRects().length > 0 && style.visibility !== 'hidden' && style.opacity !== '0',
+	};
+}))()`
+
+// linkURL — абсолютный адрес ссылки без фрагмента. Браузер уже разрешил
+// href с учётом <base>; base нужен только для <a> внутри SVG.
+func linkURL(item linkItem, base *url.URL) string {
+	raw := item.URL
+	if raw == "" {
+		ref, err := url.Parse(item.Href)
+		if err != nil || base == nil {
+			return ""
+		}
+		raw = base.ResolveReference(ref).String()
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	u.Fragment = ""
+	return u.String()
+}
+
+// linkInternal сообщает, ведёт ли ссылка на тот же сайт, что и страница.
+func linkInternal(rawURL string, base *url.URL) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil || base == nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return false
+	}
+	return trimWWW(u.Hostname()) == trimWWW(base.Hostname())
+}
+
+// LinkContext — окружение ссылки на странице.
+type LinkContext struct {
+	Before  string `json:"before"`  // Текст блока перед ссылкой
+	After   string `json:"after"`   // Текст блока после ссылки
+	Heading string `json:"heading"` // Ближайший предшествующий заголовок h1–h6
+	Section string `json:"section"` // nav, header, footer, aside, main или content
+}
+
+// linkContextItem — контекст одного <a> из linkContextScript.
+type linkContextItem struct {
+	Href string `json:"href"`
+	LinkContext
+}
+
+// linkContextScript собирает контекст для всех <a> в порядке документа —
+// том же, в котором их возвращает querySelectorAll("a"). Один проход по
+// заголовкам и ссылкам вместо отдельного запроса на каждую ссылку.
+const linkContextScript = `(() => {
+	const radius = 80;
+	const sections = [
+		['nav,[role="navigation"]', 'nav'],
+		['footer,[role="contentinfo"]', 'footer'],
+		['header,[role="banner"]', 'header'],
+		['aside,[role="complementary"]', 'aside'],
+		['main,[role="main"],article', 'main'],
+	];
+	const clean = s => (s || '').replace(/\s+/g, ' ').trim();
+	let heading = '';
+	const result = [];
+	for (const el of document.querySelectorAll('h1,h2,h3,h4,h5,h6,a')) {
+		if (el.tagName !== 'A') {
+			heading = clean(el.textContent);
+			continue;
+		}
+		let section = 'content';
+		for (const [sel, name] of sections) {
+			if (el.closest(sel)) { section = name; break; }
+		}
+		let before = '', after = '';
+		const block = el.parentElement && el.parentElement.closest('p,li,td,dd,dt,blockquote,figcaption,div,section,article');
+		if (block) {
+			const text = clean(block.textContent);
+			const own = clean(el.textContent);
+			const i = own ? text.indexOf(own) : -1;
+			if (i >= 0) {
+				before = text.slice(Math.max(0, i - radius), i).trim();
+				after = text.slice(i + own.length, i + own.length + radius).trim();
+			}
+		}
+		result.push({href: el.getAttribute('href') || '', before, after, heading, section});
+	}
+	return result;
+})()`
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Структурированные логи (slog). LOG_FORMAT=json (по умолчанию) пишет
+// каждую запись строкой JSON, LOG_FORMAT=text — в формате key=value.
+// Старые сообщения log.Printf идут через тот же обработчик как msg.
+//
+// Каждый HTTP-запрос получает идентификатор: клиентский X-Request-Id,
+// если он корректен, иначе случайный. Он возвращается в заголовке
+// X-Request-Id и в поле request_id ответа об ошибке. Записи slog.*Context
+// с контекстом запроса получают request_id сами: скрапинг переносит его в
+// контекст вкладки, так что шаги скрапинга, его итог (logScrape — для
+// всех эндпоинтов и асинхронных задач) и запись о запросе с именем
+// клиента API находятся в логах по одному идентификатору.
+
+const requestIDHeader = "X-Request-Id"
+
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+type requestIDKey struct{}
+
+// legacyLogHandler убирает из сообщений log.Printf служебный префикс «ЛОГ:»
+// и переводы строк: в JSON они только мешают. Записям с контекстом
+// запроса добавляет request_id.
+type legacyLogHandler struct {
+	slog.Handler
+}
+
+func (h legacyLogHandler) Handle(ctx context.Context, r slog.Record) error {
+	r.Message = strings.TrimPrefix(strings.TrimSpace(r.Message), "ЛОГ: ")
+	if id := requestID(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h legacyLogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return legacyLogHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h legacyLogHandler) WithGroup(name string) slog.Handler {
+	return legacyLogHandler{h.Handler.WithGroup(name)}
+}
+
+func setupLogging() {
+	var handler slog.Handler
+	switch format := os.Getenv("LOG_FORMAT"); format {
+	case "", "json":
+		handler = slog.NewJSONHandler(os.Stderr, nil)
+	case "text":
+		handler = slog.NewTextHandler(os.Stderr, nil)
+	default:
+		log.Fatalf("LOG_FORMAT может принимать значения: json, text")
+	}
+	slog.SetDefault(slog.New(legacyLogHandler{handler}))
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// requestID — идентификатор запроса из контекста; пусто вне HTTP-запроса.
+func requestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// withRequestID переносит идентификатор запроса из from в ctx — например,
+// в контекст вкладки, который от запроса не наследуется.
+func withRequestID(ctx, from context.Context) context.Context {
+	if id := requestID(from); id != "" {
+		return context.WithValue(ctx, requestIDKey{}, id)
+	}
+	return ctx
+}
+
+// withRequestLog присваивает запросу идентификатор и пишет запись о нём
+// после ответа.
+func withRequestLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+		r = r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id))
+		start := time.Now()
+		mw := &metricsResponseWriter{ResponseWriter: w}
+		next.ServeHTTP(mw, r)
+		if mw.status == 0 {
+			mw.status = http.StatusOK
+		}
+		attrs := []any{
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", mw.status,
+			"duration_ms", time.Since(start).Milliseconds(),
+			"remote", r.RemoteAddr,
+		}
+		if name, ok := apiClient(r); ok {
+			attrs = append(attrs, "client", name)
+		}
+		slog.InfoContext(r.Context(), "HTTP-запрос", attrs...)
+	})
+}
+
+// logScrape пишет итог скрапинга: адрес, включённые параметры, время и
+// исход. Параметры — только имена: значения могут содержать секреты
+// (cookies, headers, proxy).
+func logScrape(ctx context.Context, q url.Values, start time.Time, response *Response, cacheStatus string, err error) {
+	params := make([]string, 0, len(q))
+	for name := range q {
+		if name != "url" {
+			params = append(params, name)
+		}
+	}
+	slices.Sort(params)
+	attrs := []any{
+		"url", q.Get("url"),
+		"params", params,
+		"duration_ms", time.Since(start).Milliseconds(),
+	}
+	if cacheStatus != "" {
+		attrs = append(attrs, "cache", cacheStatus)
+	}
+	if err != nil {
+		slog.WarnContext(ctx, "Скрапинг не удался", append(attrs, "outcome", "error", "error", err.Error())...)
+		return
+	}
+	attrs = append(attrs, "outcome", "ok", "status", response.Status)
+	if response.Attempts > 1 {
+		attrs = append(attrs, "attempts", response.Attempts)
+	}
+	slog.InfoContext(ctx, "Скрапинг завершён", attrs...)
+}
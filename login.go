@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/chromedp/chromedp"
+)
+
+// Автоматический вход в сессии: POST /sessions/<имя>/login
+//
+//	{
+//	  "url": "https://example.com/login",
+//	  "username_selector": "#email", "username": "user@example.com",
+//	  "password_selector": "#password", "password": "secret",
+//	  "submit_selector": "button[type=submit]",   // без него — Enter в поле пароля
+//	  "success_selector": ".account-menu",        // признак успешного входа
+//	  "timeout": 20000                            // мс, по умолчанию 10000
+//	}
+//
+// Куки входа остаются в сессии, и дальнейшие /scrape?session=<имя> идут
+// уже авторизованными. Пароль в лог не пишется.
+
+// loginRequest — тело запроса входа.
+type loginRequest struct {
+	URL              string `json:"url"`
+	UsernameSelector string `json:"username_selector"`
+	Username         string `json:"username"`
+	PasswordSelector string `json:"password_selector"`
+	Password         string `json:"password"`
+	SubmitSelector   string `json:"submit_selector"`
+	SuccessSelector  string `json:"success_selector"`
+	Timeout          int    `json:"timeout"`
+}
+
+// LoginResponse — ответ на успешный вход.
+type LoginResponse struct {
+	Session string `json:"session"`
+	URL     string `json:"url"` // Адрес страницы после входа
+}
+
+// loginHandler выполняет вход внутри сессии name.
+func loginHandler(w http.ResponseWriter, r *http.Request, name string) {
+	if r.Method != http.MethodPost {
+		writeJsonError(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+		return
+	}
+	var req loginRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&req); err != nil {
+		writeJsonError(w, `Тело запроса должно быть JSON вида {"url": "...", "username_selector": "...", "username": "...", "password_selector": "...", "password": "...", "success_selector": "..."}`, http.StatusBadRequest)
+		return
+	}
+	for field, value := range map[string]string{
+		"url":               req.URL,
+		"username_selector": req.UsernameSelector,
+		"password_selector": req.PasswordSelector,
+		"success_selector":  req.SuccessSelector,
+	} {
+		if value == "" {
+			writeJsonError(w, fmt.Sprintf("Поле '%s' тела запроса обязательно", field), http.StatusBadRequest)
+			return
+		}
+	}
+	timeout := defaultWaitTimeout
+	if req.Timeout != 0 {
+		if req.Timeout < 1 || req.Timeout > int(maxWaitTimeout/time.Millisecond) {
+			writeJsonError(w, fmt.Sprintf("Поле 'timeout' тела запроса должно быть числом миллисекунд от 1 до %d", maxWaitTimeout/time.Millisecond), http.StatusBadRequest)
+			return
+		}
+		timeout = time.Duration(req.Timeout) * time.Millisecond
+	}
+
+	if err := checkTargetURL(req.URL); err != nil {
+		writeJsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Вход обращается к сайту так же, как скрапинг: пауза по CAPTCHA, лимит
+	// домена и ожидание при остановке.
+	activeScrapes.Add(1)
+	defer activeScrapes.Add(-1)
+	if err := checkScrapeScope(req.URL, name); err != nil {
+		var thErr *throttledError
+		if errors.As(err, &thErr) {
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds(thErr.RetryAfter)))
+			writeErrorResponse(w, ErrorResponse{Error: "Вход не выполнен: " + err.Error(), Code: "domain_rate_limited"}, http.StatusTooManyRequests)
+			return
+		}
+		writeJsonError(w, "Вход не выполнен: "+err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	tabCtx, cancelTab, proxy, err := sessionTab(r.Context(), name, false)
+	if err != nil {
+		writeJsonError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	defer cancelTab()
+	tabCtx, cancelTimeout := context.WithTimeout(tabCtx, maxWaitTimeout+2*timeout)
+	defer cancelTimeout()
+	tabCtx = withRequestID(tabCtx, r.Context())
+
+	slog.InfoContext(r.Context(), "Вход в сессию", "session", name, "url", req.URL, "username", req.Username)
+	submit := chromedp.KeyEvent("\r")
+	if req.SubmitSelector != "" {
+		submit = chromedp.Click(req.SubmitSelector, chromedp.ByQuery, chromedp.NodeVisible)
+	}
+	var finalURL string
+	err = chromedp.Run(tabCtx,
+		proxyAuth(proxy),
+		chromedp.Navigate(req.URL),
+		// Логин и пароль вводятся только на странице, которую разрешено
+		// открывать: редирект мог увести на другой домен.
+		chromedp.ActionFunc(func(ctx context.Context) error {
+			var landed string
+			if err := chromedp.Location(&landed).Do(ctx); err != nil {
+				return err
+			}
+			return checkTargetURL(landed)
+		}),
+		detectAndPauseOnCaptcha(req.URL, name, 0),
+		waitForSelector(req.UsernameSelector, timeout),
+		chromedp.SetValue(req.UsernameSelector, "", chromedp.ByQuery),
+		chromedp.SendKeys(req.UsernameSelector, req.Username, chromedp.ByQuery),
+		chromedp.SetValue(req.PasswordSelector, "", chromedp.ByQuery),
+		chromedp.SendKeys(req.PasswordSelector, req.Password, chromedp.ByQuery, chromedp.NodeVisible),
+		submit,
+		waitForSelector(req.SuccessSelector, timeout),
+		chromedp.Location(&finalURL),
+	)
+	if err != nil {
+		slog.WarnContext(r.Context(), "Вход в сессию не подтверждён", "session", name, "error", err)
+		writeJsonError(w, "Вход не выполнен: "+err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	if err := checkTargetURL(finalURL); err != nil {
+		writeJsonError(w, "Вход не выполнен: "+err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	slog.InfoContext(r.Context(), "Вход в сессию выполнен", "session", name, "url", finalURL)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(LoginResponse{Session: name, URL: finalURL})
+}
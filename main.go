@@ -5,47 +5,131 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
-	"sync"
 	"time"
 
-	"github.com/chromedp/cdproto/cdp"
 	"github.com/chromedp/chromedp"
 	"github.com/joho/godotenv"
 )
 
 // ... (captchaKeywords, глобальные переменные и структуры остаются без изменений) ...
+// captchaKeywords — слабый признак CAPTCHA (см. captchadetect.go); заменяется CAPTCHA_KEYWORDS.
 var captchaKeywords = []string{
 	"капча", "не робот", "подозрительная активность", "подтвердите, что",
 	"unusual traffic", "are you a robot", "prove you are human", "captcha",
 }
-var (
-	persistentBrowserCtx context.Context
-	isCaptchaPending     bool
-	captchaMutex         sync.Mutex
-)
 
 type Link struct {
-	Href string `json:"href"`
+	Href string `json:"href"`          // Как в атрибуте (после links_strip_tracking — без трекинговых параметров)
+	URL  string `json:"url,omitempty"` // Абсолютный адрес с учётом <base>, без #фрагмента
 	Text string `json:"text"`
+
+	Internal  bool   `json:"internal"` // Тот же сайт, что у страницы (www. не различается)
+	NoFollow  bool   `json:"nofollow,omitempty"`
+	Sponsored bool   `json:"sponsored,omitempty"`
+	UGC       bool   `json:"ugc,omitempty"`
+	Target    string `json:"target,omitempty"` // _blank и т. п.
+	Visible   bool   `json:"visible"`          // Ссылка отрисована и не скрыта стилями
+
+	Context *LinkContext `json:"context,omitempty"`
 }
 type Meta struct {
 	Title       string `json:"title"`
 	Description string `json:"description"`
 	Keywords    string `json:"keywords"`
+
+	Social *SocialMeta `json:"social,omitempty"` // Open Graph и Twitter Card
+
+	Canonical string      `json:"canonical,omitempty"`
+	Hreflang  []Hreflang  `json:"hreflang,omitempty"`
+	AMP       string      `json:"amphtml,omitempty"`
+	Next      string      `json:"next,omitempty"` // rel="next"/"prev" — соседние страницы серии
+	Prev      string      `json:"prev,omitempty"`
+	Robots    *RobotsMeta `json:"robots,omitempty"`
+
+	// Только для meta=all: все meta-теги и значения <link rel>.
+	All   map[string][]string `json:"all,omitempty"`
+	Links map[string][]string `json:"link_rel,omitempty"`
 }
 type Response struct {
-	Content string `json:"content,omitempty"`
-	Links   []Link `json:"links,omitempty"`
-	Meta    *Meta  `json:"meta,omitempty"`
+	Status    int64      `json:"status,omitempty"`    // HTTP-статус основного документа
+	FinalURL  string     `json:"final_url,omitempty"` // Адрес после редиректов
+	Redirects []Redirect `json:"redirects,omitempty"`
+	Attempts  int        `json:"attempts,omitempty"` // Сколько попыток понадобилось, если больше одной
+
+	ContentHash string `json:"content_hash"`
+	Simhash     string `json:"simhash"`
+	Hash        string `json:"hash,omitempty"`    // hash=true: хэш основного текста (hash.go)
+	Changed     *bool  `json:"changed,omitempty"` // Только с previous_hash
+	Content     string `json:"content,omitempty"`
+	HTML        string `json:"html,omitempty"` // DOM после выполнения JavaScript
+	Links       []Link `json:"links,omitempty"`
+
+	LinksTotal     int  `json:"links_total,omitempty"`     // Ссылок после фильтров, без учёта links_offset/links_limit
+	LinksTruncated bool `json:"links_truncated,omitempty"` // Сбор остановлен на max_links
+
+	Meta *Meta `json:"meta,omitempty"`
+
+	Document *PDFDocument `json:"document,omitempty"` // Адрес отдал PDF: сведения о документе
+
+	Images []Image `json:"images,omitempty"`
+
+	Headings []Heading `json:"headings,omitempty"`
+
+	Icons []Icon    `json:"icons,omitempty"`
+	Icon  *IconData `json:"icon,omitempty"` // icons=best: самая крупная иконка
+
+	Feeds []Feed `json:"feeds,omitempty"`
+
+	Article *Article `json:"article,omitempty"`
+
+	Selectors map[string]any `json:"selectors,omitempty"` // Результаты правил selectors по ключам
+
+	Tables []Table `json:"tables,omitempty"`
+
+	Forms []Form `json:"forms,omitempty"`
+
+	Stats *ContentStats `json:"stats,omitempty"`
+
+	Eval      json.RawMessage `json:"eval,omitempty"`       // Результат eval
+	EvalError string          `json:"eval_error,omitempty"` // Исключение в eval
+
+	FAQ   []FAQItem `json:"faq,omitempty"`
+	HowTo []HowTo   `json:"howto,omitempty"`
+
+	Pagination *Pagination `json:"pagination,omitempty"`
+
+	StructuredData []json.RawMessage `json:"structured,omitempty"` // Блоки JSON-LD страницы
+
+	Screenshot *ScreenshotData `json:"screenshot,omitempty"`
+
+	PDF []byte `json:"pdf,omitempty"` // Только при pdf=true; в JSON кодируется base64
+
+	MHTML         string       `json:"mhtml,omitempty"`          // Архив страницы при mhtml=true
+	MHTMLArtifact *ArtifactRef `json:"mhtml_artifact,omitempty"` // Ссылка на архив при mhtml=store
+
+	HAR *HAR `json:"har,omitempty"` // Сетевые запросы страницы при har=true
+
+	Console        []ConsoleMessage `json:"console,omitempty"`         // Консоль и исключения страницы при console=true
+	ConsoleDropped int              `json:"console_dropped,omitempty"` // Сообщений сверх лимита, не попавших в console
+
+	Intercepted []InterceptedResponse `json:"intercepted,omitempty"` // Ответы XHR/fetch по шаблонам intercept
+
+	PageCookies []Cookie `json:"page_cookies,omitempty"` // Только при return_cookies=true
 }
 type ErrorResponse struct {
-	Error string `json:"error"`
+	Error     string         `json:"error"`
+	Code      string         `json:"code,omitempty"` // Машинный код ошибки, не зависит от языка
+	RateLimit *RateLimitInfo `json:"rate_limit,omitempty"`
+	RequestID string         `json:"request_id,omitempty"` // Для поиска запроса в логах
 }
 
 // ... (sendTelegramNotification и detectAndPauseOnCaptcha остаются без изменений) ...
@@ -71,143 +155,173 @@ func sendTelegramNotification(message string) {
 		log.Printf("ЛОГ: Telegram API вернул ошибку: %s", resp.Status)
 	}
 }
-func detectAndPauseOnCaptcha(url string) chromedp.Action {
+func detectAndPauseOnCaptcha(url, session string, status int64) chromedp.Action {
 	return chromedp.ActionFunc(func(ctx context.Context) error {
-		log.Println("ЛОГ: Шаг [1] - Проверяю наличие CAPTCHA на странице.")
-		var bodyText string
-		if err := chromedp.Text(`body`, &bodyText, chromedp.ByQuery).Do(ctx); err != nil {
+		slog.InfoContext(ctx, "Шаг [1]: проверяю наличие CAPTCHA на странице")
+		signal, err := detectCaptcha(ctx, url, status)
+		if err != nil {
 			return err
 		}
-		lowerBodyText := strings.ToLower(bodyText)
-		for _, keyword := range captchaKeywords {
-			if strings.Contains(lowerBodyText, keyword) {
-				captchaMutex.Lock()
-				isCaptchaPending = true
-				captchaMutex.Unlock()
-				message := fmt.Sprintf("🚨 ОБНАРУЖЕНА CAPTCHA! (Найдено слово: '%s') 🚨\n\nURL: %s\n\nДействие остановлено. Пожалуйста, решите капчу и нажмите Enter в этой консоли.", keyword, url)
-				go sendTelegramNotification(message)
-				log.Println("\n======================================================================")
-				log.Println(message)
-				log.Println("======================================================================")
-				for {
-					captchaMutex.Lock()
-					if !isCaptchaPending {
-						captchaMutex.Unlock()
-						break
-					}
-					captchaMutex.Unlock()
-					time.Sleep(1 * time.Second)
-				}
-				log.Println("ЛОГ: Enter нажат, продолжаю выполнение...")
-				return chromedp.Sleep(2 * time.Second).Do(ctx)
-			}
+		if signal == "" {
+			slog.InfoContext(ctx, "Шаг [1]: CAPTCHA не обнаружена, продолжаю")
+			return nil
+		}
+		captchaPauses.Add(1)
+		wait := registerCaptcha(ctx, url, session)
+		message := fmt.Sprintf("🚨 ОБНАРУЖЕНА CAPTCHA %s! (Признак: %s) 🚨\n\nURL: %s\n\nВкладка остановлена, другие сайты обслуживаются. Пожалуйста, решите капчу и нажмите Enter в этой консоли.", wait.ID, signal, url)
+		if link := captchaRemoteLink(wait.ID); link != "" {
+			message += "\nИли решите удалённо: " + link
+		}
+		go notifyCaptcha(wait, message)
+		slog.WarnContext(ctx, "Обнаружена CAPTCHA, вкладка ждёт решения", "captcha", wait.ID, "signal", signal, "url", url)
+		// Баннер для оператора у консоли: он решает капчу по Enter.
+		banner := strings.Repeat("=", 70)
+		fmt.Fprintf(os.Stderr, "\n%s\n%s\n%s\n", banner, message, banner)
+		select {
+		case <-wait.done:
+		case <-ctx.Done():
+			unregisterCaptcha(wait)
+			return ctx.Err()
 		}
-		log.Println("ЛОГ: Шаг [1] - CAPTCHA не обнаружена, продолжаю.")
-		return nil
+		slog.InfoContext(ctx, "CAPTCHA решена, продолжаю", "captcha", wait.ID)
+		return chromedp.Sleep(2 * time.Second).Do(ctx)
 	})
 }
 
 func writeJsonError(w http.ResponseWriter, message string, statusCode int) {
+	writeErrorResponse(w, ErrorResponse{Error: message}, statusCode)
+}
+
+// writeErrorResponse переводит сообщение на язык запроса и отдаёт ошибку.
+// Явно заданный Code сохраняется.
+func writeErrorResponse(w http.ResponseWriter, resp ErrorResponse, statusCode int) {
+	message, code := localize(responseLang(w), resp.Error)
+	resp.Error = message
+	if resp.Code == "" {
+		resp.Code = code
+	}
+	resp.RequestID = w.Header().Get(requestIDHeader)
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	w.WriteHeader(statusCode)
-	json.NewEncoder(w).Encode(ErrorResponse{Error: message})
+	json.NewEncoder(w).Encode(resp)
 }
 
 func scrapeHandler(w http.ResponseWriter, r *http.Request) {
-	log.Printf("\nЛОГ: Получен новый запрос: %s", r.URL.String())
-
-	captchaMutex.Lock()
-	if isCaptchaPending {
-		captchaMutex.Unlock()
-		log.Println("ЛОГ: Отклоняю запрос, так как уже решается CAPTCHA.")
-		writeJsonError(w, "Сервис занят решением CAPTCHA. Попробуйте позже.", http.StatusServiceUnavailable)
+	q, err := scrapeQuery(w, r)
+	if err != nil {
+		writeJsonError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	captchaMutex.Unlock()
-
-	url := r.URL.Query().Get("url")
-	if url == "" {
-		writeJsonError(w, "Параметр 'url' обязателен", http.StatusBadRequest)
+	slog.InfoContext(r.Context(), "Получен запрос на скрапинг", "url", q.Get("url"))
+	if status, err := checkEvalParam(r, q); err != nil {
+		writeJsonError(w, err.Error(), status)
 		return
 	}
+	var selection []*gqlField
+	if raw := q.Get("fields"); raw != "" {
+		selection = parseFieldsParam(raw)
+		applyFieldSelection(q, selection)
+	}
 
-	tabCtx, cancelTab := chromedp.NewContext(persistentBrowserCtx)
-	defer cancelTab()
+	var transform *jsonPath
+	if raw := q.Get("transform"); raw != "" {
+		if transform, err = compileJSONPath(raw); err != nil {
+			writeJsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
 
-	var response Response
-	var tasks chromedp.Tasks
+	var outTemplate *outputTemplate
+	if name := q.Get("template"); name != "" {
+		if outTemplate, err = lookupOutputTemplate(name); err != nil {
+			writeJsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
 
-	tasks = append(tasks, chromedp.Navigate(url))
-	tasks = append(tasks, chromedp.WaitVisible(`body`, chromedp.ByQuery))
-	tasks = append(tasks, detectAndPauseOnCaptcha(url))
+	opts, err := parseScrapeOptions(q)
+	if err != nil {
+		writeJsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	// --- Временные переменные для безопасного сбора данных ---
-	var (
-		content   string
-		meta      Meta
-		descOK    bool // Флаг, что description найден
-		keysOK    bool // Флаг, что keywords найден
-		linkNodes []*cdp.Node
-	)
+	opts.trace = r.Context()
 
-	// --- Динамически строим ПЛОСКИЙ список задач ---
-	if r.URL.Query().Has("content") {
-		log.Println("ЛОГ: Добавляю в очередь задачу: сбор КОНТЕНТА.")
-		tasks = append(tasks, chromedp.Text(`body`, &content, chromedp.ByQuery))
+	if q.Get("async") == "true" || q.Has("callback_url") {
+		startAsyncScrape(w, r, q, opts, selection, transform, outTemplate)
+		return
 	}
 
-	if r.URL.Query().Has("meta") {
-		log.Println("ЛОГ: Добавляю в очередь задачу: сбор МЕТА-ДАННЫХ.")
-		tasks = append(tasks,
-			chromedp.Title(&meta.Title),
-			// !!! ГЛАВНОЕ ИСПРАВЛЕНИЕ: Передаем указатели на `descOK` и `keysOK` !!!
-			// Это делает поиск НЕБЛОКИРУЮЩИМ. Если тега нет, `ok` станет `false`, и мы пойдем дальше.
-			chromedp.AttributeValue(`meta[name="description"]`, "content", &meta.Description, &descOK, chromedp.ByQuery),
-			chromedp.AttributeValue(`meta[name="keywords"]`, "content", &meta.Keywords, &keysOK, chromedp.ByQuery),
-		)
+	response, cacheStatus, err := scrapeWithCache(q, opts)
+	if cacheStatus != "" {
+		w.Header().Set("X-Cache", cacheStatus)
 	}
-
-	if r.URL.Query().Has("links") {
-		log.Println("ЛОГ: Добавляю в очередь задачу: сбор ССЫЛОК.")
-		tasks = append(tasks, chromedp.Nodes("a", &linkNodes, chromedp.ByQueryAll))
+	var busyErr *captchaBusyError
+	if errors.As(err, &busyErr) {
+		writeErrorResponse(w, ErrorResponse{Error: "Не удалось выполнить скрапинг: " + err.Error(), Code: "captcha_pending"}, http.StatusServiceUnavailable)
+		return
 	}
-
-	// --- Финальное действие: обработка всех собранных данных ---
-	tasks = append(tasks, chromedp.ActionFunc(func(ctx context.Context) error {
-		log.Println("ЛОГ: Шаг [2] - Обрабатываю собранные данные.")
-		if r.URL.Query().Has("content") {
-			response.Content = strings.TrimSpace(content)
+	var thErr *throttledError
+	if errors.As(err, &thErr) {
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds(thErr.RetryAfter)))
+		writeErrorResponse(w, ErrorResponse{Error: "Не удалось выполнить скрапинг: " + err.Error(), Code: "domain_rate_limited"}, http.StatusTooManyRequests)
+		return
+	}
+	var rlErr *rateLimitError
+	if errors.As(err, &rlErr) {
+		w.Header().Set("Retry-After", strconv.Itoa(rlErr.Info.RetryAfterSeconds))
+		writeErrorResponse(w, ErrorResponse{Error: "Не удалось выполнить скрапинг: " + err.Error(), Code: "rate_limited", RateLimit: &rlErr.Info}, http.StatusTooManyRequests)
+		return
+	}
+	if err != nil {
+		writeJsonError(w, "Не удалось выполнить скрапинг: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if opts.PreviousHash != "" {
+		var unchanged *UnchangedResponse
+		if response, unchanged = compareHash(response, opts.PreviousHash); unchanged != nil {
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			json.NewEncoder(w).Encode(unchanged)
+			return
 		}
-		if r.URL.Query().Has("meta") {
-			response.Meta = &meta
+	}
+	// Порядок постобработки: выбор полей, transform, затем шаблон или
+	// выгрузка крупных полей (шаблону нужны данные целиком).
+	var out any = response
+	if selection != nil {
+		if out, err = projectResponse(response, selection); err != nil {
+			writeJsonError(w, "Не удалось сформировать ответ: "+err.Error(), http.StatusInternalServerError)
+			return
 		}
-		if r.URL.Query().Has("links") {
-			for _, node := range linkNodes {
-				href := node.AttributeValue("href")
-				if href == "" || strings.HasPrefix(href, "#") || strings.HasPrefix(href, "javascript:") {
-					continue
-				}
-				var text string
-				_ = chromedp.TextContent(node.FullXPath(), &text, chromedp.BySearch).Do(ctx)
-				response.Links = append(response.Links, Link{
-					Href: href,
-					Text: strings.TrimSpace(text),
-				})
-			}
+	}
+	offload := offloadThreshold > 0 && outTemplate == nil
+	if transform != nil || outTemplate != nil || offload {
+		if out, err = toGenericJSON(out); err != nil {
+			writeJsonError(w, "Не удалось сформировать ответ: "+err.Error(), http.StatusInternalServerError)
+			return
 		}
-		return nil
-	}))
-
-	log.Println("ЛОГ: Шаг [0] - Начинаю выполнение всех задач.")
-	if err := chromedp.Run(tabCtx, tasks); err != nil {
-		log.Printf("ЛОГ: Ошибка во время выполнения chromedp: %v", err)
-		writeJsonError(w, "Не удалось выполнить скрапинг: "+err.Error(), http.StatusInternalServerError)
+	}
+	if transform != nil {
+		out = transform.Apply(out)
+	}
+	if obj, ok := out.(map[string]any); ok && offload {
+		if err := offloadLargeFields(obj, r); err != nil {
+			writeJsonError(w, "Не удалось выгрузить крупные поля: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	if outTemplate != nil {
+		body, err := outTemplate.Render(out)
+		if err != nil {
+			writeJsonError(w, "Не удалось применить шаблон: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", outTemplate.contentType)
+		w.Write(body)
 		return
 	}
-
-	log.Println("ЛОГ: Все задачи успешно выполнены.")
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	json.NewEncoder(w).Encode(response)
+	json.NewEncoder(w).Encode(out)
 }
 
 // ... (manageConsoleInput и main без изменений) ...
@@ -215,47 +329,112 @@ func manageConsoleInput() {
 	reader := bufio.NewReader(os.Stdin)
 	for {
 		reader.ReadString('\n')
-		captchaMutex.Lock()
-		if isCaptchaPending {
-			isCaptchaPending = false
-			log.Println("ЛОГ: Консоль: получен Enter, флаг CAPTCHA снят.")
+		if w := currentCaptcha(""); w != nil {
+			resolveCaptcha(w, "Enter в консоли")
 		}
-		captchaMutex.Unlock()
 	}
 }
 
 func main() {
 	_ = godotenv.Load()
+	setupLogging()
+	loadTracingConfig()
 	headless := flag.Bool("headless", false, "Запуск браузера в headless режиме")
+	flag.StringVar(&profileDir, "user-data-dir", os.Getenv("PROFILE_DIR"), "Каталог профилей браузера: куки, localStorage и вход сохраняются между перезапусками")
+	flag.BoolVar(&stealthEnabled, "stealth", true, "Маскировать признаки автоматизации (navigator.webdriver, plugins, WebGL...)")
 	flag.Parse()
 
-	if *headless {
-		log.Fatal("КРИТИЧЕСКАЯ ОШИБКА: Этот режим требует ручного ввода и не может работать с флагом -headless=true")
-	}
-
 	go manageConsoleInput()
+	loadPopupSelectors()
+	loadCaptchaKeywords()
+	loadRateLimitConfig()
+	loadTrackingParams()
+	loadLanguageConfig()
+	loadOutputTemplates()
+	loadProxyConfig()
+	loadProxyPool()
+	loadBlocklistConfig()
+	loadAPIKeys()
+	loadTargetPolicy()
+	loadRequestRateLimits()
 
 	opts := append(chromedp.DefaultExecAllocatorOptions[:],
 		chromedp.Flag("headless", *headless),
-		chromedp.UserAgent(`Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/117.0.0.0 Safari/537.36`),
+		chromedp.UserAgent(desktopProfiles[0].UserAgent),
 		chromedp.Flag("disable-blink-features", "AutomationControlled"),
 		chromedp.NoSandbox,
 		chromedp.DisableGPU,
 	)
+	if globalProxy != nil {
+		opts = append(opts, chromedp.ProxyServer(globalProxy.Server))
+	}
 
-	allocCtx, cancelAlloc := chromedp.NewExecAllocator(context.Background(), opts...)
-	defer cancelAlloc()
-
-	var cancelBrowser func()
-	persistentBrowserCtx, cancelBrowser = chromedp.NewContext(allocCtx, chromedp.WithLogf(log.Printf))
-	defer cancelBrowser()
+	// Координатору браузер не нужен: скрапинг выполняют воркеры.
+	loadClusterConfig()
+	if clusterMode != "coordinator" {
+		if err := startBrowsers(opts); err != nil {
+			log.Fatalf("Не удалось запустить браузер: %v", err)
+		}
+		loadRecycleConfig()
+	}
+	if clusterMode == "worker" {
+		go runWorker()
+	}
+	// Координатор CAPTCHA не видит; воркерам кластера нужен свой бот на
+	// каждого — getUpdates одного бота читает только один процесс.
+	if telegramTwoWay() && clusterMode != "coordinator" {
+		go telegramPollLoop()
+	}
 
-	if err := chromedp.Run(persistentBrowserCtx); err != nil {
-		log.Fatalf("Не удалось запустить браузер: %v", err)
+	if dir := os.Getenv("STORAGE_DIR"); dir != "" {
+		store, err := newFileStore(dir)
+		if err != nil {
+			log.Fatalf("Не удалось открыть хранилище %s: %v", dir, err)
+		}
+		resultStore = store
+		log.Printf("ЛОГ: Хранилище результатов включено: %s", dir)
+		if resultIndex, err = buildSearchIndex(store); err != nil {
+			log.Fatalf("Не удалось построить поисковый индекс: %v", err)
+		}
+	}
+	loadOffloadConfig()
+	loadCacheConfig()
+	if scrapeCache != nil {
+		go prefetchWorker()
 	}
-	log.Println("ЛОГ: Постоянный экземпляр браузера успешно запущен.")
+	loadRetentionConfig()
+	go gcLoop()
+	loadMonitors()
+	go monitorLoop()
 
 	http.HandleFunc("/scrape", scrapeHandler)
+	http.HandleFunc("/history", historyHandler)
+	http.HandleFunc("/duplicates", duplicatesHandler)
+	http.HandleFunc("/search", searchHandler)
+	http.HandleFunc("/export", exportHandler)
+	http.HandleFunc("/graphql", graphqlHandler)
+	http.HandleFunc("/screenshot", screenshotHandler)
+	http.HandleFunc("/pdf", pdfHandler)
+	http.HandleFunc("/download", downloadHandler)
+	http.HandleFunc("/prefetch", prefetchHandler)
+	http.HandleFunc("/crawl", crawlHandler)
+	http.HandleFunc("/crawl/sitemap", crawlSitemapHandler)
+	http.HandleFunc("/jobs/", jobsHandler)
+	http.HandleFunc("/sessions", sessionsHandler)
+	http.HandleFunc("/sessions/", sessionsHandler)
+	http.HandleFunc("/monitors", monitorsHandler)
+	http.HandleFunc("/monitors/", monitorsHandler)
+	http.HandleFunc("/admin/purge", purgeHandler)
+	http.HandleFunc("/admin/proxies", proxyPoolHandler)
+	http.HandleFunc("/admin/profile", profileHandler)
+	http.HandleFunc("/admin/profile/", profileHandler)
+	http.HandleFunc("/admin/browser/restart", browserRestartHandler)
+	http.HandleFunc("/visual-diff", visualDiffHandler)
+	http.HandleFunc("/artifacts/", artifactHandler)
+	http.HandleFunc("/debug/console", debugConsoleHandler)
+	http.HandleFunc("/captcha", captchaHandler)
+	http.HandleFunc("/captcha/", captchaHandler)
+	http.HandleFunc("/metrics", metricsHandler)
 
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -263,6 +442,10 @@ func main() {
 	}
 	addr := ":" + port
 	log.Printf("Сервер запущен на http://localhost%s", addr)
-	log.Println("Режим: с графическим интерфейсом (non-headless)")
-	log.Fatal(http.ListenAndServe(addr, nil))
+	if *headless {
+		log.Println("Режим: headless; CAPTCHA решается удалённо через /captcha (нужен ADMIN_TOKEN)")
+	} else {
+		log.Println("Режим: с графическим интерфейсом (non-headless)")
+	}
+	serveUntilSignal(&http.Server{Addr: addr, Handler: withRequestLog(withTracing(withMetrics(withLanguage(withAPIKeys(withClientRateLimit(http.DefaultServeMux))))))})
 }
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// format=markdown: content (и article.text) отдаются в Markdown, собранном
+// по отрендеренному DOM, — с заголовками, списками, ссылками, таблицами и
+// блоками кода. content_hash по-прежнему считается по тексту body.
+
+var validContentFormats = map[string]bool{"text": true, "markdown": true}
+
+// markdownFunc — JS-функция, переводящая элемент в Markdown. Скрытые
+// элементы подключённого DOM пропускаются; ссылки и картинки приводятся
+// к абсолютным адресам.
+const markdownFunc = `function (root) {
+	const SKIP = new Set(['SCRIPT', 'STYLE', 'NOSCRIPT', 'TEMPLATE', 'SVG', 'CANVAS', 'IFRAME', 'HEAD', 'BUTTON', 'SELECT', 'INPUT', 'TEXTAREA']);
+	const BLOCK = /^(ADDRESS|ARTICLE|ASIDE|BLOCKQUOTE|DD|DETAILS|DIV|DL|DT|FIELDSET|FIGCAPTION|FIGURE|FOOTER|FORM|H[1-6]|HEADER|HR|LI|MAIN|NAV|OL|P|PRE|SECTION|SUMMARY|TABLE|UL)$/;
+	const TICK = String.fromCharCode(96);
+	const abs = v => { try { return new URL(v, document.baseURI).href; } catch (e) { return v || ''; } };
+	const skip = el => SKIP.has(el.tagName) || el.hidden || (el.isConnected && getComputedStyle(el).display === 'none');
+	const esc = s => s.replace(/([\\*_\[\]<>|])/g, '\\$1');
+	const isBlock = n => n.nodeType === Node.ELEMENT_NODE && BLOCK.test(n.tagName);
+
+	// inline переводит строчный узел; блочные потомки внутри строчных
+	// элементов (div в ссылке) обрабатываются как строчные.
+	const inline = n => {
+		if (n.nodeType === Node.TEXT_NODE) return esc(n.textContent.replace(/\s+/g, ' '));
+		if (n.nodeType !== Node.ELEMENT_NODE || skip(n)) return '';
+		const inner = () => Array.from(n.childNodes, inline).join('').replace(/\s+/g, ' ').trim();
+		switch (n.tagName) {
+		case 'A': {
+			const text = inner(), href = n.getAttribute('href');
+			return href && !href.startsWith('javascript:') && !href.startsWith('#') && text ? '[' + text + '](' + abs(href) + ')' : text;
+		}
+		case 'IMG': {
+			const src = n.currentSrc || n.getAttribute('src');
+			return src && !src.startsWith('data:') ? '![' + esc((n.getAttribute('alt') || '').trim()) + '](' + abs(src) + ')' : '';
+		}
+		case 'STRONG': case 'B': { const t = inner(); return t ? '**' + t + '**' : ''; }
+		case 'EM': case 'I': { const t = inner(); return t ? '*' + t + '*' : ''; }
+		case 'CODE': return TICK + n.textContent + TICK;
+		case 'BR': return '  \n';
+		}
+		return Array.from(n.childNodes, inline).join('');
+	};
+
+	// children собирает потомков: подряд идущие строчные узлы — в один
+	// абзац, блоки — отдельно, между блоками пустая строка.
+	const children = el => {
+		const parts = [];
+		let run = '';
+		const flush = () => {
+			const t = run.replace(/[ \t]+/g, ' ').replace(/ *\n */g, '\n').trim();
+			if (t) parts.push(t);
+			run = '';
+		};
+		for (const ch of el.childNodes) {
+			if (isBlock(ch)) {
+				flush();
+				const t = convert(ch).trim();
+				if (t) parts.push(t);
+			} else {
+				run += inline(ch);
+			}
+		}
+		flush();
+		return parts.join('\n\n');
+	};
+
+	const list = (el, depth) => {
+		const lines = [];
+		let n = parseInt(el.getAttribute('start') || '1', 10);
+		for (const li of el.children) {
+			if (li.tagName !== 'LI' || skip(li)) continue;
+			const marker = el.tagName === 'OL' ? (n++) + '. ' : '- ';
+			const own = li.cloneNode(true);
+			for (const sub of Array.from(own.children)) {
+				if (sub.tagName === 'UL' || sub.tagName === 'OL') sub.remove();
+			}
+			lines.push('  '.repeat(depth) + marker + children(own).replace(/\n+/g, ' ').trim());
+			for (const sub of li.children) {
+				if ((sub.tagName === 'UL' || sub.tagName === 'OL') && !skip(sub)) {
+					const nested = list(sub, depth + 1);
+					if (nested) lines.push(nested);
+				}
+			}
+		}
+		return lines.join('\n');
+	};
+
+	const table = el => {
+		const rows = Array.from(el.querySelectorAll('tr')).filter(tr => tr.closest('table') === el);
+		const cells = rows.map(tr => Array.from(tr.children)
+			.filter(c => c.tagName === 'TD' || c.tagName === 'TH')
+			.map(c => Array.from(c.childNodes, inline).join('').replace(/\s+/g, ' ').trim()));
+		const width = Math.max(0, ...cells.map(r => r.length));
+		if (!width) return '';
+		const line = r => '| ' + Array.from({length: width}, (_, i) => r[i] || '').join(' | ') + ' |';
+		return [line(cells[0]), '|' + ' --- |'.repeat(width), ...cells.slice(1).map(line)].join('\n');
+	};
+
+	const convert = el => {
+		if (skip(el)) return '';
+		const tag = el.tagName;
+		if (/^H[1-6]$/.test(tag)) {
+			const t = Array.from(el.childNodes, inline).join('').replace(/\s+/g, ' ').trim();
+			return t ? '#'.repeat(+tag[1]) + ' ' + t : '';
+		}
+		switch (tag) {
+		case 'UL': case 'OL': return list(el, 0);
+		case 'TABLE': return table(el);
+		case 'HR': return '---';
+		case 'PRE': {
+			const code = el.querySelector('code');
+			const lang = (((code && code.className) || el.className || '') + '').match(/(?:language|lang)-(\S+)/);
+			const fence = TICK.repeat(3);
+			return fence + (lang ? lang[1] : '') + '\n' + el.textContent.replace(/\n$/, '') + '\n' + fence;
+		}
+		case 'BLOCKQUOTE': {
+			const t = children(el);
+			return t ? t.split('\n').map(l => l ? '> ' + l : '>').join('\n') : '';
+		}
+		}
+		return children(el);
+	};
+
+	return convert(root).replace(/\n{3,}/g, '\n\n').trim();
+}`
+
+// markdownScript переводит в Markdown всю страницу.
+const markdownScript = `(` + markdownFunc + `)(document.body)`
+
+// htmlToMarkdownScript переводит в Markdown фрагмент разметки (очищенную статью).
+func htmlToMarkdownScript(fragment string) string {
+	quoted, _ := json.Marshal(fragment)
+	return fmt.Sprintf(`(%s)(Object.assign(document.createElement('div'), {innerHTML: %s}))`, markdownFunc, quoted)
+}
@@ -0,0 +1,159 @@
+package main
+
+import "strings"
+
+// metaAllScript собирает все <meta> и <link rel> страницы для meta=all.
+// Ключ meta — name, property, http-equiv или itemprop (в нижнем регистре),
+// у <meta charset> — "charset". У link ключ — каждое значение rel, значение —
+// абсолютный href. Повторяющиеся ключи (og:image, alternate) дают несколько значений.
+const metaAllScript = `(() => {
+	const tags = {}, links = {};
+	const add = (m, k, v) => { if (k && v != null && v !== '') (m[k] = m[k] || []).push(v); };
+	for (const el of document.querySelectorAll('meta')) {
+		if (el.hasAttribute('charset')) { add(tags, 'charset', el.getAttribute('charset')); continue; }
+		const key = el.getAttribute('name') || el.getAttribute('property') ||
+			el.getAttribute('http-equiv') || el.getAttribute('itemprop');
+		add(tags, key && key.trim().toLowerCase(), el.getAttribute('content'));
+	}
+	for (const el of document.querySelectorAll('link[rel]')) {
+		for (const rel of el.getAttribute('rel').toLowerCase().split(/\s+/)) {
+			add(links, rel, el.href || el.getAttribute('href'));
+		}
+	}
+	return {tags, links};
+})()`
+
+// metaAllResult — результат metaAllScript.
+type metaAllResult struct {
+	Tags  map[string][]string `json:"tags"`
+	Links map[string][]string `json:"links"`
+}
+
+// SocialMeta — разметка Open Graph и Twitter Card для превью в соцсетях.
+type SocialMeta struct {
+	OpenGraph *OpenGraph        `json:"og,omitempty"`
+	Twitter   map[string]string `json:"twitter,omitempty"` // Ключи без префикса: card, site, title, image...
+}
+
+// OpenGraph — основные свойства og:*. Image и URL — абсолютные адреса.
+type OpenGraph struct {
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	Image       string `json:"image,omitempty"`
+	Type        string `json:"type,omitempty"`
+	URL         string `json:"url,omitempty"`
+	SiteName    string `json:"site_name,omitempty"`
+}
+
+// socialScript собирает og:* и twitter:*. Сайты пишут их и в property,
+// и в name; при повторах берётся первое значение. Ссылки приводятся к
+// абсолютным относительно документа.
+const socialScript = `(() => {
+	const og = {}, twitter = {};
+	const ogKeys = {'og:title': 'title', 'og:description': 'description', 'og:image': 'image',
+		'og:image:url': 'image', 'og:type': 'type', 'og:url': 'url', 'og:site_name': 'site_name'};
+	const abs = v => { try { return new URL(v, document.baseURI).href; } catch (e) { return v; } };
+	for (const el of document.querySelectorAll('meta[property], meta[name]')) {
+		const key = (el.getAttribute('property') || el.getAttribute('name') || '').trim().toLowerCase();
+		const value = (el.getAttribute('content') || '').trim();
+		if (!value) continue;
+		if (ogKeys[key] && !og[ogKeys[key]]) {
+			const field = ogKeys[key];
+			og[field] = field === 'image' || field === 'url' ? abs(value) : value;
+		} else if (key.startsWith('twitter:') && key.length > 8) {
+			const field = key.slice(8);
+			if (!twitter[field]) twitter[field] = field === 'image' || field === 'image:src' ? abs(value) : value;
+		}
+	}
+	return {og: Object.keys(og).length ? og : null, twitter: Object.keys(twitter).length ? twitter : null};
+})()`
+
+// Hreflang — языковая версия страницы из <link rel="alternate" hreflang>.
+type Hreflang struct {
+	Lang string `json:"lang"` // Как на странице, например de-AT или x-default
+	Href string `json:"href"`
+}
+
+// RobotsMeta — директивы индексации: <meta name="robots"> и заголовок
+// X-Robots-Tag. NoIndex и NoFollow учитывают оба источника и «none».
+type RobotsMeta struct {
+	Directives []string            `json:"directives,omitempty"` // Из <meta name="robots">, в нижнем регистре
+	Bots       map[string][]string `json:"bots,omitempty"`       // Для отдельных роботов: googlebot, yandex...
+	Header     string              `json:"x_robots_tag,omitempty"`
+	NoIndex    bool                `json:"noindex"`
+	NoFollow   bool                `json:"nofollow"`
+}
+
+// seoLinksResult — результат seoLinksScript.
+type seoLinksResult struct {
+	Canonical string            `json:"canonical"`
+	Hreflang  []Hreflang        `json:"hreflang"`
+	AMP       string            `json:"amphtml"`
+	Next      string            `json:"next"`
+	Prev      string            `json:"prev"`
+	Robots    map[string]string `json:"robots"` // name meta-тега → content
+}
+
+// seoLinksScript собирает canonical, hreflang, amphtml, next/prev и
+// robots-мета. Берётся первое вхождение, кроме hreflang; ссылки абсолютные.
+const seoLinksScript = `(() => {
+	const first = rel => { const el = document.querySelector('link[rel~="' + rel + '" i][href]'); return el ? el.href : ''; };
+	const hreflang = [];
+	for (const el of document.querySelectorAll('link[rel~="alternate" i][hreflang][href]')) {
+		hreflang.push({lang: el.getAttribute('hreflang').trim(), href: el.href});
+	}
+	const robots = {};
+	for (const el of document.querySelectorAll('meta[name][content]')) {
+		const name = el.getAttribute('name').trim().toLowerCase();
+		if (name !== 'robots' && !/^(googlebot(-news)?|bingbot|yandex|yandexbot|slurp|duckduckbot|baiduspider|msnbot)$/.test(name)) continue;
+		robots[name] = robots[name] ? robots[name] + ', ' + el.getAttribute('content') : el.getAttribute('content');
+	}
+	return {canonical: first('canonical'), hreflang, amphtml: first('amphtml'), next: first('next'), prev: first('prev'), robots};
+})()`
+
+func robotsDirectives(content string) []string {
+	var out []string
+	// Повторённый X-Robots-Tag Chrome склеивает через перевод строки.
+	for _, d := range strings.FieldsFunc(content, func(r rune) bool { return r == ',' || r == '\n' }) {
+		if d = strings.ToLower(strings.TrimSpace(d)); d != "" {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+// buildRobotsMeta сводит robots-мету и X-Robots-Tag; nil — директив нет.
+func buildRobotsMeta(tags map[string]string, header string) *RobotsMeta {
+	robots := &RobotsMeta{Directives: robotsDirectives(tags["robots"]), Header: header}
+	for name, content := range tags {
+		if name != "robots" {
+			if robots.Bots == nil {
+				robots.Bots = map[string][]string{}
+			}
+			robots.Bots[name] = robotsDirectives(content)
+		}
+	}
+	// Директивы X-Robots-Tag для отдельного робота («googlebot: noindex»)
+	// на общие флаги не влияют.
+	var fromHeader []string
+	for _, d := range robotsDirectives(header) {
+		if bot, _, ok := strings.Cut(d, ":"); ok && bot != "unavailable_after" {
+			continue
+		}
+		fromHeader = append(fromHeader, d)
+	}
+	for _, d := range append(robots.Directives, fromHeader...) {
+		switch d {
+		case "noindex":
+			robots.NoIndex = true
+		case "nofollow":
+			robots.NoFollow = true
+		case "none":
+			robots.NoIndex, robots.NoFollow = true, true
+		}
+	}
+	if len(robots.Directives) == 0 && robots.Bots == nil && header == "" {
+		return nil
+	}
+	return robots
+}
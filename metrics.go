@@ -0,0 +1,311 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/chromedp/chromedp"
+)
+
+// Метрики в формате Prometheus: GET /metrics. Клиентская библиотека не
+// подключается — формат текстовый и простой. Доступ без токена, как и
+// принято для /metrics; закрывать его стоит на уровне сети.
+
+// latencyBuckets — границы гистограмм длительности, секунды.
+var latencyBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120}
+
+type histogram struct {
+	counts []uint64 // По границам latencyBuckets, без накопления
+	sum    float64
+	total  uint64
+}
+
+func (h *histogram) observe(v float64) {
+	if h.counts == nil {
+		h.counts = make([]uint64, len(latencyBuckets))
+	}
+	for i, le := range latencyBuckets {
+		if v <= le {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += v
+	h.total++
+}
+
+// metricsState — счётчики и гистограммы под одним мьютексом.
+type metricsState struct {
+	mu                 sync.Mutex
+	requests           map[[2]string]uint64 // {handler, code}
+	requestDuration    map[string]*histogram
+	scrapeDuration     histogram
+	navigationFailures map[string]uint64
+}
+
+var (
+	metrics = &metricsState{
+		requests:           map[[2]string]uint64{},
+		requestDuration:    map[string]*histogram{},
+		navigationFailures: map[string]uint64{},
+	}
+	captchaPauses   atomic.Uint64
+	browserRestarts atomic.Uint64
+)
+
+// observeScrape учитывает длительность скрапинга своим браузером.
+func observeScrape(d time.Duration) {
+	metrics.mu.Lock()
+	metrics.scrapeDuration.observe(d.Seconds())
+	metrics.mu.Unlock()
+}
+
+// observeNavigationFailure учитывает ошибку навигации по классу.
+func observeNavigationFailure(err error) {
+	class := navigationFailureClass(err)
+	metrics.mu.Lock()
+	metrics.navigationFailures[class]++
+	metrics.mu.Unlock()
+}
+
+// navigationFailureClass сводит ошибку навигации к небольшому набору
+// классов: у Chrome это net::ERR_*, у chromedp — ошибки контекста.
+func navigationFailureClass(err error) string {
+	var rlErr *rateLimitError
+	msg := err.Error()
+	switch {
+	case errors.As(err, &rlErr):
+		return "rate_limited"
+	case errors.Is(err, errTabCrashed):
+		return "tab_crashed"
+	case errors.Is(err, context.DeadlineExceeded), strings.Contains(msg, "ERR_TIMED_OUT"):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case strings.Contains(msg, "ERR_NAME_NOT_RESOLVED"):
+		return "dns"
+	case strings.Contains(msg, "ERR_CERT"), strings.Contains(msg, "ERR_SSL"):
+		return "tls"
+	case strings.Contains(msg, "ERR_PROXY"), strings.Contains(msg, "ERR_TUNNEL"):
+		return "proxy"
+	case strings.Contains(msg, "ERR_CONNECTION"), strings.Contains(msg, "ERR_ADDRESS"):
+		return "connection"
+	case strings.Contains(msg, "ERR_BLOCKED"):
+		return "blocked"
+	}
+	return "other"
+}
+
+// metricsResponseWriter запоминает код ответа.
+type metricsResponseWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *metricsResponseWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *metricsResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *metricsResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *metricsResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
+
+func (w *metricsResponseWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+// withMetrics считает запросы и их длительность по шаблону маршрута.
+func withMetrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		mw := &metricsResponseWriter{ResponseWriter: w}
+		next.ServeHTTP(mw, r)
+		// ServeMux записывает найденный шаблон в r.Pattern.
+		handler := r.Pattern
+		if handler == "" {
+			handler = "unmatched"
+		}
+		if mw.status == 0 {
+			mw.status = http.StatusOK
+		}
+		metrics.mu.Lock()
+		metrics.requests[[2]string{handler, fmt.Sprint(mw.status)}]++
+		h := metrics.requestDuration[handler]
+		if h == nil {
+			h = &histogram{}
+			metrics.requestDuration[handler] = h
+		}
+		h.observe(time.Since(start).Seconds())
+		metrics.mu.Unlock()
+	})
+}
+
+func writeHistogram(w io.Writer, name, labels string, h *histogram) {
+	var cumulative uint64
+	for i, le := range latencyBuckets {
+		if h.counts != nil {
+			cumulative += h.counts[i]
+		}
+		fmt.Fprintf(w, "%s_bucket{%sle=\"%g\"} %d\n", name, labels, le, cumulative)
+	}
+	fmt.Fprintf(w, "%s_bucket{%sle=\"+Inf\"} %d\n", name, labels, h.total)
+	if labels != "" {
+		labels = "{" + strings.TrimSuffix(labels, ",") + "}"
+	}
+	fmt.Fprintf(w, "%s_sum%s %g\n", name, labels, h.sum)
+	fmt.Fprintf(w, "%s_count%s %d\n", name, labels, h.total)
+}
+
+// openTabs считает вкладки экземпляра браузера.
+func openTabs(b *browserInstance) int {
+	ctx, cancel := context.WithTimeout(b.ctx, 2*time.Second)
+	defer cancel()
+	targets, err := chromedp.Targets(ctx)
+	if err != nil {
+		return 0
+	}
+	n := 0
+	for _, t := range targets {
+		if t.Type == "page" {
+			n++
+		}
+	}
+	return n
+}
+
+// clusterQueueDepth — длина общей очереди кластера.
+func clusterQueueDepth() int64 {
+	if clusterRedis == nil {
+		return 0
+	}
+	n, _ := clusterRedis.Do("LLEN", clusterKeyJobs)
+	depth, _ := n.(int64)
+	return depth
+}
+
+// metricsHandler: GET /metrics.
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	jobsMu.Lock()
+	runningJobs := 0
+	for _, job := range jobs {
+		if job.Status == "running" {
+			runningJobs++
+		}
+	}
+	jobsMu.Unlock()
+	captchaWaiting := captchaCount()
+	var browsers []*browserInstance
+	if clusterMode != "coordinator" {
+		browsers = primaryBrowsers()
+	}
+	tabs := make([]int, len(browsers))
+	totalTabs := 0
+	for i, b := range browsers {
+		tabs[i] = openTabs(b)
+		totalTabs += tabs[i]
+	}
+
+	fmt.Fprintln(w, "# HELP webextract_active_scrapes Scrapes in progress.")
+	fmt.Fprintln(w, "# TYPE webextract_active_scrapes gauge")
+	fmt.Fprintf(w, "webextract_active_scrapes %d\n", activeScrapes.Load())
+	fmt.Fprintln(w, "# HELP webextract_open_tabs Open browser tabs.")
+	fmt.Fprintln(w, "# TYPE webextract_open_tabs gauge")
+	fmt.Fprintf(w, "webextract_open_tabs %d\n", totalTabs)
+	fmt.Fprintln(w, "# HELP webextract_browser_up Whether a browser instance is running, by slot.")
+	fmt.Fprintln(w, "# TYPE webextract_browser_up gauge")
+	for i, b := range browsers {
+		up := 0
+		if b.ctx.Err() == nil {
+			up = 1
+		}
+		fmt.Fprintf(w, "webextract_browser_up{instance=\"%d\"} %d\n", i, up)
+	}
+	fmt.Fprintln(w, "# HELP webextract_browser_tabs Open tabs by browser instance slot.")
+	fmt.Fprintln(w, "# TYPE webextract_browser_tabs gauge")
+	for i := range browsers {
+		fmt.Fprintf(w, "webextract_browser_tabs{instance=\"%d\"} %d\n", i, tabs[i])
+	}
+	fmt.Fprintln(w, "# HELP webextract_queue_depth Queued work by queue.")
+	fmt.Fprintln(w, "# TYPE webextract_queue_depth gauge")
+	fmt.Fprintf(w, "webextract_queue_depth{queue=\"prefetch\"} %d\n", len(prefetchQueue))
+	fmt.Fprintf(w, "webextract_queue_depth{queue=\"async_jobs\"} %d\n", runningJobs)
+	if clusterRedis != nil {
+		fmt.Fprintf(w, "webextract_queue_depth{queue=\"cluster\"} %d\n", clusterQueueDepth())
+	}
+	fmt.Fprintln(w, "# HELP webextract_captcha_pending Tabs paused on a CAPTCHA.")
+	fmt.Fprintln(w, "# TYPE webextract_captcha_pending gauge")
+	fmt.Fprintf(w, "webextract_captcha_pending %d\n", captchaWaiting)
+	fmt.Fprintln(w, "# HELP webextract_captcha_pauses_total CAPTCHA pauses since start.")
+	fmt.Fprintln(w, "# TYPE webextract_captcha_pauses_total counter")
+	fmt.Fprintf(w, "webextract_captcha_pauses_total %d\n", captchaPauses.Load())
+	fmt.Fprintln(w, "# HELP webextract_browser_restarts_total Browser crashes followed by a relaunch or standby promotion.")
+	fmt.Fprintln(w, "# TYPE webextract_browser_restarts_total counter")
+	fmt.Fprintf(w, "webextract_browser_restarts_total %d\n", browserRestarts.Load())
+
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+	fmt.Fprintln(w, "# HELP webextract_http_requests_total HTTP requests by handler and status code.")
+	fmt.Fprintln(w, "# TYPE webextract_http_requests_total counter")
+	keys := make([][2]string, 0, len(metrics.requests))
+	for k := range metrics.requests {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i][0] != keys[j][0] {
+			return keys[i][0] < keys[j][0]
+		}
+		return keys[i][1] < keys[j][1]
+	})
+	for _, k := range keys {
+		fmt.Fprintf(w, "webextract_http_requests_total{handler=%q,code=%q} %d\n", k[0], k[1], metrics.requests[k])
+	}
+	fmt.Fprintln(w, "# HELP webextract_http_request_duration_seconds HTTP request latency by handler.")
+	fmt.Fprintln(w, "# TYPE webextract_http_request_duration_seconds histogram")
+	handlers := make([]string, 0, len(metrics.requestDuration))
+	for h := range metrics.requestDuration {
+		handlers = append(handlers, h)
+	}
+	sort.Strings(handlers)
+	for _, h := range handlers {
+		writeHistogram(w, "webextract_http_request_duration_seconds", fmt.Sprintf("handler=%q,", h), metrics.requestDuration[h])
+	}
+	fmt.Fprintln(w, "# HELP webextract_scrape_duration_seconds Browser scrape latency.")
+	fmt.Fprintln(w, "# TYPE webextract_scrape_duration_seconds histogram")
+	writeHistogram(w, "webextract_scrape_duration_seconds", "", &metrics.scrapeDuration)
+	fmt.Fprintln(w, "# HELP webextract_navigation_failures_total Navigation failures by class.")
+	fmt.Fprintln(w, "# TYPE webextract_navigation_failures_total counter")
+	classes := make([]string, 0, len(metrics.navigationFailures))
+	for c := range metrics.navigationFailures {
+		classes = append(classes, c)
+	}
+	sort.Strings(classes)
+	for _, c := range classes {
+		fmt.Fprintf(w, "webextract_navigation_failures_total{class=%q} %d\n", c, metrics.navigationFailures[c])
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/chromedp"
+)
+
+// Архив страницы в MHTML (Page.captureSnapshot): отрисованный DOM со
+// стилями, картинками и шрифтами в одном файле — для юридического и
+// комплаенс-архивирования. mhtml=true возвращает архив в поле mhtml,
+// mhtml=store сохраняет его артефактом (нужен STORAGE_DIR) и возвращает
+// ссылку в mhtml_artifact.
+
+var validMHTMLModes = map[string]bool{"true": true, "store": true}
+
+// mhtmlContentType — тип, с которым Chrome сам сохраняет .mhtml.
+const mhtmlContentType = "application/x-mimearchive"
+
+func captureMHTML(res *string) chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		log.Println("ЛОГ: Сохраняю архив страницы (MHTML).")
+		var err error
+		*res, err = page.CaptureSnapshot().WithFormat(page.CaptureSnapshotFormatMhtml).Do(ctx)
+		return err
+	})
+}
+
+// storeMHTML сохраняет архив артефактом. Ответ с ссылкой попадает в кэш и
+// в кластерные ответы, поэтому адрес сервиса берётся из PUBLIC_URL, а не
+// из запроса; без PUBLIC_URL в ссылке остаётся путь /artifacts/<sha256>.
+func storeMHTML(archive string) (*ArtifactRef, error) {
+	id, err := resultStore.SaveArtifact([]byte(archive), ".mhtml")
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("ЛОГ: Архив MHTML (%d байт) сохранён в артефакт %s.", len(archive), id)
+	return &ArtifactRef{
+		Artifact:    strings.TrimRight(os.Getenv("PUBLIC_URL"), "/") + "/artifacts/" + id,
+		Size:        len(archive),
+		SHA256:      id,
+		ContentType: mhtmlContentType,
+	}, nil
+}
@@ -0,0 +1,616 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Мониторинг страниц: POST /monitors регистрирует адрес с параметрами
+// извлечения и интервалом, и webextract сам периодически скрапит его и
+// сообщает об изменениях. Тело — как у POST /scrape плюс поля монитора:
+//
+//	{"url": "https://...", "interval": 3600, "webhook": "https://...", "telegram": true}
+//
+// interval — секунд между проверками. Изменение определяется по hash
+// основного текста, а если заданы selectors — по их значениям (цена,
+// наличие). Первая проверка запоминает исходное состояние. При изменении
+// уходит событие с кратким диффом строк: POST на webhook (подпись и
+// повторы — как у callback_url) и/или сообщение в Telegram. Список —
+// GET /monitors, состояние — GET /monitors/<id>, внеочередная проверка —
+// POST /monitors/<id>/check, удаление — DELETE /monitors/<id>. С
+// STORAGE_DIR мониторы переживают перезапуск (monitors.json), без него
+// хранятся в памяти. Параметры монитора хранятся и отдаются открытым
+// текстом, поэтому cookies, headers и прокси с паролем не принимаются.
+
+const (
+	defaultMonitorInterval = time.Hour
+	minMonitorInterval     = time.Minute
+	maxMonitorInterval     = 30 * 24 * time.Hour
+	maxMonitors            = 1000
+	monitorTick            = 10 * time.Second
+	maxMonitorText         = 256 << 10 // Текст для диффа, байт
+	maxDiffLines           = 10        // Строк каждого вида в событии
+	maxDiffLineLength      = 300
+	maxDiffCells           = 4 << 20 // Предел таблицы LCS; дальше дифф без учёта порядка
+)
+
+// monitorParams — поля тела, которые относятся к монитору, а не к скрапингу.
+var monitorParams = []string{"interval", "webhook", "telegram"}
+
+// unsupportedMonitorParams не имеют смысла для фоновой проверки.
+// cookies и headers тоже: параметры монитора видны в GET /monitors и
+// хранятся в monitors.json открытым текстом, а в них обычно секреты. Для
+// страниц за входом — session.
+var unsupportedMonitorParams = []string{"async", "callback_url", "fields", "transform", "template", "previous_hash", "cookies", "headers"}
+
+// Monitor — зарегистрированная страница для отслеживания.
+type Monitor struct {
+	ID         string     `json:"id"`
+	URL        string     `json:"url"`
+	Interval   int        `json:"interval"` // Секунд
+	Params     url.Values `json:"params,omitempty"`
+	Webhook    string     `json:"webhook,omitempty"`
+	Telegram   bool       `json:"telegram,omitempty"`
+	Created    time.Time  `json:"created"`
+	NextCheck  time.Time  `json:"next_check"`
+	LastCheck  *time.Time `json:"last_check,omitempty"`
+	LastChange *time.Time `json:"last_change,omitempty"`
+	Hash       string     `json:"hash,omitempty"` // Отпечаток последнего состояния
+	Checks     int        `json:"checks"`
+	Changes    int        `json:"changes"`
+	Error      string     `json:"error,omitempty"` // Ошибка последней проверки
+
+	text    string // Текст последнего состояния для диффа
+	running bool
+}
+
+// TextDiff — краткая сводка изменений по строкам.
+type TextDiff struct {
+	Added        int      `json:"added"`
+	Removed      int      `json:"removed"`
+	AddedLines   []string `json:"added_lines,omitempty"`
+	RemovedLines []string `json:"removed_lines,omitempty"`
+}
+
+// MonitorEvent — уведомление об изменении страницы.
+type MonitorEvent struct {
+	Monitor      string    `json:"monitor"`
+	URL          string    `json:"url"`
+	Checked      time.Time `json:"checked"`
+	PreviousHash string    `json:"previous_hash"`
+	Hash         string    `json:"hash"`
+	Diff         *TextDiff `json:"diff,omitempty"` // Нет, если прежний текст неизвестен
+}
+
+// monitorRecord — монитор в monitors.json вместе с текстом для диффа.
+type monitorRecord struct {
+	*Monitor
+	Text string `json:"text,omitempty"`
+}
+
+var (
+	monitorsMu sync.Mutex
+	monitors   = map[string]*Monitor{}
+)
+
+// monitorsFile — путь monitors.json; "" без хранилища.
+func monitorsFile() string {
+	if resultStore == nil {
+		return ""
+	}
+	return filepath.Join(resultStore.dir, "monitors.json")
+}
+
+// loadMonitors читает мониторы из хранилища.
+func loadMonitors() {
+	path := monitorsFile()
+	if path == "" {
+		return
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	if err != nil {
+		log.Fatalf("Не удалось прочитать %s: %v", path, err)
+	}
+	var records []monitorRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		log.Fatalf("Не удалось разобрать %s: %v", path, err)
+	}
+	monitorsMu.Lock()
+	defer monitorsMu.Unlock()
+	for _, rec := range records {
+		if rec.Monitor == nil || rec.ID == "" {
+			continue
+		}
+		rec.Monitor.text = rec.Text
+		monitors[rec.ID] = rec.Monitor
+	}
+	slog.Info("Мониторы загружены", "count", len(monitors))
+}
+
+// saveMonitorsLocked записывает мониторы в хранилище; вызывается под
+// monitorsMu.
+func saveMonitorsLocked() {
+	path := monitorsFile()
+	if path == "" {
+		return
+	}
+	records := make([]monitorRecord, 0, len(monitors))
+	for _, m := range monitors {
+		records = append(records, monitorRecord{Monitor: m, Text: m.text})
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].Created.Before(records[j].Created) })
+	data, err := json.Marshal(records)
+	if err == nil {
+		tmp := path + ".tmp"
+		if err = os.WriteFile(tmp, data, 0o644); err == nil {
+			err = os.Rename(tmp, path)
+		}
+	}
+	if err != nil {
+		slog.Error("Не удалось сохранить мониторы", "error", err)
+	}
+}
+
+// monitorLoop запускает проверки, срок которых подошёл, по одной.
+func monitorLoop() {
+	for range time.Tick(monitorTick) {
+		if shuttingDown.Load() {
+			return
+		}
+		for _, id := range dueMonitors(time.Now()) {
+			if shuttingDown.Load() {
+				return
+			}
+			checkMonitor(id)
+		}
+	}
+}
+
+// dueMonitors — мониторы, которые пора проверить, от самого просроченного.
+func dueMonitors(now time.Time) []string {
+	monitorsMu.Lock()
+	defer monitorsMu.Unlock()
+	var due []*Monitor
+	for _, m := range monitors {
+		if !m.running && !m.NextCheck.After(now) {
+			due = append(due, m)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].NextCheck.Before(due[j].NextCheck) })
+	ids := make([]string, len(due))
+	for i, m := range due {
+		ids[i] = m.ID
+	}
+	return ids
+}
+
+// checkMonitor скрапит страницу монитора и сравнивает с прошлым состоянием.
+func checkMonitor(id string) {
+	monitorsMu.Lock()
+	m := monitors[id]
+	if m == nil || m.running {
+		monitorsMu.Unlock()
+		return
+	}
+	m.running = true
+	q := monitorQuery(m)
+	monitorsMu.Unlock()
+
+	hash, text, err := monitorState(q)
+	now := time.Now()
+
+	monitorsMu.Lock()
+	defer monitorsMu.Unlock()
+	m.running = false
+	if monitors[id] != m {
+		return // Удалён во время проверки
+	}
+	m.Checks++
+	m.LastCheck = &now
+	m.NextCheck = now.Add(time.Duration(m.Interval) * time.Second)
+	m.Error = ""
+	if err != nil {
+		slog.Warn("Монитор: не удалось проверить страницу", "monitor", id, "url", m.URL, "error", err)
+		m.Error = err.Error()
+		saveMonitorsLocked()
+		return
+	}
+	if m.Hash == "" {
+		slog.Info("Монитор: исходное состояние запомнено", "monitor", id, "url", m.URL)
+	} else if hash != m.Hash {
+		event := MonitorEvent{Monitor: id, URL: m.URL, Checked: now, PreviousHash: m.Hash, Hash: hash}
+		if m.text != "" {
+			diff := diffLines(m.text, text)
+			event.Diff = &diff
+		}
+		m.Changes++
+		m.LastChange = &now
+		slog.Info("Монитор: страница изменилась", "monitor", id, "url", m.URL, "changes", m.Changes)
+		go notifyMonitorChange(event, m.Webhook, m.Telegram)
+	}
+	m.Hash = hash
+	m.text = truncateUTF8(text, maxMonitorText)
+	saveMonitorsLocked()
+}
+
+// monitorQuery — параметры скрапинга для проверки.
+func monitorQuery(m *Monitor) url.Values {
+	q := url.Values{}
+	for name, values := range m.Params {
+		q[name] = slices.Clone(values)
+	}
+	q.Set("url", m.URL)
+	q.Set("no_cache", "true")
+	q.Set("hash", "true")
+	q.Set("article", "true")
+	q.Set("content", "true")
+	return q
+}
+
+// monitorState скрапит страницу и возвращает отпечаток состояния и его
+// текст: значения selectors или основной текст.
+func monitorState(q url.Values) (hash, text string, err error) {
+	opts, err := parseScrapeOptions(q)
+	if err != nil {
+		return "", "", err
+	}
+	response, _, err := scrapeWithCache(q, opts)
+	if err != nil {
+		return "", "", err
+	}
+	if response.Status >= 400 {
+		return "", "", fmt.Errorf("страница ответила статусом %d", response.Status)
+	}
+	if len(opts.Selectors) > 0 {
+		keys := make([]string, 0, len(response.Selectors))
+		for key := range response.Selectors {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		lines := make([]string, 0, len(keys))
+		for _, key := range keys {
+			value, _ := json.Marshal(response.Selectors[key])
+			lines = append(lines, key+": "+string(value))
+		}
+		text = strings.Join(lines, "\n")
+		return contentHash(text), text, nil
+	}
+	text = response.Content
+	if response.Article != nil && strings.TrimSpace(response.Article.Text) != "" {
+		text = response.Article.Text
+	}
+	return response.Hash, text, nil
+}
+
+// truncateUTF8 обрезает строку до limit байт, не разрывая символ.
+func truncateUTF8(s string, limit int) string {
+	if len(s) <= limit {
+		return s
+	}
+	for limit > 0 && !utf8.RuneStart(s[limit]) {
+		limit--
+	}
+	return s[:limit]
+}
+
+// diffLines сравнивает тексты по строкам (без пустых). Общие начало и
+// конец отбрасываются, остаток сравнивается через LCS; если он слишком
+// велик — как мультимножества строк.
+func diffLines(before, after string) TextDiff {
+	split := func(text string) []string {
+		var lines []string
+		for _, line := range strings.Split(text, "\n") {
+			if line = strings.Join(strings.Fields(line), " "); line != "" {
+				lines = append(lines, line)
+			}
+		}
+		return lines
+	}
+	a, b := split(before), split(after)
+	for len(a) > 0 && len(b) > 0 && a[0] == b[0] {
+		a, b = a[1:], b[1:]
+	}
+	for len(a) > 0 && len(b) > 0 && a[len(a)-1] == b[len(b)-1] {
+		a, b = a[:len(a)-1], b[:len(b)-1]
+	}
+	var removed, added []string
+	if (len(a)+1)*(len(b)+1) <= maxDiffCells {
+		// lcs[i][j] — длина общей подпоследовательности a[i:] и b[j:].
+		lcs := make([][]int32, len(a)+1)
+		for i := range lcs {
+			lcs[i] = make([]int32, len(b)+1)
+		}
+		for i := len(a) - 1; i >= 0; i-- {
+			for j := len(b) - 1; j >= 0; j-- {
+				if a[i] == b[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else {
+					lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+				}
+			}
+		}
+		i, j := 0, 0
+		for i < len(a) && j < len(b) {
+			switch {
+			case a[i] == b[j]:
+				i, j = i+1, j+1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				removed = append(removed, a[i])
+				i++
+			default:
+				added = append(added, b[j])
+				j++
+			}
+		}
+		removed = append(removed, a[i:]...)
+		added = append(added, b[j:]...)
+	} else {
+		count := map[string]int{}
+		for _, line := range a {
+			count[line]++
+		}
+		for _, line := range b {
+			if count[line] > 0 {
+				count[line]--
+				continue
+			}
+			added = append(added, line)
+		}
+		for _, line := range slices.Backward(a) {
+			if count[line] > 0 {
+				count[line]--
+				removed = append(removed, line)
+			}
+		}
+		slices.Reverse(removed)
+	}
+	sample := func(lines []string) []string {
+		out := make([]string, 0, min(len(lines), maxDiffLines))
+		for _, line := range lines[:min(len(lines), maxDiffLines)] {
+			if utf8.RuneCountInString(line) > maxDiffLineLength {
+				line = string([]rune(line)[:maxDiffLineLength]) + "…"
+			}
+			out = append(out, line)
+		}
+		return out
+	}
+	return TextDiff{Added: len(added), Removed: len(removed), AddedLines: sample(added), RemovedLines: sample(removed)}
+}
+
+// notifyMonitorChange отправляет событие на webhook и в Telegram.
+func notifyMonitorChange(event MonitorEvent, webhook string, telegram bool) {
+	if telegram {
+		sendTelegramNotification(monitorMessage(event))
+	}
+	if webhook == "" {
+		return
+	}
+	// Имя могло с тех пор начать разрешаться во внутреннюю сеть.
+	u, err := url.Parse(webhook)
+	if err == nil {
+		err = checkOutboundHost("webhook", u.Hostname())
+	}
+	if err != nil {
+		slog.Warn("Монитор: доставка события отменена", "monitor", event.Monitor, "webhook", webhook, "error", err)
+		return
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		slog.Error("Монитор: не удалось сериализовать событие", "monitor", event.Monitor, "error", err)
+		return
+	}
+	client := webhookClient("webhook")
+	wait := webhookFirstWait
+	for attempt := 1; attempt <= webhookAttempts; attempt++ {
+		err := postWebhook(client, webhook, "X-Webextract-Monitor", event.Monitor, body)
+		if err == nil {
+			slog.Info("Монитор: событие доставлено", "monitor", event.Monitor, "webhook", webhook)
+			return
+		}
+		slog.Warn("Монитор: попытка доставки события не удалась", "monitor", event.Monitor, "webhook", webhook, "attempt", attempt, "error", err)
+		if attempt < webhookAttempts {
+			time.Sleep(wait)
+			wait *= 2
+		}
+	}
+}
+
+// monitorMessage — текст уведомления в Telegram.
+func monitorMessage(event MonitorEvent) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Страница изменилась: %s\n", event.URL)
+	if event.Diff == nil {
+		b.WriteString("Прежний текст недоступен, дифф не построен.")
+		return b.String()
+	}
+	fmt.Fprintf(&b, "Строк добавлено: %d, удалено: %d.", event.Diff.Added, event.Diff.Removed)
+	for _, line := range event.Diff.AddedLines {
+		b.WriteString("\n+ " + line)
+	}
+	for _, line := range event.Diff.RemovedLines {
+		b.WriteString("\n- " + line)
+	}
+	// Предел сообщения Telegram — 4096 символов.
+	if message := b.String(); utf8.RuneCountInString(message) > 4000 {
+		return string([]rune(message)[:4000]) + "…"
+	}
+	return b.String()
+}
+
+// newMonitor разбирает параметры POST /monitors.
+func newMonitor(q url.Values) (*Monitor, error) {
+	for _, name := range unsupportedMonitorParams {
+		if q.Has(name) {
+			return nil, fmt.Errorf("Параметр '%s' не поддерживается в мониторах", name)
+		}
+	}
+	if raw := q.Get("proxy"); raw != "" {
+		if u, err := url.Parse(raw); err == nil && u.User != nil {
+			return nil, errors.New("Прокси с логином и паролем не поддерживается в мониторах: параметры монитора хранятся открытым текстом")
+		}
+	}
+	interval := defaultMonitorInterval
+	if raw := q.Get("interval"); raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil || time.Duration(v)*time.Second < minMonitorInterval || time.Duration(v)*time.Second > maxMonitorInterval {
+			return nil, fmt.Errorf("Параметр 'interval' должен быть числом секунд от %d до %d", int(minMonitorInterval/time.Second), int(maxMonitorInterval/time.Second))
+		}
+		interval = time.Duration(v) * time.Second
+	}
+	m := &Monitor{
+		ID:       newJobID(),
+		URL:      q.Get("url"),
+		Interval: int(interval / time.Second),
+		Created:  time.Now(),
+	}
+	m.NextCheck = m.Created
+	if raw := q.Get("webhook"); raw != "" {
+		u, err := url.Parse(raw)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, errors.New("Параметр 'webhook' должен быть абсолютным http(s)-адресом")
+		}
+		if err := checkOutboundHost("webhook", u.Hostname()); err != nil {
+			return nil, err
+		}
+		m.Webhook = raw
+	}
+	switch q.Get("telegram") {
+	case "", "false":
+	case "true":
+		if os.Getenv("TELEGRAM_BOT_TOKEN") == "" || os.Getenv("TELEGRAM_CHAT_ID") == "" {
+			return nil, errors.New("Уведомления в Telegram не настроены (задайте TELEGRAM_BOT_TOKEN и TELEGRAM_CHAT_ID)")
+		}
+		m.Telegram = true
+	default:
+		return nil, errors.New("Параметр 'telegram' может принимать значения: true, false")
+	}
+	if m.Webhook == "" && !m.Telegram {
+		return nil, errors.New("Укажите, куда сообщать об изменениях: 'webhook' и/или 'telegram'")
+	}
+	m.Params = url.Values{}
+	for name, values := range q {
+		if name != "url" && !slices.Contains(monitorParams, name) {
+			m.Params[name] = values
+		}
+	}
+	// Проверяем параметры скрапинга сразу, а не при первой проверке.
+	if _, err := parseScrapeOptions(monitorQuery(m)); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// monitorsHandler: GET|POST /monitors, GET|DELETE /monitors/<id>,
+// POST /monitors/<id>/check.
+func monitorsHandler(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/monitors"), "/")
+	id, check := strings.CutSuffix(id, "/check")
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	switch {
+	case id == "" && r.Method == http.MethodGet:
+		monitorsMu.Lock()
+		list := make([]Monitor, 0, len(monitors))
+		for _, m := range monitors {
+			list = append(list, *m)
+		}
+		monitorsMu.Unlock()
+		sort.Slice(list, func(i, j int) bool { return list[i].Created.Before(list[j].Created) })
+		json.NewEncoder(w).Encode(list)
+
+	case id == "" && r.Method == http.MethodPost:
+		q, err := scrapeQuery(w, r)
+		if err != nil {
+			writeJsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if q.Get("url") == "" {
+			writeJsonError(w, "Параметр 'url' обязателен", http.StatusBadRequest)
+			return
+		}
+		if status, err := checkEvalParam(r, q); err != nil {
+			writeJsonError(w, err.Error(), status)
+			return
+		}
+		m, err := newMonitor(q)
+		if err != nil {
+			writeJsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		monitorsMu.Lock()
+		defer monitorsMu.Unlock()
+		if len(monitors) >= maxMonitors {
+			writeJsonError(w, fmt.Sprintf("Достигнут предел мониторов: %d", maxMonitors), http.StatusTooManyRequests)
+			return
+		}
+		monitors[m.ID] = m
+		saveMonitorsLocked()
+		slog.InfoContext(r.Context(), "Монитор создан", "monitor", m.ID, "url", m.URL, "interval", m.Interval)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(m)
+
+	case id != "" && !check && r.Method == http.MethodGet:
+		monitorsMu.Lock()
+		m := monitors[id]
+		var snapshot Monitor
+		if m != nil {
+			snapshot = *m
+		}
+		monitorsMu.Unlock()
+		if m == nil {
+			writeJsonError(w, "Монитор не найден", http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(snapshot)
+
+	case id != "" && check && r.Method == http.MethodPost:
+		monitorsMu.Lock()
+		m := monitors[id]
+		var snapshot Monitor
+		if m != nil {
+			m.NextCheck = time.Now()
+			snapshot = *m
+		}
+		monitorsMu.Unlock()
+		if m == nil {
+			writeJsonError(w, "Монитор не найден", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(snapshot)
+
+	case id != "" && !check && r.Method == http.MethodDelete:
+		monitorsMu.Lock()
+		m := monitors[id]
+		delete(monitors, id)
+		if m != nil {
+			saveMonitorsLocked()
+		}
+		monitorsMu.Unlock()
+		if m == nil {
+			writeJsonError(w, "Монитор не найден", http.StatusNotFound)
+			return
+		}
+		slog.InfoContext(r.Context(), "Монитор удалён", "monitor", id)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeJsonError(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+	}
+}
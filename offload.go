@@ -0,0 +1,198 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Выгрузка крупных полей: если поле ответа в JSON-виде больше
+// OFFLOAD_THRESHOLD байт, оно сохраняется в хранилище как артефакт,
+// а в ответе заменяется ссылкой ArtifactRef. Промежуточные прокси и
+// очереди между webextract и потребителями не переносят многомегабайтные
+// ответы. Требует STORAGE_DIR.
+
+// ArtifactRef заменяет в ответе выгруженное поле.
+type ArtifactRef struct {
+	Artifact    string `json:"artifact"` // URL для скачивания
+	Size        int    `json:"size"`
+	SHA256      string `json:"sha256"`
+	ContentType string `json:"content_type"`
+}
+
+// artifactsDirName — подкаталог хранилища с артефактами; Walk и LatestAll его пропускают.
+const artifactsDirName = "artifacts"
+
+// offloadThreshold — порог в байтах; 0 — выгрузка выключена.
+var offloadThreshold int
+
+func loadOffloadConfig() {
+	raw := os.Getenv("OFFLOAD_THRESHOLD")
+	if raw == "" {
+		return
+	}
+	v, err := strconv.Atoi(raw)
+	if err != nil || v <= 0 {
+		log.Fatalf("OFFLOAD_THRESHOLD должен быть положительным числом байт, получено %q", raw)
+	}
+	if resultStore == nil {
+		log.Fatal("OFFLOAD_THRESHOLD требует хранилища: задайте STORAGE_DIR")
+	}
+	offloadThreshold = v
+	log.Printf("ЛОГ: Поля больше %d байт выгружаются в артефакты.", v)
+}
+
+func isArtifactID(id string) bool {
+	if len(id) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
+
+// SaveArtifact сохраняет данные под их SHA-256; повторное сохранение того
+// же содержимого только обновляет время изменения файла.
+func (s *fileStore) SaveArtifact(data []byte, ext string) (string, error) {
+	sum := sha256.Sum256(data)
+	id := hex.EncodeToString(sum[:])
+	dir := filepath.Join(s.dir, artifactsDirName)
+	path := filepath.Join(dir, id+ext)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := os.Stat(path); err == nil {
+		// Обновляем время, чтобы сборщик мусора не удалил артефакт, на
+		// который только что выдана ссылка.
+		now := time.Now()
+		return id, os.Chtimes(path, now, now)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return "", err
+	}
+	return id, os.Rename(tmp, path)
+}
+
+// Artifact возвращает содержимое артефакта и его расширение.
+func (s *fileStore) Artifact(id string) ([]byte, string, error) {
+	if !isArtifactID(id) {
+		return nil, "", errVersionNotFound
+	}
+	matches, err := filepath.Glob(filepath.Join(s.dir, artifactsDirName, id+".*"))
+	if err != nil {
+		return nil, "", err
+	}
+	for _, path := range matches {
+		if strings.HasSuffix(path, ".tmp") {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		return data, filepath.Ext(path), err
+	}
+	return nil, "", errVersionNotFound
+}
+
+// offloadLargeFields заменяет крупные поля верхнего уровня ссылками на
+// артефакты. Строки сохраняются как текст, остальное — как JSON.
+func offloadLargeFields(out map[string]any, r *http.Request) error {
+	keys := make([]string, 0, len(out))
+	for k := range out {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		encoded, err := json.Marshal(out[key])
+		if err != nil {
+			return err
+		}
+		if len(encoded) <= offloadThreshold {
+			continue
+		}
+		data, ext, contentType := encoded, ".json", "application/json; charset=utf-8"
+		if s, ok := out[key].(string); ok {
+			data, ext, contentType = []byte(s), ".txt", "text/plain; charset=utf-8"
+		}
+		id, err := resultStore.SaveArtifact(data, ext)
+		if err != nil {
+			return err
+		}
+		out[key] = ArtifactRef{
+			Artifact:    requestBaseURL(r) + "/artifacts/" + id,
+			Size:        len(data),
+			SHA256:      id,
+			ContentType: contentType,
+		}
+		log.Printf("ЛОГ: Поле %s (%d байт) выгружено в артефакт %s.", key, len(data), id)
+	}
+	return nil
+}
+
+// requestBaseURL восстанавливает внешний адрес сервиса с учётом прокси.
+func requestBaseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	host := r.Host
+	if fwd := r.Header.Get("X-Forwarded-Host"); fwd != "" {
+		host = fwd
+	}
+	return scheme + "://" + host
+}
+
+// artifactHandler: GET /artifacts/<sha256>.
+func artifactHandler(w http.ResponseWriter, r *http.Request) {
+	if resultStore == nil {
+		writeJsonError(w, "Хранилище результатов выключено (задайте STORAGE_DIR)", http.StatusNotFound)
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/artifacts/")
+	data, ext, err := resultStore.Artifact(id)
+	if errors.Is(err, errVersionNotFound) {
+		writeJsonError(w, "Артефакт не найден", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeJsonError(w, "Не удалось прочитать артефакт: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	contentType := "text/plain; charset=utf-8"
+	switch ext {
+	case ".json":
+		contentType = "application/json; charset=utf-8"
+	case ".mhtml":
+		contentType = mhtmlContentType
+		w.Header().Set("Content-Disposition", `attachment; filename="`+id+`.mhtml"`)
+	case ".txt":
+	default:
+		// Файлы из /download отдаются с типом по расширению и только
+		// вложением: HTML и SVG не должны открываться в origin API.
+		contentType = mime.TypeByExtension(ext)
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		w.Header().Set("Content-Disposition", `attachment; filename="`+id+ext+`"`)
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+	}
+	w.Header().Set("Content-Type", contentType)
+	// Содержимое адресуется хешем и не меняется.
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Header().Set("ETag", `"`+id+`"`)
+	w.Write(data)
+}
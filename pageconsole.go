@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+
+	"github.com/chromedp/cdproto/runtime"
+	"github.com/chromedp/chromedp"
+)
+
+// Сообщения консоли страницы и необработанные исключения (console=true) —
+// первое, что нужно, когда контент не отрисовался. Собирается не больше
+// maxConsoleMessages сообщений, длинные обрезаются.
+
+const (
+	maxConsoleMessages = 500
+	maxConsoleText     = 2000
+)
+
+// ConsoleMessage — сообщение консоли или исключение страницы.
+type ConsoleMessage struct {
+	Level  string `json:"level"` // log, info, warn, error, debug... или exception
+	Text   string `json:"text"`
+	URL    string `json:"url,omitempty"`
+	Line   int64  `json:"line,omitempty"`
+	Column int64  `json:"column,omitempty"`
+}
+
+type consoleRecorder struct {
+	mu       sync.Mutex
+	messages []ConsoleMessage
+	dropped  int
+}
+
+// remoteObjectText печатает аргумент console.* примерно так, как DevTools.
+func remoteObjectText(arg *runtime.RemoteObject) string {
+	switch {
+	case arg.Type == runtime.TypeString:
+		var s string
+		if json.Unmarshal(arg.Value, &s) == nil {
+			return s
+		}
+	case len(arg.Value) > 0:
+		return string(arg.Value)
+	case arg.UnserializableValue != "":
+		return string(arg.UnserializableValue)
+	case arg.Description != "":
+		return arg.Description
+	}
+	return string(arg.Type)
+}
+
+func truncateConsoleText(s string) string {
+	if r := []rune(s); len(r) > maxConsoleText {
+		return string(r[:maxConsoleText]) + "…"
+	}
+	return s
+}
+
+func recordConsole(ctx context.Context) *consoleRecorder {
+	rec := &consoleRecorder{}
+	chromedp.ListenTarget(ctx, func(ev any) {
+		var msg ConsoleMessage
+		switch ev := ev.(type) {
+		case *runtime.EventConsoleAPICalled:
+			parts := make([]string, 0, len(ev.Args))
+			for _, arg := range ev.Args {
+				parts = append(parts, remoteObjectText(arg))
+			}
+			msg = ConsoleMessage{Level: string(ev.Type), Text: strings.Join(parts, " ")}
+			if ev.StackTrace != nil && len(ev.StackTrace.CallFrames) > 0 {
+				frame := ev.StackTrace.CallFrames[0]
+				msg.URL, msg.Line, msg.Column = frame.URL, frame.LineNumber+1, frame.ColumnNumber+1
+			}
+		case *runtime.EventExceptionThrown:
+			d := ev.ExceptionDetails
+			msg = ConsoleMessage{Level: "exception", Text: d.Text, URL: d.URL, Line: d.LineNumber + 1, Column: d.ColumnNumber + 1}
+			if d.Exception != nil && d.Exception.Description != "" {
+				msg.Text = d.Exception.Description
+			}
+		default:
+			return
+		}
+		msg.Text = truncateConsoleText(msg.Text)
+		rec.mu.Lock()
+		defer rec.mu.Unlock()
+		if len(rec.messages) >= maxConsoleMessages {
+			rec.dropped++
+			return
+		}
+		rec.messages = append(rec.messages, msg)
+	})
+	return rec
+}
+
+// Messages возвращает собранные сообщения и число пропущенных сверх лимита.
+func (rec *consoleRecorder) Messages() ([]ConsoleMessage, int) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return append([]ConsoleMessage(nil), rec.messages...), rec.dropped
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Pagination — обнаруженная схема пагинации без перехода по страницам.
+type Pagination struct {
+	Scheme         string `json:"scheme"`          // query, offset, path, rel, pager или none
+	Param          string `json:"param,omitempty"` // Имя query-параметра для scheme=query и offset
+	Next           string `json:"next,omitempty"`
+	Prev           string `json:"prev,omitempty"`
+	CurrentPage    int    `json:"current_page,omitempty"`
+	EstimatedPages int    `json:"estimated_pages,omitempty"` // 0 — оценить не удалось
+}
+
+// paginationCandidates — сырые данные из paginationScript.
+type paginationCandidates struct {
+	RelNext string          `json:"relNext"`
+	RelPrev string          `json:"relPrev"`
+	Links   []paginationRef `json:"links"`
+}
+
+type paginationRef struct {
+	Href    string `json:"href"`
+	Text    string `json:"text"`
+	InPager bool   `json:"inPager"`
+}
+
+// paginationScript собирает rel=next/prev и ссылки, похожие на пагинацию:
+// из блоков pagination/pager и все ссылки с номером страницы в адресе.
+const paginationScript = `(() => {
+	const abs = h => { try { return new URL(h, document.baseURI).href; } catch (e) { return ''; } };
+	const rel = r => {
+		const el = document.querySelector('link[rel~="' + r + '"], a[rel~="' + r + '"]');
+		return el ? abs(el.getAttribute('href')) : '';
+	};
+	const pagerSel = '[class*="pagination" i], [class*="pager" i], [class*="paging" i], [class*="paginator" i], nav[aria-label*="pag" i]';
+	const pageRe = /[?&](page|p|pg|pagen_\d+|pagenum|page_num|start|offset)=\d+|\/(page|p|stranitsa)[\/-]?\d+/i;
+	const links = [];
+	for (const a of document.querySelectorAll('a[href]')) {
+		const inPager = !!a.closest(pagerSel);
+		const href = abs(a.getAttribute('href'));
+		if (!href || (!inPager && !pageRe.test(href))) continue;
+		links.push({href, text: (a.textContent || '').trim(), inPager});
+	}
+	return {relNext: rel('next'), relPrev: rel('prev'), links};
+})()`
+
+// pageQueryParams — типичные имена параметра номера страницы
+// (PAGEN_N — Битрикс); offsetQueryParams — параметры смещения, номер
+// страницы по ним — смещение / шаг + 1, шаг — наименьшее ненулевое смещение.
+var (
+	pageQueryParams   = regexp.MustCompile(`(?i)^(page|p|pg|pagen_\d+|pagenum|page_num)$`)
+	offsetQueryParams = regexp.MustCompile(`(?i)^(start|offset)$`)
+)
+
+var pagePathRe = regexp.MustCompile(`(?i)/(?:page|p|stranitsa)[/-]?(\d+)`)
+
+// detectPagination определяет схему пагинации и оценивает число страниц
+// по максимальному номеру, встреченному в ссылках и в блоке пейджера.
+func detectPagination(pageURL string, c paginationCandidates) *Pagination {
+	p := &Pagination{Scheme: "none", Next: c.RelNext, Prev: c.RelPrev, CurrentPage: 1}
+
+	paramMax := map[string]int{}
+	offsetMax, offsetStep := map[string]int{}, map[string]int{}
+	pathMax, pagerMax := 0, 0
+	consider := func(raw string) {
+		u, err := url.Parse(raw)
+		if err != nil {
+			return
+		}
+		for name, values := range u.Query() {
+			if len(values) == 0 {
+				continue
+			}
+			n, err := strconv.Atoi(values[0])
+			if err != nil || n <= 0 {
+				continue
+			}
+			switch {
+			case pageQueryParams.MatchString(name):
+				paramMax[name] = max(paramMax[name], n)
+			case offsetQueryParams.MatchString(name):
+				offsetMax[name] = max(offsetMax[name], n)
+				if step := offsetStep[name]; step == 0 || n < step {
+					offsetStep[name] = n
+				}
+			}
+		}
+		if m := pagePathRe.FindStringSubmatch(u.Path); m != nil {
+			if n, _ := strconv.Atoi(m[1]); n > pathMax {
+				pathMax = n
+			}
+		}
+	}
+	for _, l := range c.Links {
+		consider(l.Href)
+		if l.InPager {
+			if n, err := strconv.Atoi(strings.TrimSpace(l.Text)); err == nil && n > pagerMax {
+				pagerMax = n
+			}
+		}
+	}
+	if c.RelNext != "" {
+		consider(c.RelNext)
+	}
+
+	// Текущая страница — из адреса самой страницы.
+	if u, err := url.Parse(pageURL); err == nil {
+		for name, values := range u.Query() {
+			if pageQueryParams.MatchString(name) && len(values) > 0 {
+				if n, err := strconv.Atoi(values[0]); err == nil && n > 0 {
+					p.CurrentPage = n
+				}
+			}
+		}
+		if m := pagePathRe.FindStringSubmatch(u.Path); m != nil {
+			p.CurrentPage, _ = strconv.Atoi(m[1])
+		}
+	}
+
+	bestParam, bestParamMax := "", 0
+	for name, n := range paramMax {
+		if n > bestParamMax {
+			bestParam, bestParamMax = name, n
+		}
+	}
+	// Смещения учитываем, только если номеров страниц в адресах нет.
+	offsetParam := ""
+	if bestParam == "" {
+		for name, n := range offsetMax {
+			if pages := n/offsetStep[name] + 1; pages > bestParamMax {
+				offsetParam, bestParamMax = name, pages
+			}
+		}
+	}
+	if offsetParam != "" {
+		if u, err := url.Parse(pageURL); err == nil {
+			if n, err := strconv.Atoi(u.Query().Get(offsetParam)); err == nil && n > 0 {
+				p.CurrentPage = n/offsetStep[offsetParam] + 1
+			}
+		}
+	}
+	switch {
+	case bestParam != "":
+		p.Scheme, p.Param = "query", bestParam
+	case offsetParam != "":
+		p.Scheme, p.Param = "offset", offsetParam
+	case pathMax > 0:
+		p.Scheme = "path"
+	case c.RelNext != "" || c.RelPrev != "":
+		p.Scheme = "rel"
+	case pagerMax > 0:
+		p.Scheme = "pager"
+	}
+	if p.Scheme != "none" {
+		p.EstimatedPages = max(bestParamMax, pathMax, pagerMax, p.CurrentPage)
+		// Есть следующая страница, но номеров не видно — знаем только нижнюю границу.
+		if p.EstimatedPages <= p.CurrentPage && c.RelNext != "" {
+			p.EstimatedPages = 0
+		}
+	}
+	return p
+}
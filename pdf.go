@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/chromedp"
+)
+
+// PDF страницы через Page.printToPDF — для архивирования в печатном
+// качестве. Параметры /scrape: pdf=true, pdf_format, pdf_margin,
+// pdf_background, pdf_landscape; /pdf принимает их без префикса и отдаёт
+// сам файл. Учитываются стили @media print; media=screen печатает
+// страницу так, как она выглядит на экране.
+
+// pdfPaperSizes — размеры бумаги в дюймах (ширина, высота).
+var pdfPaperSizes = map[string][2]float64{
+	"a3":      {11.69, 16.54},
+	"a4":      {8.27, 11.69},
+	"a5":      {5.83, 8.27},
+	"letter":  {8.5, 11},
+	"legal":   {8.5, 14},
+	"tabloid": {11, 17},
+}
+
+const maxPDFMargin = 100 // мм
+
+type pdfOptions struct {
+	Format     string
+	Margins    [4]float64 // Поля в мм: сверху, справа, снизу, слева
+	Background bool
+	Landscape  bool
+}
+
+func parsePDFOptions(q url.Values) (*pdfOptions, error) {
+	opts := &pdfOptions{
+		Format:     strings.ToLower(q.Get("pdf_format")),
+		Margins:    [4]float64{10, 10, 10, 10},
+		Background: q.Get("pdf_background") == "true" || q.Get("pdf_background") == "1",
+		Landscape:  q.Get("pdf_landscape") == "true" || q.Get("pdf_landscape") == "1",
+	}
+	if opts.Format == "" {
+		opts.Format = "a4"
+	}
+	if _, ok := pdfPaperSizes[opts.Format]; !ok {
+		return nil, errors.New("Параметр 'pdf_format' может принимать значения: a3, a4, a5, letter, legal, tabloid")
+	}
+	if raw := q.Get("pdf_margin"); raw != "" {
+		// Как в CSS: одно значение — все поля, два — вертикальные и
+		// горизонтальные, четыре — сверху, справа, снизу, слева.
+		parts := strings.Split(raw, ",")
+		values := make([]float64, len(parts))
+		for i, p := range parts {
+			v, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+			if err != nil || v < 0 || v > maxPDFMargin {
+				return nil, fmt.Errorf("Параметр 'pdf_margin' должен содержать 1, 2 или 4 числа миллиметров от 0 до %d через запятую", maxPDFMargin)
+			}
+			values[i] = v
+		}
+		switch len(values) {
+		case 1:
+			opts.Margins = [4]float64{values[0], values[0], values[0], values[0]}
+		case 2:
+			opts.Margins = [4]float64{values[0], values[1], values[0], values[1]}
+		case 4:
+			opts.Margins = [4]float64(values)
+		default:
+			return nil, fmt.Errorf("Параметр 'pdf_margin' должен содержать 1, 2 или 4 числа миллиметров от 0 до %d через запятую", maxPDFMargin)
+		}
+	}
+	return opts, nil
+}
+
+// renderPDF печатает страницу в PDF.
+func renderPDF(opts *pdfOptions, res *[]byte) chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		slog.InfoContext(ctx, "Печатаю страницу в PDF", "format", opts.Format, "landscape", opts.Landscape)
+		size := pdfPaperSizes[opts.Format]
+		const mmPerInch = 25.4
+		data, _, err := page.PrintToPDF().
+			WithPaperWidth(size[0]).
+			WithPaperHeight(size[1]).
+			WithMarginTop(opts.Margins[0] / mmPerInch).
+			WithMarginRight(opts.Margins[1] / mmPerInch).
+			WithMarginBottom(opts.Margins[2] / mmPerInch).
+			WithMarginLeft(opts.Margins[3] / mmPerInch).
+			WithPrintBackground(opts.Background).
+			WithLandscape(opts.Landscape).
+			WithPreferCSSPageSize(false).
+			Do(ctx)
+		if err != nil && strings.Contains(strings.ToLower(err.Error()), "printing is not available") {
+			return errors.New("печать в PDF доступна только в headless-режиме (флаг -headless)")
+		}
+		*res = data
+		return err
+	})
+}
+
+// pdfHandler: GET /pdf?url=&format=a4&margin=10&background=true&landscape=true
+// — тот же скрапинг, но ответом идёт PDF. Остальные параметры (consent,
+// popups, media и т. п.) работают как в /scrape.
+func pdfHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	q.Set("pdf", "true")
+	for _, name := range []string{"format", "margin", "background", "landscape"} {
+		if q.Has(name) {
+			q.Set("pdf_"+name, q.Get(name))
+			q.Del(name)
+		}
+	}
+	if status, err := checkEvalParam(r, q); err != nil {
+		writeJsonError(w, err.Error(), status)
+		return
+	}
+	opts, err := parseScrapeOptions(q)
+	if err != nil {
+		writeJsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	opts.trace = r.Context()
+	response, cacheStatus, err := scrapeWithCache(q, opts)
+	if cacheStatus != "" {
+		w.Header().Set("X-Cache", cacheStatus)
+	}
+	if err != nil {
+		writeJsonError(w, "Не удалось выполнить скрапинг: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Length", strconv.Itoa(len(response.PDF)))
+	w.Write(response.PDF)
+}
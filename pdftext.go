@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// Текст PDF-документов. Если адрес отдаёт PDF, DOM у страницы нет: Chrome
+// показывает встроенный просмотрщик или, без него, отдаёт файл на
+// скачивание и прерывает навигацию (net::ERR_ABORTED). В обоих случаях
+// документ загружается заново через loadResource и из него извлекаются
+// текст в content и сведения в document; meta заполняется из словаря Info.
+// Параметры, которым нужен DOM (links, images, selectors и т. п.), для PDF
+// пусты. Текстовый слой есть не у всех PDF: у сканов content будет пустым.
+
+const (
+	maxPDFDocumentSize = 50 << 20
+	maxPDFPages        = 2000
+)
+
+// PDFDocument — сведения о PDF-документе.
+type PDFDocument struct {
+	Pages    int        `json:"pages"`
+	Title    string     `json:"title,omitempty"`
+	Author   string     `json:"author,omitempty"`
+	Subject  string     `json:"subject,omitempty"`
+	Keywords string     `json:"keywords,omitempty"`
+	Creator  string     `json:"creator,omitempty"`  // Программа, в которой создан исходный документ
+	Producer string     `json:"producer,omitempty"` // Программа, создавшая PDF
+	Created  *time.Time `json:"created,omitempty"`
+	Modified *time.Time `json:"modified,omitempty"`
+}
+
+// isPDF проверяет сигнатуру файла.
+func isPDF(data []byte) bool {
+	return bytes.HasPrefix(bytes.TrimLeft(data, "\x00\t\r\n "), []byte("%PDF-"))
+}
+
+// isAbortedNavigation — навигация прервана, например потому, что документ
+// ушёл на скачивание.
+func isAbortedNavigation(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "net::ERR_ABORTED")
+}
+
+// loadPDF загружает документ по адресу; ok=false, если там не PDF.
+func loadPDF(ctx context.Context, rawURL string) ([]byte, bool) {
+	data, _, err := loadResource(ctx, rawURL, maxPDFDocumentSize)
+	if err != nil {
+		slog.WarnContext(ctx, "Не удалось загрузить адрес как PDF", "url", rawURL, "error", err.Error())
+		return nil, false
+	}
+	return data, isPDF(data)
+}
+
+// applyPDFDocument заполняет ответ по PDF-документу.
+func applyPDFDocument(ctx context.Context, opts *scrapeOptions, response *Response, data []byte) error {
+	text, doc, err := extractPDF(ctx, data)
+	if err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "Адрес отдал PDF", "pages", doc.Pages, "chars", utf8.RuneCountInString(text))
+	response.ContentHash = contentHash(text)
+	response.Simhash = fmt.Sprintf("%016x", simhash(text))
+	if opts.Content {
+		response.Content = text
+	}
+	if opts.Meta {
+		response.Meta = &Meta{Title: doc.Title, Description: doc.Subject, Keywords: doc.Keywords}
+	}
+	if opts.Stats {
+		response.Stats = contentStats(text, nil)
+	}
+	if opts.Hash {
+		response.Hash = mainTextHash("", text)
+	}
+	response.Document = &doc
+	return nil
+}
+
+// extractPDF извлекает текст и сведения о документе. Библиотека разбора
+// сообщает об ошибках паникой; страница, которую не удалось разобрать,
+// пропускается.
+func extractPDF(ctx context.Context, data []byte) (text string, doc PDFDocument, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("некорректный PDF: %v", r)
+		}
+	}()
+	reader, err := pdf.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", doc, fmt.Errorf("некорректный PDF: %v", err)
+	}
+	doc = pdfInfo(reader.Trailer().Key("Info"))
+	doc.Pages = reader.NumPage()
+	pages := make([]string, 0, min(doc.Pages, maxPDFPages))
+	for i := 1; i <= doc.Pages && i <= maxPDFPages; i++ {
+		page, err := pdfPageText(reader.Page(i))
+		if err != nil {
+			slog.WarnContext(ctx, "PDF: страница пропущена", "page", i, "error", err)
+			continue
+		}
+		if page != "" {
+			pages = append(pages, page)
+		}
+	}
+	if doc.Pages > maxPDFPages {
+		slog.InfoContext(ctx, "PDF: прочитаны не все страницы", "pages", doc.Pages, "read", maxPDFPages)
+	}
+	return strings.Join(pages, "\n\n"), doc, nil
+}
+
+func pdfInfo(info pdf.Value) PDFDocument {
+	text := func(key string) string {
+		return strings.TrimSpace(info.Key(key).Text())
+	}
+	return PDFDocument{
+		Title:    text("Title"),
+		Author:   text("Author"),
+		Subject:  text("Subject"),
+		Keywords: text("Keywords"),
+		Creator:  text("Creator"),
+		Producer: text("Producer"),
+		Created:  parsePDFDate(info.Key("CreationDate").Text()),
+		Modified: parsePDFDate(info.Key("ModDate").Text()),
+	}
+}
+
+// parsePDFDate разбирает дату PDF вида D:YYYYMMDDHHmmSS+HH'mm'; все части
+// после года необязательны.
+func parsePDFDate(raw string) *time.Time {
+	raw = strings.TrimPrefix(strings.TrimSpace(raw), "D:")
+	raw = strings.ReplaceAll(raw, "'", "")
+	digits := len(raw)
+	for i, c := range raw {
+		if c < '0' || c > '9' {
+			digits = i
+			break
+		}
+	}
+	if digits < 4 {
+		return nil
+	}
+	// Недостающие части дополняются началом периода.
+	stamp := raw[:digits] + "0101000000"[max(0, digits-4):]
+	if len(stamp) > 14 {
+		stamp = stamp[:14]
+	}
+	zone := raw[digits:]
+	switch {
+	case zone == "" || strings.HasPrefix(zone, "Z"):
+		zone = "+0000"
+	case len(zone) == 3:
+		zone += "00"
+	}
+	t, err := time.Parse("20060102150405-0700", stamp+zone)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
+
+// pdfPageText собирает текст страницы из глифов в порядке потока
+// содержимого: переход на другую строку — по смещению по вертикали,
+// пробел — по промежутку между глифами. Жирный шрифт, имитированный
+// повторной печатью со сдвигом, даёт дубли глифов; они отбрасываются.
+// У стандартных шрифтов без /Widths ширина глифов нулевая и позиции
+// внутри строки не растут — тогда пробелы берутся из самого текста.
+func pdfPageText(page pdf.Page) (text string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	if page.V.IsNull() {
+		return "", nil
+	}
+	var (
+		b    strings.Builder
+		prev pdf.Text
+		have bool
+	)
+	for _, glyph := range page.Content().Text {
+		// Библиотека завершает каждый TJ глифом "\n" — это не перевод строки.
+		if glyph.S == "" || glyph.S == "\n" {
+			continue
+		}
+		size := math.Max(math.Abs(glyph.FontSize), 1)
+		if have {
+			width := prev.W
+			if width <= 0 {
+				width = size * 0.5
+			}
+			dx, dy := glyph.X-(prev.X+width), math.Abs(glyph.Y-prev.Y)
+			switch {
+			case prev.W > 0 && glyph.S == prev.S && math.Abs(glyph.X-prev.X) < size*0.1 && dy < size*0.1:
+				continue
+			case dy > size*0.5:
+				b.WriteByte('\n')
+			case dx > size*0.15 || glyph.X < prev.X-size:
+				b.WriteByte(' ')
+			}
+		}
+		b.WriteString(glyph.S)
+		prev, have = glyph, true
+	}
+	lines := strings.Split(b.String(), "\n")
+	out := lines[:0]
+	for _, line := range lines {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			out = append(out, line)
+		}
+	}
+	return strings.Join(out, "\n"), nil
+}
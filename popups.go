@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/chromedp/chromedp"
+	"github.com/chromedp/chromedp/kb"
+)
+
+// popupCloseSelectors — кнопки закрытия рассылок, выбора региона и
+// баннеров "установите приложение". Дополняются через POPUP_SELECTORS.
+var popupCloseSelectors = []string{
+	// Универсальные кнопки закрытия модальных окон
+	"[role=\"dialog\"] [aria-label=\"Close\"]",
+	"[role=\"dialog\"] [aria-label=\"Закрыть\"]",
+	"[aria-modal=\"true\"] button[aria-label*=\"lose\"]",
+	"[aria-modal=\"true\"] button[aria-label*=\"акрыть\"]",
+	".modal.show .close",
+	".modal.show .btn-close",
+	".popup__close",
+	".modal__close",
+	".mfp-close",
+	".fancybox-close-small",
+	// Подписка на рассылку
+	".newsletter-popup .close",
+	".subscribe-popup__close",
+	"[class*=\"newsletter\"] [class*=\"close\"]",
+	"[class*=\"subscribe\"] [class*=\"close\"]",
+	// Выбор/подтверждение региона
+	"[data-testid=\"region-confirm\"]",
+	"[data-qa=\"region-confirm\"]",
+	"[class*=\"region\"] [class*=\"confirm\"]",
+	"[class*=\"geo\"] [class*=\"close\"]",
+	// Баннеры "Установите приложение"
+	"[class*=\"app-banner\"] [class*=\"close\"]",
+	"[class*=\"smart-banner\"] [class*=\"close\"]",
+	"[class*=\"install-app\"] [class*=\"close\"]",
+}
+
+// loadPopupSelectors добавляет к встроенным правилам пользовательские
+// селекторы из переменной окружения POPUP_SELECTORS (через запятую).
+func loadPopupSelectors() {
+	extra := os.Getenv("POPUP_SELECTORS")
+	if extra == "" {
+		return
+	}
+	for _, sel := range strings.Split(extra, ",") {
+		if sel = strings.TrimSpace(sel); sel != "" {
+			popupCloseSelectors = append(popupCloseSelectors, sel)
+		}
+	}
+	log.Printf("ЛОГ: Загружено правил закрытия попапов: %d.", len(popupCloseSelectors))
+}
+
+// dismissPopups нажимает Escape и закрывает найденные попапы. Попапы могут
+// появляться друг за другом, поэтому делаем несколько проходов.
+func dismissPopups() chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		slog.InfoContext(ctx, "Шаг [1.2]: закрываю всплывающие окна")
+		if err := chromedp.KeyEvent(kb.Escape).Do(ctx); err != nil {
+			log.Printf("ЛОГ: Не удалось отправить Escape: %v", err)
+		}
+		const maxPasses = 3
+		for i := 0; i < maxPasses; i++ {
+			var matched string
+			if err := chromedp.Evaluate(clickFirstVisibleScript(popupCloseSelectors), &matched).Do(ctx); err != nil {
+				log.Printf("ЛОГ: Не удалось проверить попапы: %v", err)
+				return nil
+			}
+			if matched == "" {
+				break
+			}
+			slog.InfoContext(ctx, "Шаг [1.2]: попап закрыт", "selector", matched)
+			if err := chromedp.Sleep(300 * time.Millisecond).Do(ctx); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
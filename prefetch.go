@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"time"
+)
+
+// Прогрев кэша: POST /prefetch?<параметры как у /scrape без url>
+// с телом {"urls": [...]} ставит адреса в фоновую очередь. Фоновый
+// обработчик берёт следующую задачу, только когда браузер не занят другими
+// скрапингами и не ждёт решения CAPTCHA, — прогрев не отнимает браузер у
+// пользовательских запросов.
+
+// prefetchQueueSize — ёмкость очереди; лишние адреса отклоняются.
+const prefetchQueueSize = 1000
+
+// prefetchIdlePoll — как часто фоновый обработчик проверяет, освободился ли браузер.
+const prefetchIdlePoll = 500 * time.Millisecond
+
+var (
+	prefetchQueue = make(chan url.Values, prefetchQueueSize)
+	activeScrapes atomic.Int32 // Число скрапингов, выполняющихся прямо сейчас
+)
+
+// PrefetchRequest — тело POST /prefetch.
+type PrefetchRequest struct {
+	URLs []string `json:"urls"`
+}
+
+// PrefetchResponse — сколько адресов поставлено в очередь и сколько пропущено.
+type PrefetchResponse struct {
+	Queued   int      `json:"queued"`
+	Cached   int      `json:"cached"`             // Уже есть свежий результат
+	Rejected []string `json:"rejected,omitempty"` // Очередь переполнена
+}
+
+// prefetchWorker выполняет задачи прогрева по одной с низким приоритетом.
+func prefetchWorker() {
+	for q := range prefetchQueue {
+		if shuttingDown.Load() {
+			return
+		}
+		for activeScrapes.Load() > 0 || captchaPending() {
+			time.Sleep(prefetchIdlePoll)
+		}
+		if _, ok := scrapeCache.Get(cacheKey(q), 0); ok {
+			continue
+		}
+		opts, err := parseScrapeOptions(q)
+		if err != nil {
+			log.Printf("ЛОГ: Прогрев: пропускаю %s: %v", q.Get("url"), err)
+			continue
+		}
+		log.Printf("ЛОГ: Прогрев: рендерю %s.", opts.URL)
+		if _, _, err := scrapeWithCache(q, opts); err != nil {
+			log.Printf("ЛОГ: Прогрев: не удалось получить %s: %v", opts.URL, err)
+		}
+	}
+}
+
+// prefetchHandler: POST /prefetch.
+func prefetchHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJsonError(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+		return
+	}
+	if scrapeCache == nil {
+		writeJsonError(w, "Кэш результатов выключен (задайте CACHE_TTL)", http.StatusNotFound)
+		return
+	}
+	var req PrefetchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.URLs) == 0 {
+		writeJsonError(w, "Тело запроса должно быть JSON вида {\"urls\": [\"...\"]}", http.StatusBadRequest)
+		return
+	}
+
+	base := r.URL.Query()
+	if status, err := checkEvalParam(r, base); err != nil {
+		writeJsonError(w, err.Error(), status)
+		return
+	}
+	var result PrefetchResponse
+	for _, target := range req.URLs {
+		q := url.Values{}
+		for name, values := range base {
+			q[name] = values
+		}
+		q.Set("url", target)
+		// Проверяем параметры сразу, чтобы ошибка дошла до клиента, а не в лог.
+		if _, err := parseScrapeOptions(q); err != nil {
+			writeJsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if _, ok := scrapeCache.Get(cacheKey(q), 0); ok {
+			result.Cached++
+			continue
+		}
+		select {
+		case prefetchQueue <- q:
+			result.Queued++
+		default:
+			result.Rejected = append(result.Rejected, target)
+		}
+	}
+	log.Printf("ЛОГ: Прогрев: в очереди %d, уже в кэше %d, отклонено %d.", result.Queued, result.Cached, len(result.Rejected))
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(result)
+}
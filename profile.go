@@ -0,0 +1,160 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Профиль браузера на диске (PROFILE_DIR или флаг -user-data-dir): куки,
+// localStorage и вход на сайты переживают перезапуск сервиса. Каждый
+// экземпляр браузера получает свой подкаталог browser-<слот> — Chrome не
+// открывает один профиль двумя процессами.
+//
+// GET    /admin/profile          — каталоги и размеры профилей;
+// GET    /admin/profile/snapshot — архив профилей (tar.gz) без кэшей;
+// DELETE /admin/profile          — дождаться вкладок, закрыть браузеры,
+//                                  удалить профили и запустить браузеры с
+//                                  чистыми. Сессии теряются.
+
+// profileDir — корень профилей; пусто — временный профиль на каждый запуск.
+var profileDir string
+
+// profileSkipDirs — кэши, которые в снимок не нужны: Chrome пересоберёт их сам.
+var profileSkipDirs = map[string]bool{"Cache": true, "Code Cache": true, "GPUCache": true, "ShaderCache": true, "GrShaderCache": true, "DawnCache": true}
+
+func profileDirFor(slot int) string {
+	return filepath.Join(profileDir, fmt.Sprintf("browser-%d", slot))
+}
+
+// ProfileInfo — ответ GET /admin/profile.
+type ProfileInfo struct {
+	Dir       string            `json:"dir"`
+	Instances []ProfileInstance `json:"instances"`
+}
+
+type ProfileInstance struct {
+	Slot    int    `json:"slot"`
+	Dir     string `json:"dir"`
+	Size    int64  `json:"size"`
+	Running bool   `json:"running"`
+}
+
+func dirSize(dir string) int64 {
+	var size int64
+	filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err == nil && d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return size
+}
+
+// writeProfileSnapshot пишет профили в tar.gz. Chrome продолжает работать,
+// поэтому файлы читаются целиком до записи заголовка: размер в архиве
+// совпадает с содержимым, даже если файл меняется в этот момент.
+// Блокировки Singleton* и сокеты пропускаются.
+func writeProfileSnapshot(w http.ResponseWriter) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	err := filepath.WalkDir(profileDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil // Файл удалён Chrome во время обхода
+		}
+		if d.IsDir() && profileSkipDirs[d.Name()] {
+			return filepath.SkipDir
+		}
+		if !d.Type().IsRegular() || strings.HasPrefix(d.Name(), "Singleton") {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil
+		}
+		rel, _ := filepath.Rel(profileDir, path)
+		hdr := &tar.Header{Name: filepath.ToSlash(rel), Mode: 0o600, Size: int64(len(data)), ModTime: time.Now()}
+		if info, err := d.Info(); err == nil {
+			hdr.ModTime = info.ModTime()
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		_, err = tw.Write(data)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// clearProfiles по очереди выводит основные браузеры из работы, удаляет
+// их профили и запускает заново (recycle.go).
+func clearProfiles() error {
+	for slot := range primaryBrowsers() {
+		if err := recycleBrowser(slot, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// profileHandler: /admin/profile и /admin/profile/snapshot.
+func profileHandler(w http.ResponseWriter, r *http.Request) {
+	if !adminTokenValid(r) {
+		writeJsonError(w, "Неверный или не настроенный ADMIN_TOKEN", http.StatusUnauthorized)
+		return
+	}
+	if profileDir == "" {
+		writeJsonError(w, "Профиль на диске не настроен (задайте PROFILE_DIR или -user-data-dir)", http.StatusNotFound)
+		return
+	}
+	action := strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin/profile"), "/")
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		info := ProfileInfo{Dir: profileDir, Instances: []ProfileInstance{}}
+		for slot, b := range primaryBrowsers() {
+			info.Instances = append(info.Instances, ProfileInstance{
+				Slot:    slot,
+				Dir:     profileDirFor(slot),
+				Size:    dirSize(profileDirFor(slot)),
+				Running: b.ctx.Err() == nil,
+			})
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(w).Encode(info)
+	case action == "" && r.Method == http.MethodDelete:
+		if err := clearProfiles(); err != nil {
+			log.Printf("ЛОГ: Ошибка очистки профиля: %v", err)
+			writeJsonError(w, "Не удалось очистить профиль: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case action == "snapshot" && r.Method == http.MethodGet:
+		name := "profile-" + time.Now().UTC().Format("20060102-150405") + ".tar.gz"
+		w.Header().Set("Content-Type", "application/gzip")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+		if err := writeProfileSnapshot(w); err != nil {
+			// Заголовки уже отправлены — остаётся только лог.
+			log.Printf("ЛОГ: Ошибка снимка профиля: %v", err)
+		}
+	case action == "" || action == "snapshot":
+		writeJsonError(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+	default:
+		writeJsonError(w, "Неизвестное действие с профилем: "+action, http.StatusNotFound)
+	}
+}
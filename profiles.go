@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"log"
+	"math/rand/v2"
+	"sort"
+	"strings"
+
+	"github.com/chromedp/cdproto/emulation"
+	"github.com/chromedp/chromedp"
+)
+
+// Профили браузера для profile=desktop|mobile|random: согласованные
+// User-Agent, client hints (Sec-CH-UA-*, navigator.userAgentData) и
+// размер экрана. Несовпадение UA с client hints или мобильного UA с
+// экраном 1920×1080 — типичный признак бота, поэтому профиль меняет всё
+// сразу. Внутри группы профиль выбирается случайно на каждый запрос;
+// явный user_agent применяется поверх профиля.
+
+const profileChromeVersion = "138"
+
+type browserProfile struct {
+	Name      string
+	UserAgent string
+	Platform  string // navigator.platform
+
+	// Client hints: Sec-CH-UA-Platform, -Platform-Version, -Model.
+	CHPlatform        string
+	CHPlatformVersion string
+	CHModel           string
+
+	Width, Height int64
+	Scale         float64
+	Mobile        bool
+
+	// NoClientHints — Safari: navigator.userAgentData и Sec-CH-UA-* у него нет.
+	NoClientHints bool
+}
+
+var desktopProfiles = []browserProfile{
+	{
+		Name:      "windows-chrome",
+		UserAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/" + profileChromeVersion + ".0.0.0 Safari/537.36",
+		Platform:  "Win32", CHPlatform: "Windows", CHPlatformVersion: "15.0.0",
+		Width: 1920, Height: 1080, Scale: 1,
+	},
+	{
+		Name:      "windows-chrome-laptop",
+		UserAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/" + profileChromeVersion + ".0.0.0 Safari/537.36",
+		Platform:  "Win32", CHPlatform: "Windows", CHPlatformVersion: "10.0.0",
+		Width: 1366, Height: 768, Scale: 1,
+	},
+	{
+		Name:      "macos-chrome",
+		UserAgent: "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/" + profileChromeVersion + ".0.0.0 Safari/537.36",
+		Platform:  "MacIntel", CHPlatform: "macOS", CHPlatformVersion: "14.5.0",
+		Width: 1440, Height: 900, Scale: 2,
+	},
+	{
+		Name:      "linux-chrome",
+		UserAgent: "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/" + profileChromeVersion + ".0.0.0 Safari/537.36",
+		Platform:  "Linux x86_64", CHPlatform: "Linux", CHPlatformVersion: "6.5.0",
+		Width: 1920, Height: 1080, Scale: 1,
+	},
+}
+
+var mobileProfiles = []browserProfile{
+	{
+		Name:      "pixel-7",
+		UserAgent: "Mozilla/5.0 (Linux; Android 10; K) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/" + profileChromeVersion + ".0.0.0 Mobile Safari/537.36",
+		Platform:  "Linux armv81", CHPlatform: "Android", CHPlatformVersion: "14.0.0", CHModel: "Pixel 7",
+		Width: 412, Height: 915, Scale: 2.625, Mobile: true,
+	},
+	{
+		Name:      "galaxy-s23",
+		UserAgent: "Mozilla/5.0 (Linux; Android 10; K) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/" + profileChromeVersion + ".0.0.0 Mobile Safari/537.36",
+		Platform:  "Linux armv81", CHPlatform: "Android", CHPlatformVersion: "14.0.0", CHModel: "SM-S911B",
+		Width: 360, Height: 780, Scale: 3, Mobile: true,
+	},
+	{
+		Name:      "redmi-note-12",
+		UserAgent: "Mozilla/5.0 (Linux; Android 10; K) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/" + profileChromeVersion + ".0.0.0 Mobile Safari/537.36",
+		Platform:  "Linux armv81", CHPlatform: "Android", CHPlatformVersion: "13.0.0", CHModel: "23021RAAEG",
+		Width: 393, Height: 873, Scale: 2.75, Mobile: true,
+	},
+}
+
+var validProfiles = map[string]bool{"desktop": true, "mobile": true, "random": true}
+
+const (
+	iPhoneUA = "Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Mobile/15E148 Safari/604.1"
+	// iPadOS с 13-й версии представляется настольным Safari.
+	iPadUA = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Safari/605.1.15"
+)
+
+// devicePresets — конкретные устройства для device=: в отличие от
+// profile, экран и UA фиксированы, что удобно для воспроизводимой вёрстки.
+var devicePresets = map[string]browserProfile{
+	"iphone14":         {Name: "iphone14", UserAgent: iPhoneUA, Platform: "iPhone", Width: 390, Height: 844, Scale: 3, Mobile: true, NoClientHints: true},
+	"iphone14-pro-max": {Name: "iphone14-pro-max", UserAgent: iPhoneUA, Platform: "iPhone", Width: 430, Height: 932, Scale: 3, Mobile: true, NoClientHints: true},
+	"iphone-se":        {Name: "iphone-se", UserAgent: iPhoneUA, Platform: "iPhone", Width: 375, Height: 667, Scale: 2, Mobile: true, NoClientHints: true},
+	"ipad":             {Name: "ipad", UserAgent: iPadUA, Platform: "MacIntel", Width: 820, Height: 1180, Scale: 2, Mobile: true, NoClientHints: true},
+	"ipad-pro":         {Name: "ipad-pro", UserAgent: iPadUA, Platform: "MacIntel", Width: 1024, Height: 1366, Scale: 2, Mobile: true, NoClientHints: true},
+	"pixel7":           mobileProfiles[0],
+	"galaxy-s23":       mobileProfiles[1],
+	"desktop-1080p":    desktopProfiles[0],
+	"desktop-1440p": {
+		Name:      "desktop-1440p",
+		UserAgent: desktopProfiles[0].UserAgent,
+		Platform:  "Win32", CHPlatform: "Windows", CHPlatformVersion: "15.0.0",
+		Width: 2560, Height: 1440, Scale: 1,
+	},
+	"laptop":  desktopProfiles[1],
+	"macbook": desktopProfiles[2],
+}
+
+// deviceNames — имена пресетов для сообщения об ошибке.
+func deviceNames() string {
+	names := make([]string, 0, len(devicePresets))
+	for name := range devicePresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// pickProfile выбирает профиль группы случайно.
+func pickProfile(group string) browserProfile {
+	var pool []browserProfile
+	switch group {
+	case "desktop":
+		pool = desktopProfiles
+	case "mobile":
+		pool = mobileProfiles
+	default:
+		pool = append(append(pool, desktopProfiles...), mobileProfiles...)
+	}
+	return pool[rand.IntN(len(pool))]
+}
+
+// applyProfile включает UA, client hints и метрики экрана профиля.
+// acceptLanguage (если задан) меняет и navigator.languages.
+func applyProfile(p browserProfile, acceptLanguage string) chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		log.Printf("ЛОГ: Профиль браузера: %s (%dx%d).", p.Name, p.Width, p.Height)
+		override := emulation.SetUserAgentOverride(p.UserAgent).WithPlatform(p.Platform)
+		if !p.NoClientHints {
+			override = override.WithUserAgentMetadata(userAgentMetadata(p))
+		}
+		if acceptLanguage != "" {
+			override = override.WithAcceptLanguage(acceptLanguage)
+		}
+		if err := override.Do(ctx); err != nil {
+			return err
+		}
+		err := emulation.SetDeviceMetricsOverride(p.Width, p.Height, p.Scale, p.Mobile).
+			WithScreenWidth(p.Width).
+			WithScreenHeight(p.Height).
+			Do(ctx)
+		if err != nil {
+			return err
+		}
+		return emulation.SetTouchEmulationEnabled(p.Mobile).WithMaxTouchPoints(5).Do(ctx)
+	})
+}
+
+// userAgentMetadata — client hints профиля, согласованные с его UA.
+func userAgentMetadata(p browserProfile) *emulation.UserAgentMetadata {
+	brands := []*emulation.UserAgentBrandVersion{
+		{Brand: "Not)A;Brand", Version: "8"},
+		{Brand: "Chromium", Version: profileChromeVersion},
+		{Brand: "Google Chrome", Version: profileChromeVersion},
+	}
+	metadata := &emulation.UserAgentMetadata{
+		Brands:          brands,
+		FullVersionList: brands,
+		Platform:        p.CHPlatform,
+		PlatformVersion: p.CHPlatformVersion,
+		Architecture:    "x86",
+		Model:           p.CHModel,
+		Mobile:          p.Mobile,
+	}
+	if p.Mobile {
+		metadata.Architecture = "arm"
+	}
+	return metadata
+}
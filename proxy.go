@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"log/slog"
+	"net/url"
+	"os"
+
+	"github.com/chromedp/cdproto/target"
+	"github.com/chromedp/chromedp"
+)
+
+// Прокси. PROXY_URL задаёт прокси всего браузера (флаг --proxy-server),
+// параметр proxy — прокси одного скрапинга: вкладка открывается в
+// отдельном BrowserContext со своим proxyServer, поэтому куки и кэш такой
+// вкладки изолированы от остальных. Поддерживаются http://, https:// и
+// socks5://. Логин и пароль из URL передаются по запросу авторизации
+// прокси (Fetch.authRequired); Chrome не умеет авторизоваться в SOCKS5,
+// поэтому для него учётные данные не принимаются.
+
+// proxyConfig — разобранный адрес прокси.
+type proxyConfig struct {
+	Server   string // scheme://host:port без учётных данных — так его понимает Chrome
+	Username string
+	Password string
+}
+
+var validProxySchemes = map[string]bool{"http": true, "https": true, "socks5": true}
+
+// globalProxy — прокси из PROXY_URL; nil — без прокси.
+var globalProxy *proxyConfig
+
+func parseProxyURL(raw string) (*proxyConfig, error) {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" || !validProxySchemes[u.Scheme] {
+		return nil, errors.New("Прокси должен быть задан как http://, https:// или socks5://[логин:пароль@]хост:порт")
+	}
+	cfg := &proxyConfig{Server: u.Scheme + "://" + u.Host}
+	if u.User != nil {
+		if u.Scheme == "socks5" {
+			return nil, errors.New("Chrome не поддерживает авторизацию в SOCKS5-прокси")
+		}
+		cfg.Username = u.User.Username()
+		cfg.Password, _ = u.User.Password()
+	}
+	return cfg, nil
+}
+
+// parseRequestProxy разбирает прокси из запроса: через хост во внутренней
+// сети браузер попал бы туда, куда скрапить нельзя. PROXY_URL и пул
+// задаёт администратор, их это не касается.
+func parseRequestProxy(raw string) (*proxyConfig, error) {
+	cfg, err := parseProxyURL(raw)
+	if err != nil {
+		return nil, err
+	}
+	u, _ := url.Parse(cfg.Server)
+	if err := checkOutboundHost("proxy", u.Hostname()); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func loadProxyConfig() {
+	raw := os.Getenv("PROXY_URL")
+	if raw == "" {
+		return
+	}
+	cfg, err := parseProxyURL(raw)
+	if err != nil {
+		log.Fatalf("PROXY_URL: %v", err)
+	}
+	globalProxy = cfg
+	log.Printf("ЛОГ: Браузер работает через прокси %s.", cfg.Server)
+}
+
+// newScrapeTab открывает вкладку для скрапинга: в браузере по умолчанию
+// или, если задан прокси запроса либо нужна изоляция кук, в отдельном
+// BrowserContext, который закрывается вместе с вкладкой.
+func newScrapeTab(ctx context.Context, proxy *proxyConfig, isolate bool) (context.Context, context.CancelFunc) {
+	// Удалённому браузеру --proxy-server не передать: общий прокси — через BrowserContext.
+	if proxy == nil && remoteBrowser != "" {
+		proxy = globalProxy
+	}
+	if proxy == nil && !isolate {
+		return openBrowserTab()
+	}
+	if proxy != nil {
+		slog.InfoContext(ctx, "Вкладка открывается через прокси", "proxy", proxy.Server)
+	}
+	return openBrowserTab(chromedp.WithNewBrowserContext(
+		func(p *target.CreateBrowserContextParams) *target.CreateBrowserContextParams {
+			if proxy != nil {
+				p = p.WithProxyServer(proxy.Server)
+			}
+			return p
+		},
+	))
+}
+
+// proxyAuth отвечает на запросы авторизации прокси (см. interceptRequests).
+func proxyAuth(proxy *proxyConfig) chromedp.Action {
+	return interceptRequests(proxy, nil, nil)
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Пул прокси. Список задаётся PROXY_LIST (через запятую или перевод
+// строки) или файлом PROXY_FILE (по адресу в строке, # — комментарий).
+// PROXY_ROTATION=request (по умолчанию) выдаёт прокси по кругу на каждый
+// запрос, domain — закрепляет за доменом один прокси, пока тот исправен.
+// Прокси, на котором PROXY_MAX_FAILURES (3) раза подряд упала навигация или
+// сайт ответил 403/407/429, выводится из ротации на PROXY_COOLDOWN секунд
+// (300), затем пробуется снова. Явный параметр proxy пул не использует.
+// Состояние пула — GET /admin/proxies (ADMIN_TOKEN).
+
+type poolProxy struct {
+	cfg *proxyConfig
+
+	failures       int // Подряд
+	unhealthyUntil time.Time
+	requests       int
+	errors         int
+	lastError      string
+}
+
+type proxyPoolState struct {
+	mu        sync.Mutex
+	proxies   []*poolProxy
+	next      int
+	perDomain bool
+	byDomain  map[string]*poolProxy
+
+	maxFailures int
+	cooldown    time.Duration
+}
+
+// ProxyStatus — состояние прокси в /admin/proxies. Пароль не выводится.
+type ProxyStatus struct {
+	Proxy          string     `json:"proxy"`
+	Healthy        bool       `json:"healthy"`
+	UnhealthyUntil *time.Time `json:"unhealthy_until,omitempty"`
+	Failures       int        `json:"consecutive_failures"`
+	Requests       int        `json:"requests"`
+	Errors         int        `json:"errors"`
+	LastError      string     `json:"last_error,omitempty"`
+}
+
+// proxyPool — nil, если пул не настроен.
+var proxyPool *proxyPoolState
+
+func loadProxyPool() {
+	var lines []string
+	if raw := os.Getenv("PROXY_LIST"); raw != "" {
+		lines = strings.FieldsFunc(raw, func(r rune) bool { return r == ',' || r == '\n' })
+	}
+	if path := os.Getenv("PROXY_FILE"); path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			log.Fatalf("Не удалось открыть PROXY_FILE %s: %v", path, err)
+		}
+		sc := bufio.NewScanner(f)
+		for sc.Scan() {
+			lines = append(lines, sc.Text())
+		}
+		f.Close()
+	}
+	pool := &proxyPoolState{byDomain: map[string]*poolProxy{}, maxFailures: 3, cooldown: 5 * time.Minute}
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		cfg, err := parseProxyURL(line)
+		if err != nil {
+			log.Fatalf("Пул прокси: %q: %v", maskProxy(line), err)
+		}
+		pool.proxies = append(pool.proxies, &poolProxy{cfg: cfg})
+	}
+	if len(pool.proxies) == 0 {
+		return
+	}
+	switch mode := os.Getenv("PROXY_ROTATION"); mode {
+	case "", "request":
+	case "domain":
+		pool.perDomain = true
+	default:
+		log.Fatalf("PROXY_ROTATION может принимать значения: request, domain; получено %q", mode)
+	}
+	if v, err := strconv.Atoi(os.Getenv("PROXY_MAX_FAILURES")); err == nil && v > 0 {
+		pool.maxFailures = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("PROXY_COOLDOWN")); err == nil && v > 0 {
+		pool.cooldown = time.Duration(v) * time.Second
+	}
+	proxyPool = pool
+	rotation := "запросам"
+	if pool.perDomain {
+		rotation = "доменам"
+	}
+	log.Printf("ЛОГ: Пул прокси: %d шт., ротация по %s.", len(pool.proxies), rotation)
+}
+
+// maskProxy скрывает пароль в адресе прокси для логов и статуса.
+func maskProxy(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.User == nil {
+		return raw
+	}
+	u.User = url.User(u.User.Username())
+	return u.String()
+}
+
+func (p *poolProxy) label() string {
+	if p.cfg.Username == "" {
+		return p.cfg.Server
+	}
+	u, _ := url.Parse(p.cfg.Server)
+	u.User = url.User(p.cfg.Username)
+	return u.String()
+}
+
+// Pick выбирает прокси для адреса. Если исправных нет, берётся тот, чей
+// карантин кончается раньше всех: лучше попробовать, чем отказать.
+func (pool *proxyPoolState) Pick(rawURL string) *poolProxy {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	now := time.Now()
+	var host string
+	if pool.perDomain {
+		if u, err := url.Parse(rawURL); err == nil {
+			host = strings.ToLower(trimWWW(u.Hostname()))
+		}
+		if px := pool.byDomain[host]; px != nil && !now.Before(px.unhealthyUntil) {
+			return px
+		}
+	}
+	var picked *poolProxy
+	for i := 0; i < len(pool.proxies); i++ {
+		px := pool.proxies[(pool.next+i)%len(pool.proxies)]
+		if !now.Before(px.unhealthyUntil) {
+			picked = px
+			pool.next = (pool.next + i + 1) % len(pool.proxies)
+			break
+		}
+	}
+	if picked == nil {
+		picked = pool.proxies[0]
+		for _, px := range pool.proxies[1:] {
+			if px.unhealthyUntil.Before(picked.unhealthyUntil) {
+				picked = px
+			}
+		}
+	}
+	if pool.perDomain && host != "" {
+		pool.byDomain[host] = picked
+	}
+	return picked
+}
+
+// bannedStatus — ответы, после которых прокси считается заблокированным.
+func bannedStatus(status int64) bool {
+	return status == http.StatusForbidden || status == http.StatusProxyAuthRequired || status == http.StatusTooManyRequests
+}
+
+// Report учитывает результат навигации через прокси.
+func (pool *proxyPoolState) Report(px *poolProxy, err error, status int64) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	px.requests++
+	reason := ""
+	switch {
+	case err != nil:
+		reason = err.Error()
+	case bannedStatus(status):
+		reason = "HTTP " + strconv.FormatInt(status, 10)
+	}
+	if reason == "" {
+		px.failures = 0
+		return
+	}
+	px.errors++
+	px.failures++
+	px.lastError = reason
+	if px.failures >= pool.maxFailures {
+		px.unhealthyUntil = time.Now().Add(pool.cooldown)
+		px.failures = 0
+		log.Printf("ЛОГ: Пул прокси: %s выведен из ротации до %s (%s).", px.label(), px.unhealthyUntil.Format(time.TimeOnly), reason)
+	}
+}
+
+func (pool *proxyPoolState) Status() []ProxyStatus {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	now := time.Now()
+	out := make([]ProxyStatus, 0, len(pool.proxies))
+	for _, px := range pool.proxies {
+		st := ProxyStatus{
+			Proxy:     px.label(),
+			Healthy:   !now.Before(px.unhealthyUntil),
+			Failures:  px.failures,
+			Requests:  px.requests,
+			Errors:    px.errors,
+			LastError: px.lastError,
+		}
+		if !st.Healthy {
+			until := px.unhealthyUntil
+			st.UnhealthyUntil = &until
+		}
+		out = append(out, st)
+	}
+	return out
+}
+
+// proxyPoolHandler: GET /admin/proxies.
+func proxyPoolHandler(w http.ResponseWriter, r *http.Request) {
+	if !adminTokenValid(r) {
+		writeJsonError(w, "Неверный или не настроенный ADMIN_TOKEN", http.StatusUnauthorized)
+		return
+	}
+	if proxyPool == nil {
+		writeJsonError(w, "Пул прокси не настроен (задайте PROXY_LIST или PROXY_FILE)", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(proxyPool.Status())
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Ограничение частоты запросов к самому webextract (token bucket):
+//
+//	CLIENT_RATE_LIMIT, CLIENT_RATE_BURST — запросов в минуту и запас на
+//	    клиента (имя ключа API или IP-адрес);
+//	DOMAIN_RATE_LIMIT, DOMAIN_RATE_BURST — скрапингов в минуту и запас на
+//	    целевой домен, чтобы не перегружать один сайт. Ответы из кэша
+//	    сайт не трогают и в лимит домена не входят.
+//
+// Запас по умолчанию равен лимиту в минуту. Превышение — 429 с
+// Retry-After. Не путать с RATE_LIMIT_* (retryafter.go): это реакция на
+// 429 от самих сайтов.
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter — набор корзин по ключу.
+type rateLimiter struct {
+	mu      sync.Mutex
+	perSec  float64
+	burst   float64
+	buckets map[string]*tokenBucket
+}
+
+// maxRateBuckets — при превышении полные корзины удаляются: они ничем не
+// отличаются от новых.
+const maxRateBuckets = 10000
+
+var (
+	clientLimiter *rateLimiter
+	domainLimiter *rateLimiter
+)
+
+// throttledError — запрос отклонён лимитом webextract.
+type throttledError struct {
+	Scope      string // client или domain
+	Key        string
+	RetryAfter time.Duration
+}
+
+func (e *throttledError) Error() string {
+	if e.Scope == "domain" {
+		return fmt.Sprintf("превышен лимит скрапинга домена %s, повторите через %d с", e.Key, retryAfterSeconds(e.RetryAfter))
+	}
+	return fmt.Sprintf("Превышен лимит запросов, повторите через %d с", retryAfterSeconds(e.RetryAfter))
+}
+
+func retryAfterSeconds(d time.Duration) int {
+	return max(int(math.Ceil(d.Seconds())), 1)
+}
+
+func loadRequestRateLimits() {
+	clientLimiter = newRateLimiter("CLIENT_RATE_LIMIT", "CLIENT_RATE_BURST")
+	domainLimiter = newRateLimiter("DOMAIN_RATE_LIMIT", "DOMAIN_RATE_BURST")
+}
+
+func newRateLimiter(limitEnv, burstEnv string) *rateLimiter {
+	raw := os.Getenv(limitEnv)
+	if raw == "" {
+		return nil
+	}
+	perMin, err := strconv.Atoi(raw)
+	if err != nil || perMin <= 0 {
+		log.Fatalf("%s должен быть положительным числом запросов в минуту, получено %q", limitEnv, raw)
+	}
+	burst := perMin
+	if raw := os.Getenv(burstEnv); raw != "" {
+		if burst, err = strconv.Atoi(raw); err != nil || burst <= 0 {
+			log.Fatalf("%s должен быть положительным целым числом, получено %q", burstEnv, raw)
+		}
+	}
+	log.Printf("ЛОГ: %s: %d в минуту, запас %d.", limitEnv, perMin, burst)
+	return &rateLimiter{perSec: float64(perMin) / 60, burst: float64(burst), buckets: map[string]*tokenBucket{}}
+}
+
+// Take забирает токен; если его нет, возвращает, через сколько он появится.
+func (l *rateLimiter) Take(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	b := l.buckets[key]
+	if b == nil {
+		if len(l.buckets) >= maxRateBuckets {
+			l.pruneFull(now)
+		}
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.perSec)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / l.perSec * float64(time.Second))
+}
+
+func (l *rateLimiter) pruneFull(now time.Time) {
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.perSec >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// takeDomainSlot проверяет лимит домена перед скрапингом.
+func takeDomainSlot(rawURL string) error {
+	if domainLimiter == nil {
+		return nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Hostname() == "" {
+		return nil
+	}
+	host := strings.ToLower(trimWWW(u.Hostname()))
+	if ok, wait := domainLimiter.Take(host); !ok {
+		log.Printf("ЛОГ: Лимит скрапинга домена %s исчерпан.", host)
+		return &throttledError{Scope: "domain", Key: host, RetryAfter: wait}
+	}
+	return nil
+}
+
+// withClientRateLimit ограничивает частоту запросов клиента. Пути без
+// ключа API (apiKeyExemptPrefixes) не ограничиваются.
+func withClientRateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if clientLimiter == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		for _, prefix := range apiKeyExemptPrefixes {
+			if strings.HasPrefix(r.URL.Path, prefix) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		client := requestClient(r)
+		if ok, wait := clientLimiter.Take(client); !ok {
+			log.Printf("ЛОГ: Клиент %s превысил лимит запросов.", client)
+			err := &throttledError{Scope: "client", Key: client, RetryAfter: wait}
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds(wait)))
+			writeJsonError(w, err.Error(), http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Плановый перезапуск браузеров: Chrome за долгую работу разрастается по
+// памяти, и лечится это только новым процессом. BROWSER_RECYCLE_REQUESTS —
+// перезапуск после стольких открытых вкладок, BROWSER_RECYCLE_MINUTES —
+// после стольких минут работы; 0 или пусто — без ограничения.
+// POST /admin/browser/restart[?slot=N] перезапускает вручную.
+//
+// Новые вкладки сразу уходят к замене: к резервному или только что
+// запущенному экземпляру, а при профиле на диске (два процесса не делят
+// профиль) — в остальные слоты. Старый экземпляр закрывается, когда его
+// вкладки завершатся, но не позже browserDrainTimeout. Сессии в нём теряются.
+
+const (
+	browserDrainTimeout   = 2 * time.Minute
+	browserRecycleCheck   = time.Minute
+	browserDrainPollDelay = 500 * time.Millisecond
+)
+
+var (
+	recycleAfterRequests int64
+	recycleAfterAge      time.Duration
+	// recycleMu — экземпляры заменяются по одному, чтобы не остаться без браузеров.
+	recycleMu sync.Mutex
+)
+
+func loadRecycleConfig() {
+	if raw := os.Getenv("BROWSER_RECYCLE_REQUESTS"); raw != "" {
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || n < 0 {
+			log.Fatalf("BROWSER_RECYCLE_REQUESTS должен быть неотрицательным числом")
+		}
+		recycleAfterRequests = n
+	}
+	if raw := os.Getenv("BROWSER_RECYCLE_MINUTES"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			log.Fatalf("BROWSER_RECYCLE_MINUTES должен быть неотрицательным числом")
+		}
+		recycleAfterAge = time.Duration(n) * time.Minute
+	}
+	if recycleAfterRequests > 0 || recycleAfterAge > 0 {
+		log.Printf("ЛОГ: Плановый перезапуск браузеров: после %d вкладок или %v работы (0 — без ограничения).", recycleAfterRequests, recycleAfterAge)
+		go recycleLoop()
+	}
+}
+
+// recycleLoop раз в browserRecycleCheck перезапускает отслужившие экземпляры.
+func recycleLoop() {
+	for range time.Tick(browserRecycleCheck) {
+		for slot, b := range primaryBrowsers() {
+			if b.ctx.Err() != nil || shuttingDown.Load() {
+				continue
+			}
+			opened, age := b.opened.Load(), time.Since(b.started)
+			if (recycleAfterRequests > 0 && opened >= recycleAfterRequests) || (recycleAfterAge > 0 && age >= recycleAfterAge) {
+				log.Printf("ЛОГ: Браузер #%d отработал (%d вкладок, %v), перезапускаю.", b.id, opened, age.Round(time.Minute))
+				if err := recycleBrowser(slot, false); err != nil {
+					log.Printf("ЛОГ: Не удалось перезапустить браузер слота %d: %v", slot, err)
+				}
+			}
+		}
+	}
+}
+
+// drainBrowser ждёт, пока у экземпляра не останется открытых вкладок.
+func drainBrowser(b *browserInstance) {
+	deadline := time.Now().Add(browserDrainTimeout)
+	for b.tabs.Load() > 0 && b.ctx.Err() == nil {
+		if time.Now().After(deadline) {
+			log.Printf("ЛОГ: Браузер #%d закрывается с %d незавершёнными вкладками.", b.id, b.tabs.Load())
+			return
+		}
+		time.Sleep(browserDrainPollDelay)
+	}
+}
+
+// recycleBrowser заменяет экземпляр слота новым; wipe — удалить его
+// профиль на диске перед запуском.
+func recycleBrowser(slot int, wipe bool) error {
+	recycleMu.Lock()
+	defer recycleMu.Unlock()
+	browserMu.Lock()
+	if slot < 0 || slot >= len(browserSlots) {
+		browserMu.Unlock()
+		return fmt.Errorf("нет браузера в слоте %d", slot)
+	}
+	old := browserSlots[slot]
+	if profileDir == "" {
+		browserMu.Unlock()
+		promoteStandby(slot) // Слот сразу получает новый экземпляр
+		drainBrowser(old)
+		old.cancel()
+		log.Printf("ЛОГ: Браузер #%d закрыт после перезапуска.", old.id)
+		return nil
+	}
+	old.retired, old.draining = true, true
+	browserMu.Unlock()
+	drainBrowser(old)
+	old.cancel() // Ждёт завершения процесса Chrome, профиль освобождается
+	if wipe {
+		if err := os.RemoveAll(profileDirFor(slot)); err != nil {
+			return err
+		}
+	}
+	for {
+		fresh, err := launchBrowser(slot)
+		if err == nil {
+			browserMu.Lock()
+			browserSlots[slot] = fresh
+			browserMu.Unlock()
+			log.Printf("ЛОГ: Браузер #%d перезапущен как #%d.", old.id, fresh.id)
+			return nil
+		}
+		if shuttingDown.Load() {
+			return err
+		}
+		log.Printf("ЛОГ: Не удалось перезапустить браузер: %v. Повтор через %v.", err, browserRelaunchDelay)
+		time.Sleep(browserRelaunchDelay)
+	}
+}
+
+// BrowserRestartResponse — ответ POST /admin/browser/restart.
+type BrowserRestartResponse struct {
+	Slots []int `json:"slots"`
+}
+
+// browserRestartHandler: POST /admin/browser/restart[?slot=N]. Перезапуск
+// идёт в фоне: ожидание вкладок может занять до browserDrainTimeout.
+func browserRestartHandler(w http.ResponseWriter, r *http.Request) {
+	if !adminTokenValid(r) {
+		writeJsonError(w, "Неверный или не настроенный ADMIN_TOKEN", http.StatusUnauthorized)
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeJsonError(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+		return
+	}
+	if clusterMode == "coordinator" {
+		writeJsonError(w, "Браузер на координаторе не запускается", http.StatusNotFound)
+		return
+	}
+	n := len(primaryBrowsers())
+	slots := make([]int, 0, n)
+	if raw := r.URL.Query().Get("slot"); raw != "" {
+		slot, err := strconv.Atoi(raw)
+		if err != nil || slot < 0 || slot >= n {
+			writeJsonError(w, fmt.Sprintf("Параметр 'slot' должен быть числом от %d до %d", 0, n-1), http.StatusBadRequest)
+			return
+		}
+		slots = append(slots, slot)
+	} else {
+		for slot := range n {
+			slots = append(slots, slot)
+		}
+	}
+	go func() {
+		for _, slot := range slots {
+			if err := recycleBrowser(slot, false); err != nil {
+				log.Printf("ЛОГ: Не удалось перезапустить браузер слота %d: %v", slot, err)
+			}
+		}
+	}()
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(BrowserRestartResponse{Slots: slots})
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"sync"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/chromedp"
+)
+
+// Redirect — один HTTP-редирект основного документа.
+type Redirect struct {
+	URL      string `json:"url"`
+	Status   int64  `json:"status"`
+	Location string `json:"location"`
+}
+
+// redirectTracker собирает цепочку редиректов основного документа по
+// событиям Network.requestWillBeSent: у запроса, вызванного редиректом,
+// есть redirectResponse с ответом предыдущего шага. Новая навигация без
+// redirectResponse (например, повтор после Retry-After) начинает цепочку
+// заново. Документы во фреймах не учитываются: у главного фрейма
+// идентификатор совпадает с идентификатором вкладки.
+type redirectTracker struct {
+	mu    sync.Mutex
+	chain []Redirect
+}
+
+func trackRedirects(ctx context.Context) *redirectTracker {
+	t := &redirectTracker{}
+	var mainFrame cdp.FrameID
+	if c := chromedp.FromContext(ctx); c != nil && c.Target != nil {
+		mainFrame = cdp.FrameID(c.Target.TargetID)
+	}
+	chromedp.ListenTarget(ctx, func(ev any) {
+		req, ok := ev.(*network.EventRequestWillBeSent)
+		if !ok || req.Type != network.ResourceTypeDocument || req.FrameID != mainFrame {
+			return
+		}
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if req.RedirectResponse == nil {
+			t.chain = nil
+			return
+		}
+		t.chain = append(t.chain, Redirect{
+			URL:      req.RedirectResponse.URL,
+			Status:   req.RedirectResponse.Status,
+			Location: req.Request.URL,
+		})
+	})
+	return t
+}
+
+// Chain возвращает копию собранной цепочки.
+func (t *redirectTracker) Chain() []Redirect {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]Redirect(nil), t.chain...)
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Минимальный клиент Redis (протокол RESP) для распределённого режима.
+// Команд нужно немного — очередь, ключи с TTL, — поэтому отдельная
+// зависимость не заводится.
+
+// errRedisNil — ответ nil (ключа нет, SET NX не сработал, BRPOP по таймауту).
+var errRedisNil = errors.New("redis: nil")
+
+type redisConn struct {
+	conn net.Conn
+	rd   *bufio.Reader
+}
+
+func dialRedis(addr, password string) (*redisConn, error) {
+	conn, err := net.DialTimeout("tcp", addr, 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	c := &redisConn{conn: conn, rd: bufio.NewReader(conn)}
+	if password != "" {
+		if _, err := c.do(0, "AUTH", password); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// do отправляет команду и читает ответ. timeout — дедлайн на весь обмен;
+// для блокирующих команд он должен быть больше их собственного таймаута.
+func (c *redisConn) do(timeout time.Duration, args ...string) (any, error) {
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+	c.conn.SetDeadline(time.Now().Add(timeout))
+	buf := fmt.Appendf(nil, "*%d\r\n", len(args))
+	for _, a := range args {
+		buf = fmt.Appendf(buf, "$%d\r\n%s\r\n", len(a), a)
+	}
+	if _, err := c.conn.Write(buf); err != nil {
+		return nil, err
+	}
+	return c.readReply()
+}
+
+func (c *redisConn) readReply() (any, error) {
+	line, err := c.rd.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 {
+		return nil, fmt.Errorf("redis: некорректный ответ %q", line)
+	}
+	kind, body := line[0], line[1:len(line)-2]
+	switch kind {
+	case '+':
+		return body, nil
+	case '-':
+		return nil, redisError(body)
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, errRedisNil
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(c.rd, data); err != nil {
+			return nil, err
+		}
+		return string(data[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, errRedisNil
+		}
+		items := make([]any, n)
+		for i := range items {
+			if items[i], err = c.readReply(); err != nil && !errors.Is(err, errRedisNil) {
+				return nil, err
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("redis: неизвестный тип ответа %q", kind)
+}
+
+// redisClient — пул соединений. Блокирующие команды (BRPOP) занимают
+// соединение целиком, поэтому каждое Do берёт своё.
+type redisClient struct {
+	addr, password string
+
+	mu   sync.Mutex
+	idle []*redisConn
+}
+
+func newRedisClient(addr, password string) *redisClient {
+	return &redisClient{addr: addr, password: password}
+}
+
+// Do выполняет команду с обычным таймаутом.
+func (r *redisClient) Do(args ...string) (any, error) {
+	return r.DoTimeout(0, args...)
+}
+
+func (r *redisClient) DoTimeout(timeout time.Duration, args ...string) (any, error) {
+	r.mu.Lock()
+	var c *redisConn
+	if n := len(r.idle); n > 0 {
+		c, r.idle = r.idle[n-1], r.idle[:n-1]
+	}
+	r.mu.Unlock()
+	if c == nil {
+		var err error
+		if c, err = dialRedis(r.addr, r.password); err != nil {
+			return nil, err
+		}
+	}
+	reply, err := c.do(timeout, args...)
+	if err != nil && !errors.Is(err, errRedisNil) && !isRedisReplyError(err) {
+		// Сетевая ошибка: состояние соединения неизвестно, закрываем его.
+		c.conn.Close()
+		return nil, err
+	}
+	r.mu.Lock()
+	r.idle = append(r.idle, c)
+	r.mu.Unlock()
+	return reply, err
+}
+
+// redisError — ошибка-ответ сервера (-ERR ...); соединение после неё исправно.
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+func isRedisReplyError(err error) bool {
+	var re redisError
+	return errors.As(err, &re)
+}
+
+// String выполняет команду и возвращает строковый ответ.
+func (r *redisClient) String(args ...string) (string, error) {
+	reply, err := r.Do(args...)
+	if err != nil {
+		return "", err
+	}
+	s, ok := reply.(string)
+	if !ok {
+		return "", fmt.Errorf("redis: ожидалась строка, получено %T", reply)
+	}
+	return s, nil
+}
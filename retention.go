@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Политика хранения и сборка мусора. Фоновый сборщик раз в GC_INTERVAL
+// секунд (по умолчанию 600):
+//   - удаляет из хранилища версии и артефакты старше STORAGE_MAX_AGE_DAYS;
+//   - если хранилище больше STORAGE_MAX_MB, удаляет самые старые записи,
+//     пока не уложится в лимит;
+//   - чистит кэш от просроченных записей и сверх CACHE_MAX_ENTRIES.
+// Завершённые асинхронные задачи живут JOB_RETENTION секунд (по умолчанию
+// 3600); сверх JOB_MAX_ENTRIES новая задача вытесняет самые старые
+// завершённые.
+// POST /admin/purge?url= или ?domain= удаляет всё по адресу или домену
+// (с поддоменами) из кэша, хранилища, поискового индекса и задач; требует
+// ADMIN_TOKEN.
+
+var (
+	storageMaxAge   time.Duration // 0 — без ограничения по возрасту
+	storageMaxBytes int64         // 0 — без ограничения по размеру
+	cacheMaxEntries int           // 0 — без ограничения
+	jobRetention    = time.Hour
+	jobMaxEntries   int // 0 — без ограничения
+	gcInterval      = 10 * time.Minute
+)
+
+// PurgeResponse — ответ /admin/purge.
+type PurgeResponse struct {
+	CacheEntries int `json:"cache_entries"`
+	Versions     int `json:"versions"`
+	Jobs         int `json:"jobs"`
+}
+
+func loadRetentionConfig() {
+	positive := func(name string) int {
+		raw := os.Getenv(name)
+		if raw == "" {
+			return 0
+		}
+		v, err := strconv.Atoi(raw)
+		if err != nil || v <= 0 {
+			log.Fatalf("%s должен быть положительным целым числом, получено %q", name, raw)
+		}
+		return v
+	}
+	storageMaxAge = time.Duration(positive("STORAGE_MAX_AGE_DAYS")) * 24 * time.Hour
+	storageMaxBytes = int64(positive("STORAGE_MAX_MB")) << 20
+	cacheMaxEntries = positive("CACHE_MAX_ENTRIES")
+	if v := positive("JOB_RETENTION"); v > 0 {
+		jobRetention = time.Duration(v) * time.Second
+	}
+	jobMaxEntries = positive("JOB_MAX_ENTRIES")
+	if v := positive("GC_INTERVAL"); v > 0 {
+		gcInterval = time.Duration(v) * time.Second
+	}
+}
+
+// gcLoop периодически запускает сборку мусора.
+func gcLoop() {
+	for range time.Tick(gcInterval) {
+		collectGarbage()
+	}
+}
+
+// gcItem — версия или артефакт, кандидат на удаление.
+type gcItem struct {
+	at     time.Time
+	size   int64
+	remove func() error
+}
+
+func collectGarbage() {
+	if scrapeCache != nil {
+		if n := scrapeCache.Sweep(cacheMaxEntries); n > 0 {
+			log.Printf("ЛОГ: GC: из кэша удалено записей: %d.", n)
+		}
+	}
+	if resultStore == nil || (storageMaxAge == 0 && storageMaxBytes == 0) {
+		return
+	}
+	items, err := storeGCItems()
+	if err != nil {
+		log.Printf("ЛОГ: GC: не удалось обойти хранилище: %v", err)
+		return
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].at.Before(items[j].at) })
+	var total int64
+	for _, it := range items {
+		total += it.size
+	}
+	removed, freed := 0, int64(0)
+	cutoff := time.Now().Add(-storageMaxAge)
+	for _, it := range items {
+		tooOld := storageMaxAge > 0 && it.at.Before(cutoff)
+		tooBig := storageMaxBytes > 0 && total-freed > storageMaxBytes
+		if !tooOld && !tooBig {
+			break // Элементы отсортированы по времени: дальше только свежее
+		}
+		if err := it.remove(); err != nil {
+			log.Printf("ЛОГ: GC: ошибка удаления: %v", err)
+			continue
+		}
+		removed++
+		freed += it.size
+	}
+	if removed > 0 {
+		log.Printf("ЛОГ: GC: из хранилища удалено записей: %d, освобождено %d КБ.", removed, freed>>10)
+	}
+}
+
+// storeGCItems собирает версии и артефакты хранилища.
+func storeGCItems() ([]gcItem, error) {
+	versions, err := resultStore.versionFiles()
+	if err != nil {
+		return nil, err
+	}
+	items := make([]gcItem, 0, len(versions))
+	for _, f := range versions {
+		items = append(items, gcItem{at: f.scrapedAt, size: f.size, remove: func() error {
+			url, err := resultStore.deleteVersion(f)
+			if err == nil && url != "" && resultIndex != nil {
+				resultIndex.Remove(url, f.id)
+			}
+			return err
+		}})
+	}
+	entries, err := os.ReadDir(filepath.Join(resultStore.dir, artifactsDirName))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		path := filepath.Join(resultStore.dir, artifactsDirName, e.Name())
+		items = append(items, gcItem{at: info.ModTime(), size: info.Size(), remove: func() error { return os.Remove(path) }})
+	}
+	return items, nil
+}
+
+func adminTokenValid(r *http.Request) bool {
+	return requestTokenValid(r, "ADMIN_TOKEN", "X-Admin-Token")
+}
+
+// purgeHandler: POST /admin/purge?url= | ?domain=.
+func purgeHandler(w http.ResponseWriter, r *http.Request) {
+	if !adminTokenValid(r) {
+		writeJsonError(w, "Неверный или не настроенный ADMIN_TOKEN", http.StatusUnauthorized)
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeJsonError(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+		return
+	}
+	target, domain := r.URL.Query().Get("url"), r.URL.Query().Get("domain")
+	if (target == "") == (domain == "") {
+		writeJsonError(w, "Укажите ровно один из параметров 'url' или 'domain'", http.StatusBadRequest)
+		return
+	}
+	match := func(u string) bool { return u == target }
+	if domain != "" {
+		match = func(u string) bool { return hostMatchesDomain(u, domain) }
+	}
+
+	var result PurgeResponse
+	if scrapeCache != nil {
+		result.CacheEntries = scrapeCache.Purge(match)
+	}
+	if resultStore != nil {
+		urls := []string{target}
+		if domain != "" {
+			latest, err := resultStore.LatestAll()
+			if err != nil {
+				writeJsonError(w, "Не удалось обойти хранилище: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			urls = urls[:0]
+			for _, rec := range latest {
+				if match(rec.URL) {
+					urls = append(urls, rec.URL)
+				}
+			}
+		}
+		for _, u := range urls {
+			ids, err := resultStore.PurgeURL(u)
+			if err != nil {
+				writeJsonError(w, "Не удалось удалить версии: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			for _, id := range ids {
+				resultIndex.Remove(u, id)
+			}
+			result.Versions += len(ids)
+		}
+	}
+	result.Jobs = purgeJobs(match)
+	log.Printf("ЛОГ: Очистка (url=%q, domain=%q): кэш %d, версий %d, задач %d.", target, domain, result.CacheEntries, result.Versions, result.Jobs)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// Повторы скрапинга (retries, retry_backoff): сбой, который может не
+// повториться, — таймаут навигации, net::ERR_* кроме заведомо постоянных,
+// 5xx документа, упавшая или закрытая вкладка — повторяется в новой
+// вкладке с паузой retry_backoff, удваиваемой на каждой попытке (не больше
+// maxRetryBackoff). Ограничение частоты (rateLimitError) не повторяется:
+// его уже обработал navigateRespectingRetryAfter. Если 5xx не прошёл и
+// после последней попытки, клиент получает страницу со статусом. timeout
+// — общий срок на все попытки и паузы между ними.
+
+const (
+	maxRetries          = 5
+	defaultRetryBackoff = time.Second
+	maxRetryBackoff     = 30 * time.Second
+)
+
+// permanentNetErrors — ошибки Chrome, которые повтор не исправит.
+var permanentNetErrors = []string{"ERR_NAME_NOT_RESOLVED", "ERR_CERT", "ERR_SSL", "ERR_BLOCKED", "ERR_INVALID_URL", "ERR_UNSAFE", "ERR_ABORTED"}
+
+// transientFailure возвращает причину для повтора или "".
+func transientFailure(resp *Response, err error) string {
+	if err == nil {
+		if resp != nil && resp.Status >= 500 {
+			return fmt.Sprintf("HTTP %d", resp.Status)
+		}
+		return ""
+	}
+	var rlErr *rateLimitError
+	if errors.As(err, &rlErr) {
+		return ""
+	}
+	msg := err.Error()
+	switch {
+	case errors.Is(err, errTabCrashed):
+		return "вкладка упала"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "таймаут"
+	case errors.Is(err, context.Canceled):
+		// Вкладку закрыл перезапуск браузера.
+		return "вкладка закрыта"
+	case strings.Contains(msg, "net::ERR_"):
+		for _, code := range permanentNetErrors {
+			if strings.Contains(msg, code) {
+				return ""
+			}
+		}
+		return msg
+	}
+	return ""
+}
+
+// scrapeWithRetries выполняет performScrape с повторами по opts.Retries.
+// timeout ограничивает все попытки вместе: когда до срока не остаётся
+// времени на паузу, повторов больше нет. В хранилище попадает только
+// итоговая попытка.
+func scrapeWithRetries(opts *scrapeOptions) (*Response, error) {
+	run := *opts
+	if run.Timeout > 0 {
+		run.deadline = time.Now().Add(run.Timeout)
+	}
+	backoff := run.RetryBackoff
+	for attempt := 1; ; attempt++ {
+		resp, save, err := performScrape(&run)
+		reason := transientFailure(resp, err)
+		expired := !run.deadline.IsZero() && time.Until(run.deadline) <= backoff
+		if reason == "" || attempt > run.Retries || expired || shuttingDown.Load() {
+			if save != nil {
+				save()
+			}
+			if resp != nil && attempt > 1 {
+				resp.Attempts = attempt
+			}
+			return resp, err
+		}
+		slog.WarnContext(run.trace, "Попытка скрапинга не удалась, повторю", "attempt", attempt, "url", run.URL, "reason", reason, "backoff", backoff.String())
+		time.Sleep(backoff)
+		backoff = min(backoff*2, maxRetryBackoff)
+	}
+}
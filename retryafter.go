@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/chromedp"
+)
+
+// RateLimitInfo — сведения об ограничении частоты со стороны целевого сайта.
+type RateLimitInfo struct {
+	Status            int64 `json:"status"`
+	RetryAfterSeconds int   `json:"retry_after_seconds"`
+	Attempts          int   `json:"attempts"`
+}
+
+// rateLimitError возвращается, когда сайт продолжает отвечать 429/503
+// после всех повторов или просит ждать дольше допустимого.
+type rateLimitError struct {
+	Info RateLimitInfo
+}
+
+func (e *rateLimitError) Error() string {
+	return fmt.Sprintf("сайт ограничил частоту запросов (HTTP %d, Retry-After %d с, попыток: %d)",
+		e.Info.Status, e.Info.RetryAfterSeconds, e.Info.Attempts)
+}
+
+// Ограничения ожидания по Retry-After: RATE_LIMIT_RETRIES повторов,
+// не дольше RATE_LIMIT_MAX_WAIT секунд на одно ожидание.
+var (
+	rateLimitRetries = 2
+	rateLimitMaxWait = 60 * time.Second
+)
+
+func loadRateLimitConfig() {
+	if raw := os.Getenv("RATE_LIMIT_RETRIES"); raw != "" {
+		if v, err := strconv.Atoi(raw); err == nil && v >= 0 {
+			rateLimitRetries = v
+		}
+	}
+	if raw := os.Getenv("RATE_LIMIT_MAX_WAIT"); raw != "" {
+		if v, err := strconv.Atoi(raw); err == nil && v > 0 {
+			rateLimitMaxWait = time.Duration(v) * time.Second
+		}
+	}
+}
+
+// headerValue ищет заголовок без учёта регистра: CDP отдаёт имена как есть.
+func headerValue(headers network.Headers, name string) string {
+	for k, v := range headers {
+		if strings.EqualFold(k, name) {
+			return fmt.Sprint(v)
+		}
+	}
+	return ""
+}
+
+// parseRetryAfter разбирает Retry-After в секундах или в формате HTTP-даты.
+func parseRetryAfter(raw string) (time.Duration, bool) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(raw); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(raw); err == nil {
+		d := time.Until(t)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return 0, false
+}
+
+// navigateRespectingRetryAfter открывает url и, если документ пришёл с
+// 429/503 и заголовком Retry-After, ждёт указанное время (в пределах лимита)
+// и повторяет навигацию.
+func navigateRespectingRetryAfter(ctx context.Context, url string) (*network.Response, error) {
+	for attempt := 1; ; attempt++ {
+		resp, err := chromedp.RunResponse(ctx, chromedp.Navigate(url))
+		if err != nil {
+			return nil, err
+		}
+		if resp == nil || (resp.Status != http.StatusTooManyRequests && resp.Status != http.StatusServiceUnavailable) {
+			return resp, nil
+		}
+		wait, ok := parseRetryAfter(headerValue(resp.Headers, "Retry-After"))
+		if !ok {
+			return resp, nil
+		}
+		info := RateLimitInfo{Status: resp.Status, RetryAfterSeconds: int(wait.Round(time.Second) / time.Second), Attempts: attempt}
+		if attempt > rateLimitRetries || wait > rateLimitMaxWait {
+			slog.WarnContext(ctx, "Сайт ограничил частоту, повторы исчерпаны", "status", resp.Status, "retry_after", wait.String())
+			return nil, &rateLimitError{Info: info}
+		}
+		slog.InfoContext(ctx, "Жду по Retry-After", "status", resp.Status, "retry_after", wait.String(), "attempt", attempt)
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Разбор robots.txt для обхода (crawl.go). Учитываются:
+//
+//   - Allow/Disallow группы «webextract» или, если её нет, «*»: побеждает
+//     самое длинное совпавшее правило, при равенстве — Allow; поддерживаются
+//     * и $ в конце;
+//   - Crawl-delay — пауза между запросами к хосту (не больше maxCrawlDelay);
+//   - Clean-param (Яндекс) — параметры, не влияющие на содержимое: они
+//     вырезаются из адресов, и дубли вроде ?utm_source=... не скрапятся;
+//   - Sitemap — адреса sitemap сайта.
+
+const (
+	robotsAgent   = "webextract"
+	maxRobotsSize = 500 << 10 // Как у Google: остаток файла игнорируется
+	maxCrawlDelay = time.Minute
+)
+
+type robotsRule struct {
+	allow   bool
+	length  int
+	pattern *regexp.Regexp
+}
+
+type robotsGroup struct {
+	agents []string
+	rules  []robotsRule
+	delay  time.Duration
+}
+
+type cleanParam struct {
+	params map[string]bool
+	path   *regexp.Regexp // nil — для всех адресов
+}
+
+// robotsRules — правила хоста. Нулевое значение разрешает всё.
+type robotsRules struct {
+	rules       []robotsRule
+	crawlDelay  time.Duration
+	cleanParams []cleanParam
+	sitemaps    []string
+}
+
+// robotsPattern переводит шаблон пути robots.txt в регулярное выражение
+// с привязкой к началу.
+func robotsPattern(p string) *regexp.Regexp {
+	anchored := strings.HasSuffix(p, "$")
+	p = strings.TrimSuffix(p, "$")
+	expr := "^" + strings.ReplaceAll(regexp.QuoteMeta(p), `\*`, ".*")
+	if anchored {
+		expr += "$"
+	}
+	return regexp.MustCompile(expr)
+}
+
+func parseRobots(data []byte) *robotsRules {
+	if len(data) > maxRobotsSize {
+		data = data[:maxRobotsSize]
+	}
+	rules := &robotsRules{}
+	var groups []*robotsGroup
+	var current *robotsGroup
+	inAgents := false // Подряд идущие User-agent относятся к одной группе
+	for _, line := range strings.Split(string(data), "\n") {
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key, value = strings.ToLower(strings.TrimSpace(key)), strings.TrimSpace(value)
+		if key != "user-agent" {
+			inAgents = false
+		}
+		switch key {
+		case "user-agent":
+			if !inAgents {
+				current = &robotsGroup{}
+				groups = append(groups, current)
+				inAgents = true
+			}
+			current.agents = append(current.agents, strings.ToLower(value))
+		case "allow", "disallow":
+			if current == nil || value == "" {
+				continue // Пустой Disallow ничего не запрещает
+			}
+			current.rules = append(current.rules, robotsRule{allow: key == "allow", length: len(value), pattern: robotsPattern(value)})
+		case "crawl-delay":
+			if current == nil {
+				continue
+			}
+			if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+				current.delay = min(time.Duration(seconds*float64(time.Second)), maxCrawlDelay)
+			}
+		case "clean-param":
+			names, path, _ := strings.Cut(value, " ")
+			cp := cleanParam{params: map[string]bool{}}
+			for _, name := range strings.Split(names, "&") {
+				if name = strings.TrimSpace(name); name != "" {
+					cp.params[name] = true
+				}
+			}
+			if path = strings.TrimSpace(path); path != "" {
+				cp.path = robotsPattern(path)
+			}
+			if len(cp.params) > 0 {
+				rules.cleanParams = append(rules.cleanParams, cp)
+			}
+		case "sitemap":
+			if value != "" {
+				rules.sitemaps = append(rules.sitemaps, value)
+			}
+		}
+	}
+	var chosen *robotsGroup
+	for _, g := range groups {
+		for _, agent := range g.agents {
+			if agent == robotsAgent {
+				chosen = g
+			} else if agent == "*" && chosen == nil {
+				chosen = g
+			}
+		}
+	}
+	if chosen != nil {
+		rules.rules, rules.crawlDelay = chosen.rules, chosen.delay
+	}
+	return rules
+}
+
+// robotsPath — путь с запросом, как его сравнивает robots.txt.
+func robotsPath(u *url.URL) string {
+	p := u.EscapedPath()
+	if p == "" {
+		p = "/"
+	}
+	if u.RawQuery != "" {
+		p += "?" + u.RawQuery
+	}
+	return p
+}
+
+// Allowed сообщает, можно ли обходить адрес.
+func (r *robotsRules) Allowed(u *url.URL) bool {
+	path := robotsPath(u)
+	allowed, best := true, -1
+	for _, rule := range r.rules {
+		if !rule.pattern.MatchString(path) {
+			continue
+		}
+		if rule.length > best || (rule.length == best && rule.allow) {
+			allowed, best = rule.allow, rule.length
+		}
+	}
+	return allowed
+}
+
+// Clean вырезает из адреса параметры Clean-param, сохраняя порядок остальных.
+func (r *robotsRules) Clean(u *url.URL) {
+	if u.RawQuery == "" || len(r.cleanParams) == 0 {
+		return
+	}
+	path := u.EscapedPath()
+	drop := map[string]bool{}
+	for _, cp := range r.cleanParams {
+		if cp.path == nil || cp.path.MatchString(path) {
+			for name := range cp.params {
+				drop[name] = true
+			}
+		}
+	}
+	if len(drop) == 0 {
+		return
+	}
+	var kept []string
+	for _, pair := range strings.Split(u.RawQuery, "&") {
+		name, _, _ := strings.Cut(pair, "=")
+		if decoded, err := url.QueryUnescape(name); err == nil {
+			name = decoded
+		}
+		if !drop[name] {
+			kept = append(kept, pair)
+		}
+	}
+	u.RawQuery = strings.Join(kept, "&")
+}
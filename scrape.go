@@ -0,0 +1,1064 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chromedp/chromedp"
+)
+
+// scrapeOptions — разобранные параметры одного скрапинга. Заполняется из
+// query-параметров /scrape и из аргументов GraphQL-запроса.
+type scrapeOptions struct {
+	URL string
+
+	Content     bool
+	Format      string // text или markdown — формат content и article.text
+	HTML        bool
+	Article     bool // Основной текст без навигации и баннеров (в духе Readability)
+	Selectors   []selectorRule
+	Tables      bool
+	Forms       bool
+	Stats       bool   // Число слов, язык, доля текста в HTML (stats.go)
+	TablesCSV   bool   // tables_csv=true: к каждой таблице добавить CSV
+	Eval        string // JavaScript клиента; доступ проверяет checkEvalParam
+	Meta        bool
+	MetaAll     bool   // meta=all: дополнительно все meta-теги и <link rel>
+	Images      bool   // Перед сбором страница прокручивается для ленивой загрузки
+	Headings    int    // Собрать заголовки до этого уровня (headings.go); 0 — не собирать
+	Icons       string // true или best — иконки страницы (icons.go)
+	Feeds       string // true или items — RSS/Atom-ленты страницы (feeds.go)
+	Links       bool
+	LinksFilter linkFilter // Параметры links_filter, links_exclude, links_internal_only, links_ext
+
+	LinksContext       bool            // Добавлять к ссылкам окружающий текст, заголовок и раздел
+	LinksStripTracking bool            // Удалять utm_*, gclid и прочие трекинговые параметры
+	LinksStripParams   map[string]bool // Дополнительные параметры для удаления в этом запросе
+	LinksDedupe        bool            // Оставить одну ссылку на абсолютный адрес
+
+	MaxLinks    int // Прекратить сбор после стольких ссылок (0 — без ограничения)
+	LinksOffset int // Страница ссылок: пропустить первые LinksOffset
+	LinksLimit  int // и вернуть не больше LinksLimit (0 — все остальные)
+
+	FAQ        bool
+	HowTo      bool
+	Pagination bool
+	Structured bool
+
+	Hash         bool   // hash=true: хэш основного текста (hash.go)
+	PreviousHash string // Прежний hash: без изменений — короткий ответ
+
+	Consent bool
+	Popups  bool
+
+	Hover     []string      // Селекторы, на элементы которых наводится курсор перед сбором
+	HoverWait time.Duration // Пауза после каждого наведения
+
+	Actions []pageAction // Сценарий действий перед сбором
+
+	Scroll      bool
+	ScrollSteps int           // 0 — scroll=auto, до исчерпания ленты
+	ScrollDelay time.Duration // Пауза после каждой прокрутки
+
+	Visual bool // Сохранить PNG-снимок страницы в хранилище для /visual-diff
+
+	Screenshot        string // full или viewport; пусто — без скриншота
+	ScreenshotFormat  string
+	ScreenshotQuality int
+
+	PDF   *pdfOptions // pdf=true: напечатать страницу в PDF (pdf.go)
+	MHTML string      // true или store — архив страницы (mhtml.go)
+	HAR   bool        // Записать сетевые запросы в HAR 1.2 (har.go)
+
+	Console   bool             // Собрать сообщения консоли и исключения страницы (pageconsole.go)
+	Intercept []*regexp.Regexp // Шаблоны адресов XHR/fetch, ответы которых вернуть (intercept.go)
+
+	Media       string
+	ColorScheme string
+	Network     string
+	CPUSlowdown float64
+
+	Timeout  time.Duration // Ограничение на весь скрапинг со всеми повторами; 0 — без ограничения
+	deadline time.Time     // Срок, вычисленный из Timeout в scrapeWithRetries
+	Proxy    *proxyConfig  // Прокси этого запроса; nil — общий (PROXY_URL) или без прокси
+
+	Retries      int           // Повторы при временных сбоях (retry.go)
+	RetryBackoff time.Duration // Пауза перед первым повтором, дальше удваивается
+
+	Profile string // desktop, mobile или random — согласованные UA, client hints и экран
+	Device  string // Конкретное устройство из devicePresets (iphone14, pixel7, ipad...)
+
+	Geolocation *geoPoint // Координаты для navigator.geolocation
+	Locale      string    // BCP 47, например de-DE: Intl, navigator.language и Accept-Language
+	Timezone    string    // IANA, например Europe/Berlin
+
+	Stealth bool // Подключить маскировку автоматизации (stealth.go); по умолчанию — флаг -stealth
+
+	trace context.Context // Контекст со спаном HTTP-запроса (tracing.go); nil — трасса начинается здесь
+
+	UserAgent string
+	Headers   map[string]string // Дополнительные заголовки запросов вкладки
+	Block     []string          // Категории ресурсов, которые не загружать (blocking.go)
+
+	BlockDomains []string // Дополнительные записи списка блокировки
+	AllowDomains []string // Записи, исключаемые из общего списка блокировки
+
+	Session       string   // Имя сессии (/sessions): вкладка открывается в её BrowserContext
+	Cookies       []Cookie // Выставить до навигации; вне сессии вкладка изолируется
+	ReturnCookies bool
+
+	CacheTTL time.Duration // Сколько годен результат в кэше; 0 — CACHE_TTL
+	NoCache  bool          // Не брать результат из кэша
+
+	WaitFor     string        // Селектор, видимости которого ждать перед сбором
+	WaitTimeout time.Duration // Сколько ждать WaitFor и тишины в сети
+	Wait        string        // networkidle — ждать тишины в сети перед сбором
+	WaitIdle    time.Duration // Сколько должна длиться тишина
+}
+
+// parseScrapeOptions проверяет параметры запроса. Ошибка содержит текст,
+// пригодный для отдачи клиенту с кодом 400.
+func parseScrapeOptions(q url.Values) (*scrapeOptions, error) {
+	opts := &scrapeOptions{
+		URL:     q.Get("url"),
+		Content: q.Has("content"),
+		HTML:    q.Has("html"),
+		Format:  q.Get("format"),
+		Article: q.Has("article"),
+		Tables:  q.Has("tables"),
+		Forms:   q.Has("forms"),
+		Stats:   q.Has("stats"),
+		Hash:    q.Has("hash") || q.Has("previous_hash"),
+		Meta:    q.Has("meta"),
+		MetaAll: q.Get("meta") == "all" || q.Get("meta_all") == "true",
+		Links:   q.Has("links"),
+		Images:  q.Has("images"),
+
+		LinksContext:       q.Has("links_context"),
+		TablesCSV:          q.Get("tables_csv") == "true" || q.Get("tables_csv") == "1",
+		LinksStripTracking: q.Has("links_strip_tracking"),
+		LinksDedupe:        q.Get("links_dedupe") == "true" || q.Get("links_dedupe") == "1",
+		FAQ:                q.Has("faq"),
+		HowTo:              q.Has("howto"),
+		Pagination:         q.Has("pagination"),
+		Structured:         q.Has("structured"),
+		Consent:            q.Has("consent"),
+		Popups:             q.Has("popups"),
+		Visual:             q.Has("visual"),
+		HAR:                q.Has("har"),
+		Console:            q.Has("console"),
+		Media:              q.Get("media"),
+		ColorScheme:        q.Get("color_scheme"),
+		Network:            q.Get("network"),
+		Hover:              q["hover"],
+		HoverWait:          500 * time.Millisecond,
+		Eval:               q.Get("eval"),
+		WaitFor:            q.Get("wait_for"),
+		WaitTimeout:        defaultWaitTimeout,
+		Wait:               q.Get("wait"),
+		WaitIdle:           defaultNetworkIdle,
+		ScrollDelay:        defaultScrollDelay,
+		RetryBackoff:       defaultRetryBackoff,
+		Stealth:            stealthEnabled,
+	}
+	if opts.URL == "" {
+		return nil, errors.New("Параметр 'url' обязателен")
+	}
+	if err := checkTargetURL(opts.URL); err != nil {
+		return nil, err
+	}
+	if raw := q.Get("selectors"); raw != "" {
+		rules, err := parseSelectorRules(raw)
+		if err != nil {
+			return nil, err
+		}
+		opts.Selectors = rules
+	}
+	if q.Has("headings") {
+		headings, err := parseHeadingsParam(q.Get("headings"))
+		if err != nil {
+			return nil, err
+		}
+		opts.Headings = headings
+	}
+	if q.Has("icons") {
+		// ?icons и fields=icons — режим по умолчанию.
+		opts.Icons = q.Get("icons")
+		if opts.Icons == "" {
+			opts.Icons = "true"
+		}
+		if !validIconModes[opts.Icons] {
+			return nil, errors.New("Параметр 'icons' может принимать значения: true, best")
+		}
+	}
+	if q.Has("feeds") {
+		// ?feeds и fields=feeds — режим по умолчанию.
+		opts.Feeds = q.Get("feeds")
+		if opts.Feeds == "" {
+			opts.Feeds = "true"
+		}
+		if !validFeedModes[opts.Feeds] {
+			return nil, errors.New("Параметр 'feeds' может принимать значения: true, items")
+		}
+	}
+	if opts.Format != "" && !validContentFormats[opts.Format] {
+		return nil, errors.New("Параметр 'format' может принимать значения: text, markdown")
+	}
+	if raw := q.Get("links_filter"); raw != "" {
+		re, err := regexp.Compile(raw)
+		if err != nil {
+			return nil, errors.New("Параметр 'links_filter' должен быть корректным регулярным выражением")
+		}
+		opts.LinksFilter.Include = re
+	}
+	if raw := q.Get("links_exclude"); raw != "" {
+		re, err := regexp.Compile(raw)
+		if err != nil {
+			return nil, errors.New("Параметр 'links_exclude' должен быть корректным регулярным выражением")
+		}
+		opts.LinksFilter.Exclude = re
+	}
+	opts.LinksFilter.InternalOnly = q.Get("links_internal_only") == "true" || q.Get("links_internal_only") == "1"
+	if raw := q.Get("links_ext"); raw != "" {
+		opts.LinksFilter.Extensions = parseExtList(raw)
+	}
+	if raw := q.Get("links_exclude_ext"); raw != "" {
+		opts.LinksFilter.ExcludeExt = parseExtList(raw)
+	}
+	if raw := q.Get("links_strip_params"); raw != "" {
+		opts.LinksStripTracking = true
+		opts.LinksStripParams = map[string]bool{}
+		for _, name := range strings.Split(raw, ",") {
+			if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+				opts.LinksStripParams[name] = true
+			}
+		}
+	}
+	for _, p := range []struct {
+		name string
+		dst  *int
+	}{{"max_links", &opts.MaxLinks}, {"links_offset", &opts.LinksOffset}, {"links_limit", &opts.LinksLimit}} {
+		if raw := q.Get(p.name); raw != "" {
+			v, err := strconv.Atoi(raw)
+			if err != nil || v < 0 {
+				return nil, fmt.Errorf("Параметр '%s' должен быть неотрицательным целым числом", p.name)
+			}
+			*p.dst = v
+		}
+	}
+	if raw := q.Get("hover_wait"); raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil || v < 0 || v > 10000 {
+			return nil, errors.New("Параметр 'hover_wait' должен быть числом миллисекунд от 0 до 10000")
+		}
+		opts.HoverWait = time.Duration(v) * time.Millisecond
+	}
+	if q.Has("screenshot") {
+		opts.Screenshot = q.Get("screenshot")
+		if opts.Screenshot == "" || opts.Screenshot == "true" || opts.Screenshot == "1" {
+			opts.Screenshot = "full"
+		}
+		if !validScreenshotModes[opts.Screenshot] {
+			return nil, errors.New("Параметр 'screenshot' может принимать значения: full, viewport")
+		}
+		opts.ScreenshotFormat = q.Get("screenshot_format")
+		if opts.ScreenshotFormat == "" {
+			opts.ScreenshotFormat = "png"
+		}
+		if !validScreenshotFormats[opts.ScreenshotFormat] {
+			return nil, errors.New("Параметр 'screenshot_format' может принимать значения: png, jpeg")
+		}
+		opts.ScreenshotQuality = defaultJPEGQuality
+		if raw := q.Get("screenshot_quality"); raw != "" {
+			v, err := strconv.Atoi(raw)
+			if err != nil || v < 1 || v > 100 {
+				return nil, errors.New("Параметр 'screenshot_quality' должен быть числом от 1 до 100")
+			}
+			opts.ScreenshotQuality = v
+		}
+	}
+	if q.Has("pdf") {
+		pdf, err := parsePDFOptions(q)
+		if err != nil {
+			return nil, err
+		}
+		opts.PDF = pdf
+	}
+	if q.Has("intercept") {
+		patterns, err := parseInterceptPatterns(q["intercept"])
+		if err != nil {
+			return nil, err
+		}
+		opts.Intercept = patterns
+	}
+	if q.Has("mhtml") {
+		opts.MHTML = q.Get("mhtml")
+		if opts.MHTML == "" || opts.MHTML == "1" {
+			opts.MHTML = "true"
+		}
+		if !validMHTMLModes[opts.MHTML] {
+			return nil, errors.New("Параметр 'mhtml' может принимать значения: true, store")
+		}
+		if opts.MHTML == "store" && resultStore == nil {
+			return nil, errors.New("Параметр 'mhtml=store' требует включённого хранилища (STORAGE_DIR)")
+		}
+	}
+	if opts.Visual && resultStore == nil {
+		return nil, errors.New("Параметр 'visual' требует включённого хранилища (STORAGE_DIR)")
+	}
+	if opts.Media != "" && !validMediaTypes[opts.Media] {
+		return nil, errors.New("Параметр 'media' может принимать значения: print, screen")
+	}
+	if opts.ColorScheme != "" && !validColorSchemes[opts.ColorScheme] {
+		return nil, errors.New("Параметр 'color_scheme' может принимать значения: dark, light")
+	}
+	if _, ok := networkProfiles[opts.Network]; opts.Network != "" && !ok {
+		return nil, errors.New("Параметр 'network' может принимать значения: slow3g, fast3g, offline")
+	}
+	if raw := q.Get("cpu_slowdown"); raw != "" {
+		v, err := strconv.ParseFloat(raw, 64)
+		if err != nil || v < 1 || v > 20 {
+			return nil, errors.New("Параметр 'cpu_slowdown' должен быть числом от 1 до 20")
+		}
+		opts.CPUSlowdown = v
+	}
+	if raw := q.Get("wait_timeout"); raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil || v < 1 || v > int(maxWaitTimeout/time.Millisecond) {
+			return nil, fmt.Errorf("Параметр 'wait_timeout' должен быть числом миллисекунд от 1 до %d", maxWaitTimeout/time.Millisecond)
+		}
+		opts.WaitTimeout = time.Duration(v) * time.Millisecond
+	}
+	if raw := q.Get("actions"); raw != "" {
+		actions, err := parsePageActions(raw)
+		if err != nil {
+			return nil, err
+		}
+		opts.Actions = actions
+	}
+	if raw := q.Get("scroll"); raw != "" {
+		opts.Scroll = true
+		if raw != "auto" {
+			v, err := strconv.Atoi(raw)
+			if err != nil || v < 1 || v > maxScrollSteps {
+				return nil, fmt.Errorf("Параметр 'scroll' должен быть числом от 1 до %d или auto", maxScrollSteps)
+			}
+			opts.ScrollSteps = v
+		}
+	}
+	if raw := q.Get("scroll_delay"); raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil || v < 0 || v > int(maxScrollDelay/time.Millisecond) {
+			return nil, fmt.Errorf("Параметр 'scroll_delay' должен быть числом миллисекунд от 0 до %d", maxScrollDelay/time.Millisecond)
+		}
+		opts.ScrollDelay = time.Duration(v) * time.Millisecond
+	}
+	if opts.Wait != "" && !validWaitStrategies[opts.Wait] {
+		return nil, errors.New("Параметр 'wait' может принимать значения: networkidle")
+	}
+	if raw := q.Get("wait_idle"); raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil || v < 1 || v > int(maxNetworkIdle/time.Millisecond) {
+			return nil, fmt.Errorf("Параметр 'wait_idle' должен быть числом миллисекунд от 1 до %d", maxNetworkIdle/time.Millisecond)
+		}
+		opts.WaitIdle = time.Duration(v) * time.Millisecond
+	}
+	opts.Profile = q.Get("profile")
+	if opts.Profile != "" && !validProfiles[opts.Profile] {
+		return nil, errors.New("Параметр 'profile' может принимать значения: desktop, mobile, random")
+	}
+	opts.Device = q.Get("device")
+	if _, ok := devicePresets[opts.Device]; opts.Device != "" && !ok {
+		return nil, fmt.Errorf("Параметр 'device' может принимать значения: %s", deviceNames())
+	}
+	if opts.Device != "" && opts.Profile != "" {
+		return nil, errors.New("Параметры 'profile' и 'device' нельзя указывать вместе")
+	}
+	opts.UserAgent = q.Get("user_agent")
+	if raw := q.Get("headers"); raw != "" {
+		headers, err := parseRequestHeaders(raw)
+		if err != nil {
+			return nil, err
+		}
+		opts.Headers = headers
+	}
+	if raw := q.Get("geolocation"); raw != "" {
+		g, err := parseGeolocation(raw)
+		if err != nil {
+			return nil, err
+		}
+		opts.Geolocation = g
+	}
+	opts.Locale = q.Get("locale")
+	if opts.Locale != "" {
+		if !localePattern.MatchString(opts.Locale) {
+			return nil, errors.New("Параметр 'locale' должен быть тегом языка, например de-DE")
+		}
+		// Явный Accept-Language из headers важнее.
+		if opts.Headers["Accept-Language"] == "" {
+			if opts.Headers == nil {
+				opts.Headers = map[string]string{}
+			}
+			opts.Headers["Accept-Language"] = acceptLanguageFor(opts.Locale)
+		}
+	}
+	opts.Timezone = q.Get("timezone")
+	if opts.Timezone != "" {
+		if _, err := time.LoadLocation(opts.Timezone); err != nil || opts.Timezone == "Local" {
+			return nil, errors.New("Параметр 'timezone' должен быть часовым поясом IANA, например Europe/Berlin")
+		}
+	}
+	switch q.Get("stealth") {
+	case "":
+	case "true":
+		opts.Stealth = true
+	case "false":
+		opts.Stealth = false
+	default:
+		return nil, errors.New("Параметр 'stealth' может принимать значения: true, false")
+	}
+	if raw := q.Get("previous_hash"); raw != "" {
+		raw = strings.ToLower(raw)
+		if !isArtifactID(raw) {
+			return nil, errors.New("Параметр 'previous_hash' должен быть значением hash: SHA-256 в шестнадцатеричной записи")
+		}
+		opts.PreviousHash = raw
+	}
+	opts.Session = q.Get("session")
+	if opts.Session != "" && !validSessionName.MatchString(opts.Session) {
+		return nil, errors.New("Параметр 'session' может содержать латиницу, цифры, _ . - (до 64 символов)")
+	}
+	if raw := q.Get("cookies"); raw != "" {
+		cookies, err := parseRequestCookies(raw)
+		if err != nil {
+			return nil, err
+		}
+		opts.Cookies = cookies
+	}
+	opts.ReturnCookies = q.Get("return_cookies") == "true" || q.Get("return_cookies") == "1"
+	if raw := q.Get("block"); raw != "" {
+		block, ok := parseBlockParam(raw)
+		if !ok {
+			return nil, errors.New("Параметр 'block' может принимать значения: " + validBlockCategories)
+		}
+		opts.Block = block
+	}
+	opts.BlockDomains = parseDomainList(q.Get("block_domains"))
+	opts.AllowDomains = parseDomainList(q.Get("allow_domains"))
+	if raw := q.Get("proxy"); raw != "" {
+		proxy, err := parseRequestProxy(raw)
+		if err != nil {
+			return nil, err
+		}
+		opts.Proxy = proxy
+	}
+	if raw := q.Get("timeout"); raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil || v < 1 || v > 300 {
+			return nil, errors.New("Параметр 'timeout' должен быть числом от 1 до 300")
+		}
+		opts.Timeout = time.Duration(v) * time.Second
+	}
+	if raw := q.Get("retries"); raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil || v < 0 || v > maxRetries {
+			return nil, fmt.Errorf("Параметр 'retries' должен быть числом от 0 до %d", maxRetries)
+		}
+		opts.Retries = v
+	}
+	if raw := q.Get("retry_backoff"); raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil || v < 1 || v > int(maxRetryBackoff/time.Millisecond) {
+			return nil, fmt.Errorf("Параметр 'retry_backoff' должен быть числом миллисекунд от 1 до %d", maxRetryBackoff/time.Millisecond)
+		}
+		opts.RetryBackoff = time.Duration(v) * time.Millisecond
+	}
+	if raw := q.Get("cache_ttl"); raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil || v < 1 || v > int(maxCacheTTL/time.Second) {
+			return nil, fmt.Errorf("Параметр 'cache_ttl' должен быть числом от 1 до %d", int(maxCacheTTL/time.Second))
+		}
+		opts.CacheTTL = time.Duration(v) * time.Second
+	}
+	opts.NoCache = q.Get("no_cache") == "true" || q.Get("no_cache") == "1"
+	return opts, nil
+}
+
+// performScrape открывает вкладку в постоянном браузере и выполняет все
+// запрошенные задачи. save сохраняет результат в хранилище; его вызывает
+// scrapeWithRetries только для последней попытки.
+func performScrape(opts *scrapeOptions) (_ *Response, save func(), err error) {
+	start := time.Now()
+	defer func() { observeScrape(time.Since(start)) }()
+	traceCtx, span := startSpan(opts.trace, "scrape")
+	span.SetAttr("url.full", opts.URL)
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+	var (
+		tabCtx    context.Context
+		cancelTab context.CancelFunc
+		proxy     = opts.Proxy
+		pooled    *poolProxy
+	)
+	if opts.Session != "" {
+		var err error
+		tabCtx, cancelTab, proxy, err = sessionTab(opts.trace, opts.Session, clusterMode == "worker")
+		if err != nil {
+			return nil, nil, err
+		}
+	} else {
+		if proxy == nil && proxyPool != nil {
+			pooled = proxyPool.Pick(opts.URL)
+			proxy = pooled.cfg
+		}
+		tabCtx, cancelTab = newScrapeTab(opts.trace, proxy, len(opts.Cookies) > 0)
+	}
+	defer cancelTab()
+	tabCtx, cancelCrashWatch := watchTabCrash(tabCtx)
+	defer cancelCrashWatch()
+	if !opts.deadline.IsZero() {
+		var cancelTimeout context.CancelFunc
+		tabCtx, cancelTimeout = context.WithDeadline(tabCtx, opts.deadline)
+		defer cancelTimeout()
+	} else if opts.Timeout > 0 {
+		var cancelTimeout context.CancelFunc
+		tabCtx, cancelTimeout = context.WithTimeout(tabCtx, opts.Timeout)
+		defer cancelTimeout()
+	}
+	// Записи шагов в логе получают request_id из контекста вкладки.
+	tabCtx = withRequestID(tabCtx, opts.trace)
+
+	var response Response
+
+	// --- Настройка вкладки до навигации ---
+	var setup chromedp.Tasks
+	if proxy == nil {
+		proxy = globalProxy
+	}
+	// Вкладка сессии получила скрипт при создании; повторно не подключаем.
+	if opts.Stealth && opts.Session == "" {
+		setup = append(setup, applyStealth())
+	}
+	setup = append(setup, interceptRequests(proxy, opts.Block, domainBlocklist(opts.URL, opts.BlockDomains, opts.AllowDomains)))
+	if len(opts.Cookies) > 0 {
+		setup = append(setup, setCookies(opts.Cookies, opts.URL))
+	}
+	if opts.Profile != "" {
+		setup = append(setup, applyProfile(pickProfile(opts.Profile), opts.Headers["Accept-Language"]))
+	}
+	if opts.Device != "" {
+		setup = append(setup, applyProfile(devicePresets[opts.Device], opts.Headers["Accept-Language"]))
+	}
+	if opts.UserAgent != "" || len(opts.Headers) > 0 {
+		setup = append(setup, overrideHeaders(opts.UserAgent, opts.Headers))
+	}
+	if opts.Locale != "" || opts.Timezone != "" {
+		overrideUA := opts.Profile == "" && opts.Device == "" && opts.UserAgent == ""
+		setup = append(setup, emulateLocale(opts.Locale, opts.Timezone, overrideUA))
+	}
+	if opts.Geolocation != nil {
+		setup = append(setup, emulateGeolocation(opts.Geolocation, opts.URL))
+	}
+	if opts.Media != "" || opts.ColorScheme != "" {
+		setup = append(setup, emulateMedia(opts.Media, opts.ColorScheme))
+	}
+	if opts.Network != "" {
+		setup = append(setup, emulateNetwork(opts.Network))
+	}
+	if opts.CPUSlowdown > 1 {
+		setup = append(setup, emulateCPU(opts.CPUSlowdown))
+	}
+	if err := chromedp.Run(tabCtx, tracedAction(traceCtx, "setup", setup)); err != nil {
+		slog.WarnContext(tabCtx, "Ошибка настройки вкладки", "url", opts.URL, "error", err.Error())
+		return nil, nil, tabError(tabCtx, err)
+	}
+
+	var netTracker *networkTracker
+	if opts.Wait == "networkidle" {
+		netTracker = trackNetwork(tabCtx)
+	}
+
+	redirects := trackRedirects(tabCtx)
+	var har *harRecorder
+	if opts.HAR {
+		har = recordHAR(tabCtx)
+	}
+	var console *consoleRecorder
+	if opts.Console {
+		console = recordConsole(tabCtx)
+	}
+	var intercepted *interceptRecorder
+	if len(opts.Intercept) > 0 {
+		intercepted = recordIntercepted(tabCtx, opts.Intercept)
+	}
+
+	// Навигацию выполняем отдельно, чтобы получить ответ документа (статус, заголовки).
+	slog.InfoContext(tabCtx, "Шаг [0]: открываю страницу", "url", opts.URL)
+	_, navSpan := startSpan(traceCtx, "navigate")
+	navResp, err := navigateRespectingRetryAfter(tabCtx, opts.URL)
+	if navResp != nil {
+		navSpan.SetAttr("http.response.status_code", navResp.Status)
+	}
+	navSpan.RecordError(err)
+	navSpan.End()
+	// Без встроенного просмотрщика Chrome отдаёт PDF на скачивание и
+	// прерывает навигацию; такой документ загружаем сами.
+	var pdfDocument []byte
+	if isAbortedNavigation(err) {
+		if data, ok := loadPDF(tabCtx, opts.URL); ok {
+			pdfDocument, err = data, nil
+		}
+	}
+	if pooled != nil {
+		var status int64
+		if navResp != nil {
+			status = navResp.Status
+		}
+		proxyPool.Report(pooled, err, status)
+	}
+	if err != nil {
+		err = tabError(tabCtx, err)
+		slog.WarnContext(tabCtx, "Ошибка навигации", "url", opts.URL, "error", err.Error())
+		observeNavigationFailure(err)
+		return nil, nil, err
+	}
+	// Относительные ссылки разрешаем от итогового адреса (после редиректов).
+	finalURL := opts.URL
+	if navResp != nil && navResp.URL != "" {
+		finalURL = navResp.URL
+	}
+	if err := checkTargetURL(finalURL); err != nil {
+		slog.WarnContext(tabCtx, "Переадресация на запрещённый адрес", "url", opts.URL, "final_url", finalURL, "error", err.Error())
+		return nil, nil, err
+	}
+	baseURL, _ := url.Parse(finalURL)
+	response.FinalURL = finalURL
+	response.Redirects = redirects.Chain()
+	var robotsHeader string
+	if navResp != nil {
+		response.Status = navResp.Status
+		robotsHeader = headerValue(navResp.Headers, "X-Robots-Tag")
+	}
+	if len(response.Redirects) > 0 {
+		slog.InfoContext(tabCtx, "Шаг [0]: переадресации", "redirects", len(response.Redirects), "final_url", finalURL, "status", response.Status)
+	}
+	if pdfDocument == nil && navResp != nil && navResp.MimeType == "application/pdf" {
+		if data, ok := loadPDF(tabCtx, finalURL); ok {
+			pdfDocument = data
+		}
+	}
+	if pdfDocument != nil {
+		if response.Status == 0 {
+			response.Status = http.StatusOK
+		}
+		if err := applyPDFDocument(tabCtx, opts, &response, pdfDocument); err != nil {
+			return nil, nil, err
+		}
+		return &response, func() { saveScrapeResult(tabCtx, opts.URL, response, nil) }, nil
+	}
+
+	var (
+		tasks  chromedp.Tasks
+		queued []string // Имена задач для лога
+	)
+	tasks = append(tasks, tracedAction(traceCtx, "wait", chromedp.WaitVisible(`body`, chromedp.ByQuery)))
+	tasks = append(tasks, tracedAction(traceCtx, "captcha-check", detectAndPauseOnCaptcha(opts.URL, opts.Session, response.Status)))
+	if opts.WaitFor != "" {
+		tasks = append(tasks, tracedAction(traceCtx, "wait", waitForSelector(opts.WaitFor, opts.WaitTimeout)))
+	}
+	if netTracker != nil {
+		tasks = append(tasks, tracedAction(traceCtx, "wait", waitNetworkIdle(netTracker, opts.WaitIdle, opts.WaitTimeout)))
+	}
+	// Действия со страницей и извлечение попадают в спаны interact и extract.
+	interactFrom := len(tasks)
+
+	if opts.Consent {
+		queued = append(queued, "consent")
+		tasks = append(tasks, dismissCookieConsent())
+	}
+
+	if opts.Popups {
+		queued = append(queued, "popups")
+		tasks = append(tasks, dismissPopups())
+	}
+
+	if len(opts.Hover) > 0 {
+		queued = append(queued, "hover")
+		tasks = append(tasks, hoverElements(opts.Hover, opts.HoverWait))
+	}
+
+	if len(opts.Actions) > 0 {
+		queued = append(queued, "actions: "+describeActions(opts.Actions))
+		tasks = append(tasks, runPageActions(opts.Actions))
+	}
+
+	if opts.Scroll {
+		tasks = append(tasks, scrollPage(opts.ScrollSteps, opts.ScrollDelay))
+	}
+
+	if opts.Images {
+		tasks = append(tasks, triggerLazyLoad())
+	}
+
+	// --- Временные переменные для безопасного сбора данных ---
+	var (
+		content      string
+		markdown     string
+		html         string
+		article      Article
+		selected     map[string]any
+		tables       []tableCells
+		forms        []Form
+		stats        statsResult
+		evalResult   []byte
+		meta         Meta
+		descOK       bool // Флаг, что description найден
+		keysOK       bool // Флаг, что keywords найден
+		metaAll      metaAllResult
+		social       SocialMeta
+		seoLinks     seoLinksResult
+		linkItems    []linkItem
+		linkContexts []linkContextItem
+		faqData      faqResult
+		pagination   paginationCandidates
+		structured   []string
+		images       []Image
+		headings     []Heading
+		screenshot   []byte
+		userShot     []byte
+		pdfData      []byte
+		mhtml        string
+	)
+
+	extractFrom := len(tasks)
+	// --- Динамически строим ПЛОСКИЙ список задач ---
+	// Текст body собираем всегда: по нему считается content_hash.
+	if opts.Content {
+		queued = append(queued, "content")
+	}
+	tasks = append(tasks, chromedp.Text(`body`, &content, chromedp.ByQuery))
+	if opts.Content && opts.Format == "markdown" {
+		tasks = append(tasks, chromedp.Evaluate(markdownScript, &markdown))
+	}
+
+	if opts.HTML {
+		queued = append(queued, "html")
+		tasks = append(tasks, chromedp.OuterHTML(`html`, &html, chromedp.ByQuery))
+	}
+
+	if opts.Meta {
+		queued = append(queued, "meta")
+		tasks = append(tasks,
+			chromedp.Title(&meta.Title),
+			// !!! ГЛАВНОЕ ИСПРАВЛЕНИЕ: Передаем указатели на `descOK` и `keysOK` !!!
+			// Это делает поиск НЕБЛОКИРУЮЩИМ. Если тега нет, `ok` станет `false`, и мы пойдем дальше.
+			chromedp.AttributeValue(`meta[name="description"]`, "content", &meta.Description, &descOK, chromedp.ByQuery),
+			chromedp.AttributeValue(`meta[name="keywords"]`, "content", &meta.Keywords, &keysOK, chromedp.ByQuery),
+			chromedp.Evaluate(socialScript, &social),
+			chromedp.Evaluate(seoLinksScript, &seoLinks),
+		)
+		if opts.MetaAll {
+			tasks = append(tasks, chromedp.Evaluate(metaAllScript, &metaAll))
+		}
+	}
+
+	if opts.Links {
+		queued = append(queued, "links")
+		tasks = append(tasks, chromedp.Evaluate(linksScript, &linkItems))
+		if opts.LinksContext {
+			tasks = append(tasks, chromedp.Evaluate(linkContextScript, &linkContexts))
+		}
+	}
+
+	if opts.FAQ || opts.HowTo {
+		queued = append(queued, "faq")
+		tasks = append(tasks, chromedp.Evaluate(faqScript, &faqData))
+	}
+
+	if opts.Pagination {
+		queued = append(queued, "pagination")
+		tasks = append(tasks, chromedp.Evaluate(paginationScript, &pagination))
+	}
+
+	if opts.Article {
+		queued = append(queued, "article")
+	}
+	// Для hash статья нужна, даже если её не просили.
+	if opts.Article || opts.Hash {
+		tasks = append(tasks, chromedp.Evaluate(articleScript, &article))
+	}
+
+	if len(opts.Selectors) > 0 {
+		queued = append(queued, "selectors")
+		tasks = append(tasks, chromedp.Evaluate(selectorsExpression(opts.Selectors), &selected))
+	}
+
+	if opts.Tables {
+		queued = append(queued, "tables")
+		tasks = append(tasks, chromedp.Evaluate(tablesScript, &tables))
+	}
+
+	if opts.Forms {
+		queued = append(queued, "forms")
+		tasks = append(tasks, chromedp.Evaluate(formsScript, &forms))
+	}
+
+	if opts.Stats {
+		queued = append(queued, "stats")
+		tasks = append(tasks, chromedp.Evaluate(statsScript, &stats))
+	}
+
+	if opts.Eval != "" {
+		tasks = append(tasks, evaluateUserScript(opts.Eval, &evalResult, &response.EvalError))
+	}
+
+	if opts.Images {
+		queued = append(queued, "images")
+		tasks = append(tasks, chromedp.Evaluate(imagesScript, &images))
+	}
+
+	if opts.Headings > 0 {
+		queued = append(queued, "headings")
+		tasks = append(tasks, chromedp.Evaluate(headingsExpression(opts.Headings), &headings))
+	}
+
+	if opts.Icons != "" {
+		queued = append(queued, "icons")
+		tasks = append(tasks, collectIcons(finalURL, opts.Icons == "best", &response.Icons, &response.Icon))
+	}
+
+	if opts.Feeds != "" {
+		queued = append(queued, "feeds")
+		tasks = append(tasks, collectFeeds(opts.Feeds == "items", &response.Feeds))
+	}
+
+	if opts.Structured {
+		queued = append(queued, "structured")
+		tasks = append(tasks, chromedp.Evaluate(structuredScript, &structured))
+	}
+
+	if opts.Visual {
+		queued = append(queued, "visual")
+		// Качество 100 даёт PNG без потерь — JPEG-артефакты давали бы ложные различия.
+		tasks = append(tasks, chromedp.FullScreenshot(&screenshot, 100))
+	}
+
+	if opts.ReturnCookies {
+		tasks = append(tasks, pageCookies(&response.PageCookies))
+	}
+
+	if opts.Screenshot != "" {
+		queued = append(queued, "screenshot")
+		tasks = append(tasks, captureScreenshot(opts.Screenshot, opts.ScreenshotFormat, opts.ScreenshotQuality, &userShot))
+	}
+
+	if opts.PDF != nil {
+		queued = append(queued, "pdf")
+		tasks = append(tasks, renderPDF(opts.PDF, &pdfData))
+	}
+
+	if opts.MHTML != "" {
+		queued = append(queued, "mhtml")
+		tasks = append(tasks, captureMHTML(&mhtml))
+	}
+
+	// --- Финальное действие: обработка всех собранных данных ---
+	tasks = append(tasks, chromedp.ActionFunc(func(ctx context.Context) error {
+		slog.InfoContext(ctx, "Шаг [2]: обрабатываю собранные данные")
+		response.ContentHash = contentHash(content)
+		response.Simhash = fmt.Sprintf("%016x", simhash(content))
+		if opts.Hash {
+			response.Hash = mainTextHash(article.Text, content)
+		}
+		if opts.Content {
+			response.Content = strings.TrimSpace(content)
+			if opts.Format == "markdown" {
+				response.Content = markdown
+			}
+		}
+		if opts.HTML {
+			response.HTML = html
+		}
+		if opts.Meta {
+			meta.All, meta.Links = metaAll.Tags, metaAll.Links
+			meta.Canonical, meta.Hreflang, meta.AMP = seoLinks.Canonical, seoLinks.Hreflang, seoLinks.AMP
+			meta.Next, meta.Prev = seoLinks.Next, seoLinks.Prev
+			meta.Robots = buildRobotsMeta(seoLinks.Robots, robotsHeader)
+			if social.OpenGraph != nil || social.Twitter != nil {
+				meta.Social = &social
+			}
+			response.Meta = &meta
+		}
+		if opts.FAQ {
+			response.FAQ = faqData.FAQ
+		}
+		if opts.HowTo {
+			response.HowTo = faqData.HowTo
+		}
+		if opts.Article {
+			if opts.Format == "markdown" {
+				if err := chromedp.Evaluate(htmlToMarkdownScript(article.HTML), &article.Text).Do(ctx); err != nil {
+					return err
+				}
+			}
+			response.Article = &article
+		}
+		if len(opts.Selectors) > 0 {
+			response.Selectors = selected
+		}
+		if opts.Tables {
+			response.Tables = buildTables(tables, opts.TablesCSV)
+		}
+		if opts.Forms {
+			response.Forms = forms
+		}
+		if opts.Stats {
+			response.Stats = contentStats(content, &stats)
+		}
+		if opts.Eval != "" && response.EvalError == "" {
+			response.Eval = evalResult
+		}
+		if opts.Images {
+			response.Images = images
+		}
+		if opts.Headings > 0 {
+			response.Headings = headings
+		}
+		if opts.Structured {
+			response.StructuredData = parseStructuredData(structured)
+		}
+		if opts.Pagination {
+			response.Pagination = detectPagination(finalURL, pagination)
+		}
+		if opts.Screenshot != "" {
+			response.Screenshot = &ScreenshotData{Mode: opts.Screenshot, Format: opts.ScreenshotFormat, Data: userShot}
+		}
+		if opts.PDF != nil {
+			response.PDF = pdfData
+		}
+		if har != nil {
+			response.HAR = har.HAR(finalURL)
+		}
+		if console != nil {
+			response.Console, response.ConsoleDropped = console.Messages()
+		}
+		if intercepted != nil {
+			response.Intercepted = intercepted.Responses()
+		}
+		switch opts.MHTML {
+		case "true":
+			response.MHTML = mhtml
+		case "store":
+			ref, err := storeMHTML(mhtml)
+			if err != nil {
+				return fmt.Errorf("не удалось сохранить архив MHTML: %w", err)
+			}
+			response.MHTMLArtifact = ref
+		}
+		if opts.Links {
+			seen := map[string]bool{}
+			total := 0
+			for i, item := range linkItems {
+				href := item.Href
+				// Контексты собраны отдельным скриптом в том же порядке документа;
+				// сверяем href на случай, если DOM успел измениться между запросами.
+				var linkCtx *LinkContext
+				if i < len(linkContexts) && linkContexts[i].Href == href {
+					linkCtx = &linkContexts[i].LinkContext
+				}
+				if href == "" || strings.HasPrefix(href, "#") || strings.HasPrefix(href, "javascript:") {
+					continue
+				}
+				linkAddr := linkURL(item, baseURL)
+				// После удаления трекинговых параметров разные href часто
+				// совпадают — такие дубликаты схлопываем.
+				if opts.LinksStripTracking {
+					href = stripTrackingParams(href, opts.LinksStripParams)
+					linkAddr = stripTrackingParams(linkAddr, opts.LinksStripParams)
+					if seen[href] {
+						continue
+					}
+					seen[href] = true
+				}
+				// links_dedupe: одна ссылка на адрес — первая в документе.
+				if opts.LinksDedupe && linkAddr != "" {
+					if seen["url "+linkAddr] {
+						continue
+					}
+					seen["url "+linkAddr] = true
+				}
+				if !opts.LinksFilter.Allow(href, baseURL) {
+					continue
+				}
+				if opts.MaxLinks > 0 && total >= opts.MaxLinks {
+					response.LinksTruncated = true
+					break
+				}
+				total++
+				if total <= opts.LinksOffset || (opts.LinksLimit > 0 && total > opts.LinksOffset+opts.LinksLimit) {
+					continue
+				}
+				response.Links = append(response.Links, Link{
+					Href:      href,
+					URL:       linkAddr,
+					Text:      item.Text,
+					Internal:  linkInternal(linkAddr, baseURL),
+					NoFollow:  slices.Contains(item.Rel, "nofollow"),
+					Sponsored: slices.Contains(item.Rel, "sponsored"),
+					UGC:       slices.Contains(item.Rel, "ugc"),
+					Target:    item.Target,
+					Visible:   item.Visible,
+					Context:   linkCtx,
+				})
+			}
+			response.LinksTotal = total
+		}
+		return nil
+	}))
+
+	if tracer != nil {
+		tasks = append(tasks[:interactFrom:interactFrom],
+			tracedAction(traceCtx, "interact", tasks[interactFrom:extractFrom]),
+			tracedAction(traceCtx, "extract", tasks[extractFrom:]))
+	}
+	slog.InfoContext(tabCtx, "Начинаю выполнение задач извлечения", "tasks", queued)
+	if err := chromedp.Run(tabCtx, tasks); err != nil {
+		slog.WarnContext(tabCtx, "Ошибка во время выполнения chromedp", "url", opts.URL, "error", err.Error())
+		return nil, nil, tabError(tabCtx, err)
+	}
+
+	slog.InfoContext(tabCtx, "Все задачи успешно выполнены")
+	return &response, func() { saveScrapeResult(tabCtx, opts.URL, response, screenshot) }, nil
+}
+
+// saveScrapeResult сохраняет результат в хранилище, если оно включено.
+func saveScrapeResult(ctx context.Context, pageURL string, response Response, screenshot []byte) {
+	if resultStore == nil {
+		return
+	}
+	// Скриншот, PDF, архив, HAR и иконка раздули бы каждую версию; для сравнения снимков есть visual.
+	// Куки — учётные данные клиента, в историю они не попадают.
+	response.Screenshot = nil
+	response.PDF = nil
+	response.MHTML = ""
+	response.HAR = nil
+	response.Icon = nil
+	response.PageCookies = nil
+	if rec, err := resultStore.Save(pageURL, response, screenshot); err != nil {
+		slog.WarnContext(ctx, "Не удалось сохранить результат в хранилище", "url", pageURL, "error", err.Error())
+	} else {
+		slog.InfoContext(ctx, "Результат сохранён в хранилище", "url", pageURL, "version", rec.ID)
+		resultIndex.Add(rec)
+	}
+}
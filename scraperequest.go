@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// POST /scrape принимает параметры JSON-документом вместо query-строки —
+// для длинных URL и структурных опций:
+//
+//	{"url": "https://...", "extract": ["content", "meta", "links"], "timeout": 30}
+//
+// extract перечисляет включаемые флаги. Остальные поля документа — те же
+// параметры, что и у GET: строки и числа передаются как есть, true включает
+// флаг (false — выключает), массив скаляров — повторяющийся параметр
+// (hover), объект и массив объектов (selectors, actions) — их JSON-запись.
+// Параметры query-строки POST-запроса тоже учитываются; поля тела имеют
+// приоритет. Дальше запрос обрабатывается так же, как GET.
+
+// maxScrapeBodySize ограничивает тело POST /scrape.
+const maxScrapeBodySize = 1 << 20
+
+const scrapeBodyExample = `{"url": "...", "extract": ["content", "meta", "links"]}`
+
+// scrapeQuery возвращает параметры скрапинга из query-строки или, для
+// POST с телом, из JSON-документа.
+func scrapeQuery(w http.ResponseWriter, r *http.Request) (url.Values, error) {
+	q := r.URL.Query()
+	if r.Method != http.MethodPost {
+		return q, nil
+	}
+	var doc map[string]any
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxScrapeBodySize))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("Тело запроса должно быть JSON вида %s", scrapeBodyExample)
+	}
+	for name, value := range doc {
+		if name == "extract" {
+			continue
+		}
+		values, err := bodyParamValues(value)
+		if err != nil {
+			return nil, fmt.Errorf("Поле '%s' тела запроса имеет неподдерживаемое значение", name)
+		}
+		if values == nil {
+			q.Del(name)
+			continue
+		}
+		q[name] = values
+	}
+	if raw, ok := doc["extract"]; ok {
+		list, ok := raw.([]any)
+		if !ok {
+			return nil, errors.New("Поле 'extract' тела запроса должно быть массивом строк")
+		}
+		for _, item := range list {
+			name, ok := item.(string)
+			if !ok || name == "" {
+				return nil, errors.New("Поле 'extract' тела запроса должно быть массивом строк")
+			}
+			if !q.Has(name) {
+				q.Set(name, "true")
+			}
+		}
+	}
+	return q, nil
+}
+
+// bodyParamValues переводит значение поля тела в значения параметра;
+// nil — параметр не задан.
+func bodyParamValues(value any) ([]string, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{v}, nil
+	case json.Number:
+		return []string{v.String()}, nil
+	case bool:
+		if !v {
+			return nil, nil
+		}
+		return []string{"true"}, nil
+	case []any:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			switch item := item.(type) {
+			case string:
+				values = append(values, item)
+			case json.Number:
+				values = append(values, item.String())
+			case bool:
+				values = append(values, strconv.FormatBool(item))
+			case map[string]any:
+				// Массив объектов (actions) передаётся JSON-записью целиком.
+				data, err := json.Marshal(v)
+				if err != nil {
+					return nil, err
+				}
+				return []string{string(data)}, nil
+			default:
+				return nil, errors.New("вложенные массивы не поддерживаются")
+			}
+		}
+		return values, nil
+	case map[string]any:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		return []string{string(data)}, nil
+	}
+	return nil, fmt.Errorf("неподдерживаемый тип %T", value)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/chromedp"
+)
+
+// ScreenshotData — снимок страницы в ответе. Data в JSON кодируется base64.
+type ScreenshotData struct {
+	Mode   string `json:"mode"`   // full или viewport
+	Format string `json:"format"` // png или jpeg
+	Data   []byte `json:"data"`
+}
+
+var (
+	validScreenshotModes   = map[string]bool{"full": true, "viewport": true}
+	validScreenshotFormats = map[string]bool{"png": true, "jpeg": true}
+)
+
+// defaultJPEGQuality — качество JPEG, если screenshot_quality не задан.
+const defaultJPEGQuality = 80
+
+// captureScreenshot снимает всю страницу (full) или видимую область (viewport).
+func captureScreenshot(mode, format string, quality int, res *[]byte) chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		slog.InfoContext(ctx, "Снимаю скриншот", "mode", mode, "format", format)
+		capture := page.CaptureScreenshot().WithFromSurface(true)
+		if mode == "full" {
+			capture = capture.WithCaptureBeyondViewport(true)
+		}
+		if format == "jpeg" {
+			capture = capture.WithFormat(page.CaptureScreenshotFormatJpeg).WithQuality(int64(quality))
+		} else {
+			capture = capture.WithFormat(page.CaptureScreenshotFormatPng)
+		}
+		var err error
+		*res, err = capture.Do(ctx)
+		return err
+	})
+}
+
+// screenshotHandler: GET /screenshot?url=&mode=full|viewport&format=png|jpeg&quality=
+// — тот же скрапинг, но ответом идёт само изображение. Остальные параметры
+// (consent, popups, hover, media и т. п.) работают как в /scrape.
+func screenshotHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	mode := q.Get("mode")
+	if mode == "" {
+		mode = "full"
+	}
+	q.Set("screenshot", mode)
+	for _, name := range []string{"format", "quality"} {
+		if q.Has(name) {
+			q.Set("screenshot_"+name, q.Get(name))
+			q.Del(name)
+		}
+	}
+	q.Del("mode")
+	if status, err := checkEvalParam(r, q); err != nil {
+		writeJsonError(w, err.Error(), status)
+		return
+	}
+	opts, err := parseScrapeOptions(q)
+	if err != nil {
+		writeJsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	opts.trace = r.Context()
+	response, cacheStatus, err := scrapeWithCache(q, opts)
+	if cacheStatus != "" {
+		w.Header().Set("X-Cache", cacheStatus)
+	}
+	if err != nil {
+		writeJsonError(w, "Не удалось выполнить скрапинг: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	shot := response.Screenshot
+	w.Header().Set("Content-Type", "image/"+shot.Format)
+	w.Header().Set("Content-Length", strconv.Itoa(len(shot.Data)))
+	w.Write(shot.Data)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/chromedp/chromedp"
+)
+
+// Бесконечная прокрутка: scroll=N прокручивает страницу вниз до N раз,
+// scroll=auto — пока после прокрутки появляется новое содержимое (высота
+// документа растёт), но не больше maxScrollSteps раз. После каждой
+// прокрутки ждём scroll_delay мс, пока лента догрузит элементы.
+
+const (
+	maxScrollSteps     = 50
+	defaultScrollDelay = time.Second
+	maxScrollDelay     = 10 * time.Second
+	// scrollStableChecks — сколько прокруток подряд без роста высоты
+	// означают конец ленты в режиме auto: одна может совпасть с медленным ответом.
+	scrollStableChecks = 2
+)
+
+// scrollToBottomScript прокручивает в конец и возвращает высоту документа.
+const scrollToBottomScript = `(() => {
+	window.scrollTo(0, document.documentElement.scrollHeight);
+	return document.documentElement.scrollHeight;
+})()`
+
+// scrollPage прокручивает ленту; steps == 0 — режим auto.
+func scrollPage(steps int, delay time.Duration) chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		auto := steps == 0
+		if auto {
+			steps = maxScrollSteps
+		}
+		slog.InfoContext(ctx, "Шаг [1.4]: прокручиваю ленту", "max_steps", steps, "auto", auto)
+		var lastHeight int64
+		stable := 0
+		for i := 0; i < steps; i++ {
+			var height int64
+			if err := chromedp.Evaluate(scrollToBottomScript, &height).Do(ctx); err != nil {
+				return err
+			}
+			if err := chromedp.Sleep(delay).Do(ctx); err != nil {
+				return err
+			}
+			if err := chromedp.Evaluate(`document.documentElement.scrollHeight`, &height).Do(ctx); err != nil {
+				return err
+			}
+			if height <= lastHeight {
+				stable++
+				if auto && stable >= scrollStableChecks {
+					slog.InfoContext(ctx, "Шаг [1.4]: новое содержимое не появляется", "scrolls", i+1)
+					break
+				}
+			} else {
+				stable = 0
+			}
+			lastHeight = height
+		}
+		return nil
+	})
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// SearchHit — одна найденная версия страницы.
+type SearchHit struct {
+	URL       string    `json:"url"`
+	VersionID string    `json:"version_id"`
+	ScrapedAt time.Time `json:"scraped_at"`
+	Score     int       `json:"score"`
+	Snippet   string    `json:"snippet"`
+}
+
+// SearchResponse — ответ /search.
+type SearchResponse struct {
+	Query string      `json:"query"`
+	Total int         `json:"total"`
+	Hits  []SearchHit `json:"hits"`
+}
+
+type searchDoc struct {
+	url       string
+	versionID string
+	scrapedAt time.Time
+	text      string
+}
+
+// searchIndex — простой инвертированный индекс в памяти по всем
+// сохранённым версиям. Строится при старте из хранилища и пополняется при Save.
+type searchIndex struct {
+	mu       sync.RWMutex
+	docs     map[string]*searchDoc
+	postings map[string]map[string]int // терм -> ключ документа -> частота
+}
+
+var resultIndex *searchIndex
+
+func newSearchIndex() *searchIndex {
+	return &searchIndex{docs: map[string]*searchDoc{}, postings: map[string]map[string]int{}}
+}
+
+// tokenize разбивает текст на термы в нижнем регистре по небуквенным символам.
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// searchableText — текст версии, по которому ведётся поиск.
+func searchableText(response Response) string {
+	parts := []string{response.Content}
+	if response.Meta != nil {
+		parts = append(parts, response.Meta.Title, response.Meta.Description, response.Meta.Keywords)
+	}
+	return strings.Join(parts, "\n")
+}
+
+// Add индексирует сохранённую версию.
+func (idx *searchIndex) Add(rec *StoredResult) {
+	key := rec.URL + "#" + rec.ID
+	text := searchableText(rec.Response)
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if _, ok := idx.docs[key]; ok {
+		return
+	}
+	idx.docs[key] = &searchDoc{url: rec.URL, versionID: rec.ID, scrapedAt: rec.ScrapedAt, text: text}
+	for _, term := range tokenize(text) {
+		docs := idx.postings[term]
+		if docs == nil {
+			docs = map[string]int{}
+			idx.postings[term] = docs
+		}
+		docs[key]++
+	}
+}
+
+// Remove убирает версию из индекса.
+func (idx *searchIndex) Remove(url, id string) {
+	key := url + "#" + id
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	doc, ok := idx.docs[key]
+	if !ok {
+		return
+	}
+	delete(idx.docs, key)
+	for _, term := range tokenize(doc.text) {
+		if docs := idx.postings[term]; docs != nil {
+			delete(docs, key)
+			if len(docs) == 0 {
+				delete(idx.postings, term)
+			}
+		}
+	}
+}
+
+// Search ищет версии, содержащие все термы запроса, с фильтрами по домену и дате.
+func (idx *searchIndex) Search(query, domain string, from, to time.Time) []SearchHit {
+	terms := tokenize(query)
+	if len(terms) == 0 {
+		return nil
+	}
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	scores := map[string]int{}
+	for key, tf := range idx.postings[terms[0]] {
+		scores[key] = tf
+	}
+	for _, term := range terms[1:] {
+		docs := idx.postings[term]
+		for key := range scores {
+			tf, ok := docs[key]
+			if !ok {
+				delete(scores, key)
+				continue
+			}
+			scores[key] += tf
+		}
+	}
+
+	var hits []SearchHit
+	for key, score := range scores {
+		doc := idx.docs[key]
+		if domain != "" && !hostMatchesDomain(doc.url, domain) {
+			continue
+		}
+		if !from.IsZero() && doc.scrapedAt.Before(from) {
+			continue
+		}
+		if !to.IsZero() && !doc.scrapedAt.Before(to) {
+			continue
+		}
+		hits = append(hits, SearchHit{
+			URL:       doc.url,
+			VersionID: doc.versionID,
+			ScrapedAt: doc.scrapedAt,
+			Score:     score,
+			Snippet:   makeSnippet(doc.text, terms[0]),
+		})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].ScrapedAt.After(hits[j].ScrapedAt)
+	})
+	return hits
+}
+
+// makeSnippet вырезает фрагмент текста вокруг первого вхождения терма.
+func makeSnippet(text, term string) string {
+	const radius = 80
+	text = normalizeText(text)
+	runes := []rune(text)
+	pos := 0
+	if i := strings.Index(strings.ToLower(text), term); i >= 0 {
+		pos = utf8.RuneCountInString(text[:i])
+	}
+	start, end := max(pos-radius, 0), min(pos+radius, len(runes))
+	return string(runes[start:end])
+}
+
+// hostMatchesDomain проверяет, что хост url совпадает с domain или является его поддоменом.
+func hostMatchesDomain(rawURL, domain string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	domain = strings.ToLower(domain)
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+// parseDateParam принимает дату в формате RFC3339 или YYYY-MM-DD.
+func parseDateParam(raw string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", raw)
+}
+
+// searchHandler: GET /search?q=&domain=&from=&to=&limit= — полнотекстовый поиск
+// по сохранённым результатам.
+func searchHandler(w http.ResponseWriter, r *http.Request) {
+	if resultIndex == nil {
+		writeJsonError(w, "Хранилище результатов выключено (задайте STORAGE_DIR)", http.StatusNotFound)
+		return
+	}
+	q := r.URL.Query().Get("q")
+	if strings.TrimSpace(q) == "" {
+		writeJsonError(w, "Параметр 'q' обязателен", http.StatusBadRequest)
+		return
+	}
+	var from, to time.Time
+	var err error
+	if raw := r.URL.Query().Get("from"); raw != "" {
+		if from, err = parseDateParam(raw); err != nil {
+			writeJsonError(w, "Параметр 'from' должен быть датой (YYYY-MM-DD или RFC3339)", http.StatusBadRequest)
+			return
+		}
+	}
+	if raw := r.URL.Query().Get("to"); raw != "" {
+		if to, err = parseDateParam(raw); err != nil {
+			writeJsonError(w, "Параметр 'to' должен быть датой (YYYY-MM-DD или RFC3339)", http.StatusBadRequest)
+			return
+		}
+	}
+	limit := 50
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil || v < 1 || v > 1000 {
+			writeJsonError(w, "Параметр 'limit' должен быть числом от 1 до 1000", http.StatusBadRequest)
+			return
+		}
+		limit = v
+	}
+
+	hits := resultIndex.Search(q, r.URL.Query().Get("domain"), from, to)
+	result := SearchResponse{Query: q, Total: len(hits), Hits: hits}
+	if len(result.Hits) > limit {
+		result.Hits = result.Hits[:limit]
+	}
+	if result.Hits == nil {
+		result.Hits = []SearchHit{}
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(result)
+}
+
+// buildSearchIndex строит индекс по всему содержимому хранилища.
+func buildSearchIndex(store *fileStore) (*searchIndex, error) {
+	idx := newSearchIndex()
+	count := 0
+	err := store.Walk(func(rec *StoredResult) error {
+		idx.Add(rec)
+		count++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("ЛОГ: Поисковый индекс построен, версий: %d.", count)
+	return idx, nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Извлечение по CSS-селекторам: selectors — JSON-объект «ключ → правило»,
+// удобнее всего передавать его в теле POST /scrape:
+//
+//	{"url": "...", "selectors": {"title": "h1", "price": ".product-price",
+//	  "images": {"selector": ".gallery img", "attr": "src", "all": true}}}
+//
+// Правило-строка — селектор, берётся текст первого совпадения. В объекте
+// attr задаёт атрибут (text — текст, html — внутренняя разметка), all —
+// вернуть массив всех совпадений. Ответ selectors — объект с теми же
+// ключами; null, если элемент не найден или селектор некорректен.
+
+// maxSelectorRules ограничивает число правил в одном запросе.
+const maxSelectorRules = 100
+
+type selectorRule struct {
+	Name     string `json:"name"`
+	Selector string `json:"selector"`
+	Attr     string `json:"attr,omitempty"`
+	All      bool   `json:"all,omitempty"`
+}
+
+// parseSelectorRules разбирает параметр selectors; правила сортируются по
+// ключу, чтобы одинаковые запросы давали одинаковый скрипт.
+func parseSelectorRules(raw string) ([]selectorRule, error) {
+	var spec map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(raw), &spec); err != nil || spec == nil {
+		return nil, errors.New("Параметр 'selectors' должен быть JSON-объектом")
+	}
+	if len(spec) > maxSelectorRules {
+		return nil, fmt.Errorf("Параметр 'selectors' может содержать не больше %d правил", maxSelectorRules)
+	}
+	rules := make([]selectorRule, 0, len(spec))
+	for name, value := range spec {
+		rule := selectorRule{Name: name}
+		if err := json.Unmarshal(value, &rule.Selector); err != nil {
+			if err := json.Unmarshal(value, &rule); err != nil {
+				return nil, fmt.Errorf("Правило '%s' в selectors должно быть строкой или объектом {selector, attr, all}", name)
+			}
+			rule.Name = name
+		}
+		if rule.Selector == "" {
+			return nil, fmt.Errorf("Правило '%s' в selectors должно быть строкой или объектом {selector, attr, all}", name)
+		}
+		rules = append(rules, rule)
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].Name < rules[j].Name })
+	return rules, nil
+}
+
+// selectorsScript применяет правила. Атрибуты href и src приводятся к
+// абсолютным адресам.
+const selectorsScript = `((rules) => {
+	const out = {};
+	const value = (el, attr) => {
+		if (!attr || attr === 'text') return (el.innerText || el.textContent || '').replace(/\s+/g, ' ').trim();
+		if (attr === 'html') return el.innerHTML;
+		const v = el.getAttribute(attr);
+		if (v == null) return null;
+		if (attr === 'href' || attr === 'src') { try { return new URL(v, document.baseURI).href; } catch (e) {} }
+		return v;
+	};
+	for (const r of rules) {
+		let found;
+		try { found = r.all ? Array.from(document.querySelectorAll(r.selector)) : [document.querySelector(r.selector)].filter(Boolean); }
+		catch (e) { out[r.name] = null; continue; }
+		if (r.all) out[r.name] = found.map(el => value(el, r.attr)).filter(v => v != null);
+		else out[r.name] = found.length ? value(found[0], r.attr) : null;
+	}
+	return out;
+})(%s)`
+
+func selectorsExpression(rules []selectorRule) string {
+	data, _ := json.Marshal(rules)
+	return fmt.Sprintf(selectorsScript, data)
+}
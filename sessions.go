@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chromedp/chromedp"
+)
+
+// Именованные сессии — отдельные BrowserContext со своими куками,
+// localStorage и кэшем:
+//
+//	POST   /sessions          {"name": "shop", "proxy": "http://..."} — создать
+//	GET    /sessions          — список
+//	DELETE /sessions/shop     — закрыть и удалить всё состояние
+//	POST   /sessions/shop/login — автоматический вход (login.go)
+//	/scrape?session=shop&...  — скрапинг внутри сессии
+//
+// При создании открывается вкладка-держатель: в режиме с окном в ней можно
+// войти на сайт вручную, и куки останутся в сессии. Прокси сессии задаётся
+// при создании; параметр proxy в скрапинге с session не действует.
+// Сессии живут в памяти и пропадают при перезапуске браузера. В кластере
+// сессии создаются на воркере автоматически при первом скрапинге с
+// session, а sticky-маршрутизация держит их на одном воркере.
+
+var validSessionName = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+type browserSession struct {
+	name    string
+	ctx     context.Context // Вкладка-держатель; её дочерние вкладки наследуют BrowserContext
+	cancel  context.CancelFunc
+	proxy   *proxyConfig
+	created time.Time
+	used    time.Time
+}
+
+// SessionInfo — описание сессии в ответах /sessions.
+type SessionInfo struct {
+	Name     string    `json:"name"`
+	Proxy    string    `json:"proxy,omitempty"`
+	Created  time.Time `json:"created"`
+	LastUsed time.Time `json:"last_used"`
+}
+
+var (
+	sessionsMu sync.Mutex
+	sessions   = map[string]*browserSession{}
+)
+
+func (s *browserSession) info() SessionInfo {
+	info := SessionInfo{Name: s.name, Created: s.created, LastUsed: s.used}
+	if s.proxy != nil {
+		info.Proxy = s.proxy.Server
+	}
+	return info
+}
+
+// createSession открывает BrowserContext сессии; trace — контекст запроса
+// для логов.
+func createSession(trace context.Context, name string, proxy *proxyConfig) (*browserSession, error) {
+	ctx, cancel := newScrapeTab(trace, proxy, true)
+	actions := chromedp.Tasks{proxyAuth(proxy)}
+	if stealthEnabled {
+		actions = append(actions, applyStealth())
+	}
+	if err := chromedp.Run(ctx, actions); err != nil {
+		cancel()
+		return nil, err
+	}
+	now := time.Now()
+	s := &browserSession{name: name, ctx: ctx, cancel: cancel, proxy: proxy, created: now, used: now}
+	slog.InfoContext(trace, "Сессия создана", "session", name)
+	return s, nil
+}
+
+// sessionTab открывает вкладку в сессии. autoCreate — создать сессию, если
+// её нет (воркер кластера).
+func sessionTab(trace context.Context, name string, autoCreate bool) (context.Context, context.CancelFunc, *proxyConfig, error) {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	s := sessions[name]
+	if s != nil && s.ctx.Err() != nil {
+		// Браузер перезапускался: контекст сессии погиб вместе с ним.
+		delete(sessions, name)
+		s.cancel()
+		if !autoCreate {
+			return nil, nil, nil, fmt.Errorf("Сессия '%s' потеряна при перезапуске браузера", name)
+		}
+		s = nil
+	}
+	if s == nil {
+		if !autoCreate {
+			return nil, nil, nil, fmt.Errorf("Сессия '%s' не найдена (создайте её через POST /sessions)", name)
+		}
+		var err error
+		if s, err = createSession(trace, name, nil); err != nil {
+			return nil, nil, nil, err
+		}
+		sessions[name] = s
+	}
+	s.used = time.Now()
+	ctx, cancel := chromedp.NewContext(s.ctx)
+	return ctx, cancel, s.proxy, nil
+}
+
+// closeSessions закрывает все сессии при остановке сервиса.
+func closeSessions() {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	for name, s := range sessions {
+		s.cancel()
+		delete(sessions, name)
+	}
+}
+
+// sessionsHandler: /sessions и /sessions/<имя>.
+func sessionsHandler(w http.ResponseWriter, r *http.Request) {
+	if clusterMode == "coordinator" {
+		writeJsonError(w, "Сессии недоступны на координаторе: они создаются на воркерах при первом скрапинге с session", http.StatusNotFound)
+		return
+	}
+	name := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/sessions"), "/")
+	if session, ok := strings.CutSuffix(name, "/login"); ok {
+		loginHandler(w, r, session)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	switch {
+	case name == "" && r.Method == http.MethodGet:
+		sessionsMu.Lock()
+		list := make([]SessionInfo, 0, len(sessions))
+		for _, s := range sessions {
+			list = append(list, s.info())
+		}
+		sessionsMu.Unlock()
+		sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+		json.NewEncoder(w).Encode(list)
+
+	case name == "" && r.Method == http.MethodPost:
+		var req struct {
+			Name  string `json:"name"`
+			Proxy string `json:"proxy"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&req); err != nil {
+			writeJsonError(w, `Тело запроса должно быть JSON вида {"name": "...", "proxy": "..."}`, http.StatusBadRequest)
+			return
+		}
+		if !validSessionName.MatchString(req.Name) {
+			writeJsonError(w, "Имя сессии может содержать латиницу, цифры, _ . - (до 64 символов)", http.StatusBadRequest)
+			return
+		}
+		var proxy *proxyConfig
+		if req.Proxy != "" {
+			var err error
+			if proxy, err = parseRequestProxy(req.Proxy); err != nil {
+				writeJsonError(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		sessionsMu.Lock()
+		defer sessionsMu.Unlock()
+		if s := sessions[req.Name]; s != nil && s.ctx.Err() == nil {
+			writeJsonError(w, fmt.Sprintf("Сессия '%s' уже существует", req.Name), http.StatusConflict)
+			return
+		}
+		s, err := createSession(r.Context(), req.Name, proxy)
+		if err != nil {
+			writeJsonError(w, "Не удалось создать сессию: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		sessions[req.Name] = s
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(s.info())
+
+	case name != "" && r.Method == http.MethodDelete:
+		sessionsMu.Lock()
+		s := sessions[name]
+		delete(sessions, name)
+		sessionsMu.Unlock()
+		if s == nil {
+			writeJsonError(w, fmt.Sprintf("Сессия '%s' не найдена (создайте её через POST /sessions)", name), http.StatusNotFound)
+			return
+		}
+		s.cancel()
+		slog.InfoContext(r.Context(), "Сессия удалена", "session", name)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeJsonError(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// Плавная остановка по SIGTERM/SIGINT: сервер перестаёт принимать
+// соединения, ждёт завершения текущих запросов и фоновых скрапингов
+// (асинхронные задачи, прогрев, задачи кластера) не дольше
+// SHUTDOWN_TIMEOUT секунд (по умолчанию 30), затем закрывает сессии и
+// браузеры — иначе при передеплое остаются осиротевшие процессы Chrome.
+
+var shuttingDown atomic.Bool
+
+func shutdownTimeout() time.Duration {
+	if v, err := strconv.Atoi(os.Getenv("SHUTDOWN_TIMEOUT")); err == nil && v > 0 {
+		return time.Duration(v) * time.Second
+	}
+	return 30 * time.Second
+}
+
+// serveUntilSignal запускает сервер и при сигнале останавливает сервис.
+func serveUntilSignal(srv *http.Server) {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	errCh := make(chan error, 1)
+	go func() { errCh <- srv.ListenAndServe() }()
+	select {
+	case err := <-errCh:
+		log.Fatal(err)
+	case <-ctx.Done():
+	}
+	stop() // Повторный сигнал завершит процесс сразу
+
+	timeout := shutdownTimeout()
+	log.Printf("ЛОГ: Получен сигнал остановки, жду завершения запросов (до %v).", timeout)
+	shuttingDown.Store(true)
+	deadline, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := srv.Shutdown(deadline); err != nil && !errors.Is(err, context.DeadlineExceeded) {
+		log.Printf("ЛОГ: Ошибка остановки сервера: %v", err)
+	}
+	for activeScrapes.Load() > 0 && deadline.Err() == nil {
+		time.Sleep(100 * time.Millisecond)
+	}
+	if n := activeScrapes.Load(); n > 0 {
+		log.Printf("ЛОГ: Время ожидания истекло, прерываю скрапингов: %d.", n)
+	}
+	closeSessions()
+	if clusterMode != "coordinator" {
+		closeBrowsers()
+	}
+	log.Println("ЛОГ: Сервис остановлен.")
+}
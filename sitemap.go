@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Обход по sitemap: GET|POST /crawl/sitemap?sitemap=<адрес>&<параметры
+// обхода и скрапинга> (crawl.go). sitemap — адрес sitemap.xml (в том числе
+// индекса sitemap и .xml.gz) или текстового sitemap; если указан корень
+// сайта, sitemap берутся из robots.txt, а без них — /sitemap.xml.
+// Вложенные индексы читаются до глубины maxSitemapDepth, адреса — до limit.
+
+const (
+	maxSitemapSize  = 50 << 20 // Предел протокола sitemap для несжатого файла
+	maxSitemapDepth = 3
+	maxSitemapFiles = 100
+)
+
+// sitemapDoc — urlset или sitemapindex.
+type sitemapDoc struct {
+	XMLName xml.Name
+	URLs    []struct {
+		Loc     string `xml:"loc"`
+		Lastmod string `xml:"lastmod"`
+	} `xml:"url"`
+	Sitemaps []struct {
+		Loc string `xml:"loc"`
+	} `xml:"sitemap"`
+}
+
+// sitemapCollector собирает адреса страниц из sitemap.
+type sitemapCollector struct {
+	run     *crawlRun
+	files   int
+	targets []crawlTarget
+}
+
+func (s *sitemapCollector) full() bool {
+	return len(s.targets) >= s.run.limit
+}
+
+// collect читает sitemap и, для индекса, вложенные sitemap. Ошибка
+// возвращается только для самого файла; ошибки вложенных пишутся в лог.
+func (s *sitemapCollector) collect(ctx context.Context, rawURL string, depth int) error {
+	if s.files >= maxSitemapFiles {
+		return nil
+	}
+	s.files++
+	data, status, err := fetchCrawlFile(ctx, rawURL, maxSitemapSize)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("HTTP %d", status)
+	}
+	data = bytes.TrimPrefix(bytes.TrimSpace(data), []byte("\xef\xbb\xbf"))
+	if !bytes.HasPrefix(data, []byte("<")) {
+		// Текстовый sitemap: адрес на строку.
+		lines := bufio.NewScanner(bytes.NewReader(data))
+		for lines.Scan() && !s.full() {
+			s.add(strings.TrimSpace(lines.Text()), "")
+		}
+		return nil
+	}
+	var doc sitemapDoc
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.Strict = false
+	if err := dec.Decode(&doc); err != nil {
+		return err
+	}
+	for _, u := range doc.URLs {
+		if s.full() {
+			return nil
+		}
+		s.add(strings.TrimSpace(u.Loc), strings.TrimSpace(u.Lastmod))
+	}
+	if depth >= maxSitemapDepth {
+		if len(doc.Sitemaps) > 0 {
+			slog.WarnContext(ctx, "Обход: индекс sitemap вложен слишком глубоко, пропускаю", "url", rawURL, "max_depth", maxSitemapDepth)
+		}
+		return nil
+	}
+	for _, child := range doc.Sitemaps {
+		if s.full() || ctx.Err() != nil {
+			return nil
+		}
+		loc := strings.TrimSpace(child.Loc)
+		if err := s.collect(ctx, loc, depth+1); err != nil {
+			slog.WarnContext(ctx, "Обход: не удалось прочитать sitemap", "url", loc, "error", err)
+		}
+	}
+	return nil
+}
+
+func (s *sitemapCollector) add(raw, lastmod string) {
+	if raw == "" {
+		return
+	}
+	if target, ok := s.run.accept(raw); ok {
+		s.targets = append(s.targets, crawlTarget{URL: target, Lastmod: lastmod})
+	}
+}
+
+// sitemapSources — sitemap для обхода: сам адрес или, для корня сайта,
+// sitemap из robots.txt.
+func sitemapSources(c *crawlRun, u *url.URL) []string {
+	if u.Path != "" && u.Path != "/" {
+		return []string{u.String()}
+	}
+	if sitemaps := c.rules(u).sitemaps; len(sitemaps) > 0 {
+		return sitemaps
+	}
+	return []string{u.Scheme + "://" + u.Host + "/sitemap.xml"}
+}
+
+// crawlSitemapHandler: GET|POST /crawl/sitemap.
+func crawlSitemapHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		writeJsonError(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+		return
+	}
+	q, err := scrapeQuery(w, r)
+	if err != nil {
+		writeJsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	raw := q.Get("sitemap")
+	if raw == "" {
+		writeJsonError(w, "Параметр 'sitemap' обязателен", http.StatusBadRequest)
+		return
+	}
+	if err := checkTargetURL(raw); err != nil {
+		writeJsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	run, status, err := newCrawlRun(w, r, q)
+	if err != nil {
+		writeJsonError(w, err.Error(), status)
+		return
+	}
+	sitemapURL, _ := url.Parse(raw)
+	slog.InfoContext(r.Context(), "Обход по sitemap", "sitemap", raw, "limit", run.limit)
+
+	collector := &sitemapCollector{run: run}
+	var lastErr error
+	read := 0
+	for _, source := range sitemapSources(run, sitemapURL) {
+		if collector.full() {
+			break
+		}
+		if err := collector.collect(r.Context(), source, 1); err != nil {
+			slog.WarnContext(r.Context(), "Обход: не удалось прочитать sitemap", "url", source, "error", err)
+			lastErr = err
+			continue
+		}
+		read++
+	}
+	if read == 0 && lastErr != nil {
+		writeJsonError(w, "Не удалось загрузить sitemap: "+lastErr.Error(), http.StatusBadGateway)
+		return
+	}
+	if len(collector.targets) > 0 {
+		if err := run.checkOptions(collector.targets[0].URL); err != nil {
+			writeJsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	slog.InfoContext(r.Context(), "Обход: адреса из sitemap отобраны", "targets", len(collector.targets), "files", collector.files)
+	run.start()
+	run.run(collector.targets)
+}
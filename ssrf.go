@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/netip"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Защита от SSRF: адрес скрапинга проверяется до навигации, а итоговый
+// адрес после переадресаций — сразу после неё.
+//
+//   - допускаются только схемы http и https (никаких file://, chrome://);
+//   - адреса link-local (169.254.0.0/16 с метаданными облаков, fe80::/10)
+//     запрещены всегда;
+//   - loopback, частные сети (10/8, 172.16/12, 192.168/16, fc00::/7),
+//     CGNAT (100.64/10) и 0.0.0.0 запрещены, пока не задано
+//     ALLOW_PRIVATE_NETWORKS=true;
+//   - TARGET_DENYLIST — домены через запятую (с поддоменами), которые
+//     скрапить нельзя; TARGET_ALLOWLIST — если задан, скрапить можно
+//     только эти домены.
+//
+// Имя проверяется по всем адресам, в которые оно разрешается. Браузер
+// разрешает имя сам, поэтому от подмены DNS между проверкой и навигацией
+// защищает только проверка итогового адреса.
+//
+// Те же запреты адресов действуют для хостов, к которым сервер обращается
+// сам по указанию клиента: callback_url (и его переадресации) и прокси из
+// запроса. Списки доменов TARGET_* к ним не применяются — они про сайты,
+// которые скрапят.
+
+var (
+	allowPrivateNetworks bool
+	targetAllowlist      []string
+	targetDenylist       []string
+)
+
+var (
+	linkLocalPrefixes = []netip.Prefix{
+		netip.MustParsePrefix("169.254.0.0/16"),
+		netip.MustParsePrefix("fe80::/10"),
+	}
+	cgnatPrefix = netip.MustParsePrefix("100.64.0.0/10")
+)
+
+const targetLookupTimeout = 5 * time.Second
+
+func loadTargetPolicy() {
+	allowPrivateNetworks = os.Getenv("ALLOW_PRIVATE_NETWORKS") == "true" || os.Getenv("ALLOW_PRIVATE_NETWORKS") == "1"
+	targetAllowlist = parseDomainList(os.Getenv("TARGET_ALLOWLIST"))
+	targetDenylist = parseDomainList(os.Getenv("TARGET_DENYLIST"))
+	if len(targetAllowlist) > 0 {
+		log.Printf("ЛОГ: Скрапинг разрешён только для доменов: %s.", strings.Join(targetAllowlist, ", "))
+	}
+	if allowPrivateNetworks {
+		log.Println("ЛОГ: Скрапинг адресов частных сетей разрешён (ALLOW_PRIVATE_NETWORKS).")
+	}
+}
+
+// forbiddenAddr сообщает, почему адрес запрещён, или "".
+func forbiddenAddr(ip netip.Addr) string {
+	ip = ip.Unmap()
+	for _, p := range linkLocalPrefixes {
+		if p.Contains(ip) {
+			return "link-local"
+		}
+	}
+	if allowPrivateNetworks {
+		return ""
+	}
+	switch {
+	case ip.IsLoopback():
+		return "loopback"
+	case ip.IsPrivate(), cgnatPrefix.Contains(ip):
+		return "private"
+	case ip.IsUnspecified(), ip.IsMulticast():
+		return "reserved"
+	}
+	return ""
+}
+
+// checkTargetURL проверяет, можно ли скрапить адрес.
+func checkTargetURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return fmt.Errorf("Адрес '%s' не поддерживается: нужен абсолютный http(s)-адрес", raw)
+	}
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	for _, domain := range targetDenylist {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return fmt.Errorf("Домен '%s' запрещён для скрапинга", host)
+		}
+	}
+	if len(targetAllowlist) > 0 {
+		allowed := false
+		for _, domain := range targetAllowlist {
+			if host == domain || strings.HasSuffix(host, "."+domain) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Errorf("Домен '%s' запрещён для скрапинга", host)
+		}
+	}
+
+	if ip, reason := forbiddenHost(host); reason != "" {
+		return fmt.Errorf("Адрес '%s' запрещён для скрапинга: %s (%s)", host, ip, reason)
+	}
+	return nil
+}
+
+// checkPageRequest проверяет запрос, который делает открытая страница.
+// Документы (переход, каждый шаг редиректа, фрейм) проверяются как адрес
+// скрапинга; остальным ресурсам списки доменов не указ — у страниц свои CDN
+// и счётчики, — но запрещённые адреса отклоняются и для них.
+func checkPageRequest(raw string, document bool) error {
+	if document {
+		return checkTargetURL(raw)
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil
+	}
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if ip, reason := forbiddenHost(host); reason != "" {
+		return fmt.Errorf("Адрес '%s' запрещён для скрапинга: %s (%s)", host, ip, reason)
+	}
+	return nil
+}
+
+// forbiddenHost разрешает имя и возвращает первый запрещённый адрес и
+// причину; reason == "" — хост допустим.
+func forbiddenHost(host string) (ip netip.Addr, reason string) {
+	var addrs []netip.Addr
+	if ip, err := netip.ParseAddr(host); err == nil {
+		addrs = []netip.Addr{ip}
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), targetLookupTimeout)
+		defer cancel()
+		if addrs, err = net.DefaultResolver.LookupNetIP(ctx, "ip", host); err != nil {
+			// Не разрешилось здесь — не откроется и в браузере; ошибку
+			// навигации клиент получит как обычно.
+			return netip.Addr{}, ""
+		}
+	}
+	for _, ip := range addrs {
+		if reason := forbiddenAddr(ip); reason != "" {
+			return ip.Unmap(), reason
+		}
+	}
+	return netip.Addr{}, ""
+}
+
+// checkOutboundHost проверяет хост, к которому сервер обратится сам по
+// параметру param.
+func checkOutboundHost(param, host string) error {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if ip, reason := forbiddenHost(host); reason != "" {
+		return fmt.Errorf("Параметр '%s' запрещён: адрес '%s' — %s (%s)", param, host, ip, reason)
+	}
+	return nil
+}
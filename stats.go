@@ -0,0 +1,208 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Статистика текста (stats=true): число слов и символов, язык, доля
+// текста в HTML и время чтения — то, что для SEO и отбора страниц в
+// датасеты иначе считают на стороне клиента по полному дампу. Считается
+// по тому же тексту body, что и content_hash. Язык определяется по
+// письменности и частотным словам; для коротких текстов и языков вне
+// списка stopWords он может быть не определён.
+
+const (
+	readingWordsPerMinute = 200
+	readingCJKPerMinute   = 500 // Иероглифы и кана: знаков в минуту
+)
+
+// ContentStats — статистика текста страницы.
+type ContentStats struct {
+	Words              int      `json:"words"`
+	Characters         int      `json:"characters"`
+	CharactersNoSpaces int      `json:"characters_no_spaces"`
+	Language           string   `json:"language,omitempty"`          // ISO 639-1, определён по тексту
+	DeclaredLanguage   string   `json:"declared_language,omitempty"` // Атрибут lang у <html>
+	TextHTMLRatio      *float64 `json:"text_html_ratio,omitempty"`   // Доля видимого текста в HTML, 0–1; для PDF нет
+	ReadingTime        int      `json:"reading_time"`                // Секунд
+}
+
+// statsResult — данные страницы для ContentStats.
+type statsResult struct {
+	TextLength int    `json:"text"`
+	HTMLLength int    `json:"html"`
+	Lang       string `json:"lang"`
+}
+
+const statsScript = `(() => ({
+	text: document.body ? document.body.innerText.length : 0,
+	html: document.documentElement.outerHTML.length,
+	lang: document.documentElement.getAttribute('lang') || '',
+}))()`
+
+// stopWords — частотные слова языков на латинице и кириллице.
+var stopWords = map[string][]string{
+	"en": {"the", "and", "of", "to", "is", "in", "that", "it", "for", "with", "was", "on", "are", "this", "you", "be", "have", "not"},
+	"de": {"der", "die", "und", "das", "ist", "nicht", "mit", "den", "ein", "eine", "auf", "sich", "dem", "für", "auch", "wird"},
+	"fr": {"le", "la", "les", "et", "des", "est", "une", "dans", "que", "pour", "pas", "sur", "qui", "avec", "du", "au", "sont"},
+	"es": {"el", "la", "los", "las", "y", "que", "del", "en", "es", "por", "una", "para", "con", "no", "se", "como", "más"},
+	"it": {"il", "la", "di", "che", "e", "per", "un", "una", "non", "sono", "del", "della", "con", "gli", "anche", "come"},
+	"pt": {"o", "a", "os", "as", "de", "que", "e", "do", "da", "em", "um", "uma", "para", "não", "com", "por", "mais"},
+	"nl": {"de", "het", "een", "en", "van", "is", "dat", "niet", "op", "te", "voor", "met", "zijn", "ook", "er", "wordt"},
+	"pl": {"i", "w", "nie", "na", "się", "że", "jest", "do", "to", "z", "jak", "ale", "co", "od", "są", "przez"},
+	"cs": {"a", "je", "se", "na", "v", "že", "to", "není", "jsou", "pro", "jak", "ale", "by", "od", "které", "také"},
+	"tr": {"ve", "bir", "bu", "da", "de", "için", "ile", "çok", "daha", "olarak", "gibi", "ama", "olan", "değil"},
+	"sv": {"och", "att", "det", "som", "en", "är", "av", "för", "med", "till", "den", "inte", "har", "på", "om"},
+	"ru": {"и", "в", "не", "на", "что", "с", "по", "это", "как", "для", "из", "но", "он", "к", "так", "все", "же", "от"},
+	"uk": {"і", "в", "не", "на", "що", "з", "та", "це", "як", "для", "до", "але", "від", "він", "й", "його", "є"},
+	"bg": {"и", "в", "не", "на", "да", "се", "за", "от", "че", "е", "са", "това", "като", "по", "но", "ще"},
+}
+
+var stopWordIndex = func() map[string][]string {
+	index := map[string][]string{}
+	for lang, words := range stopWords {
+		for _, w := range words {
+			index[w] = append(index[w], lang)
+		}
+	}
+	return index
+}()
+
+// isCJK — знак пишется без пробелов между словами.
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana)
+}
+
+// textWords делит текст на слова; апостроф и дефис внутри слова его не
+// разрывают. Иероглифы и кана считаются по одному слову на знак.
+func textWords(text string) (words []string, cjk int) {
+	for _, field := range strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsMark(r) && r != '\'' && r != '’' && r != '-'
+	}) {
+		var word strings.Builder
+		for _, r := range field {
+			if isCJK(r) {
+				cjk++
+				continue
+			}
+			word.WriteRune(r)
+		}
+		if w := strings.Trim(word.String(), "'’-"); w != "" {
+			words = append(words, w)
+		}
+	}
+	return words, cjk
+}
+
+// detectLanguage определяет язык текста: по преобладающей письменности,
+// а для латиницы и кириллицы — по частотным словам.
+func detectLanguage(text string, words []string) string {
+	scripts := map[string]int{}
+	kana, persian := 0, 0
+	for _, r := range text {
+		switch {
+		case unicode.In(r, unicode.Hiragana, unicode.Katakana):
+			kana++
+			scripts["cjk"]++
+		case unicode.Is(unicode.Han, r):
+			scripts["cjk"]++
+		case unicode.Is(unicode.Latin, r):
+			scripts["latin"]++
+		case unicode.Is(unicode.Cyrillic, r):
+			scripts["cyrillic"]++
+		case unicode.Is(unicode.Greek, r):
+			scripts["el"]++
+		case unicode.Is(unicode.Arabic, r):
+			scripts["arabic"]++
+			if strings.ContainsRune("پچژگکی", r) {
+				persian++
+			}
+		case unicode.Is(unicode.Hebrew, r):
+			scripts["he"]++
+		case unicode.Is(unicode.Hangul, r):
+			scripts["ko"]++
+		case unicode.Is(unicode.Thai, r):
+			scripts["th"]++
+		case unicode.Is(unicode.Devanagari, r):
+			scripts["hi"]++
+		case unicode.Is(unicode.Armenian, r):
+			scripts["hy"]++
+		case unicode.Is(unicode.Georgian, r):
+			scripts["ka"]++
+		}
+	}
+	script, top := "", 0
+	for name, n := range scripts {
+		if n > top || (n == top && name < script) {
+			script, top = name, n
+		}
+	}
+	switch script {
+	case "cjk":
+		// В японском тексте кана встречается постоянно, в китайском — нет.
+		if kana*10 >= top {
+			return "ja"
+		}
+		return "zh"
+	case "arabic":
+		if persian*20 >= top {
+			return "fa"
+		}
+		return "ar"
+	case "latin", "cyrillic":
+		return detectByStopWords(words)
+	}
+	return script
+}
+
+// detectByStopWords выбирает язык с наибольшей долей частотных слов.
+func detectByStopWords(words []string) string {
+	scores := map[string]int{}
+	for _, w := range words {
+		for _, lang := range stopWordIndex[strings.ToLower(w)] {
+			scores[lang]++
+		}
+	}
+	best, top := "", 0
+	for lang, n := range scores {
+		if n > top || (n == top && lang < best) {
+			best, top = lang, n
+		}
+	}
+	// Одно-два совпадения в длинном тексте — случайность.
+	if top < 2 || top*20 < len(words) {
+		return ""
+	}
+	return best
+}
+
+// contentStats считает статистику текста; page — данные страницы, для
+// PDF их нет.
+func contentStats(text string, page *statsResult) *ContentStats {
+	text = strings.TrimSpace(text)
+	words, cjk := textWords(text)
+	stats := &ContentStats{
+		Words:      len(words) + cjk,
+		Characters: utf8.RuneCountInString(strings.Join(strings.Fields(text), " ")),
+		Language:   detectLanguage(text, words),
+	}
+	for _, r := range text {
+		if !unicode.IsSpace(r) {
+			stats.CharactersNoSpaces++
+		}
+	}
+	minutes := float64(len(words))/readingWordsPerMinute + float64(cjk)/readingCJKPerMinute
+	stats.ReadingTime = int(math.Ceil(minutes * 60))
+	if page != nil {
+		stats.DeclaredLanguage = strings.TrimSpace(page.Lang)
+		ratio := 0.0
+		if page.HTMLLength > 0 {
+			ratio = math.Round(float64(page.TextLength)/float64(page.HTMLLength)*10000) / 10000
+		}
+		stats.TextHTMLRatio = &ratio
+	}
+	return stats
+}
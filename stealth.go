@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/chromedp"
+)
+
+// Маскировка автоматизации. Флаг disable-blink-features=AutomationControlled
+// убирает только navigator.webdriver; защищённые сайты проверяют больше:
+// пустые navigator.plugins, отсутствие window.chrome, несогласованность
+// Notification.permission и permissions.query, WebGL-рендерер SwiftShader
+// (при --disable-gpu), нулевые outerWidth/outerHeight в headless. Скрипт
+// подключается через Page.addScriptToEvaluateOnNewDocument и выполняется
+// до скриптов страницы в каждом документе вкладки, включая фреймы.
+//
+// Включается флагом -stealth (по умолчанию включён); в запросе можно
+// переопределить параметром stealth=true|false. Сессии получают скрипт
+// один раз при создании, по флагу.
+
+// stealthEnabled — значение флага -stealth.
+var stealthEnabled = true
+
+// stealthScript — набор подмен. Подменённые функции выдают себя за
+// встроенные: Function.prototype.toString возвращает для них
+// «function x() { [native code] }».
+const stealthScript = `(() => {
+	const nativeToString = Function.prototype.toString;
+	const masked = new WeakMap();
+	const mask = (fn, name) => { masked.set(fn, 'function ' + name + '() { [native code] }'); return fn; };
+	const toString = mask(function toString() {
+		return masked.has(this) ? masked.get(this) : nativeToString.call(this);
+	}, 'toString');
+	Object.defineProperty(Function.prototype, 'toString', {value: toString, writable: true, configurable: true});
+	const getter = (obj, prop, fn) => {
+		Object.defineProperty(obj, prop, {get: mask(fn, 'get ' + prop), configurable: true, enumerable: true});
+	};
+
+	// navigator.webdriver: в обычном Chrome false, свойство на прототипе.
+	getter(Navigator.prototype, 'webdriver', () => false);
+
+	// navigator.languages: без Accept-Language override бывает пустым.
+	if (!navigator.languages || navigator.languages.length === 0) {
+		getter(Navigator.prototype, 'languages', () => ['en-US', 'en']);
+	}
+
+	// navigator.plugins и mimeTypes: Chrome показывает встроенный PDF-просмотрщик.
+	if (navigator.plugins.length === 0 && typeof PluginArray !== 'undefined') {
+		const mime = Object.create(MimeType.prototype);
+		const define = (o, props) => { for (const k in props) Object.defineProperty(o, k, {value: props[k], enumerable: true}); };
+		const names = ['PDF Viewer', 'Chrome PDF Viewer', 'Chromium PDF Viewer', 'Microsoft Edge PDF Viewer', 'WebKit built-in PDF'];
+		const plugins = names.map(name => {
+			const p = Object.create(Plugin.prototype);
+			define(p, {name, filename: 'internal-pdf-viewer', description: 'Portable Document Format', length: 1, 0: mime});
+			return p;
+		});
+		define(mime, {type: 'application/pdf', suffixes: 'pdf', description: 'Portable Document Format', enabledPlugin: plugins[0]});
+		const pluginArray = Object.create(PluginArray.prototype);
+		plugins.forEach((p, i) => define(pluginArray, {[i]: p}));
+		define(pluginArray, {length: plugins.length});
+		pluginArray.item = mask(function item(i) { return plugins[i] || null; }, 'item');
+		pluginArray.namedItem = mask(function namedItem(n) { return plugins.find(p => p.name === n) || null; }, 'namedItem');
+		pluginArray.refresh = mask(function refresh() {}, 'refresh');
+		const mimeArray = Object.create(MimeTypeArray.prototype);
+		define(mimeArray, {0: mime, length: 1});
+		mimeArray.item = mask(function item(i) { return i === 0 ? mime : null; }, 'item');
+		mimeArray.namedItem = mask(function namedItem(n) { return n === 'application/pdf' ? mime : null; }, 'namedItem');
+		getter(Navigator.prototype, 'plugins', () => pluginArray);
+		getter(Navigator.prototype, 'mimeTypes', () => mimeArray);
+		getter(Navigator.prototype, 'pdfViewerEnabled', () => true);
+	}
+
+	// window.chrome: в headless его нет, в обычном Chrome есть runtime, app, csi, loadTimes.
+	if (!window.chrome) {
+		Object.defineProperty(window, 'chrome', {value: {}, writable: true, configurable: true, enumerable: true});
+	}
+	if (!window.chrome.runtime) {
+		window.chrome.runtime = {
+			OnInstalledReason: {CHROME_UPDATE: 'chrome_update', INSTALL: 'install', SHARED_MODULE_UPDATE: 'shared_module_update', UPDATE: 'update'},
+			PlatformOs: {ANDROID: 'android', CROS: 'cros', LINUX: 'linux', MAC: 'mac', OPENBSD: 'openbsd', WIN: 'win'},
+			connect: mask(function connect() { throw new TypeError('Error in invocation of runtime.connect(optional string extensionId, optional object connectInfo): chrome.runtime.connect() called from a webpage must specify an Extension ID (string) for its first argument.'); }, 'connect'),
+			sendMessage: mask(function sendMessage() { throw new TypeError('Error in invocation of runtime.sendMessage(optional string extensionId, any message, optional object options, optional function callback): chrome.runtime.sendMessage() called from a webpage must specify an Extension ID (string) for its first argument.'); }, 'sendMessage'),
+		};
+	}
+	if (!window.chrome.app) {
+		window.chrome.app = {
+			isInstalled: false,
+			InstallState: {DISABLED: 'disabled', INSTALLED: 'installed', NOT_INSTALLED: 'not_installed'},
+			RunningState: {CANNOT_RUN: 'cannot_run', READY_TO_RUN: 'ready_to_run', RUNNING: 'running'},
+			getDetails: mask(function getDetails() { return null; }, 'getDetails'),
+			getIsInstalled: mask(function getIsInstalled() { return false; }, 'getIsInstalled'),
+		};
+	}
+	if (!window.chrome.csi) {
+		const start = Date.now();
+		window.chrome.csi = mask(function csi() {
+			return {startE: start, onloadT: start + 100, pageT: Date.now() - start, tran: 15};
+		}, 'csi');
+	}
+	if (!window.chrome.loadTimes) {
+		const t = Date.now() / 1000;
+		window.chrome.loadTimes = mask(function loadTimes() {
+			return {
+				requestTime: t, startLoadTime: t, commitLoadTime: t + 0.05, finishDocumentLoadTime: t + 0.2,
+				finishLoadTime: t + 0.3, firstPaintTime: t + 0.1, firstPaintAfterLoadTime: 0, navigationType: 'Other',
+				wasFetchedViaSpdy: true, wasNpnNegotiated: true, npnNegotiatedProtocol: 'h2',
+				wasAlternateProtocolAvailable: false, connectionInfo: 'h2',
+			};
+		}, 'loadTimes');
+	}
+
+	// Permissions API: в headless query({name:'notifications'}) даёт denied
+	// при Notification.permission === 'default'.
+	if (navigator.permissions && navigator.permissions.query && typeof Notification !== 'undefined') {
+		const origQuery = navigator.permissions.query;
+		const patched = mask(function query(params) {
+			if (params && params.name === 'notifications') {
+				const state = Notification.permission === 'default' ? 'prompt' : Notification.permission;
+				return Promise.resolve(Object.setPrototypeOf({state, name: 'notifications', onchange: null}, PermissionStatus.prototype));
+			}
+			return origQuery.call(this, params);
+		}, 'query');
+		Object.defineProperty(Permissions.prototype, 'query', {value: patched, writable: true, configurable: true});
+	}
+
+	// WebGL: вместо SwiftShader — типичная встроенная графика Intel.
+	const vendor = 'Google Inc. (Intel)';
+	const renderer = 'ANGLE (Intel, Intel(R) UHD Graphics 630 (0x00003E92) Direct3D11 vs_5_0 ps_5_0, D3D11)';
+	for (const ctx of [window.WebGLRenderingContext, window.WebGL2RenderingContext]) {
+		if (!ctx) continue;
+		const origGetParameter = ctx.prototype.getParameter;
+		Object.defineProperty(ctx.prototype, 'getParameter', {
+			value: mask(function getParameter(p) {
+				if (p === 37445) return vendor;   // UNMASKED_VENDOR_WEBGL
+				if (p === 37446) return renderer; // UNMASKED_RENDERER_WEBGL
+				return origGetParameter.call(this, p);
+			}, 'getParameter'),
+			writable: true, configurable: true,
+		});
+	}
+
+	// outerWidth/outerHeight в headless равны нулю.
+	if (window.outerWidth === 0 && window.outerHeight === 0) {
+		getter(window, 'outerWidth', () => window.innerWidth);
+		getter(window, 'outerHeight', () => window.innerHeight + 85);
+	}
+})()`
+
+// applyStealth подключает stealthScript ко всем будущим документам вкладки.
+func applyStealth() chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		log.Println("ЛОГ: Включаю маскировку автоматизации (stealth).")
+		_, err := page.AddScriptToEvaluateOnNewDocument(stealthScript).WithRunImmediately(true).Do(ctx)
+		return err
+	})
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StoredResult — одна сохранённая версия результата скрапинга.
+type StoredResult struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	ScrapedAt time.Time `json:"scraped_at"`
+	Hash      string    `json:"hash"`
+	Response  Response  `json:"response"`
+
+	HasScreenshot bool `json:"has_screenshot,omitempty"`
+}
+
+// VersionInfo — краткое описание версии для списка истории.
+type VersionInfo struct {
+	ID            string    `json:"id"`
+	ScrapedAt     time.Time `json:"scraped_at"`
+	Hash          string    `json:"hash"`
+	HasScreenshot bool      `json:"has_screenshot,omitempty"`
+}
+
+// HistoryResponse — ответ /history со списком версий.
+type HistoryResponse struct {
+	URL      string        `json:"url"`
+	Versions []VersionInfo `json:"versions"`
+}
+
+// errVersionNotFound возвращается, если запрошенной версии нет в хранилище.
+var errVersionNotFound = errors.New("версия не найдена")
+
+// fileStore хранит каждую версию результата в отдельном JSON-файле:
+// <dir>/<sha256(url)>/<id>.json, где id — время скрапинга в наносекундах.
+type fileStore struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// resultStore включается переменной окружения STORAGE_DIR; nil — хранилище выключено.
+var resultStore *fileStore
+
+func newFileStore(dir string) (*fileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &fileStore{dir: dir}, nil
+}
+
+func (s *fileStore) urlDir(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:]))
+}
+
+// Save сохраняет новую версию результата для url. Если передан screenshot
+// (PNG), он сохраняется рядом с версией как <id>.png.
+func (s *fileStore) Save(url string, response Response, screenshot []byte) (*StoredResult, error) {
+	body, err := json.Marshal(response)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(body)
+	now := time.Now().UTC()
+	rec := &StoredResult{
+		ID:        fmt.Sprintf("%d", now.UnixNano()),
+		URL:       url,
+		ScrapedAt: now,
+		Hash:      hex.EncodeToString(sum[:]),
+		Response:  response,
+
+		HasScreenshot: len(screenshot) > 0,
+	}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	dir := s.urlDir(url)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	if rec.HasScreenshot {
+		if err := os.WriteFile(filepath.Join(dir, rec.ID+".png"), screenshot, 0o644); err != nil {
+			return nil, err
+		}
+	}
+	// Пишем во временный файл и переименовываем, чтобы читатели не увидели половину записи.
+	tmp := filepath.Join(dir, rec.ID+".json.tmp")
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp, filepath.Join(dir, rec.ID+".json")); err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+// Versions возвращает все версии url, от старых к новым.
+func (s *fileStore) Versions(url string) ([]VersionInfo, error) {
+	entries, err := os.ReadDir(s.urlDir(url))
+	if errors.Is(err, os.ErrNotExist) {
+		return []VersionInfo{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	versions := []VersionInfo{}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		rec, err := s.readFile(filepath.Join(s.urlDir(url), e.Name()))
+		if err != nil {
+			log.Printf("ЛОГ: Пропускаю повреждённую запись %s: %v", e.Name(), err)
+			continue
+		}
+		versions = append(versions, VersionInfo{ID: rec.ID, ScrapedAt: rec.ScrapedAt, Hash: rec.Hash, HasScreenshot: rec.HasScreenshot})
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].ScrapedAt.Before(versions[j].ScrapedAt) })
+	return versions, nil
+}
+
+// Get возвращает конкретную версию url.
+func (s *fileStore) Get(url, id string) (*StoredResult, error) {
+	if id == "" || strings.ContainsAny(id, `/\.`) {
+		return nil, errVersionNotFound
+	}
+	rec, err := s.readFile(filepath.Join(s.urlDir(url), id+".json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, errVersionNotFound
+	}
+	return rec, err
+}
+
+// Walk обходит все сохранённые версии всех url. Порядок не гарантирован.
+func (s *fileStore) Walk(fn func(rec *StoredResult) error) error {
+	dirs, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	for _, d := range dirs {
+		if !d.IsDir() || d.Name() == artifactsDirName {
+			continue
+		}
+		entries, err := os.ReadDir(filepath.Join(s.dir, d.Name()))
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if !strings.HasSuffix(e.Name(), ".json") {
+				continue
+			}
+			rec, err := s.readFile(filepath.Join(s.dir, d.Name(), e.Name()))
+			if err != nil {
+				log.Printf("ЛОГ: Пропускаю повреждённую запись %s: %v", e.Name(), err)
+				continue
+			}
+			if err := fn(rec); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// LatestAll возвращает последнюю версию каждого сохранённого url.
+func (s *fileStore) LatestAll() ([]*StoredResult, error) {
+	dirs, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var results []*StoredResult
+	for _, d := range dirs {
+		if !d.IsDir() || d.Name() == artifactsDirName {
+			continue
+		}
+		entries, err := os.ReadDir(filepath.Join(s.dir, d.Name()))
+		if err != nil {
+			return nil, err
+		}
+		// Имена файлов — наносекунды одинаковой длины, поэтому последняя по
+		// алфавиту запись и есть самая свежая.
+		for i := len(entries) - 1; i >= 0; i-- {
+			if !strings.HasSuffix(entries[i].Name(), ".json") {
+				continue
+			}
+			rec, err := s.readFile(filepath.Join(s.dir, d.Name(), entries[i].Name()))
+			if err != nil {
+				log.Printf("ЛОГ: Пропускаю повреждённую запись %s: %v", entries[i].Name(), err)
+				continue
+			}
+			results = append(results, rec)
+			break
+		}
+	}
+	return results, nil
+}
+
+// Screenshot возвращает PNG-снимок версии url.
+func (s *fileStore) Screenshot(url, id string) ([]byte, error) {
+	if id == "" || strings.ContainsAny(id, `/\.`) {
+		return nil, errVersionNotFound
+	}
+	data, err := os.ReadFile(filepath.Join(s.urlDir(url), id+".png"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, errVersionNotFound
+	}
+	return data, err
+}
+
+// versionFile — версия на диске без содержимого; нужна сборщику мусора.
+type versionFile struct {
+	dir       string // Каталог url внутри хранилища
+	id        string
+	scrapedAt time.Time
+	size      int64 // JSON вместе со снимком
+}
+
+// versionFiles перечисляет все версии по именам файлов, не читая их.
+func (s *fileStore) versionFiles() ([]versionFile, error) {
+	dirs, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []versionFile
+	for _, d := range dirs {
+		if !d.IsDir() || d.Name() == artifactsDirName {
+			continue
+		}
+		entries, err := os.ReadDir(filepath.Join(s.dir, d.Name()))
+		if err != nil {
+			return nil, err
+		}
+		sizes := map[string]int64{}
+		for _, e := range entries {
+			id, ext, _ := strings.Cut(e.Name(), ".")
+			if ext != "json" && ext != "png" {
+				continue
+			}
+			if info, err := e.Info(); err == nil {
+				sizes[id] += info.Size()
+			}
+		}
+		for id, size := range sizes {
+			nanos, err := strconv.ParseInt(id, 10, 64)
+			if err != nil {
+				continue
+			}
+			files = append(files, versionFile{dir: d.Name(), id: id, scrapedAt: time.Unix(0, nanos).UTC(), size: size})
+		}
+	}
+	return files, nil
+}
+
+// deleteVersion удаляет версию со снимком и возвращает её url (для поискового
+// индекса). Опустевший каталог url удаляется.
+func (s *fileStore) deleteVersion(f versionFile) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	dir := filepath.Join(s.dir, f.dir)
+	var url string
+	if rec, err := s.readFile(filepath.Join(dir, f.id+".json")); err == nil {
+		url = rec.URL
+	}
+	for _, ext := range []string{".json", ".png"} {
+		if err := os.Remove(filepath.Join(dir, f.id+ext)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return url, err
+		}
+	}
+	os.Remove(dir) // Удалится, только если пуст
+	return url, nil
+}
+
+// PurgeURL удаляет все версии url и возвращает их идентификаторы.
+func (s *fileStore) PurgeURL(url string) ([]string, error) {
+	versions, err := s.Versions(url)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := make([]string, 0, len(versions))
+	for _, v := range versions {
+		ids = append(ids, v.ID)
+	}
+	return ids, os.RemoveAll(s.urlDir(url))
+}
+
+func (s *fileStore) readFile(path string) (*StoredResult, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rec StoredResult
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+// historyHandler: GET /history?url= — список версий,
+// GET /history?url=&version= — конкретная версия целиком.
+func historyHandler(w http.ResponseWriter, r *http.Request) {
+	if resultStore == nil {
+		writeJsonError(w, "Хранилище результатов выключено (задайте STORAGE_DIR)", http.StatusNotFound)
+		return
+	}
+	url := r.URL.Query().Get("url")
+	if url == "" {
+		writeJsonError(w, "Параметр 'url' обязателен", http.StatusBadRequest)
+		return
+	}
+
+	if id := r.URL.Query().Get("version"); id != "" {
+		rec, err := resultStore.Get(url, id)
+		if errors.Is(err, errVersionNotFound) {
+			writeJsonError(w, "Версия не найдена", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Printf("ЛОГ: Ошибка чтения версии из хранилища: %v", err)
+			writeJsonError(w, "Не удалось прочитать версию: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(w).Encode(rec)
+		return
+	}
+
+	versions, err := resultStore.Versions(url)
+	if err != nil {
+		log.Printf("ЛОГ: Ошибка чтения истории из хранилища: %v", err)
+		writeJsonError(w, "Не удалось прочитать историю: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(HistoryResponse{URL: url, Versions: versions})
+}
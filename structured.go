@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"strings"
+)
+
+// structuredScript возвращает содержимое всех блоков JSON-LD страницы.
+const structuredScript = `Array.from(document.querySelectorAll('script[type="application/ld+json" i]'), s => s.textContent)`
+
+// parseStructuredData разбирает блоки JSON-LD. Блок-массив раскрывается в
+// отдельные элементы; обёртки <!-- --> и CDATA, которые встречаются в
+// шаблонах CMS, снимаются; невалидные блоки пропускаются.
+func parseStructuredData(blocks []string) []json.RawMessage {
+	var out []json.RawMessage
+	for _, block := range blocks {
+		data := []byte(stripJSONLDWrappers(block))
+		if len(data) == 0 {
+			continue
+		}
+		if !json.Valid(data) {
+			log.Printf("ЛОГ: Пропускаю некорректный блок JSON-LD (%d байт).", len(data))
+			continue
+		}
+		if data[0] == '[' {
+			var items []json.RawMessage
+			if err := json.Unmarshal(data, &items); err == nil {
+				out = append(out, items...)
+				continue
+			}
+		}
+		var compact bytes.Buffer
+		if err := json.Compact(&compact, data); err != nil {
+			continue
+		}
+		out = append(out, compact.Bytes())
+	}
+	return out
+}
+
+func stripJSONLDWrappers(s string) string {
+	s = strings.TrimSpace(s)
+	for _, w := range [][2]string{{"<!--", "-->"}, {"//<![CDATA[", "//]]>"}, {"<![CDATA[", "]]>"}} {
+		if strings.HasPrefix(s, w[0]) && strings.HasSuffix(s, w[1]) {
+			s = strings.TrimSpace(s[len(w[0]) : len(s)-len(w[1])])
+		}
+	}
+	return s
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+)
+
+// Table — таблица страницы. Rows — объекты «заголовок → значение ячейки».
+type Table struct {
+	Caption string              `json:"caption,omitempty"`
+	Headers []string            `json:"headers"`
+	Rows    []map[string]string `json:"rows"`
+	CSV     string              `json:"csv,omitempty"` // Только при tables_csv=true
+}
+
+// tableCells — результат tablesScript: заголовки и строки в виде массивов.
+type tableCells struct {
+	Caption string     `json:"caption"`
+	Headers []string   `json:"headers"`
+	Rows    [][]string `json:"rows"`
+}
+
+// tablesScript собирает таблицы данных. Вёрсточные таблицы (с вложенными
+// таблицами или role=presentation) и таблицы из одной строки пропускаются.
+// colspan и rowspan раскрываются повтором значения, чтобы строки были
+// одинаковой ширины. Заголовки — строка из <th> в thead или первая
+// строка; если их нет, используются col1, col2... Повторяющиеся заголовки
+// получают суффикс _2, _3.
+const tablesScript = `(() => {
+	const clean = s => (s || '').replace(/\s+/g, ' ').trim();
+	const out = [];
+	for (const table of document.querySelectorAll('table')) {
+		if (table.querySelector('table') || table.getAttribute('role') === 'presentation') continue;
+		const trs = Array.from(table.rows);
+		if (trs.length < 2) continue;
+		const grid = [], pending = [];
+		trs.forEach((tr, r) => {
+			const row = grid[r] = grid[r] || [];
+			let c = 0;
+			for (const cell of tr.cells) {
+				while (row[c] !== undefined) c++;
+				const text = clean(cell.innerText || cell.textContent);
+				const cs = Math.max(1, Math.min(cell.colSpan || 1, 100)), rs = Math.max(1, Math.min(cell.rowSpan || 1, trs.length - r));
+				for (let i = 0; i < rs; i++) {
+					const target = grid[r + i] = grid[r + i] || [];
+					for (let j = 0; j < cs; j++) target[c + j] = text;
+				}
+				c += cs;
+			}
+		});
+		const width = Math.max(...grid.map(r => r.length));
+		if (!width) continue;
+		const rows = grid.map(r => Array.from({length: width}, (_, i) => r[i] || ''));
+		const first = trs[0];
+		const headerRow = (table.tHead && table.tHead.rows.length && table.tHead.rows[0] === first) ||
+			Array.from(first.cells).every(cell => cell.tagName === 'TH');
+		let headers = headerRow ? rows.shift() : Array.from({length: width}, (_, i) => 'col' + (i + 1));
+		const seen = {};
+		headers = headers.map((h, i) => {
+			h = h || 'col' + (i + 1);
+			seen[h] = (seen[h] || 0) + 1;
+			return seen[h] > 1 ? h + '_' + seen[h] : h;
+		});
+		const caption = table.caption ? clean(table.caption.textContent) : '';
+		out.push({caption, headers, rows: rows.filter(r => r.some(Boolean))});
+	}
+	return out;
+})()`
+
+// buildTables переводит строки в объекты и при необходимости добавляет CSV.
+func buildTables(raw []tableCells, withCSV bool) []Table {
+	tables := make([]Table, 0, len(raw))
+	for _, t := range raw {
+		table := Table{Caption: t.Caption, Headers: t.Headers, Rows: make([]map[string]string, 0, len(t.Rows))}
+		for _, row := range t.Rows {
+			obj := make(map[string]string, len(t.Headers))
+			for i, h := range t.Headers {
+				if i < len(row) {
+					obj[h] = row[i]
+				}
+			}
+			table.Rows = append(table.Rows, obj)
+		}
+		if withCSV {
+			var buf bytes.Buffer
+			w := csv.NewWriter(&buf)
+			w.Write(t.Headers)
+			w.WriteAll(t.Rows)
+			table.CSV = buf.String()
+		}
+		tables = append(tables, table)
+	}
+	return tables
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chromedp/cdproto/input"
+	"github.com/chromedp/chromedp"
+	"github.com/chromedp/chromedp/kb"
+)
+
+// Двусторонний Telegram: при CAPTCHA в чат уходит скриншот вкладки с
+// кнопками, а ответы из чата управляют вкладкой — без доступа к консоли
+// сервера. Бот читает обновления long polling'ом (getUpdates), поэтому
+// вебхук у бота должен быть выключен. Команды принимаются только из
+// TELEGRAM_CHAT_ID:
+//
+//	кнопка «Готово» или /done   — CAPTCHA решена, продолжить
+//	кнопка «Скриншот» или /shot — прислать свежий скриншот
+//	/click X Y                  — клик в точку скриншота (в пикселях)
+//	/enter                      — нажать Enter
+//	любой другой текст          — ввести его в активное поле страницы
+//
+// Если CAPTCHA ждут несколько вкладок, команды относятся к самой ранней;
+// после её решения бот присылает следующую.
+//
+// TELEGRAM_TWO_WAY=false оставляет только текстовые уведомления.
+
+const (
+	telegramPollTimeout = 30 // секунд, long polling getUpdates
+	telegramRetryDelay  = 5 * time.Second
+)
+
+var telegramHelp = "Ответьте на это сообщение: кнопка «Готово» или /done — продолжить; /shot — свежий скриншот; " +
+	"/click X Y — клик в точку скриншота; /enter — Enter; любой текст — ввести в активное поле."
+
+func telegramTwoWay() bool {
+	return os.Getenv("TELEGRAM_BOT_TOKEN") != "" && os.Getenv("TELEGRAM_CHAT_ID") != "" &&
+		os.Getenv("TELEGRAM_TWO_WAY") != "false"
+}
+
+func telegramURL(method string) string {
+	return fmt.Sprintf("https://api.telegram.org/bot%s/%s", os.Getenv("TELEGRAM_BOT_TOKEN"), method)
+}
+
+// telegramCall вызывает метод Bot API с JSON-телом и разбирает result.
+func telegramCall(client *http.Client, method string, params any, result any) error {
+	body, _ := json.Marshal(params)
+	resp, err := client.Post(telegramURL(method), "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var reply struct {
+		OK          bool            `json:"ok"`
+		Description string          `json:"description"`
+		Result      json.RawMessage `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+		return err
+	}
+	if !reply.OK {
+		return fmt.Errorf("%s: %s", method, reply.Description)
+	}
+	if result != nil {
+		return json.Unmarshal(reply.Result, result)
+	}
+	return nil
+}
+
+// notifyCaptcha сообщает о CAPTCHA: в двустороннем режиме — скриншотом с
+// кнопками, иначе (или если скриншот не ушёл) — текстом.
+func notifyCaptcha(wait *captchaWait, message string) {
+	if telegramTwoWay() {
+		err := sendCaptchaScreenshot(wait, message+"\n\n"+telegramHelp)
+		if err == nil {
+			return
+		}
+		log.Printf("ЛОГ: Telegram: не удалось отправить скриншот CAPTCHA: %v", err)
+	}
+	sendTelegramNotification(message)
+}
+
+// sendCaptchaScreenshot отправляет скриншот вкладки с CAPTCHA.
+func sendCaptchaScreenshot(wait *captchaWait, caption string) error {
+	ctx, cancel := context.WithTimeout(wait.tab, captchaActionTimeout)
+	defer cancel()
+	var shot []byte
+	if err := chromedp.Run(ctx, chromedp.CaptureScreenshot(&shot)); err != nil {
+		return err
+	}
+	keyboard, _ := json.Marshal(map[string]any{"inline_keyboard": [][]map[string]string{{
+		{"text": "✅ Готово", "callback_data": "done"},
+		{"text": "🔄 Скриншот", "callback_data": "shot"},
+	}}})
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("chat_id", os.Getenv("TELEGRAM_CHAT_ID"))
+	if len([]rune(caption)) > 1024 {
+		caption = string([]rune(caption)[:1024])
+	}
+	mw.WriteField("caption", caption)
+	mw.WriteField("reply_markup", string(keyboard))
+	part, _ := mw.CreateFormFile("photo", "captcha.png")
+	part.Write(shot)
+	mw.Close()
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Post(telegramURL("sendPhoto"), mw.FormDataContentType(), &body)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Telegram API: %s", resp.Status)
+	}
+	log.Println("ЛОГ: Telegram: скриншот CAPTCHA отправлен.")
+	return nil
+}
+
+// telegramUpdate — нужная часть объекта Update.
+type telegramUpdate struct {
+	UpdateID int64 `json:"update_id"`
+	Message  *struct {
+		Chat struct {
+			ID int64 `json:"id"`
+		} `json:"chat"`
+		Text string `json:"text"`
+	} `json:"message"`
+	CallbackQuery *struct {
+		ID      string `json:"id"`
+		Data    string `json:"data"`
+		Message *struct {
+			Chat struct {
+				ID int64 `json:"id"`
+			} `json:"chat"`
+		} `json:"message"`
+	} `json:"callback_query"`
+}
+
+// telegramPollLoop читает ответы из чата и управляет вкладкой с CAPTCHA.
+func telegramPollLoop() {
+	chatID, err := strconv.ParseInt(os.Getenv("TELEGRAM_CHAT_ID"), 10, 64)
+	if err != nil {
+		log.Printf("ЛОГ: Telegram: TELEGRAM_CHAT_ID должен быть числом, двусторонний режим выключен.")
+		return
+	}
+	log.Println("ЛОГ: Telegram: двусторонний режим включён, жду ответов из чата.")
+	client := &http.Client{Timeout: (telegramPollTimeout + 10) * time.Second}
+	var offset int64
+	for {
+		var updates []telegramUpdate
+		err := telegramCall(client, "getUpdates", map[string]any{
+			"offset":          offset,
+			"timeout":         telegramPollTimeout,
+			"allowed_updates": []string{"message", "callback_query"},
+		}, &updates)
+		if err != nil {
+			log.Printf("ЛОГ: Telegram: ошибка getUpdates: %v", err)
+			time.Sleep(telegramRetryDelay)
+			continue
+		}
+		for _, u := range updates {
+			offset = u.UpdateID + 1
+			switch {
+			case u.CallbackQuery != nil && u.CallbackQuery.Message != nil && u.CallbackQuery.Message.Chat.ID == chatID:
+				telegramCall(client, "answerCallbackQuery", map[string]string{"callback_query_id": u.CallbackQuery.ID}, nil)
+				handleTelegramCommand("/" + u.CallbackQuery.Data)
+			case u.Message != nil && u.Message.Chat.ID == chatID && u.Message.Text != "":
+				handleTelegramCommand(u.Message.Text)
+			}
+		}
+	}
+}
+
+// handleTelegramCommand выполняет ответ оператора.
+func handleTelegramCommand(text string) {
+	wait := currentCaptcha("")
+	if wait == nil {
+		sendTelegramNotification("Сейчас нет CAPTCHA, ожидающей решения.")
+		return
+	}
+	ctx, cancel := context.WithTimeout(wait.tab, captchaActionTimeout)
+	defer cancel()
+	fields := strings.Fields(text)
+	var err error
+	switch {
+	case text == "/done":
+		resolveCaptcha(wait, "Telegram")
+		sendTelegramNotification(fmt.Sprintf("CAPTCHA %s: пауза снята, скрапинг продолжается.", wait.ID))
+		if next := currentCaptcha(""); next != nil {
+			sendCaptchaScreenshot(next, fmt.Sprintf("Следующая CAPTCHA %s на %s.\n\n%s", next.ID, next.URL, telegramHelp))
+		}
+		return
+	case text == "/shot":
+	case text == "/enter":
+		err = chromedp.Run(ctx, chromedp.KeyEvent(kb.Enter))
+	case len(fields) == 3 && fields[0] == "/click":
+		x, errX := strconv.ParseFloat(fields[1], 64)
+		y, errY := strconv.ParseFloat(fields[2], 64)
+		if errX != nil || errY != nil {
+			sendTelegramNotification("Формат: /click X Y, координаты в пикселях скриншота.")
+			return
+		}
+		log.Printf("ЛОГ: CAPTCHA: оператор из Telegram кликает в (%.0f, %.0f).", x, y)
+		err = chromedp.Run(ctx,
+			input.DispatchMouseEvent(input.MouseMoved, x, y),
+			input.DispatchMouseEvent(input.MousePressed, x, y).WithButton(input.Left).WithClickCount(1),
+			input.DispatchMouseEvent(input.MouseReleased, x, y).WithButton(input.Left).WithClickCount(1),
+		)
+	default:
+		log.Println("ЛОГ: CAPTCHA: оператор из Telegram вводит текст.")
+		err = chromedp.Run(ctx, chromedp.KeyEvent(text))
+	}
+	if err != nil {
+		sendTelegramNotification(fmt.Sprintf("Не удалось выполнить действие: %v", err))
+		return
+	}
+	// Даём странице отреагировать и показываем результат.
+	time.Sleep(time.Second)
+	if err := sendCaptchaScreenshot(wait, fmt.Sprintf("CAPTCHA %s.\n\n%s", wait.ID, telegramHelp)); err != nil {
+		log.Printf("ЛОГ: Telegram: не удалось отправить скриншот: %v", err)
+	}
+}
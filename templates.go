@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// Шаблоны ответа: файлы <имя>[.<расширение>].tmpl из каталога TEMPLATES_DIR
+// (Go text/template). Запрос с template=<имя> получает отрендеренный текст
+// вместо JSON; Content-Type берётся по расширению (legacy.xml.tmpl → XML,
+// без расширения — text/plain). В шаблон передаётся ответ в JSON-виде,
+// поэтому поля адресуются как в JSON: {{.meta.title}}, {{range .links}}.
+
+type outputTemplate struct {
+	tmpl        *template.Template
+	contentType string
+}
+
+// outputTemplates — загруженные шаблоны по имени; пусто, если TEMPLATES_DIR не задан.
+var outputTemplates = map[string]*outputTemplate{}
+
+var templateFuncs = template.FuncMap{
+	"xml": func(v any) (string, error) {
+		var buf bytes.Buffer
+		if err := xml.EscapeText(&buf, []byte(fmt.Sprint(v))); err != nil {
+			return "", err
+		}
+		return buf.String(), nil
+	},
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	// oneline заменяет переводы строк пробелами — для форматов key=value.
+	"oneline": func(v any) string {
+		return strings.Join(strings.Fields(fmt.Sprint(v)), " ")
+	},
+	"join": func(sep string, items []any) string {
+		parts := make([]string, len(items))
+		for i, item := range items {
+			parts[i] = fmt.Sprint(item)
+		}
+		return strings.Join(parts, sep)
+	},
+	"lower":   strings.ToLower,
+	"upper":   strings.ToUpper,
+	"trim":    strings.TrimSpace,
+	"replace": strings.ReplaceAll,
+}
+
+// loadOutputTemplates читает шаблоны из TEMPLATES_DIR. Ошибка в любом
+// шаблоне останавливает запуск: лучше упасть сразу, чем отдавать
+// потребителю битый формат.
+func loadOutputTemplates() {
+	dir := os.Getenv("TEMPLATES_DIR")
+	if dir == "" {
+		return
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "*.tmpl"))
+	if err != nil {
+		log.Fatalf("Не удалось прочитать каталог шаблонов %s: %v", dir, err)
+	}
+	for _, path := range paths {
+		base := strings.TrimSuffix(filepath.Base(path), ".tmpl")
+		name, ext := base, ""
+		if i := strings.IndexByte(base, '.'); i > 0 {
+			name, ext = base[:i], base[i:]
+		}
+		tmpl, err := template.New(filepath.Base(path)).Funcs(templateFuncs).Option("missingkey=zero").ParseFiles(path)
+		if err != nil {
+			log.Fatalf("Ошибка в шаблоне %s: %v", path, err)
+		}
+		contentType := "text/plain; charset=utf-8"
+		if ct := mime.TypeByExtension(ext); ext != "" && ct != "" {
+			contentType = ct
+		}
+		outputTemplates[name] = &outputTemplate{tmpl: tmpl, contentType: contentType}
+	}
+	log.Printf("ЛОГ: Загружено шаблонов ответа: %d.", len(outputTemplates))
+}
+
+// lookupOutputTemplate возвращает шаблон по имени или ошибку для ответа клиенту.
+func lookupOutputTemplate(name string) (*outputTemplate, error) {
+	if t, ok := outputTemplates[name]; ok {
+		return t, nil
+	}
+	if len(outputTemplates) == 0 {
+		return nil, fmt.Errorf("шаблоны ответа не настроены (задайте TEMPLATES_DIR)")
+	}
+	return nil, fmt.Errorf("шаблон %q не найден", name)
+}
+
+// Render рендерит данные целиком в память, чтобы ошибка посреди шаблона
+// не оставила клиенту обрезанный ответ со статусом 200.
+func (t *outputTemplate) Render(data any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := t.tmpl.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chromedp/chromedp"
+)
+
+// Трассировка OpenTelemetry. Спаны HTTP-запроса и этапов скрапинга
+// (setup, navigate, wait, captcha-check, interact, extract) отправляются
+// экспортёром OTLP/HTTP в формате JSON — его принимает любой OTel
+// Collector, поэтому SDK как зависимость не заводится, как и для Redis.
+//
+// Включается переменной OTEL_EXPORTER_OTLP_ENDPOINT (http://collector:4318,
+// спаны уходят на /v1/traces) или OTEL_EXPORTER_OTLP_TRACES_ENDPOINT
+// (полный адрес). OTEL_EXPORTER_OTLP_HEADERS — заголовки вида k=v,k2=v2,
+// OTEL_SERVICE_NAME — имя сервиса (по умолчанию webextract). Входящий
+// заголовок traceparent (W3C) продолжает трассу клиента.
+
+const (
+	traceBatchSize     = 256
+	traceQueueSize     = 4096
+	traceFlushInterval = 5 * time.Second
+	traceExportTimeout = 10 * time.Second
+)
+
+const (
+	spanKindInternal = 1
+	spanKindServer   = 2
+	spanStatusError  = 2
+)
+
+var tracer *traceExporter
+
+type traceExporter struct {
+	endpoint string
+	headers  map[string]string
+	service  string
+	queue    chan *span
+	client   *http.Client
+}
+
+// span — этап работы. Методы безопасны для nil: при выключенной
+// трассировке startSpan возвращает nil.
+type span struct {
+	traceID  [16]byte
+	spanID   [8]byte
+	parentID [8]byte
+	name     string
+	kind     int
+	start    time.Time
+	end      time.Time
+	mu       sync.Mutex
+	attrs    map[string]any
+	errText  string
+}
+
+type spanKey struct{}
+
+// remoteSpan — родитель из заголовка traceparent.
+type remoteSpan struct {
+	traceID [16]byte
+	spanID  [8]byte
+}
+
+type remoteSpanKey struct{}
+
+func loadTracingConfig() {
+	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	if endpoint == "" {
+		if base := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); base != "" {
+			endpoint = strings.TrimRight(base, "/") + "/v1/traces"
+		}
+	}
+	if endpoint == "" {
+		return
+	}
+	t := &traceExporter{
+		endpoint: endpoint,
+		headers:  map[string]string{},
+		service:  os.Getenv("OTEL_SERVICE_NAME"),
+		queue:    make(chan *span, traceQueueSize),
+		client:   &http.Client{Timeout: traceExportTimeout},
+	}
+	if t.service == "" {
+		t.service = "webextract"
+	}
+	for _, pair := range strings.Split(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"), ",") {
+		if name, value, ok := strings.Cut(pair, "="); ok {
+			t.headers[strings.TrimSpace(name)] = strings.TrimSpace(value)
+		}
+	}
+	tracer = t
+	go t.run()
+	slog.Info("Трассировка OpenTelemetry включена", "endpoint", endpoint)
+}
+
+// startSpan открывает дочерний спан текущего спана ctx (или удалённого
+// родителя из traceparent). ctx может быть nil.
+func startSpan(ctx context.Context, name string) (context.Context, *span) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if tracer == nil {
+		return ctx, nil
+	}
+	s := &span{name: name, kind: spanKindInternal, start: time.Now(), attrs: map[string]any{}}
+	rand.Read(s.spanID[:])
+	switch {
+	case spanFromContext(ctx) != nil:
+		parent := spanFromContext(ctx)
+		s.traceID, s.parentID = parent.traceID, parent.spanID
+	case ctx.Value(remoteSpanKey{}) != nil:
+		parent := ctx.Value(remoteSpanKey{}).(remoteSpan)
+		s.traceID, s.parentID = parent.traceID, parent.spanID
+	default:
+		rand.Read(s.traceID[:])
+	}
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+func spanFromContext(ctx context.Context) *span {
+	s, _ := ctx.Value(spanKey{}).(*span)
+	return s
+}
+
+func (s *span) SetAttr(key string, value any) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.attrs[key] = value
+	s.mu.Unlock()
+}
+
+// RecordError помечает спан ошибочным; nil ничего не меняет.
+func (s *span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	s.errText = err.Error()
+	s.mu.Unlock()
+}
+
+// End завершает спан и ставит его в очередь экспорта; при переполненной
+// очереди (коллектор недоступен) спан отбрасывается.
+func (s *span) End() {
+	if s == nil {
+		return
+	}
+	s.end = time.Now()
+	select {
+	case tracer.queue <- s:
+	default:
+	}
+}
+
+// parseTraceparent разбирает заголовок W3C traceparent версии 00.
+func parseTraceparent(header string) (remoteSpan, bool) {
+	var rs remoteSpan
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) < 4 || parts[0] != "00" || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return rs, false
+	}
+	if _, err := hex.Decode(rs.traceID[:], []byte(parts[1])); err != nil {
+		return rs, false
+	}
+	if _, err := hex.Decode(rs.spanID[:], []byte(parts[2])); err != nil {
+		return rs, false
+	}
+	if rs.traceID == [16]byte{} || rs.spanID == [8]byte{} {
+		return rs, false
+	}
+	return rs, true
+}
+
+// withTracing открывает серверный спан на каждый HTTP-запрос.
+func withTracing(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if tracer == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx := r.Context()
+		if parent, ok := parseTraceparent(r.Header.Get("traceparent")); ok {
+			ctx = context.WithValue(ctx, remoteSpanKey{}, parent)
+		}
+		ctx, s := startSpan(ctx, r.Method)
+		s.kind = spanKindServer
+		r = r.WithContext(ctx)
+		mw := &metricsResponseWriter{ResponseWriter: w}
+		next.ServeHTTP(mw, r)
+		if r.Pattern != "" {
+			s.name = r.Method + " " + r.Pattern
+			s.SetAttr("http.route", r.Pattern)
+		}
+		if mw.status == 0 {
+			mw.status = http.StatusOK
+		}
+		s.SetAttr("http.request.method", r.Method)
+		s.SetAttr("url.path", r.URL.Path)
+		s.SetAttr("http.response.status_code", mw.status)
+		if id := requestID(ctx); id != "" {
+			s.SetAttr("request.id", id)
+		}
+		if mw.status >= 500 {
+			s.RecordError(fmt.Errorf("HTTP %d", mw.status))
+		}
+		s.End()
+	})
+}
+
+// tracedAction выполняет действие chromedp внутри спана name.
+func tracedAction(parent context.Context, name string, action chromedp.Action) chromedp.Action {
+	if tracer == nil {
+		return action
+	}
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		_, s := startSpan(parent, name)
+		err := action.Do(ctx)
+		s.RecordError(err)
+		s.End()
+		return err
+	})
+}
+
+// run отправляет спаны пачками по traceBatchSize или раз в traceFlushInterval.
+func (t *traceExporter) run() {
+	ticker := time.NewTicker(traceFlushInterval)
+	defer ticker.Stop()
+	batch := make([]*span, 0, traceBatchSize)
+	for {
+		select {
+		case s := <-t.queue:
+			batch = append(batch, s)
+			if len(batch) < traceBatchSize {
+				continue
+			}
+		case <-ticker.C:
+			if len(batch) == 0 {
+				continue
+			}
+		}
+		if err := t.export(batch); err != nil {
+			// Экспорт идёт вне запросов: контекста с request_id здесь нет.
+			slog.Warn("Не удалось отправить спаны", "spans", len(batch), "error", err)
+		}
+		batch = batch[:0]
+	}
+}
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"` // int64 в OTLP/JSON передаётся строкой
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+}
+
+type otlpAttr struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string     `json:"traceId"`
+	SpanID            string     `json:"spanId"`
+	ParentSpanID      string     `json:"parentSpanId,omitempty"`
+	Name              string     `json:"name"`
+	Kind              int        `json:"kind"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+	Attributes        []otlpAttr `json:"attributes,omitempty"`
+	Status            otlpStatus `json:"status"`
+}
+
+func otlpAttribute(key string, value any) otlpAttr {
+	var v otlpValue
+	switch x := value.(type) {
+	case string:
+		v.StringValue = &x
+	case bool:
+		v.BoolValue = &x
+	case int:
+		s := strconv.Itoa(x)
+		v.IntValue = &s
+	case int64:
+		s := strconv.FormatInt(x, 10)
+		v.IntValue = &s
+	case float64:
+		v.DoubleValue = &x
+	default:
+		s := fmt.Sprint(x)
+		v.StringValue = &s
+	}
+	return otlpAttr{Key: key, Value: v}
+}
+
+func (s *span) otlp() otlpSpan {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := otlpSpan{
+		TraceID:           hex.EncodeToString(s.traceID[:]),
+		SpanID:            hex.EncodeToString(s.spanID[:]),
+		Name:              s.name,
+		Kind:              s.kind,
+		StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+	}
+	if s.parentID != [8]byte{} {
+		out.ParentSpanID = hex.EncodeToString(s.parentID[:])
+	}
+	for key, value := range s.attrs {
+		out.Attributes = append(out.Attributes, otlpAttribute(key, value))
+	}
+	if s.errText != "" {
+		out.Status = otlpStatus{Code: spanStatusError, Message: s.errText}
+	}
+	return out
+}
+
+func (t *traceExporter) export(batch []*span) error {
+	spans := make([]otlpSpan, 0, len(batch))
+	for _, s := range batch {
+		spans = append(spans, s.otlp())
+	}
+	body, err := json.Marshal(map[string]any{
+		"resourceSpans": []any{map[string]any{
+			"resource": map[string]any{"attributes": []otlpAttr{otlpAttribute("service.name", t.service)}},
+			"scopeSpans": []any{map[string]any{
+				"scope": map[string]string{"name": "webextract"},
+				"spans": spans,
+			}},
+		}},
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, t.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range t.headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("коллектор ответил HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,407 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Параметр transform= — выражение JSONPath, применяемое к готовому ответу.
+// Поддерживаемое подмножество:
+//
+//	$.meta.title  $['meta']['title']   — доступ к полям
+//	$.links[0]  $.links[-1]            — индексы (отрицательные — с конца)
+//	$.links[0:10]  $.links[*]  $.meta.* — срезы и подстановки
+//	$..href                            — рекурсивный спуск
+//	$.links[?(@.text == 'Купить')]     — фильтры: == != < <= > >= =~ и [?(@.поле)]
+//
+// Если выражение указывает ровно на одно значение (нет *, .., срезов и
+// фильтров), возвращается само значение, иначе — массив совпадений.
+
+type pathStepKind int
+
+const (
+	stepField pathStepKind = iota
+	stepIndex
+	stepSlice
+	stepWildcard
+	stepRecursive
+	stepFilter
+)
+
+type pathStep struct {
+	kind       pathStepKind
+	name       string
+	index      int
+	start, end *int
+	filter     *pathFilter
+}
+
+// pathFilter — условие [?(@.path op value)].
+type pathFilter struct {
+	path  []string // Поля внутри @
+	op    string   // "" — проверка существования
+	value any      // string, float64, bool или nil
+	re    *regexp.Regexp
+}
+
+type jsonPath struct {
+	steps    []pathStep
+	definite bool
+}
+
+// compileJSONPath разбирает выражение. Ошибка пригодна для ответа клиенту.
+func compileJSONPath(expr string) (*jsonPath, error) {
+	expr = strings.TrimSpace(expr)
+	if !strings.HasPrefix(expr, "$") {
+		return nil, fmt.Errorf("выражение transform должно начинаться с '$'")
+	}
+	p := &jsonPath{definite: true}
+	s := expr[1:]
+	for len(s) > 0 {
+		switch {
+		case strings.HasPrefix(s, ".."):
+			s = s[2:]
+			p.definite = false
+			p.steps = append(p.steps, pathStep{kind: stepRecursive})
+			// После .. идёт имя, * или скобка.
+			if len(s) > 0 && s[0] != '[' {
+				name, rest := readPathName(s)
+				if name == "" {
+					return nil, fmt.Errorf("ожидалось имя после '..' в transform")
+				}
+				s = rest
+				if name == "*" {
+					p.steps = append(p.steps, pathStep{kind: stepWildcard})
+				} else {
+					p.steps = append(p.steps, pathStep{kind: stepField, name: name})
+				}
+			}
+		case s[0] == '.':
+			name, rest := readPathName(s[1:])
+			if name == "" {
+				return nil, fmt.Errorf("ожидалось имя поля после '.' в transform")
+			}
+			s = rest
+			if name == "*" {
+				p.definite = false
+				p.steps = append(p.steps, pathStep{kind: stepWildcard})
+			} else {
+				p.steps = append(p.steps, pathStep{kind: stepField, name: name})
+			}
+		case s[0] == '[':
+			end := matchingBracket(s)
+			if end < 0 {
+				return nil, fmt.Errorf("не закрыта скобка '[' в transform")
+			}
+			step, err := parseBracket(s[1:end])
+			if err != nil {
+				return nil, err
+			}
+			if step.kind != stepField && step.kind != stepIndex {
+				p.definite = false
+			}
+			p.steps = append(p.steps, step)
+			s = s[end+1:]
+		default:
+			return nil, fmt.Errorf("неожиданный символ %q в transform", s[0])
+		}
+	}
+	return p, nil
+}
+
+func readPathName(s string) (string, string) {
+	i := 0
+	for i < len(s) && s[i] != '.' && s[i] != '[' {
+		i++
+	}
+	return s[:i], s[i:]
+}
+
+// matchingBracket находит закрывающую ']' с учётом кавычек и вложенных скобок.
+func matchingBracket(s string) int {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func unquote(s string) (string, bool) {
+	if len(s) >= 2 && (s[0] == '\'' || s[0] == '"') && s[len(s)-1] == s[0] {
+		return strings.ReplaceAll(s[1:len(s)-1], `\`+string(s[0]), string(s[0])), true
+	}
+	return "", false
+}
+
+func parseBracket(inner string) (pathStep, error) {
+	inner = strings.TrimSpace(inner)
+	if inner == "*" {
+		return pathStep{kind: stepWildcard}, nil
+	}
+	if name, ok := unquote(inner); ok {
+		return pathStep{kind: stepField, name: name}, nil
+	}
+	if strings.HasPrefix(inner, "?(") && strings.HasSuffix(inner, ")") {
+		f, err := parseFilter(inner[2 : len(inner)-1])
+		if err != nil {
+			return pathStep{}, err
+		}
+		return pathStep{kind: stepFilter, filter: f}, nil
+	}
+	if before, after, ok := strings.Cut(inner, ":"); ok {
+		step := pathStep{kind: stepSlice}
+		if before = strings.TrimSpace(before); before != "" {
+			v, err := strconv.Atoi(before)
+			if err != nil {
+				return pathStep{}, fmt.Errorf("некорректный срез [%s] в transform", inner)
+			}
+			step.start = &v
+		}
+		if after = strings.TrimSpace(after); after != "" {
+			v, err := strconv.Atoi(after)
+			if err != nil {
+				return pathStep{}, fmt.Errorf("некорректный срез [%s] в transform", inner)
+			}
+			step.end = &v
+		}
+		return step, nil
+	}
+	v, err := strconv.Atoi(inner)
+	if err != nil {
+		return pathStep{}, fmt.Errorf("некорректный индекс [%s] в transform", inner)
+	}
+	return pathStep{kind: stepIndex, index: v}, nil
+}
+
+var filterOps = []string{"==", "!=", "<=", ">=", "=~", "<", ">"}
+
+func parseFilter(expr string) (*pathFilter, error) {
+	expr = strings.TrimSpace(expr)
+	f := &pathFilter{}
+	left := expr
+	// Оператор ищем слева направо: правая часть может содержать те же символы.
+	opPos := -1
+	for i := 0; i < len(expr) && opPos < 0; i++ {
+		for _, op := range filterOps {
+			if strings.HasPrefix(expr[i:], op) {
+				f.op, opPos = op, i
+				break
+			}
+		}
+	}
+	if opPos >= 0 {
+		left = strings.TrimSpace(expr[:opPos])
+		right := strings.TrimSpace(expr[opPos+len(f.op):])
+		switch {
+		case f.op == "=~":
+			pattern := right
+			if len(pattern) >= 2 && pattern[0] == '/' && pattern[len(pattern)-1] == '/' {
+				pattern = pattern[1 : len(pattern)-1]
+			} else if q, ok := unquote(pattern); ok {
+				pattern = q
+			}
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("некорректное регулярное выражение в фильтре transform: %v", err)
+			}
+			f.re = re
+		case right == "true" || right == "false":
+			f.value = right == "true"
+		case right == "null":
+			f.value = nil
+		default:
+			if q, ok := unquote(right); ok {
+				f.value = q
+			} else if n, err := strconv.ParseFloat(right, 64); err == nil {
+				f.value = n
+			} else {
+				return nil, fmt.Errorf("некорректное значение %q в фильтре transform", right)
+			}
+		}
+	}
+	if left != "@" && !strings.HasPrefix(left, "@.") {
+		return nil, fmt.Errorf("фильтр transform должен ссылаться на @")
+	}
+	if left != "@" {
+		f.path = strings.Split(left[2:], ".")
+	}
+	return f, nil
+}
+
+func (f *pathFilter) match(v any) bool {
+	for _, name := range f.path {
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return false
+		}
+		if v, ok = obj[name]; !ok {
+			return false
+		}
+	}
+	switch f.op {
+	case "":
+		return v != nil && v != false && v != ""
+	case "=~":
+		s, ok := v.(string)
+		return ok && f.re.MatchString(s)
+	case "==":
+		return v == f.value
+	case "!=":
+		return v != f.value
+	}
+	switch a := v.(type) {
+	case float64:
+		b, ok := f.value.(float64)
+		if !ok {
+			return false
+		}
+		switch f.op {
+		case "<":
+			return a < b
+		case "<=":
+			return a <= b
+		case ">":
+			return a > b
+		case ">=":
+			return a >= b
+		}
+	case string:
+		b, ok := f.value.(string)
+		if !ok {
+			return false
+		}
+		switch f.op {
+		case "<":
+			return a < b
+		case "<=":
+			return a <= b
+		case ">":
+			return a > b
+		case ">=":
+			return a >= b
+		}
+	}
+	return false
+}
+
+// Apply применяет выражение к документу в обобщённом JSON-виде.
+func (p *jsonPath) Apply(doc any) any {
+	current := []any{doc}
+	for _, step := range p.steps {
+		var next []any
+		for _, v := range current {
+			next = append(next, applyStep(step, v)...)
+		}
+		current = next
+	}
+	if p.definite {
+		if len(current) == 0 {
+			return nil
+		}
+		return current[0]
+	}
+	if current == nil {
+		return []any{}
+	}
+	return current
+}
+
+func applyStep(step pathStep, v any) []any {
+	switch step.kind {
+	case stepField:
+		if obj, ok := v.(map[string]any); ok {
+			if val, ok := obj[step.name]; ok {
+				return []any{val}
+			}
+		}
+	case stepIndex:
+		if arr, ok := v.([]any); ok {
+			i := step.index
+			if i < 0 {
+				i += len(arr)
+			}
+			if i >= 0 && i < len(arr) {
+				return []any{arr[i]}
+			}
+		}
+	case stepSlice:
+		if arr, ok := v.([]any); ok {
+			start, end := 0, len(arr)
+			if step.start != nil {
+				start = *step.start
+				if start < 0 {
+					start += len(arr)
+				}
+			}
+			if step.end != nil {
+				end = *step.end
+				if end < 0 {
+					end += len(arr)
+				}
+			}
+			start, end = max(start, 0), min(end, len(arr))
+			if start < end {
+				return append([]any(nil), arr[start:end]...)
+			}
+		}
+	case stepWildcard:
+		return children(v)
+	case stepRecursive:
+		// Сам узел и все его потомки; следующий шаг применится к каждому.
+		out := []any{v}
+		for _, c := range children(v) {
+			out = append(out, applyStep(step, c)...)
+		}
+		return out
+	case stepFilter:
+		var out []any
+		for _, c := range children(v) {
+			if step.filter.match(c) {
+				out = append(out, c)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+func children(v any) []any {
+	switch val := v.(type) {
+	case []any:
+		return val
+	case map[string]any:
+		// Ключи сортируем, чтобы результат * и .. не зависел от порядка обхода map.
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		out := make([]any, 0, len(val))
+		for _, k := range keys {
+			out = append(out, val[k])
+		}
+		return out
+	}
+	return nil
+}
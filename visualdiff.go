@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// DiffRegion — прямоугольная область с изменениями, в пикселях.
+type DiffRegion struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// VisualDiffResponse — ответ /visual-diff.
+type VisualDiffResponse struct {
+	URL           string       `json:"url"`
+	From          string       `json:"from"`
+	To            string       `json:"to"`
+	Width         int          `json:"width"`
+	Height        int          `json:"height"`
+	ChangedPixels int          `json:"changed_pixels"`
+	ChangePercent float64      `json:"change_percent"`
+	Regions       []DiffRegion `json:"regions"`
+	DiffImage     string       `json:"diff_image"` // PNG в base64: изменения красным поверх приглушённого нового снимка
+}
+
+// diffCellSize — размер ячейки сетки, по которой изменённые пиксели
+// объединяются в области. Мелкие ячейки дробят регион на сотни кусков.
+const diffCellSize = 16
+
+// visualDiff сравнивает два снимка попиксельно. Пиксели, отличающиеся по
+// любому каналу больше чем на tolerance (0–255), считаются изменёнными;
+// области за пределами меньшего снимка — тоже.
+func visualDiff(before, after image.Image, tolerance int) (*VisualDiffResponse, *image.RGBA) {
+	ab, bb := before.Bounds(), after.Bounds()
+	width, height := max(ab.Dx(), bb.Dx()), max(ab.Dy(), bb.Dy())
+	out := image.NewRGBA(image.Rect(0, 0, width, height))
+	cols, rows := (width+diffCellSize-1)/diffCellSize, (height+diffCellSize-1)/diffCellSize
+	cells := make([]bool, cols*rows)
+
+	changed := 0
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			inA := x < ab.Dx() && y < ab.Dy()
+			inB := x < bb.Dx() && y < bb.Dy()
+			var bgGray uint8 = 255
+			diff := !inA || !inB
+			if inB {
+				r2, g2, b2, _ := after.At(bb.Min.X+x, bb.Min.Y+y).RGBA()
+				// Приглушённая серая подложка нового снимка, чтобы красное было заметно.
+				bgGray = uint8(200 + (((r2+g2+b2)/3)>>8)*55/255)
+				if inA {
+					r1, g1, b1, _ := before.At(ab.Min.X+x, ab.Min.Y+y).RGBA()
+					diff = channelDiff(r1, r2) > tolerance || channelDiff(g1, g2) > tolerance || channelDiff(b1, b2) > tolerance
+				}
+			}
+			if diff {
+				changed++
+				cells[(y/diffCellSize)*cols+x/diffCellSize] = true
+				out.SetRGBA(x, y, color.RGBA{R: 255, A: 255})
+			} else {
+				out.SetRGBA(x, y, color.RGBA{R: bgGray, G: bgGray, B: bgGray, A: 255})
+			}
+		}
+	}
+
+	result := &VisualDiffResponse{
+		Width:         width,
+		Height:        height,
+		ChangedPixels: changed,
+		Regions:       diffRegions(cells, cols, rows, width, height),
+	}
+	if total := width * height; total > 0 {
+		result.ChangePercent = float64(changed) * 100 / float64(total)
+	}
+	return result, out
+}
+
+func channelDiff(a, b uint32) int {
+	d := int(a>>8) - int(b>>8)
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+// diffRegions объединяет соседние изменённые ячейки сетки в связные
+// компоненты и возвращает их ограничивающие прямоугольники.
+func diffRegions(cells []bool, cols, rows, width, height int) []DiffRegion {
+	regions := []DiffRegion{}
+	visited := make([]bool, len(cells))
+	for start := range cells {
+		if !cells[start] || visited[start] {
+			continue
+		}
+		minC, minR, maxC, maxR := cols, rows, 0, 0
+		stack := []int{start}
+		visited[start] = true
+		for len(stack) > 0 {
+			i := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			c, r := i%cols, i/cols
+			minC, minR, maxC, maxR = min(minC, c), min(minR, r), max(maxC, c), max(maxR, r)
+			for _, n := range [][2]int{{c - 1, r}, {c + 1, r}, {c, r - 1}, {c, r + 1}} {
+				if n[0] < 0 || n[1] < 0 || n[0] >= cols || n[1] >= rows {
+					continue
+				}
+				j := n[1]*cols + n[0]
+				if cells[j] && !visited[j] {
+					visited[j] = true
+					stack = append(stack, j)
+				}
+			}
+		}
+		x, y := minC*diffCellSize, minR*diffCellSize
+		regions = append(regions, DiffRegion{
+			X:      x,
+			Y:      y,
+			Width:  min((maxC+1)*diffCellSize, width) - x,
+			Height: min((maxR+1)*diffCellSize, height) - y,
+		})
+	}
+	return regions
+}
+
+// loadStoredScreenshot читает и декодирует снимок версии из хранилища.
+func loadStoredScreenshot(url, id string) (image.Image, error) {
+	data, err := resultStore.Screenshot(url, id)
+	if err != nil {
+		return nil, err
+	}
+	return png.Decode(bytes.NewReader(data))
+}
+
+// visualDiffHandler: GET /visual-diff?url=&from=&to=&tolerance=&format=json|png.
+// Без from/to сравниваются два последних снимка url.
+func visualDiffHandler(w http.ResponseWriter, r *http.Request) {
+	if resultStore == nil {
+		writeJsonError(w, "Хранилище результатов выключено (задайте STORAGE_DIR)", http.StatusNotFound)
+		return
+	}
+	url := r.URL.Query().Get("url")
+	if url == "" {
+		writeJsonError(w, "Параметр 'url' обязателен", http.StatusBadRequest)
+		return
+	}
+	tolerance := 16
+	if raw := r.URL.Query().Get("tolerance"); raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil || v < 0 || v > 255 {
+			writeJsonError(w, "Параметр 'tolerance' должен быть числом от 0 до 255", http.StatusBadRequest)
+			return
+		}
+		tolerance = v
+	}
+
+	from, to := r.URL.Query().Get("from"), r.URL.Query().Get("to")
+	if from == "" || to == "" {
+		versions, err := resultStore.Versions(url)
+		if err != nil {
+			writeJsonError(w, "Не удалось прочитать историю: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		var withShots []string
+		for _, v := range versions {
+			if v.HasScreenshot {
+				withShots = append(withShots, v.ID)
+			}
+		}
+		if len(withShots) < 2 {
+			writeJsonError(w, "Для сравнения нужны минимум два снимка (скрапьте url с параметром visual)", http.StatusNotFound)
+			return
+		}
+		if from == "" {
+			from = withShots[len(withShots)-2]
+		}
+		if to == "" {
+			to = withShots[len(withShots)-1]
+		}
+	}
+
+	before, err := loadStoredScreenshot(url, from)
+	var after image.Image
+	if err == nil {
+		after, err = loadStoredScreenshot(url, to)
+	}
+	if errors.Is(err, errVersionNotFound) {
+		writeJsonError(w, "Снимок для указанной версии не найден", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeJsonError(w, "Не удалось прочитать снимок: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	result, diffImg := visualDiff(before, after, tolerance)
+	result.URL, result.From, result.To = url, from, to
+	log.Printf("ЛОГ: Визуальное сравнение %s: %s → %s, изменено %.2f%%.", url, from, to, result.ChangePercent)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, diffImg); err != nil {
+		writeJsonError(w, "Не удалось закодировать изображение: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if r.URL.Query().Get("format") == "png" {
+		w.Header().Set("Content-Type", "image/png")
+		w.Header().Set("X-Change-Percent", strconv.FormatFloat(result.ChangePercent, 'f', 4, 64))
+		w.Write(buf.Bytes())
+		return
+	}
+	result.DiffImage = base64.StdEncoding.EncodeToString(buf.Bytes())
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/chromedp"
+)
+
+const (
+	defaultWaitTimeout = 10 * time.Second
+	maxWaitTimeout     = 60 * time.Second
+
+	defaultNetworkIdle = 500 * time.Millisecond
+	maxNetworkIdle     = 10 * time.Second
+	// idleMaxInflight — сколько незавершённых запросов допускается в
+	// «тишине»: long polling и счётчики аналитики могут не закончиться никогда.
+	idleMaxInflight = 2
+)
+
+var validWaitStrategies = map[string]bool{"networkidle": true}
+
+// waitForSelector ждёт видимости элемента: SPA отдают body сразу, а
+// содержимое дорисовывают позже.
+func waitForSelector(selector string, timeout time.Duration) chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		slog.InfoContext(ctx, "Шаг [0.5]: жду появления элемента", "selector", selector, "timeout", timeout.String())
+		waitCtx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		err := chromedp.WaitVisible(selector, chromedp.ByQuery).Do(waitCtx)
+		if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+			return fmt.Errorf("элемент '%s' не появился за %v", selector, timeout)
+		}
+		return err
+	})
+}
+
+// networkTracker считает запросы вкладки. Подписка оформляется до
+// навигации, иначе запросы загрузки документа будут пропущены.
+type networkTracker struct {
+	mu       sync.Mutex
+	inflight map[network.RequestID]bool
+	last     time.Time
+}
+
+func trackNetwork(ctx context.Context) *networkTracker {
+	t := &networkTracker{inflight: map[network.RequestID]bool{}, last: time.Now()}
+	chromedp.ListenTarget(ctx, func(ev any) {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		switch ev := ev.(type) {
+		case *network.EventRequestWillBeSent:
+			t.inflight[ev.RequestID] = true
+		case *network.EventLoadingFinished:
+			delete(t.inflight, ev.RequestID)
+		case *network.EventLoadingFailed:
+			delete(t.inflight, ev.RequestID)
+		default:
+			return
+		}
+		t.last = time.Now()
+	})
+	return t
+}
+
+// idleFor — сколько длится тишина в сети (0, если запросов слишком много).
+func (t *networkTracker) idleFor() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.inflight) > idleMaxInflight {
+		return 0
+	}
+	return time.Since(t.last)
+}
+
+// waitNetworkIdle ждёт, пока в сети не будет новых запросов и ответов в
+// течение idle. По истечении timeout сбор продолжается с тем, что есть.
+func waitNetworkIdle(t *networkTracker, idle, timeout time.Duration) chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		slog.InfoContext(ctx, "Шаг [0.6]: жду тишины в сети", "idle", idle.String(), "timeout", timeout.String())
+		deadline := time.Now().Add(timeout)
+		for t.idleFor() < idle {
+			if time.Now().After(deadline) {
+				slog.InfoContext(ctx, "Шаг [0.6]: сеть не успокоилась, продолжаю с тем, что загружено")
+				return nil
+			}
+			if err := chromedp.Sleep(50 * time.Millisecond).Do(ctx); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}